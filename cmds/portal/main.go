@@ -24,6 +24,7 @@ import (
 	"cloudiac/portal/web"
 	"cloudiac/utils/kafka"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/tracing"
 )
 
 type Option struct {
@@ -48,6 +49,8 @@ func main() {
 	configs.Init(opt.Config)
 	conf := configs.Get().Log
 	logs.Init(conf.LogLevel, conf.LogPath, conf.LogMaxDays)
+	tracing.Init(iac_common.IacPortalServiceName, configs.Get().Tracing)
+	defer tracing.Shutdown()
 
 	logs.Get().Debugf("%+v", configs.Get().Demo)
 
@@ -20,6 +20,8 @@ import (
 	iac_common "cloudiac/common"
 	"cloudiac/configs"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
+	"cloudiac/utils/tracing"
 )
 
 type Option struct {
@@ -50,6 +52,8 @@ func main() {
 
 	logConf := configs.Get().Log
 	logs.Init(logConf.LogLevel, logConf.LogPath, logConf.LogMaxDays)
+	tracing.Init(iac_common.RunnerServiceName, configs.Get().Tracing)
+	defer tracing.Shutdown()
 
 	runnerConfJson, _ := json.Marshal(configs.Get().Runner)
 	logs.Get().Infof("runner configs: %s", runnerConfJson)
@@ -118,6 +122,17 @@ func StartServer() {
 		logs.MustGetLogWriter("error"),
 	)))
 
+	metrics.MustRegisterRunner()
+	if conf.Runner.MetricsListen != "" {
+		go func() {
+			logger.Infof("starting metrics server on %v", conf.Runner.MetricsListen)
+			if err := metrics.ListenAndServe(conf.Runner.MetricsListen); err != nil {
+				logger.Fatalln(err)
+			}
+		}()
+	}
+	e.Use(tracing.GinMiddleware(iac_common.RunnerServiceName))
+
 	v1.RegisterRoute(e.Group("/api/v1"))
 	logger.Infof("starting runner on %v", conf.Listen)
 	if err := e.Run(conf.Listen); err != nil {
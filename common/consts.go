@@ -18,6 +18,8 @@ const (
 	TaskTypeEnvParse = "envParse" // 环境策略扫描，只执行策略扫描，不修改资源或配置
 	TaskTypeTplScan  = "tplScan"  // 云模板策略扫描，只执行策略扫描，不修改资源或配置
 	TaskTypeTplParse = "tplParse" // 云模板策略扫描，只执行策略扫描，不修改资源或配置
+	TaskTypeImport   = "import"   // 导入已存在的云资源到环境的 state 中
+	TaskTypeStateOp  = "stateOp"  // state 操作，如 state mv、state rm、taint 等
 
 	// TODO 与 taskTypexxx 重复，需要替换
 	TaskJobPlan     = "plan"
@@ -29,6 +31,8 @@ const (
 	TaskJobEnvParse = "envParse"
 	TaskJobTplScan  = "tplScan"
 	TaskJobTplParse = "tplParse"
+	TaskJobImport   = "import"
+	TaskJobStateOp  = "stateOp"
 
 	TaskPending   = "pending"
 	TaskRunning   = "running"
@@ -43,6 +47,8 @@ const (
 	TaskStepTfPlan    = "terraformPlan"
 	TaskStepTfApply   = "terraformApply"
 	TaskStepTfDestroy = "terraformDestroy"
+	TaskStepTfImport  = "terraformImport"
+	TaskStepTfStateOp = "terraformStateOp"
 
 	// 0.3 扫描步骤名称
 	TaskStepOpaScan = "opaScan" // 云模板策略扫描
@@ -82,6 +88,19 @@ const (
 	TaskTypeEnvParseName = "envParse"
 	TaskTypeTplScanName  = "tplScan"
 	TaskTypeTplParseName = "tplParse"
+	TaskTypeImportName   = "import"
+	TaskTypeStateOpName  = "stateOp"
+
+	// 资源导入方式
+	TaskImportModeCli   = "cli"   // 逐个执行 terraform import 命令
+	TaskImportModeBlock = "block" // 生成 import 块，通过 plan -generate-config-out 生成资源配置后 apply
+
+	// state 操作类型
+	StateOpMv          = "mv"          // terraform state mv
+	StateOpRm          = "rm"          // terraform state rm
+	StateOpTaint       = "taint"       // terraform taint
+	StateOpUntaint     = "untaint"     // terraform untaint
+	StateOpForceUnlock = "forceUnlock" // terraform force-unlock
 
 	ProjectStatusEnable  = "enable"
 	ProjectStatusDisable = "disable"
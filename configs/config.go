@@ -52,12 +52,16 @@ type RunnerConfig struct {
 	OfflineMode       bool   `yaml:"offline_mode"`       // 离线模式?
 	ReserveContainer  bool   `yaml:"reserver_container"` // 任务结束后保留容器?(停止容器但不删除)
 	ProviderCachePath string `yaml:"provider_cache_path"`
+	MetricsListen     string `yaml:"metrics_listen"` // prometheus 指标接口的监听地址，为空则不提供指标接口
 }
 
 type PortalConfig struct {
 	Address       string `yaml:"address"` // portal 对外提供服务的 url
 	SSHPrivateKey string `yaml:"ssh_private_key"`
 	SSHPublicKey  string `yaml:"ssh_public_key"`
+
+	ProviderMirrorPath string `yaml:"provider_mirror_path"` // provider mirror 安装包的保存目录
+	MetricsListen      string `yaml:"metrics_listen"`       // prometheus 指标接口的监听地址，为空则不提供指标接口
 }
 
 type LdapConfig struct {
@@ -159,6 +163,12 @@ type PolicyConfig struct {
 	Enabled bool `yaml:"enabled"`
 }
 
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`     // OTLP/HTTP collector 地址，如 http://otel-collector:4318，为空则不启用链路追踪
+	SampleRatio float64           `yaml:"sample_ratio"` // 采样比例(0~1]，不配置则全部采样
+	Headers     map[string]string `yaml:"headers"`      // 上报数据时附加的请求头(如认证信息)
+}
+
 type Config struct {
 	Mysql              string           `yaml:"mysql"`
 	Listen             string           `yaml:"listen"`
@@ -176,6 +186,7 @@ type Config struct {
 	Policy             PolicyConfig     `yaml:"policy"`
 	Ldap               LdapConfig       `yaml:"ldap"`
 	CostServe          string           `yaml:"cost_serve"`
+	Tracing            TracingConfig    `yaml:"tracing"`
 
 	EnableTaskAbort bool `yaml:"enableTaskAbort"` // 启用任务中止功能
 	EnableRegister  bool `yaml:"enableRegister"`  // 启用注册
@@ -199,6 +210,8 @@ var (
 		Portal: PortalConfig{
 			SSHPrivateKey: "var/private_key",
 			SSHPublicKey:  "var/private_key.pub",
+
+			ProviderMirrorPath: "var/provider-mirror",
 		},
 		Demo: DemoConfig{
 			OrgNameSuffix:  "的演示组织",
@@ -81,6 +81,12 @@ var Polices = []Policy{
 	{"member", "systems", "read"},
 	{"member", "system_config", "read"},
 
+	// provider mirror(平台级配置，仅平台管理员可以修改)
+	{"login", "provider_mirrors", "read"},
+	{"admin", "provider_mirrors", "read"},
+	{"member", "provider_mirrors", "read"},
+	{"complianceManager", "provider_mirrors", "read"},
+
 	// 合规策略
 	// 组织角色
 	{"admin", "policies", "*"},
@@ -137,7 +143,7 @@ var Polices = []Policy{
 	// 任务
 	{"manager", "tasks", "*"},
 	{"approver", "tasks", "*"},
-	{"operator", "tasks", "read/abort"},
+	{"operator", "tasks", "read/abort/rerun"},
 	{"guest", "tasks", "read"},
 
 	// 云模板
@@ -178,6 +184,54 @@ var Polices = []Policy{
 	{"member", "notifications", "read"},
 	{"complianceManager", "notifications", "read"},
 
+	// 部署冻结
+	{"admin", "deploy_freezes", "*"},
+	{"member", "deploy_freezes", "read"},
+	{"complianceManager", "deploy_freezes", "read"},
+
+	{"manager", "deploy_freezes", "*"},
+	{"approver", "deploy_freezes", "read"},
+	{"operator", "deploy_freezes", "read"},
+	{"guest", "deploy_freezes", "read"},
+
+	// 漂移忽略规则
+	{"admin", "drift_ignore_rules", "*"},
+	{"member", "drift_ignore_rules", "read"},
+	{"complianceManager", "drift_ignore_rules", "read"},
+
+	{"manager", "drift_ignore_rules", "*"},
+	{"approver", "drift_ignore_rules", "read"},
+	{"operator", "drift_ignore_rules", "read"},
+	{"guest", "drift_ignore_rules", "read"},
+
+	// 审批策略
+	{"manager", "approval_policies", "*"},
+	{"approver", "approval_policies", "read"},
+	{"operator", "approval_policies", "read"},
+	{"guest", "approval_policies", "read"},
+
+	// 费用预算
+	{"manager", "budgets", "*"},
+	{"approver", "budgets", "read"},
+	{"operator", "budgets", "read"},
+	{"guest", "budgets", "read"},
+
+	// 环境批量操作
+	{"manager", "env_batches", "*"},
+	{"approver", "env_batches", "*"},
+	{"operator", "env_batches", "read"},
+	{"guest", "env_batches", "read"},
+
+	// 环境标签规范
+	{"admin", "env_tag_schemas", "*"},
+	{"member", "env_tag_schemas", "read"},
+	{"complianceManager", "env_tag_schemas", "read"},
+
+	{"manager", "env_tag_schemas", "read"},
+	{"approver", "env_tag_schemas", "read"},
+	{"operator", "env_tag_schemas", "read"},
+	{"guest", "env_tag_schemas", "read"},
+
 	//vcs
 	{"admin", "vcs", "*"},
 	{"member", "vcs", "read"},
@@ -217,6 +271,16 @@ var Polices = []Policy{
 	{"operator", "registry", "read"},
 	{"guest", "registry", "read"},
 
+	// 私有模块 registry
+	{"admin", "registry_modules", "*"},
+	{"member", "registry_modules", "read"},
+	{"complianceManager", "registry_modules", "read"},
+
+	{"manager", "registry_modules", "*"},
+	{"approver", "registry_modules", "read"},
+	{"operator", "registry_modules", "read"},
+	{"guest", "registry_modules", "read"},
+
 	// 注意：以下为旧版本演示模式用户权限配置，新版本中每个用户都有自己的演示组织，以下权限配置不再生效。
 	// 演示模式，当访问演示组织下的资源，进入受限模式
 	{"demo", "orgs", "read"},
@@ -225,6 +289,12 @@ var Polices = []Policy{
 	{"demo", "projects", "read"},
 	{"demo", "tokens", "read"},
 	{"demo", "notifications", "read"},
+	{"demo", "deploy_freezes", "read"},
+	{"demo", "drift_ignore_rules", "read"},
+	{"demo", "approval_policies", "read"},
+	{"demo", "budgets", "read"},
+	{"demo", "env_batches", "read"},
+	{"demo", "env_tag_schemas", "read"},
 	{"demo", "vcs", "read"},
 	{"demo", "runners", "read"},
 	{"demo", "keys", "read"},
@@ -234,4 +304,5 @@ var Polices = []Policy{
 	{"demo", "variables", "*"},
 	{"demo", "policies", "read"},
 	{"demo", "registry", "read"},
+	{"demo", "registry_modules", "read"},
 }
@@ -0,0 +1,110 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+func SearchApprovalPolicy(c *ctx.ServiceContext, form *forms.SearchApprovalPolicyForm) (interface{}, e.Error) {
+	query := services.QueryApprovalPolicy(c.DB(), c.OrgId, c.ProjectId, form.EnvId)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	policies := make([]*models.ApprovalPolicy, 0)
+	if err := p.Scan(&policies); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     policies,
+	}, nil
+}
+
+func CreateApprovalPolicy(c *ctx.ServiceContext, form *forms.CreateApprovalPolicyForm) (*models.ApprovalPolicy, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create approval policy %s", form.Name))
+
+	if form.EnvId != "" {
+		query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+		if _, err := services.GetEnvById(query, form.EnvId); err != nil {
+			return nil, e.AutoNew(err, e.EnvNotExists, http.StatusBadRequest)
+		}
+	}
+
+	return services.CreateApprovalPolicy(c.DB(), models.ApprovalPolicy{
+		OrgId:             c.OrgId,
+		ProjectId:         c.ProjectId,
+		EnvId:             form.EnvId,
+		Name:              form.Name,
+		RequiredApprovals: form.RequiredApprovals,
+		Approvers:         form.Approvers,
+		ApproverRoles:     form.ApproverRoles,
+		AllowSelfApproval: form.AllowSelfApproval,
+		Timeout:           form.Timeout,
+		Enabled:           true,
+		CreatorId:         c.UserId,
+	})
+}
+
+func UpdateApprovalPolicy(c *ctx.ServiceContext, form *forms.UpdateApprovalPolicyForm) (policy *models.ApprovalPolicy, er e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update approval policy %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetApprovalPolicyById(query, form.Id); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("requiredApprovals") {
+		attrs["requiredApprovals"] = form.RequiredApprovals
+	}
+	if form.HasKey("approvers") {
+		attrs["approvers"] = models.StrSlice(form.Approvers)
+	}
+	if form.HasKey("approverRoles") {
+		attrs["approverRoles"] = models.StrSlice(form.ApproverRoles)
+	}
+	if form.HasKey("allowSelfApproval") {
+		attrs["allowSelfApproval"] = form.AllowSelfApproval
+	}
+	if form.HasKey("timeout") {
+		attrs["timeout"] = form.Timeout
+	}
+	if form.HasKey("enabled") {
+		attrs["enabled"] = form.Enabled
+	}
+
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		policy, er = services.UpdateApprovalPolicy(tx, form.Id, attrs)
+		return er
+	})
+	return policy, er
+}
+
+func DeleteApprovalPolicy(c *ctx.ServiceContext, form *forms.DeleteApprovalPolicyForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete approval policy %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetApprovalPolicyById(query, form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteApprovalPolicy(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func ApprovalPolicyDetail(c *ctx.ServiceContext, form *forms.DetailApprovalPolicyForm) (*models.ApprovalPolicy, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	return services.GetApprovalPolicyById(query, form.Id)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+func SearchBudget(c *ctx.ServiceContext, form *forms.SearchBudgetForm) (interface{}, e.Error) {
+	query := services.QueryBudget(c.DB(), c.OrgId, c.ProjectId, form.EnvId)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	budgets := make([]*models.Budget, 0)
+	if err := p.Scan(&budgets); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     budgets,
+	}, nil
+}
+
+func CreateBudget(c *ctx.ServiceContext, form *forms.CreateBudgetForm) (*models.Budget, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create budget %.2f", form.Amount))
+
+	if form.EnvId != "" {
+		query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+		if _, err := services.GetEnvById(query, form.EnvId); err != nil {
+			return nil, e.AutoNew(err, e.EnvNotExists, http.StatusBadRequest)
+		}
+	}
+
+	policy := form.Policy
+	if policy == "" {
+		policy = models.BudgetPolicyApproval
+	}
+	return services.CreateBudget(c.DB(), models.Budget{
+		OrgId:     c.OrgId,
+		ProjectId: c.ProjectId,
+		EnvId:     form.EnvId,
+		Amount:    form.Amount,
+		Policy:    policy,
+		Enabled:   true,
+		CreatorId: c.UserId,
+	})
+}
+
+func UpdateBudget(c *ctx.ServiceContext, form *forms.UpdateBudgetForm) (budget *models.Budget, er e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update budget %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetBudgetById(query, form.Id); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("amount") {
+		attrs["amount"] = form.Amount
+	}
+	if form.HasKey("policy") {
+		attrs["policy"] = form.Policy
+	}
+	if form.HasKey("enabled") {
+		attrs["enabled"] = form.Enabled
+	}
+
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		budget, er = services.UpdateBudget(tx, form.Id, attrs)
+		return er
+	})
+	return budget, er
+}
+
+func DeleteBudget(c *ctx.ServiceContext, form *forms.DeleteBudgetForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete budget %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetBudgetById(query, form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteBudget(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func BudgetDetail(c *ctx.ServiceContext, form *forms.DetailBudgetForm) (*models.Budget, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	return services.GetBudgetById(query, form.Id)
+}
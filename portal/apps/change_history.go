@@ -0,0 +1,79 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"net/http"
+)
+
+// EnvHistory 环境配置变更记录
+func EnvHistory(c *ctx.ServiceContext, form *forms.ObjectHistoryForm) (interface{}, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId, models.Env{}.TableName())
+	if _, err := services.GetEnvById(query, form.Id); err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return searchChangeHistory(c, consts.ScopeEnv, form)
+}
+
+// TemplateHistory 云模板配置变更记录
+func TemplateHistory(c *ctx.ServiceContext, form *forms.ObjectHistoryForm) (interface{}, e.Error) {
+	tpl, err := services.GetTemplateById(c.DB(), form.Id)
+	if err != nil {
+		if err.Code() == e.TemplateNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if tpl.OrgId != c.OrgId {
+		return nil, e.New(e.TemplateNotExists, http.StatusNotFound)
+	}
+	return searchChangeHistory(c, consts.ScopeTemplate, form)
+}
+
+func searchChangeHistory(c *ctx.ServiceContext, objectType string, form *forms.ObjectHistoryForm) (interface{}, e.Error) {
+	query := services.QueryChangeHistory(c.DB(), c.OrgId, objectType, form.Id, form.Field)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	histories := make([]*resps.ChangeHistoryResp, 0)
+	if err := p.Scan(&histories); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     histories,
+	}, nil
+}
+
+// updateVarGroupRelationship 更新对象关联的变量组，并记录关联关系的变更
+func updateVarGroupRelationship(c *ctx.ServiceContext, tx *db.Session,
+	vgIds, delVgIds []models.Id, objectType string, objectId models.Id) e.Error {
+	before, err := services.GetObjectVarGroupIds(tx, objectType, objectId)
+	if err != nil {
+		return err
+	}
+	if err := services.BatchUpdateRelationship(tx, vgIds, delVgIds, objectType, objectId.String()); err != nil {
+		return err
+	}
+	return recordVarGroupChanges(c, tx, before, objectType, objectId)
+}
+
+func recordVarGroupChanges(c *ctx.ServiceContext, tx *db.Session, before []models.Id, objectType string, objectId models.Id) e.Error {
+	after, err := services.GetObjectVarGroupIds(tx, objectType, objectId)
+	if err != nil {
+		return err
+	}
+	changes := services.DiffVarGroupIds(before, after)
+	return services.CreateChangeHistory(tx, c.OrgId, objectType, objectId, c.UserId, c.RequestId, changes)
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func SearchDeployFreeze(c *ctx.ServiceContext, form *forms.SearchDeployFreezeForm) (interface{}, e.Error) {
+	query := services.QueryDeployFreeze(c.DB(), c.OrgId, c.ProjectId, form.EnvId)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	freezes := make([]*models.DeployFreeze, 0)
+	if err := p.Scan(&freezes); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     freezes,
+	}, nil
+}
+
+func parseDeployFreezeTime(s string) (*models.Time, e.Error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := models.Time{}.Parse(s)
+	if err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+	return &t, nil
+}
+
+func CreateDeployFreeze(c *ctx.ServiceContext, form *forms.CreateDeployFreezeForm) (*models.DeployFreeze, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create deploy freeze %s", form.Name))
+
+	if form.EnvId != "" {
+		// 环境级规则需要在项目下创建
+		if c.ProjectId == "" {
+			return nil, e.New(e.BadRequest, fmt.Errorf("'IaC-Project-Id' is required"), http.StatusBadRequest)
+		}
+		query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+		if _, err := services.GetEnvById(query, form.EnvId); err != nil {
+			return nil, e.AutoNew(err, e.EnvNotExists, http.StatusBadRequest)
+		}
+	}
+
+	startAt, err := parseDeployFreezeTime(form.StartAt)
+	if err != nil {
+		return nil, err
+	}
+	endAt, err := parseDeployFreezeTime(form.EndAt)
+	if err != nil {
+		return nil, err
+	}
+
+	action := form.Action
+	if action == "" {
+		action = models.DeployFreezeActionBlock
+	}
+
+	return services.CreateDeployFreeze(c.DB(), models.DeployFreeze{
+		OrgId:       c.OrgId,
+		ProjectId:   c.ProjectId,
+		EnvId:       form.EnvId,
+		Name:        form.Name,
+		Description: form.Description,
+		Kind:        form.Kind,
+		Type:        form.Type,
+		Action:      action,
+		Enabled:     true,
+		Timezone:    form.Timezone,
+		Weekdays:    form.Weekdays,
+		StartTime:   form.StartTime,
+		EndTime:     form.EndTime,
+		StartAt:     startAt,
+		EndAt:       endAt,
+		CreatorId:   c.UserId,
+	})
+}
+
+func setUpdateDeployFreezeByForm(attrs models.Attrs, form *forms.UpdateDeployFreezeForm) e.Error {
+	strAttrs := map[string]string{
+		"name":        form.Name,
+		"description": form.Description,
+		"kind":        form.Kind,
+		"type":        form.Type,
+		"action":      form.Action,
+		"timezone":    form.Timezone,
+		"startTime":   form.StartTime,
+		"endTime":     form.EndTime,
+	}
+	for k, v := range strAttrs {
+		if form.HasKey(k) {
+			attrs[k] = v
+		}
+	}
+
+	if form.HasKey("enabled") {
+		attrs["enabled"] = form.Enabled
+	}
+	if form.HasKey("weekdays") {
+		attrs["weekdays"] = models.StrSlice(form.Weekdays)
+	}
+	if form.HasKey("startAt") {
+		t, err := parseDeployFreezeTime(form.StartAt)
+		if err != nil {
+			return err
+		}
+		attrs["start_at"] = t
+	}
+	if form.HasKey("endAt") {
+		t, err := parseDeployFreezeTime(form.EndAt)
+		if err != nil {
+			return err
+		}
+		attrs["end_at"] = t
+	}
+	return nil
+}
+
+func UpdateDeployFreeze(c *ctx.ServiceContext, form *forms.UpdateDeployFreezeForm) (freeze *models.DeployFreeze, er e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update deploy freeze %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetDeployFreezeById(query, form.Id); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if err := setUpdateDeployFreezeByForm(attrs, form); err != nil {
+		return nil, err
+	}
+
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		freeze, er = services.UpdateDeployFreeze(tx, form.Id, attrs)
+		return er
+	})
+	return freeze, er
+}
+
+func DeleteDeployFreeze(c *ctx.ServiceContext, form *forms.DeleteDeployFreezeForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete deploy freeze %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetDeployFreezeById(query, form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteDeployFreeze(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func DeployFreezeDetail(c *ctx.ServiceContext, form *forms.DetailDeployFreezeForm) (*models.DeployFreeze, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	return services.GetDeployFreezeById(query, form.Id)
+}
+
+// checkEnvDeployFreeze 检查环境是否处于部署冻结期。
+// 冻结期内只有组织管理员或项目管理者填写原因后才可以强制执行，返回值为 true 表示本次任务需要强制执行
+func checkEnvDeployFreeze(c *ctx.ServiceContext, tx *db.Session, env *models.Env, taskType, reason string) (bool, e.Error) {
+	if !(models.BaseTask{}).IsEffectTaskType(taskType) {
+		return false, nil
+	}
+
+	freeze, err := services.GetActiveDeployFreeze(tx, env.OrgId, env.ProjectId, env.Id, time.Now())
+	if err != nil || freeze == nil {
+		return false, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		if freeze.Action == models.DeployFreezeActionHold {
+			// 任务正常创建，冻结结束后再执行
+			return false, nil
+		}
+		return false, e.New(e.DeployFreezeActive, fmt.Errorf("deploy freeze '%s' is active", freeze.Name), http.StatusForbidden)
+	}
+	if err := services.CheckDeployFreezeOverridePerm(tx, env.OrgId, env.ProjectId, c.UserId); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordDeployFreezeOverride 记录冻结期内强制执行任务的操作日志
+func recordDeployFreezeOverride(c *ctx.ServiceContext, env *models.Env, task *models.Task) {
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "freezeOverride", env.Name,
+		models.ResAttrs{
+			"taskId":   task.Id,
+			"taskType": task.Type,
+			"reason":   task.FreezeOverrideReason,
+		})
+}
@@ -14,6 +14,7 @@ import (
 	"cloudiac/portal/models/resps"
 	"cloudiac/portal/services"
 	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"fmt"
 	"net/http"
@@ -67,15 +68,18 @@ func GetCronTaskTypeAndCheckParam(cronExpress string, autoRepairDrift, openCronD
 }
 
 type CronDriftParam struct {
-	CronDriftExpress  *string    `json:"cronDriftExpress"`  // 偏移检测表达式
-	AutoRepairDrift   *bool      `json:"autoRepairDrift"`   // 是否进行自动纠偏
-	OpenCronDrift     *bool      `json:"openCronDrift"`     // 是否开启偏移检测
-	NextDriftTaskTime *time.Time `json:"nextDriftTaskTime"` // 下次执行偏移检测任务的时间
+	CronDriftExpress   *string    `json:"cronDriftExpress"`   // 偏移检测表达式
+	AutoRepairDrift    *bool      `json:"autoRepairDrift"`    // 是否进行自动纠偏
+	OpenCronDrift      *bool      `json:"openCronDrift"`      // 是否开启偏移检测
+	DriftRepairMode    *string    `json:"driftRepairMode"`    // 纠偏方式
+	DriftRepairTimeout *int       `json:"driftRepairTimeout"` // 纠偏任务的审批超时时间(分钟)
+	NextDriftTaskTime  *time.Time `json:"nextDriftTaskTime"`  // 下次执行偏移检测任务的时间
 }
 
 func GetCronDriftParam(form forms.CronDriftForm) (*CronDriftParam, e.Error) {
 	cronDriftParam := &CronDriftParam{}
-	if form.HasKey("cronDriftExpress") || form.HasKey("autoRepairDrift") || form.HasKey("openCronDrift") {
+	if form.HasKey("cronDriftExpress") || form.HasKey("autoRepairDrift") || form.HasKey("openCronDrift") ||
+		form.HasKey("driftRepairMode") || form.HasKey("driftRepairTimeout") {
 		cronTaskType, err := GetCronTaskTypeAndCheckParam(form.CronDriftExpress, form.AutoRepairDrift, form.OpenCronDrift)
 		if err != nil {
 			return nil, err
@@ -86,6 +90,12 @@ func GetCronDriftParam(form forms.CronDriftForm) (*CronDriftParam, e.Error) {
 		if form.HasKey("openCronDrift") {
 			cronDriftParam.OpenCronDrift = &form.OpenCronDrift
 		}
+		if form.HasKey("driftRepairMode") {
+			cronDriftParam.DriftRepairMode = &form.DriftRepairMode
+		}
+		if form.HasKey("driftRepairTimeout") {
+			cronDriftParam.DriftRepairTimeout = &form.DriftRepairTimeout
+		}
 		if cronTaskType != "" {
 			// 如果任务类型不为空，说明配置了漂移检测任务
 			cronDriftParam.CronDriftExpress = &form.CronDriftExpress
@@ -110,13 +120,18 @@ func GetNextCronTime(cronExpress string) (*time.Time, e.Error) {
 	return ParseCronpress(cronExpress)
 }
 
+// needAutoApprovalForDrift 直接执行的自动纠偏需要开启自动审批，纠偏任务需要审批时不要求
+func needAutoApprovalForDrift(autoRepairDrift bool, repairMode string) bool {
+	return autoRepairDrift && repairMode != models.EnvDriftRepairModeApproval
+}
+
 func createEnvCheck(c *ctx.ServiceContext, form *forms.CreateEnvForm) e.Error {
 	if c.OrgId == "" || c.ProjectId == "" {
 		return e.New(e.BadRequest, http.StatusBadRequest)
 	}
 
 	// 检查自动纠漂移、推送到分支时重新部署时，是否了配置自动审批
-	if !services.CheckoutAutoApproval(form.AutoApproval, form.AutoRepairDrift, form.Triggers) {
+	if !services.CheckoutAutoApproval(form.AutoApproval, needAutoApprovalForDrift(form.AutoRepairDrift, form.DriftRepairMode), form.Triggers) {
 		return e.New(e.EnvCheckAutoApproval, http.StatusBadRequest)
 	}
 
@@ -124,9 +139,11 @@ func createEnvCheck(c *ctx.ServiceContext, form *forms.CreateEnvForm) e.Error {
 		return e.New(e.TemplateKeyIdNotSet)
 	}
 
-	if er := services.CheckEnvTags(form.Tags); er != nil {
+	tags, er := checkEnvTags(c, form.Tags)
+	if er != nil {
 		return er
 	}
+	form.Tags = tags
 
 	return nil
 }
@@ -382,6 +399,16 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		return nil, err
 	}
 
+	// 指定云模板版本时使用版本对应的分支/标签
+	if form.TplVersion != "" {
+		tplVersion, err := services.GetTemplateVersion(c.DB(), tpl.Id, form.TplVersion)
+		if err != nil {
+			return nil, err
+		}
+		form.TplVersion = tplVersion.Version
+		form.Revision = tplVersion.Revision
+	}
+
 	// 检查环境传入工作目录
 	if err = envWorkdirCheck(c, tpl.RepoId, form.Revision, form.Workdir, tpl.VcsId); err != nil {
 		return nil, err
@@ -426,6 +453,7 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		Revision:     form.Revision,
 		KeyId:        form.KeyId,
 		Workdir:      form.Workdir,
+		TplVersion:   form.TplVersion,
 
 		TTL:             form.TTL,
 		AutoDestroyAt:   &destroyAt,
@@ -444,6 +472,9 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		OpenCronDrift:    form.OpenCronDrift,
 		PolicyEnable:     form.PolicyEnable,
 
+		DriftRepairMode:    utils.FirstValueStr(form.DriftRepairMode, models.EnvDriftRepairModeAuto),
+		DriftRepairTimeout: form.DriftRepairTimeout,
+
 		AutoDeployAt:    &deployAt,
 		AutoDeployCron:  form.AutoDeployCron,
 		AutoDestroyCron: form.AutoDestroyCron,
@@ -467,6 +498,17 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		return nil, err
 	}
 
+	// 部署冻结检查
+	freezeOverride, err := checkEnvDeployFreeze(c, tx, env, form.TaskType, form.FreezeOverrideReason)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	overrideReason := ""
+	if freezeOverride {
+		overrideReason = strings.TrimSpace(form.FreezeOverrideReason)
+	}
+
 	// 来源：手动触发、外部调用
 	taskSource, taskSourceSys := getEnvSource(form.Source)
 
@@ -489,6 +531,8 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		Callback:  form.Callback,
 		Source:    taskSource,
 		SourceSys: taskSourceSys,
+
+		FreezeOverrideReason: overrideReason,
 	})
 
 	if err != nil {
@@ -496,6 +540,9 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		c.Logger().Errorf("error creating task, err %s", err)
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
+	if freezeOverride {
+		recordDeployFreezeOverride(c, env, task)
+	}
 
 	// 首次部署，直接更新 last_task_id
 	env.LastTaskId = task.Id
@@ -559,6 +606,9 @@ func SearchEnv(c *ctx.ServiceContext, form *forms.SearchEnvForm) (interface{}, e
 	// 环境更新时间过滤
 	query = services.FilterEnvUpdatedTime(query, form.StartTime, form.EndTime)
 
+	// 环境标签过滤
+	query = services.FilterEnvTags(query, models.ParseEnvTags(form.Tags))
+
 	if form.Q != "" {
 		qs := "%" + form.Q + "%"
 		query = query.Joins("left join iac_template on iac_env.tpl_id = iac_template.id")
@@ -653,7 +703,7 @@ func updateEnvCheck(orgId, projectId models.Id, form *forms.UpdateEnvForm) e.Err
 	}
 
 	// 检查自动纠漂移、推送到分支时重新部署时，是否了配置自动审批
-	if !services.CheckoutAutoApproval(form.AutoApproval, form.AutoRepairDrift, form.Triggers) {
+	if !services.CheckoutAutoApproval(form.AutoApproval, needAutoApprovalForDrift(form.AutoRepairDrift, form.DriftRepairMode), form.Triggers) {
 		return e.New(e.EnvCheckAutoApproval, http.StatusBadRequest)
 	}
 
@@ -768,6 +818,8 @@ func setAndCheckUpdateEnvDestroy(tx *db.Session, attrs models.Attrs, env *models
 	if !form.HasKey("destroyAt") && !form.HasKey("ttl") && !form.HasKey("autoDestroyCron") {
 		return nil
 	}
+	// 重新设置自动销毁后延期次数重新计算
+	attrs["extend_count"] = 0
 
 	if form.HasKey("destroyAt") {
 		destroyAt, err := models.Time{}.Parse(form.DestroyAt)
@@ -850,10 +902,10 @@ func setAndCheckUpdateEnvTriggers(c *ctx.ServiceContext, tx *db.Session, attrs m
 
 func setAndCheckUpdateEnvByForm(c *ctx.ServiceContext, tx *db.Session, attrs models.Attrs, env *models.Env, form *forms.UpdateEnvForm) e.Error { // nolint:cyclop
 	if form.HasKey("tags") {
-		if er := services.CheckEnvTags(form.Tags); er != nil {
+		if tags, er := checkEnvTags(c, form.Tags); er != nil {
 			return er
 		} else {
-			attrs["tags"] = strings.TrimSpace(form.Tags)
+			attrs["tags"] = tags
 		}
 	}
 
@@ -925,6 +977,7 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 		_ = tx.Rollback()
 		return nil, e.New(e.EnvLocked, http.StatusBadRequest)
 	}
+	envBefore := *env
 	if !env.Archived {
 		if form.Archived {
 			// 环境归档时自动重新命名
@@ -938,6 +991,9 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 		CronDriftExpress: form.CronDriftExpress,
 		AutoRepairDrift:  form.AutoRepairDrift,
 		OpenCronDrift:    form.OpenCronDrift,
+
+		DriftRepairMode:    form.DriftRepairMode,
+		DriftRepairTimeout: form.DriftRepairTimeout,
 	})
 
 	if err != nil {
@@ -960,6 +1016,12 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 	attrs["openCronDrift"] = cronDriftParam.OpenCronDrift
 	attrs["cronDriftExpress"] = cronDriftParam.CronDriftExpress
 	attrs["nextDriftTaskTime"] = cronDriftParam.NextDriftTaskTime
+	if cronDriftParam.DriftRepairMode != nil {
+		attrs["drift_repair_mode"] = utils.FirstValueStr(*cronDriftParam.DriftRepairMode, models.EnvDriftRepairModeAuto)
+	}
+	if cronDriftParam.DriftRepairTimeout != nil {
+		attrs["drift_repair_timeout"] = *cronDriftParam.DriftRepairTimeout
+	}
 
 	setUpdateEnvByForm(attrs, form)
 	err = setAndCheckUpdateEnvByForm(c, tx, attrs, env, form)
@@ -976,6 +1038,10 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 		c.Logger().Errorf("error update env, err %s", err)
 		return nil, err
 	}
+	if err := services.RecordEnvChanges(tx, &envBefore, env, c.UserId, c.RequestId); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
 
 	env.MergeTaskStatus()
 	detail := &models.EnvDetail{Env: *env}
@@ -1178,6 +1244,13 @@ func setEnvByForm(env *models.Env, form *forms.DeployEnvForm) {
 	if form.HasKey("playbook") {
 		env.Playbook = form.Playbook
 	}
+	if form.TplVersion != "" {
+		env.TplVersion = form.TplVersion
+		env.Revision = form.Revision
+	} else if form.HasKey("tplVersion") || form.Revision != env.Revision {
+		// 显式清空版本或切换分支/标签时解除版本锁定
+		env.TplVersion = ""
+	}
 	if form.HasKey("revision") {
 		env.Revision = form.Revision
 	}
@@ -1262,6 +1335,8 @@ func setAndCheckEnvAutoDestroy(tx *db.Session, env *models.Env, form *forms.Depl
 	if !form.HasKey("destroyAt") && !form.HasKey("ttl") && !form.HasKey("autoDestroyCron") {
 		return nil
 	}
+	// 重新设置自动销毁后延期次数重新计算
+	env.ExtendCount = 0
 
 	if form.HasKey("destroyAt") {
 		destroyAt, err := models.Time{}.Parse(form.DestroyAt)
@@ -1315,6 +1390,9 @@ func setAndCheckEnvDriftCron(env *models.Env, form *forms.DeployEnvForm) e.Error
 		CronDriftExpress: form.CronDriftExpress,
 		AutoRepairDrift:  form.AutoRepairDrift,
 		OpenCronDrift:    form.OpenCronDrift,
+
+		DriftRepairMode:    form.DriftRepairMode,
+		DriftRepairTimeout: form.DriftRepairTimeout,
 	})
 	if err != nil {
 		return err
@@ -1330,6 +1408,12 @@ func setAndCheckEnvDriftCron(env *models.Env, form *forms.DeployEnvForm) e.Error
 	if cronDriftParam.CronDriftExpress != nil {
 		env.CronDriftExpress = *cronDriftParam.CronDriftExpress
 	}
+	if cronDriftParam.DriftRepairMode != nil {
+		env.DriftRepairMode = utils.FirstValueStr(*cronDriftParam.DriftRepairMode, models.EnvDriftRepairModeAuto)
+	}
+	if cronDriftParam.DriftRepairTimeout != nil {
+		env.DriftRepairTimeout = *cronDriftParam.DriftRepairTimeout
+	}
 
 	return nil
 }
@@ -1384,7 +1468,7 @@ func setAndCheckEnvByForm(c *ctx.ServiceContext, tx *db.Session, env *models.Env
 
 	if form.HasKey("varGroupIds") || form.HasKey("delVarGroupIds") {
 		// 创建变量组与实例的关系
-		if err := services.BatchUpdateRelationship(tx, form.VarGroupIds, form.DelVarGroupIds, consts.ScopeEnv, env.Id.String()); err != nil {
+		if err := updateVarGroupRelationship(c, tx, form.VarGroupIds, form.DelVarGroupIds, consts.ScopeEnv, env.Id); err != nil {
 			return err
 		}
 	}
@@ -1402,7 +1486,7 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	lg.Debugln("envDeploy -> envPreCheck finish")
 
 	// 检查自动纠漂移、推送到分支时重新部署时，是否了配置自动审批
-	if !services.CheckoutAutoApproval(form.AutoApproval, form.AutoRepairDrift, form.Triggers) {
+	if !services.CheckoutAutoApproval(form.AutoApproval, needAutoApprovalForDrift(form.AutoRepairDrift, form.DriftRepairMode), form.Triggers) {
 		return nil, e.New(e.EnvCheckAutoApproval, http.StatusBadRequest)
 	}
 	lg.Debugln("envDeploy -> CheckoutAutoApproval finish")
@@ -1417,6 +1501,23 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	if form.TaskType != common.TaskTypePlan && env.Locked {
 		return nil, e.New(e.EnvLocked, http.StatusBadRequest)
 	}
+	envBefore := *env
+
+	// replace、refresh-only 参数检查
+	replaces, err := services.BuildTaskReplaces(form.TaskType, form.Replaces, form.RefreshOnly, form.IsDriftTask)
+	if err != nil {
+		return nil, err
+	}
+
+	// 部署冻结检查
+	freezeOverride, err := checkEnvDeployFreeze(c, tx, env, form.TaskType, form.FreezeOverrideReason)
+	if err != nil {
+		return nil, err
+	}
+	overrideReason := ""
+	if freezeOverride {
+		overrideReason = strings.TrimSpace(form.FreezeOverrideReason)
+	}
 
 	// 模板检查
 	tpl, err := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
@@ -1432,6 +1533,15 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 		form.Revision = env.Revision
 	}
 
+	if form.TplVersion != "" {
+		tplVersion, err := services.GetTemplateVersion(tx, tpl.Id, form.TplVersion)
+		if err != nil {
+			return nil, err
+		}
+		form.TplVersion = tplVersion.Version
+		form.Revision = tplVersion.Revision
+	}
+
 	// 环境下云模版工作目录检查
 	if err = envWorkdirCheck(c, tpl.RepoId, form.Revision, form.Workdir, tpl.VcsId); err != nil {
 		return nil, err
@@ -1486,8 +1596,10 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 
 	// 创建任务
 	task, err := services.CreateTask(tx, tpl, env, models.Task{
-		Name:            models.Task{}.GetTaskNameByType(form.TaskType),
+		Name:            models.Task{}.GetTaskRunModeName(form.TaskType, form.RefreshOnly, replaces),
 		Targets:         targets,
+		Replaces:        replaces,
+		RefreshOnly:     form.RefreshOnly,
 		CreatorId:       c.UserId,
 		KeyId:           env.KeyId,
 		Variables:       vars,
@@ -1504,6 +1616,8 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 		SourceSys:   taskSourceSys,
 		Callback:    env.Callback,
 		IsDriftTask: IsDriftTask,
+
+		FreezeOverrideReason: overrideReason,
 	})
 
 	if err != nil {
@@ -1511,11 +1625,17 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 	lg.Debugln("envDeploy -> CreateTask finish")
+	if freezeOverride {
+		recordDeployFreezeOverride(c, env, task)
+	}
 
 	if _, err := tx.UpdateAll(env); err != nil {
 		c.Logger().Errorf("error save env, err %s", err)
 		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
 	}
+	if err := services.RecordEnvChanges(tx, &envBefore, env, c.UserId, c.RequestId); err != nil {
+		return nil, err
+	}
 
 	env.MergeTaskStatus()
 	envDetail := &models.EnvDetail{
@@ -1716,17 +1836,24 @@ func ResourceGraphDetail(c *ctx.ServiceContext, form *forms.ResourceGraphDetailF
 }
 
 func EnvUpdateTags(c *ctx.ServiceContext, form *forms.UpdateEnvTagsForm) (resp interface{}, er e.Error) {
-	if er := services.CheckEnvTags(form.Tags); er != nil {
+	tags, er := checkEnvTags(c, form.Tags)
+	if er != nil {
 		return nil, er
 	}
 
 	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
-	tags := strings.TrimSpace(form.Tags)
-	if env, er := services.UpdateEnv(query, form.Id, models.Attrs{"tags": tags}); er != nil {
+	envBefore, er := services.GetEnvById(query, form.Id)
+	if er != nil {
 		return nil, er
-	} else {
-		return env, nil
 	}
+	env, er := services.UpdateEnv(query, form.Id, models.Attrs{"tags": tags})
+	if er != nil {
+		return nil, er
+	}
+	if er := services.RecordEnvChanges(c.DB(), envBefore, env, c.UserId, c.RequestId); er != nil {
+		c.Logger().Warnf("record env %s changes error: %v", env.Id, er)
+	}
+	return env, nil
 }
 
 func EnvLock(c *ctx.ServiceContext, form *forms.EnvLockForm) (interface{}, e.Error) {
@@ -1764,6 +1891,13 @@ func EnvLock(c *ctx.ServiceContext, form *forms.EnvLockForm) (interface{}, e.Err
 		_ = tx.Rollback()
 		return nil, err
 	}
+	if !env.Locked {
+		lockChanges := []services.FieldChange{{Field: "locked", OldValue: "false", NewValue: "true"}}
+		if err := services.CreateChangeHistory(tx, env.OrgId, consts.ScopeEnv, env.Id, c.UserId, c.RequestId, lockChanges); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -1781,9 +1915,17 @@ func EnvUnLock(c *ctx.ServiceContext, form *forms.EnvUnLockForm) (interface{}, e
 		attrs["ttl"] = ""
 	}
 
-	if _, err := services.UpdateEnv(c.DB(), form.Id, attrs); err != nil {
+	envBefore, err := services.GetEnvById(c.DB(), form.Id)
+	if err != nil {
 		return nil, err
 	}
+	env, err := services.UpdateEnv(c.DB(), form.Id, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.RecordEnvChanges(c.DB(), envBefore, env, c.UserId, c.RequestId); err != nil {
+		c.Logger().Warnf("record env %s changes error: %v", env.Id, err)
+	}
 	return nil, nil
 }
 
@@ -0,0 +1,170 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func envBatchFilter(form forms.EnvBatchFilterForm) models.EnvBatchFilter {
+	tags := make([]string, 0, len(form.Tags))
+	for _, t := range form.Tags {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return models.EnvBatchFilter{
+		EnvIds: form.EnvIds,
+		TplId:  form.TplId,
+		Status: form.Status,
+		Tags:   tags,
+	}
+}
+
+func getEnvBatchEnvs(c *ctx.ServiceContext, filter models.EnvBatchFilter) ([]models.Env, e.Error) {
+	query, er := services.QueryEnvBatchEnvs(c.DB(), c.OrgId, c.ProjectId, filter)
+	if er != nil {
+		return nil, er
+	}
+	envs := make([]models.Env, 0)
+	if err := query.Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return envs, nil
+}
+
+// PreviewEnvBatch 预览批量操作会影响的环境
+func PreviewEnvBatch(c *ctx.ServiceContext, form *forms.PreviewEnvBatchForm) (*resps.EnvBatchPreviewResp, e.Error) {
+	envs, er := getEnvBatchEnvs(c, envBatchFilter(form.EnvBatchFilterForm))
+	if er != nil {
+		return nil, er
+	}
+
+	resp := resps.EnvBatchPreviewResp{
+		Action: form.Action,
+		Total:  len(envs),
+		Envs:   make([]resps.EnvBatchPreviewEnv, 0, len(envs)),
+	}
+	for i := range envs {
+		reason := services.CheckEnvBatchAction(&envs[i], form.Action)
+		if reason == "" {
+			resp.Allowed++
+		}
+		resp.Envs = append(resp.Envs, resps.EnvBatchPreviewEnv{
+			Id:         envs[i].Id,
+			Name:       envs[i].Name,
+			Status:     envs[i].Status,
+			TaskStatus: envs[i].TaskStatus,
+			Locked:     envs[i].Locked,
+			Tags:       envs[i].Tags,
+			Allowed:    reason == "",
+			Reason:     reason,
+		})
+	}
+	return &resp, nil
+}
+
+// CreateEnvBatch 创建批量操作，部署、plan、销毁任务由后台按速率限制逐步创建
+func CreateEnvBatch(c *ctx.ServiceContext, form *forms.CreateEnvBatchForm) (*resps.EnvBatchDetailResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create env batch %s", form.Action))
+
+	reason := strings.TrimSpace(form.FreezeOverrideReason)
+	if reason != "" {
+		if err := services.CheckDeployFreezeOverridePerm(c.DB(), c.OrgId, c.ProjectId, c.UserId); err != nil {
+			return nil, err
+		}
+	}
+
+	filter := envBatchFilter(form.EnvBatchFilterForm)
+	envs, er := getEnvBatchEnvs(c, filter)
+	if er != nil {
+		return nil, er
+	}
+
+	rate := form.Rate
+	if rate == 0 {
+		rate = consts.EnvBatchDefaultRate
+	}
+	batch := &models.EnvBatch{
+		OrgId:                c.OrgId,
+		ProjectId:            c.ProjectId,
+		CreatorId:            c.UserId,
+		Action:               form.Action,
+		Filters:              filter,
+		Rate:                 rate,
+		FreezeOverrideReason: reason,
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	if batch, er = services.CreateEnvBatch(tx, batch, envs); er != nil {
+		_ = tx.Rollback()
+		return nil, er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, batch.Id, consts.OperatorObjectTypeEnv, "batch", form.Action,
+		models.ResAttrs{"filters": filter, "total": batch.Total, "rate": batch.Rate, "freezeOverrideReason": reason})
+
+	// 锁定、解锁、归档操作不需要限速，直接执行
+	if !utils.StrInArray(batch.Action, models.EnvBatchTaskActions...) {
+		if er := services.ProcessEnvBatch(c.DB(), batch, time.Now(), c.Logger()); er != nil {
+			c.Logger().Errorf("process env batch %s error: %v", batch.Id, er)
+		}
+	}
+	return EnvBatchDetail(c, &forms.DetailEnvBatchForm{Id: batch.Id})
+}
+
+func SearchEnvBatch(c *ctx.ServiceContext, form *forms.SearchEnvBatchForm) (interface{}, e.Error) {
+	query := services.QueryEnvBatch(c.DB(), c.OrgId, c.ProjectId)
+	if form.Status != "" {
+		query = query.Where("iac_env_batch.status = ?", form.Status)
+	}
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	batches := make([]*resps.EnvBatchResp, 0)
+	if err := p.Scan(&batches); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     batches,
+	}, nil
+}
+
+func EnvBatchDetail(c *ctx.ServiceContext, form *forms.DetailEnvBatchForm) (*resps.EnvBatchDetailResp, e.Error) {
+	resp := resps.EnvBatchDetailResp{}
+	query := services.QueryEnvBatch(c.DB(), c.OrgId, c.ProjectId).Where("iac_env_batch.id = ?", form.Id)
+	if err := query.First(&resp.EnvBatchResp); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvBatchNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+
+	resp.Items = make([]resps.EnvBatchItemResp, 0)
+	if err := services.QueryEnvBatchItemDetail(c.DB(), form.Id).Find(&resp.Items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &resp, nil
+}
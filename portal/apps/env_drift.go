@@ -0,0 +1,180 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SearchEnvDriftRun 环境漂移检测历史
+func SearchEnvDriftRun(c *ctx.ServiceContext, form *forms.SearchEnvDriftRunForm) (interface{}, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetEnvById(query, form.Id); err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	query = services.QueryEnvDriftRun(c.DB(), form.Id)
+	if form.Drifted != nil {
+		query = query.Where("drifted = ?", *form.Drifted)
+	}
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	runs := make([]*models.EnvDriftRun, 0)
+	if err := p.Scan(&runs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     runs,
+	}, nil
+}
+
+// EnvDriftRunDetail 漂移检测记录详情，包含每个资源的属性漂移信息
+func EnvDriftRunDetail(c *ctx.ServiceContext, form *forms.DetailEnvDriftRunForm) (*models.EnvDriftRun, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetEnvById(query, form.Id); err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return services.GetEnvDriftRun(c.DB(), form.Id, form.DriftId)
+}
+
+// SearchDriftRemediation 环境的漂移纠偏记录
+func SearchDriftRemediation(c *ctx.ServiceContext, form *forms.SearchDriftRemediationForm) (interface{}, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetEnvById(query, form.Id); err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	query = services.QueryDriftRemediation(c.DB(), form.Id)
+	if form.Status != "" {
+		query = query.Where("status = ?", form.Status)
+	}
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	records := make([]*models.DriftRemediation, 0)
+	if err := p.Scan(&records); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     records,
+	}, nil
+}
+
+// DriftRemediationStat 环境的纠偏统计，包括平均纠偏时间
+func DriftRemediationStat(c *ctx.ServiceContext, form *forms.DriftRemediationStatForm) (*resps.DriftRemediationStatResp, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetEnvById(query, form.Id); err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return services.GetEnvDriftRemediationStat(c.DB(), form.Id)
+}
+
+func SearchDriftIgnoreRule(c *ctx.ServiceContext, form *forms.SearchDriftIgnoreRuleForm) (interface{}, e.Error) {
+	query := services.QueryDriftIgnoreRule(c.DB(), c.OrgId, c.ProjectId, form.EnvId)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	rules := make([]*models.DriftIgnoreRule, 0)
+	if err := p.Scan(&rules); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     rules,
+	}, nil
+}
+
+func CreateDriftIgnoreRule(c *ctx.ServiceContext, form *forms.CreateDriftIgnoreRuleForm) (*models.DriftIgnoreRule, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create drift ignore rule %s %s", form.ResourceType, form.Attribute))
+
+	if form.EnvId != "" {
+		// 环境级规则需要在项目下创建
+		if c.ProjectId == "" {
+			return nil, e.New(e.BadRequest, fmt.Errorf("'IaC-Project-Id' is required"), http.StatusBadRequest)
+		}
+		query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+		if _, err := services.GetEnvById(query, form.EnvId); err != nil {
+			return nil, e.AutoNew(err, e.EnvNotExists, http.StatusBadRequest)
+		}
+	}
+
+	return services.CreateDriftIgnoreRule(c.DB(), models.DriftIgnoreRule{
+		OrgId:        c.OrgId,
+		ProjectId:    c.ProjectId,
+		EnvId:        form.EnvId,
+		ResourceType: strings.TrimSpace(form.ResourceType),
+		Attribute:    strings.TrimSpace(form.Attribute),
+		Description:  form.Description,
+		Enabled:      true,
+		CreatorId:    c.UserId,
+	})
+}
+
+func UpdateDriftIgnoreRule(c *ctx.ServiceContext, form *forms.UpdateDriftIgnoreRuleForm) (rule *models.DriftIgnoreRule, er e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update drift ignore rule %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetDriftIgnoreRuleById(query, form.Id); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("resourceType") {
+		attrs["resource_type"] = strings.TrimSpace(form.ResourceType)
+	}
+	if form.HasKey("attribute") {
+		attrs["attribute"] = strings.TrimSpace(form.Attribute)
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+	if form.HasKey("enabled") {
+		attrs["enabled"] = form.Enabled
+	}
+
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		rule, er = services.UpdateDriftIgnoreRule(tx, form.Id, attrs)
+		return er
+	})
+	return rule, er
+}
+
+func DeleteDriftIgnoreRule(c *ctx.ServiceContext, form *forms.DeleteDriftIgnoreRuleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete drift ignore rule %s", form.Id))
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	if _, err := services.GetDriftIgnoreRuleById(query, form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteDriftIgnoreRule(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func DriftIgnoreRuleDetail(c *ctx.ServiceContext, form *forms.DetailDriftIgnoreRuleForm) (*models.DriftIgnoreRule, e.Error) {
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	return services.GetDriftIgnoreRuleById(query, form.Id)
+}
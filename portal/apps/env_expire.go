@@ -0,0 +1,114 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"cloudiac/utils/logs"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// EnvExtend 延长环境的自动销毁时间
+func EnvExtend(c *ctx.ServiceContext, form *forms.EnvExtendForm) (*models.Env, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("extend env %s", form.Id))
+
+	duration, err := services.ParseTTL(form.Duration)
+	if err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+
+	query := c.DB().Where("iac_env.org_id = ? AND iac_env.project_id = ?", c.OrgId, c.ProjectId)
+	env, er := services.GetEnvById(query, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	env, er = extendEnv(c.DB(), env, duration, c.UserId, c.RequestId)
+	if er != nil {
+		return nil, er
+	}
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "extend", env.Name,
+		models.ResAttrs{"duration": form.Duration, "autoDestroyAt": env.AutoDestroyAt})
+	return env, nil
+}
+
+// getSignedExtendEnv 校验延期链接的 token 并返回对应的环境，环境已延期或销毁时间被修改后链接失效
+func getSignedExtendEnv(c *ctx.ServiceContext, token string) (*models.Env, *services.EnvExtendClaims, e.Error) {
+	claims, er := services.VerifyEnvExtendToken(token)
+	if er != nil {
+		return nil, nil, er
+	}
+	env, er := services.GetEnvById(c.DB(), claims.EnvId)
+	if er != nil {
+		return nil, nil, er
+	}
+	if env.AutoDestroyAt == nil || env.AutoDestroyAt.Unix() != claims.DestroyAt {
+		return nil, nil, e.New(e.InvalidToken, fmt.Errorf("env auto destroy time changed"), http.StatusBadRequest)
+	}
+	return env, claims, nil
+}
+
+// EnvSignedExtendInfo 查询延期链接对应的环境及延期时长，用于延期前的确认，不修改环境
+func EnvSignedExtendInfo(c *ctx.ServiceContext, form *forms.EnvSignedExtendForm) (*resps.EnvSignedExtendInfoResp, e.Error) {
+	env, claims, er := getSignedExtendEnv(c, form.Token)
+	if er != nil {
+		return nil, er
+	}
+	return &resps.EnvSignedExtendInfoResp{
+		EnvId:     env.Id,
+		EnvName:   env.Name,
+		DestroyAt: env.AutoDestroyAt,
+		Duration:  claims.Duration,
+	}, nil
+}
+
+// EnvSignedExtend 通过提醒消息中的签名链接延长环境的自动销毁时间
+func EnvSignedExtend(c *ctx.ServiceContext, form *forms.EnvSignedExtendForm) (*models.Env, e.Error) {
+	env, claims, er := getSignedExtendEnv(c, form.Token)
+	if er != nil {
+		return nil, er
+	}
+	c.AddLogField("action", fmt.Sprintf("signed extend env %s", claims.EnvId))
+
+	duration, err := services.ParseTTL(claims.Duration)
+	if err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+
+	env, er = extendEnv(c.DB(), env, duration, consts.SysUserId, c.RequestId)
+	if er != nil {
+		return nil, er
+	}
+	services.InsertUserOperateLog(consts.SysUserId, env.OrgId, env.Id, consts.OperatorObjectTypeEnv, "extend", env.Name,
+		models.ResAttrs{"duration": claims.Duration, "autoDestroyAt": env.AutoDestroyAt, "signed": true})
+	return env, nil
+}
+
+func extendEnv(query *db.Session, env *models.Env, duration time.Duration,
+	operatorId models.Id, requestId string) (*models.Env, e.Error) {
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+	project, er := services.GetProjectsById(query, env.ProjectId)
+	if er != nil {
+		return nil, er
+	}
+	envBefore := *env
+	newEnv, er := services.ExtendEnv(query, env, project, duration)
+	if er != nil {
+		return nil, er
+	}
+	if er := services.RecordEnvChanges(query, &envBefore, newEnv, operatorId, requestId); er != nil {
+		logs.Get().Warnf("record env %s changes error: %v", env.Id, er)
+	}
+	return newEnv, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/runner"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// EnvImport 创建导入任务，将已存在的云资源导入到环境的 state 中
+func EnvImport(c *ctx.ServiceContext, form *forms.ImportEnvForm) (ret *models.EnvDetail, er e.Error) {
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		ret, er = envImport(c, tx, form)
+		return er
+	})
+	if er != nil {
+		return nil, er
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, form.Id, consts.OperatorObjectTypeEnv, common.TaskTypeImport, ret.Name,
+		map[string]interface{}{"taskId": ret.TaskId, "resources": len(form.Resources)})
+	return ret, nil
+}
+
+func envImport(c *ctx.ServiceContext, tx *db.Session, form *forms.ImportEnvForm) (*models.EnvDetail, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("import resources to env %s", form.Id))
+
+	env, tpl, err := envOpTaskCheck(c, tx, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := form.Mode
+	if mode == "" {
+		mode = common.TaskImportModeCli
+	}
+	if err := services.CheckImportTfVersion(mode, tpl.TfVersion); err != nil {
+		return nil, err
+	}
+
+	items := make([]runner.TaskImport, 0, len(form.Resources))
+	for _, r := range form.Resources {
+		items = append(items, runner.TaskImport{Address: strings.TrimSpace(r.Address), Id: r.Id})
+	}
+	imports, err := services.BuildTaskImports(items)
+	if err != nil {
+		return nil, err
+	}
+
+	return createEnvOpTask(c, tx, env, tpl, models.Task{
+		Imports:    imports,
+		ImportMode: mode,
+		BaseTask:   models.BaseTask{Type: common.TaskTypeImport},
+	}, form.FreezeOverrideReason)
+}
+
+// envOpTaskCheck 检查环境及云模板是否允许执行导入、state 操作等任务
+func envOpTaskCheck(c *ctx.ServiceContext, tx *db.Session, envId models.Id) (*models.Env, *models.Template, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	env, err := envCheck(tx, c.OrgId, c.ProjectId, envId, c.Logger())
+	if err != nil {
+		return nil, nil, err
+	}
+	if env.Locked {
+		return nil, nil, e.New(e.EnvLocked, http.StatusBadRequest)
+	}
+
+	tpl, err := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+	if err != nil {
+		return nil, nil, err
+	}
+	return env, tpl, nil
+}
+
+// createEnvOpTask 使用环境的配置创建导入、state 操作等任务，pt 中只需要设置任务类型及操作参数
+func createEnvOpTask(c *ctx.ServiceContext, tx *db.Session, env *models.Env, tpl *models.Template,
+	pt models.Task, freezeOverrideReason string) (*models.EnvDetail, e.Error) {
+	// 部署冻结检查
+	freezeOverride, err := checkEnvDeployFreeze(c, tx, env, pt.Type, freezeOverrideReason)
+	if err != nil {
+		return nil, err
+	}
+	if freezeOverride {
+		pt.FreezeOverrideReason = strings.TrimSpace(freezeOverrideReason)
+	}
+
+	vars, er := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if er != nil {
+		return nil, e.AutoNew(er, e.DBError)
+	}
+
+	rId, err := services.GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+	if err != nil {
+		return nil, err
+	}
+
+	pt.Name = models.Task{}.GetTaskNameByType(pt.Type)
+	pt.CreatorId = c.UserId
+	pt.KeyId = env.KeyId
+	pt.Variables = vars
+	pt.AutoApprove = env.AutoApproval
+	pt.Revision = env.Revision
+	pt.StopOnViolation = env.StopOnViolation
+	pt.ExtraData = env.ExtraData
+	pt.StepTimeout = env.StepTimeout
+	pt.RunnerId = rId
+	pt.Source = consts.TaskSourceManual
+	pt.Callback = env.Callback
+
+	task, err := services.CreateTask(tx, tpl, env, pt)
+	if err != nil {
+		c.Logger().Errorf("error creating %s task, err %s", pt.Type, err)
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if freezeOverride {
+		recordDeployFreezeOverride(c, env, task)
+	}
+
+	env.MergeTaskStatus()
+	envDetail := &models.EnvDetail{
+		Env:    *env,
+		TaskId: task.Id,
+	}
+	return PopulateLastTask(c.DB(), envDetail), nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/utils/logs"
+	"fmt"
+)
+
+// 统一后的 PR 事件类型
+const (
+	PrActionOpen  = "open"  // 创建或重新打开
+	PrActionSync  = "sync"  // 源分支有新的提交
+	PrActionClose = "close" // 关闭或合并
+)
+
+// getPrAction 将各 vcs 的 PR 事件转换为统一的事件类型，非 PR 事件或无需处理的事件返回空字符串
+func getPrAction(vcsType string, form forms.WebhooksApiHandler) string {
+	switch vcsType {
+	case consts.GitTypeGitLab:
+		if form.ObjectKind != "merge_request" {
+			return ""
+		}
+		switch form.ObjectAttributes.Action {
+		case "open", "reopen":
+			return PrActionOpen
+		case "update":
+			// 只修改标题、描述等信息时 oldrev 为空
+			if form.ObjectAttributes.Oldrev != "" {
+				return PrActionSync
+			}
+		case "close", "merge":
+			return PrActionClose
+		}
+	case consts.GitTypeGitee:
+		switch form.Action {
+		case "open":
+			return PrActionOpen
+		case "update":
+			if form.ActionDesc == "source_branch_changed" {
+				return PrActionSync
+			}
+		case "close", "merge":
+			return PrActionClose
+		}
+	default:
+		// github, gitea
+		switch form.Action {
+		case "opened", "reopened":
+			return PrActionOpen
+		case "synchronize", "synchronized":
+			return PrActionSync
+		case "closed":
+			return PrActionClose
+		}
+	}
+	return ""
+}
+
+// previewEnvName 预览环境名称，多个云模板可以共用预览项目，名称中包含云模板 id 避免重名
+func previewEnvName(tpl *models.Template, prId int) string {
+	return fmt.Sprintf("%s-%s-pr-%d", tpl.Name, tpl.Id, prId)
+}
+
+// createPreviewEnv 使用云模板的配置在预览项目下创建 PR 预览环境，
+// fork 仓库的 PR 源分支在模板仓库中不存在，环境及任务都使用 PR 的 head commit 部署
+func createPreviewEnv(tx *db.Session, userId models.Id, tpl *models.Template, options webhookOptions) (*models.Env, e.Error) {
+	runnerId, err := services.GetDefaultRunnerId()
+	if err != nil {
+		return nil, err
+	}
+
+	return services.CreateEnv(tx, models.Env{
+		OrgId:     tpl.OrgId,
+		ProjectId: tpl.PreviewProjectId,
+		TplId:     tpl.Id,
+		CreatorId: userId,
+
+		Name:        previewEnvName(tpl, options.PrId),
+		Description: fmt.Sprintf("Preview environment of PR #%d (%s)", options.PrId, options.HeadRef),
+		Status:      models.EnvStatusInactive,
+		StepTimeout: common.DefaultTaskStepTimeout,
+		RunnerId:    runnerId,
+
+		TfVarsFile:   tpl.TfVarsFile,
+		PlayVarsFile: tpl.PlayVarsFile,
+		Playbook:     tpl.Playbook,
+		Revision:     options.HeadCommit,
+		KeyId:        tpl.KeyId,
+		Workdir:      tpl.Workdir,
+		PolicyEnable: tpl.PolicyEnable,
+
+		// 预览环境由 PR 事件驱动，部署无需审批
+		TTL:          tpl.PreviewTTL,
+		AutoApproval: true,
+		PreviewPrId:  options.PrId,
+	})
+}
+
+// actionPreviewEnv PR 创建时创建预览环境并部署，有新的提交时重新部署，PR 关闭或合并时销毁并归档
+func actionPreviewEnv(tx *db.Session, userId models.Id, tpl *models.Template, options webhookOptions) error {
+	logger := logs.Get().WithField("webhook", "previewEnv").WithField("tplId", tpl.Id)
+
+	env, err := services.GetPreviewEnv(tx, tpl.Id, options.PrId)
+	if err != nil && err.Code() != e.EnvNotExists {
+		return err
+	}
+
+	if options.PrAction == PrActionClose {
+		if env == nil || env.Archived {
+			return nil
+		}
+		if env.Status == models.EnvStatusInactive || env.Status == models.EnvStatusDestroyed {
+			// 没有需要销毁的资源，直接归档
+			_, err := services.UpdateEnv(tx, env.Id, models.Attrs{"archived": true})
+			return err
+		}
+		if env.Locked {
+			logger.Errorf("env %s is locked don't allow destroy", env.Id)
+			return nil
+		}
+		_, er := CreateWebhookTask(tx, CreateWebhookTaskParam{
+			TaskType: models.TaskTypeDestroy,
+			Revision: env.Revision,
+			UserId:   userId,
+			Env:      env,
+			Tpl:      tpl,
+			PrId:     options.PrId,
+			Source:   consts.TaskSourceWebhookDestroy,
+		})
+		return er
+	}
+
+	if options.HeadCommit == "" {
+		return fmt.Errorf("head commit of pr %d is empty", options.PrId)
+	}
+	if env == nil {
+		if env, err = createPreviewEnv(tx, userId, tpl, options); err != nil {
+			return err
+		}
+		logger.Infof("preview env %s created for pr %d", env.Id, options.PrId)
+	} else {
+		if env.Locked {
+			logger.Errorf("env %s is locked don't allow apply", env.Id)
+			return nil
+		}
+		// PR 重新打开时恢复已归档的预览环境
+		if env, err = services.UpdateEnv(tx, env.Id, models.Attrs{
+			"archived": false,
+			"revision": options.HeadCommit,
+		}); err != nil {
+			return err
+		}
+	}
+
+	_, er := CreateWebhookTask(tx, CreateWebhookTaskParam{
+		TaskType: models.TaskTypeApply,
+		Revision: options.HeadCommit,
+		CommitId: options.HeadCommit,
+		UserId:   userId,
+		Env:      env,
+		Tpl:      tpl,
+		PrId:     options.PrId,
+		Source:   consts.TaskSourceWebhookApply,
+	})
+	return er
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"net/http"
+)
+
+// checkPromoteTargetPerm 检查用户是否有目标项目的环境管理权限
+func checkPromoteTargetPerm(c *ctx.ServiceContext, projectId models.Id) e.Error {
+	if c.IsSuperAdmin ||
+		services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) ||
+		services.UserHasProjectRole(c.UserId, c.OrgId, projectId, consts.ProjectRoleManager) ||
+		services.UserHasProjectRole(c.UserId, c.OrgId, projectId, consts.ProjectRoleApprover) {
+		return nil
+	}
+	return e.New(e.PermissionDeny, fmt.Errorf("no permission to manage envs of project %s", projectId), http.StatusForbidden)
+}
+
+// getPromoteTargetEnv 获取并检查目标环境，目标环境需与源环境使用相同的云模板
+func getPromoteTargetEnv(c *ctx.ServiceContext, src *models.Env, form *forms.PromoteEnvForm) (*models.Env, e.Error) {
+	if form.TargetEnvId == src.Id {
+		return nil, e.New(e.BadParam, fmt.Errorf("target env can not be the source env"), http.StatusBadRequest)
+	}
+	dst, err := envCheck(c.DB(), c.OrgId, form.TargetProjectId, form.TargetEnvId, c.Logger())
+	if err != nil {
+		return nil, err
+	}
+	if dst.TplId != src.TplId {
+		return nil, e.New(e.EnvPromoteTplMismatch, http.StatusBadRequest)
+	}
+	return dst, nil
+}
+
+// checkPromoteNewEnv 检查新建的目标环境，云模板需要关联到目标项目且环境名称不能重复
+func checkPromoteNewEnv(c *ctx.ServiceContext, src *models.Env, form *forms.PromoteEnvForm) e.Error {
+	ok, err := c.DB().Model(&models.ProjectTemplate{}).
+		Where("template_id = ? AND project_id = ?", src.TplId, form.TargetProjectId).Exists()
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if !ok {
+		return e.New(e.TemplateNotAssociationCurrentProject, http.StatusBadRequest)
+	}
+
+	if env, _ := services.GetEnvByName(c.DB(), c.OrgId, form.TargetProjectId, form.TargetEnvName); env != nil {
+		return e.New(e.EnvAlreadyExists, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// PromoteEnv 将环境配置复制到其他项目中的新环境或已有环境
+func PromoteEnv(c *ctx.ServiceContext, form *forms.PromoteEnvForm) (*resps.PromoteEnvResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("promote env %s to project %s", form.Id, form.TargetProjectId))
+
+	envQuery := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	src, err := services.GetEnvById(envQuery, form.Id)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusNotFound)
+	}
+
+	project, err := services.GetProjectsById(c.DB(), form.TargetProjectId)
+	if err != nil {
+		return nil, e.New(e.ProjectNotExists, err, http.StatusBadRequest)
+	}
+	if project.OrgId != c.OrgId {
+		return nil, e.New(e.ProjectNotExists, http.StatusBadRequest)
+	}
+	if err := checkPromoteTargetPerm(c, project.Id); err != nil {
+		return nil, err
+	}
+
+	conf, err := services.GetEnvPromoteConfig(c.DB(), src)
+	if err != nil {
+		return nil, err
+	}
+	// 预览的变更中不包含目标项目无法使用的变量组及策略组
+	if err := services.FilterEnvPromoteGroups(c.DB(), c.OrgId, project.Id, conf); err != nil {
+		return nil, err
+	}
+
+	resp := &resps.PromoteEnvResp{SourceEnvId: src.Id}
+	if form.PinCommit {
+		lastTask, err := services.GetEnvLastSuccessTask(c.DB(), src.Id)
+		if err != nil {
+			return nil, e.AutoNew(err, e.DBError, http.StatusBadRequest)
+		}
+		conf.Revision = lastTask.CommitId
+		resp.PinnedCommit = lastTask.CommitId
+		resp.PinnedTaskId = lastTask.Id
+	}
+
+	var (
+		dst     *models.Env
+		dstConf *services.EnvPromoteConfig
+	)
+	if form.TargetEnvId != "" {
+		if dst, err = getPromoteTargetEnv(c, src, form); err != nil {
+			return nil, err
+		}
+		if dstConf, err = services.GetEnvPromoteConfig(c.DB(), dst); err != nil {
+			return nil, err
+		}
+		resp.TargetEnvId = dst.Id
+	} else {
+		if form.TargetEnvName == "" {
+			form.TargetEnvName = src.Name
+		}
+		if err := checkPromoteNewEnv(c, src, form); err != nil {
+			return nil, err
+		}
+		resp.Created = true
+	}
+
+	resp.Changes = services.DiffEnvPromoteConfig(conf, dstConf)
+	if form.DryRun {
+		return resp, nil
+	}
+
+	tpl, err := envTplCheck(c.DB(), c.OrgId, src.TplId, c.Logger())
+	if err != nil {
+		return nil, err
+	}
+
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		if dst == nil {
+			dst, err = services.CreateEnv(tx, models.Env{
+				OrgId:     c.OrgId,
+				ProjectId: project.Id,
+				TplId:     src.TplId,
+				CreatorId: c.UserId,
+				Name:      form.TargetEnvName,
+				Status:    models.EnvStatusInactive,
+			})
+			if err != nil {
+				return err
+			}
+			resp.TargetEnvId = dst.Id
+		}
+
+		if dst, err = services.ApplyEnvPromoteConfig(tx, dst, conf, c.UserId); err != nil {
+			return err
+		}
+
+		if !form.Plan {
+			return nil
+		}
+		vars, err := services.GetValidVarsAndVgVars(tx, dst.OrgId, dst.ProjectId, dst.TplId, dst.Id)
+		if err != nil {
+			return err
+		}
+		runnerId, err := services.GetAvailableRunnerIdByStr(dst.RunnerId, dst.RunnerTags)
+		if err != nil {
+			return err
+		}
+		task, err := services.CreateTask(tx, tpl, dst, models.Task{
+			Name:            models.Task{}.GetTaskNameByType(common.TaskTypePlan),
+			CreatorId:       c.UserId,
+			KeyId:           dst.KeyId,
+			Variables:       vars,
+			AutoApprove:     dst.AutoApproval,
+			Revision:        dst.Revision,
+			StopOnViolation: dst.StopOnViolation,
+			BaseTask: models.BaseTask{
+				Type:        common.TaskTypePlan,
+				StepTimeout: dst.StepTimeout,
+				RunnerId:    runnerId,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		resp.TaskId = task.Id
+		return nil
+	})
+	if er != nil {
+		c.Logger().Errorf("promote env %s error: %v", src.Id, er)
+		return nil, e.AutoNew(er, e.DBError)
+	}
+
+	if len(conf.Triggers) > 0 {
+		vcs, _ := services.QueryVcsByVcsId(tpl.VcsId, c.DB())
+		token, err := GetWebhookToken(c)
+		if err != nil {
+			return nil, err
+		}
+		if err := vcsrv.SetWebhook(vcs, tpl.RepoId, token.Key, conf.Triggers); err != nil {
+			c.Logger().Errorf("set webhook err :%v", err)
+		}
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, dst.Id, consts.OperatorObjectTypeEnv, "promote", dst.Name,
+		map[string]interface{}{"sourceEnvId": src.Id, "pinnedCommit": resp.PinnedCommit})
+	return resp, nil
+}
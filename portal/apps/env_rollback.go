@@ -0,0 +1,85 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/desensitize"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// EnvRollback 使用历史部署任务的参数重新部署环境
+func EnvRollback(c *ctx.ServiceContext, form *forms.EnvRollbackForm) (*resps.TaskDetailResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("rollback env %s to task %s", form.Id, form.TaskId))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	var (
+		task     *models.Task
+		env      *models.Env
+		override bool
+	)
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		var err e.Error
+		env, err = envCheck(tx, c.OrgId, c.ProjectId, form.Id, c.Logger())
+		if err != nil {
+			return err
+		}
+		if env.Locked {
+			return e.New(e.EnvLocked, http.StatusBadRequest)
+		}
+
+		taskQuery := services.QueryWithProjectId(services.QueryWithOrgId(tx, c.OrgId), c.ProjectId)
+		src, err := services.GetTaskById(taskQuery, form.TaskId)
+		if err != nil {
+			return e.AutoNew(err, e.TaskNotExists, http.StatusNotFound)
+		}
+		if err = services.CheckRollbackTask(src, env); err != nil {
+			return err
+		}
+
+		override, err = checkEnvDeployFreeze(c, tx, env, models.TaskTypeApply, form.FreezeOverrideReason)
+		if err != nil {
+			return err
+		}
+		overrideReason := ""
+		if override {
+			overrideReason = form.FreezeOverrideReason
+		}
+
+		task, err = services.CloneRollbackTask(tx, *src, env, c.UserId, overrideReason)
+		if err != nil {
+			c.Logger().Errorf("error rollback env, err %s", err)
+			return err
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.InternalError)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "rollback", env.Name,
+		models.ResAttrs{
+			"taskId":         task.Id,
+			"rollbackTaskId": task.RollbackTaskId,
+			"commitId":       task.CommitId,
+		})
+	if override {
+		recordDeployFreezeOverride(c, env, task)
+	}
+
+	return &resps.TaskDetailResp{
+		Task:    desensitize.NewTask(*task),
+		Creator: c.Username,
+	}, nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/runner"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// EnvStateOps 创建 state 操作任务，在 runner 中执行 state mv/rm、taint/untaint 或 force-unlock
+func EnvStateOps(c *ctx.ServiceContext, form *forms.EnvStateOpsForm) (ret *models.EnvDetail, er e.Error) {
+	var ops models.TaskStateOps
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		ret, ops, er = envStateOps(c, tx, form)
+		return er
+	})
+	if er != nil {
+		return nil, er
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, form.Id, consts.OperatorObjectTypeEnv, common.TaskTypeStateOp, ret.Name,
+		map[string]interface{}{"taskId": ret.TaskId, "ops": ops})
+	return ret, nil
+}
+
+func envStateOps(c *ctx.ServiceContext, tx *db.Session, form *forms.EnvStateOpsForm) (
+	*models.EnvDetail, models.TaskStateOps, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("state operations on env %s", form.Id))
+
+	env, tpl, err := envOpTaskCheck(c, tx, form.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items := make([]runner.TaskStateOp, 0, len(form.Ops))
+	for _, op := range form.Ops {
+		items = append(items, runner.TaskStateOp{
+			Action:      op.Action,
+			Address:     strings.TrimSpace(op.Address),
+			Destination: strings.TrimSpace(op.Destination),
+			LockId:      strings.TrimSpace(op.LockId),
+		})
+	}
+	ops, err := services.BuildTaskStateOps(items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detail, err := createEnvOpTask(c, tx, env, tpl, models.Task{
+		StateOps: ops,
+		BaseTask: models.BaseTask{Type: common.TaskTypeStateOp},
+	}, form.FreezeOverrideReason)
+	return detail, ops, err
+}
+
+// EnvStateSnapshot 获取 state 操作任务执行前后的 state 快照
+func EnvStateSnapshot(c *ctx.ServiceContext, form *forms.EnvStateSnapshotForm) (interface{}, e.Error) {
+	query := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	task, err := services.GetTask(query, form.TaskId)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusNotFound)
+	}
+	if task.EnvId != form.Id {
+		return nil, e.New(e.TaskNotExists, http.StatusNotFound)
+	}
+
+	stage := form.Stage
+	if stage == "" {
+		stage = models.StateSnapshotBefore
+	}
+	content, err := services.GetTaskStateSnapshot(task, stage)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(content), nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// checkEnvTags 检查环境标签格式及是否满足组织的标签规范，返回格式化后的标签
+func checkEnvTags(c *ctx.ServiceContext, tags string) (string, e.Error) {
+	tags, er := services.CheckEnvTags(tags)
+	if er != nil {
+		return "", er
+	}
+	schemas, er := services.GetOrgEnvTagSchemas(c.DB(), c.OrgId)
+	if er != nil {
+		return "", er
+	}
+	if er := services.CheckEnvTagsSchema(models.ParseEnvTags(tags), schemas); er != nil {
+		return "", er
+	}
+	return tags, nil
+}
+
+func SearchEnvTagSchema(c *ctx.ServiceContext, form *forms.SearchEnvTagSchemaForm) (interface{}, e.Error) {
+	query := services.QueryEnvTagSchema(c.DB(), c.OrgId)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	schemas := make([]*models.EnvTagSchema, 0)
+	if err := p.Scan(&schemas); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     schemas,
+	}, nil
+}
+
+func CreateEnvTagSchema(c *ctx.ServiceContext, form *forms.CreateEnvTagSchemaForm) (*models.EnvTagSchema, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create env tag schema %s", form.Key))
+
+	return services.CreateEnvTagSchema(c.DB(), models.EnvTagSchema{
+		OrgId:       c.OrgId,
+		Key:         strings.TrimSpace(form.Key),
+		Required:    form.Required,
+		Values:      form.Values,
+		Description: form.Description,
+		CreatorId:   c.UserId,
+	})
+}
+
+func UpdateEnvTagSchema(c *ctx.ServiceContext, form *forms.UpdateEnvTagSchemaForm) (schema *models.EnvTagSchema, er e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update env tag schema %s", form.Id))
+
+	if _, err := services.GetEnvTagSchemaById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("required") {
+		attrs["required"] = form.Required
+	}
+	if form.HasKey("values") {
+		attrs["values"] = models.StrSlice(form.Values)
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		schema, er = services.UpdateEnvTagSchema(tx, form.Id, attrs)
+		return er
+	})
+	return schema, er
+}
+
+func DeleteEnvTagSchema(c *ctx.ServiceContext, form *forms.DeleteEnvTagSchemaForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete env tag schema %s", form.Id))
+
+	if _, err := services.GetEnvTagSchemaById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteEnvTagSchema(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func EnvTagSchemaDetail(c *ctx.ServiceContext, form *forms.DetailEnvTagSchemaForm) (*models.EnvTagSchema, e.Error) {
+	return services.GetEnvTagSchemaById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+}
+
+// OrgTagCostStat 按环境标签统计组织下的费用
+func OrgTagCostStat(c *ctx.ServiceContext, form *forms.OrgTagCostStatForm) ([]resps.TagCostStatResp, e.Error) {
+	var projectIds []string
+	if form.ProjectIds != "" {
+		projectIds = strings.Split(form.ProjectIds, ",")
+	}
+	cycle := form.Cycle
+	if cycle == "" {
+		cycle = time.Now().Format("2006-01")
+	}
+	return services.GetOrgTagCostStat(c.DB(), c.OrgId, projectIds, strings.TrimSpace(form.TagKey), cycle)
+}
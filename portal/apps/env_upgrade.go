@@ -0,0 +1,107 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/desensitize"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// EnvUpgrade 使用指定云模板版本发起需要审批的部署任务，任务部署成功后环境才会锁定到该版本
+func EnvUpgrade(c *ctx.ServiceContext, form *forms.EnvUpgradeForm) (*resps.TaskDetailResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("upgrade env %s to version %s", form.Id, form.Version))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	var (
+		task       *models.Task
+		env        *models.Env
+		tplVersion *models.TemplateVersion
+		fromVer    string
+	)
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		var err e.Error
+		env, err = envCheck(tx, c.OrgId, c.ProjectId, form.Id, c.Logger())
+		if err != nil {
+			return err
+		}
+		if env.Locked {
+			return e.New(e.EnvLocked, http.StatusBadRequest)
+		}
+
+		tpl, err := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+		if err != nil {
+			return err
+		}
+		tplVersion, err = services.GetTemplateVersion(tx, tpl.Id, form.Version)
+		if err != nil {
+			return err
+		}
+		if err = envWorkdirCheck(c, tpl.RepoId, tplVersion.Revision, env.Workdir, tpl.VcsId); err != nil {
+			return err
+		}
+
+		fromVer = env.TplVersion
+
+		vars, er := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+		if er != nil {
+			return e.AutoNew(er, e.InternalError)
+		}
+		runnerId, err := services.GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+		if err != nil {
+			return err
+		}
+		// 升级任务总是需要审批，确认 plan 结果后才会部署
+		task, err = services.CreateTask(tx, tpl, env, models.Task{
+			Name:            fmt.Sprintf("%s (upgrade to %s)", models.Task{}.GetTaskNameByType(common.TaskTypeApply), tplVersion.Version),
+			Targets:         env.Targets,
+			CreatorId:       c.UserId,
+			KeyId:           env.KeyId,
+			Variables:       vars,
+			AutoApprove:     false,
+			Revision:        tplVersion.Revision,
+			TplVersion:      tplVersion.Version,
+			StopOnViolation: env.StopOnViolation,
+			ExtraData:       env.ExtraData,
+			BaseTask: models.BaseTask{
+				Type:        common.TaskTypeApply,
+				StepTimeout: env.StepTimeout,
+				RunnerId:    runnerId,
+			},
+			Source: consts.TaskSourceManual,
+		})
+		if err != nil {
+			c.Logger().Errorf("error upgrade env, err %s", err)
+			return err
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.InternalError)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "upgrade", env.Name,
+		models.ResAttrs{
+			"taskId":      task.Id,
+			"fromVersion": fromVer,
+			"toVersion":   tplVersion.Version,
+			"revision":    tplVersion.Revision,
+		})
+
+	return &resps.TaskDetailResp{
+		Task:    desensitize.NewTask(*task),
+		Creator: c.Username,
+	}, nil
+}
@@ -540,6 +540,7 @@ func SearchOrgResources(c *ctx.ServiceContext, form *forms.SearchOrgResourceForm
 	if len(form.ProjectIds) != 0 {
 		query = query.Where("iac_env.project_id in (?)", strings.Split(form.ProjectIds, ","))
 	}
+	query = services.FilterEnvTags(query, models.ParseEnvTags(form.Tags))
 	return searchResource(query, form.Providers, form.CurrentPage(), form.PageSize())
 }
 
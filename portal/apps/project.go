@@ -242,6 +242,11 @@ func UpdateProject(c *ctx.ServiceContext, form *forms.UpdateProjectForm) (interf
 		attrs["status"] = form.Status
 	}
 
+	if er := setProjectEnvExpireAttrs(attrs, form); er != nil {
+		_ = tx.Rollback()
+		return nil, er
+	}
+
 	project := &models.Project{}
 	project.Id = form.Id
 	err := services.UpdateProject(tx, project, attrs)
@@ -262,6 +267,28 @@ func UpdateProject(c *ctx.ServiceContext, form *forms.UpdateProjectForm) (interf
 	return nil, nil
 }
 
+// setProjectEnvExpireAttrs 校验并设置环境自动销毁提醒及延期规则
+func setProjectEnvExpireAttrs(attrs models.Attrs, form *forms.UpdateProjectForm) e.Error {
+	if form.HasKey("envExpireNotify") {
+		if _, err := services.ParseEnvExpireNotify(form.EnvExpireNotify); err != nil {
+			return e.New(e.BadParam, fmt.Errorf("invalid envExpireNotify: %v", err), http.StatusBadRequest)
+		}
+		attrs["env_expire_notify"] = models.StrSlice(form.EnvExpireNotify)
+	}
+	if form.HasKey("envExtendMax") {
+		if form.EnvExtendMax != "" {
+			if d, err := services.ParseTTL(form.EnvExtendMax); err != nil || d <= 0 {
+				return e.New(e.BadParam, fmt.Errorf("invalid envExtendMax: %s", form.EnvExtendMax), http.StatusBadRequest)
+			}
+		}
+		attrs["env_extend_max"] = form.EnvExtendMax
+	}
+	if form.HasKey("envExtendLimit") {
+		attrs["env_extend_limit"] = form.EnvExtendLimit
+	}
+	return nil
+}
+
 func DeleteProject(c *ctx.ServiceContext, form *forms.DeleteProjectForm) (interface{}, e.Error) {
 	return nil, e.New(e.NotImplement)
 }
@@ -314,6 +341,7 @@ func SearchProjectResources(c *ctx.ServiceContext, form *forms.SearchProjectReso
 	if len(form.EnvIds) != 0 {
 		query = query.Where("iac_env.id in (?)", strings.Split(form.EnvIds, ","))
 	}
+	query = services.FilterEnvTags(query, models.ParseEnvTags(form.Tags))
 	return searchResource(query, form.Providers, form.CurrentPage(), form.PageSize())
 
 }
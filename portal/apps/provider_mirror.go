@@ -0,0 +1,175 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 同步 provider 时未指定平台使用的默认平台，与 runner 容器一致
+var defaultProviderMirrorPlatforms = []string{"linux_amd64"}
+
+// SearchProviderMirror 查询 provider mirror 中的安装包
+func SearchProviderMirror(c *ctx.ServiceContext, form *forms.SearchProviderMirrorForm) (interface{}, e.Error) {
+	query := services.QueryProviderMirrorPackage(c.DB())
+	if form.Q != "" {
+		q := fmt.Sprintf("%%%s%%", form.Q)
+		query = query.Where("(namespace LIKE ? OR type LIKE ?)", q, q)
+	}
+	if form.Status != "" {
+		query = query.Where("status = ?", form.Status)
+	}
+	query = query.Order("hostname, namespace, type, created_at DESC")
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	pkgs := make([]models.ProviderMirrorPackage, 0)
+	if err := p.Scan(&pkgs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     pkgs,
+	}, nil
+}
+
+// UploadProviderMirror 上传 provider 安装包，未指定的类型、版本及平台从安装包文件名中解析
+func UploadProviderMirror(c *ctx.ServiceContext, form *forms.UploadProviderMirrorForm) (*models.ProviderMirrorPackage, e.Error) {
+	pkg := models.ProviderMirrorPackage{
+		Hostname:  form.Hostname,
+		Namespace: form.Namespace,
+		Type:      form.Type,
+		Version:   form.Version,
+		Os:        form.Os,
+		Arch:      form.Arch,
+		Source:    models.ProviderMirrorSourceUpload,
+		CreatorId: c.UserId,
+	}
+	if typ, version, goos, goarch, ok := services.ParseProviderPackageFilename(form.File.Filename); ok {
+		if pkg.Type == "" {
+			pkg.Type = typ
+		}
+		if pkg.Version == "" {
+			pkg.Version = version
+		}
+		if pkg.Os == "" {
+			pkg.Os = goos
+		}
+		if pkg.Arch == "" {
+			pkg.Arch = goarch
+		}
+	}
+	if err := services.CheckProviderMirrorPackage(&pkg); err != nil {
+		return nil, err
+	}
+	c.AddLogField("action", fmt.Sprintf("upload provider %s %s %s", pkg.Provider(), pkg.Version, pkg.Platform()))
+
+	// 先以同步中状态创建记录，唯一索引保证同一安装包只有一个请求可以写入文件，
+	// 安装包已存在时直接返回错误，不会覆盖或删除已有的安装包文件
+	pkg.Status = models.ProviderMirrorStatusSyncing
+	created, er := services.CreateProviderMirrorPackage(c.DB(), pkg)
+	if er != nil {
+		return nil, er
+	}
+
+	if er := saveUploadProviderMirrorFile(form, created); er != nil {
+		// 文件未保存成功，删除记录以便重新上传
+		if err := services.DeleteProviderMirrorPackage(c.DB(), created); err != nil {
+			c.Logger().Errorf("delete provider mirror package %s: %v", created.Id, err)
+		}
+		return nil, er
+	}
+
+	attrs := models.Attrs{
+		"status": models.ProviderMirrorStatusReady,
+		"size":   created.Size,
+		"sha256": created.Sha256,
+	}
+	if _, err := models.UpdateAttr(c.DB().Where("id = ?", created.Id), &models.ProviderMirrorPackage{}, attrs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	created.Status = models.ProviderMirrorStatusReady
+	return created, nil
+}
+
+func saveUploadProviderMirrorFile(form *forms.UploadProviderMirrorForm, pkg *models.ProviderMirrorPackage) e.Error {
+	file, err := form.File.Open()
+	if err != nil {
+		return e.New(e.IOError, err)
+	}
+	defer file.Close()
+
+	return services.SaveProviderMirrorFile(pkg, file)
+}
+
+// SyncProviderMirror 从 registry 同步 provider 安装包，同步在后台执行，返回待同步的安装包
+func SyncProviderMirror(c *ctx.ServiceContext, form *forms.SyncProviderMirrorForm) (pkgs []models.ProviderMirrorPackage, er e.Error) {
+	c.AddLogField("action", fmt.Sprintf("sync provider %s/%s %s", form.Namespace, form.Type, form.Version))
+
+	platforms := form.Platforms
+	if len(platforms) == 0 {
+		platforms = defaultProviderMirrorPlatforms
+	}
+
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		pkgs, er = services.PrepareProviderMirrorSync(tx, models.ProviderMirrorPackage{
+			Hostname:  form.Hostname,
+			Namespace: form.Namespace,
+			Type:      form.Type,
+			Version:   form.Version,
+			CreatorId: c.UserId,
+		}, platforms)
+		return er
+	})
+	if er != nil {
+		return nil, er
+	}
+
+	if len(pkgs) > 0 {
+		go services.RunProviderMirrorSync(db.Get(), pkgs)
+	}
+	return pkgs, nil
+}
+
+// DeleteProviderMirror 删除 provider 安装包
+func DeleteProviderMirror(c *ctx.ServiceContext, form *forms.DeleteProviderMirrorForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete provider mirror package %s", form.Id))
+
+	pkg, err := services.GetProviderMirrorPackageById(c.DB(), form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Status == models.ProviderMirrorStatusSyncing {
+		return nil, e.New(e.ProviderMirrorInvalid, fmt.Errorf("package is syncing"), http.StatusConflict)
+	}
+	return nil, services.DeleteProviderMirrorPackage(c.DB(), pkg)
+}
+
+// ProviderMirrorVersions 按 network mirror 协议返回 provider 的可用版本
+func ProviderMirrorVersions(c *ctx.ServiceContext, form *forms.ProviderMirrorProtocolForm) (*resps.ProviderMirrorVersions, e.Error) {
+	return services.GetProviderMirrorVersions(c.DB(), strings.ToLower(form.Hostname), form.Namespace, form.Type)
+}
+
+// ProviderMirrorArchives 按 network mirror 协议返回 provider 版本在各平台的安装包
+func ProviderMirrorArchives(c *ctx.ServiceContext, form *forms.ProviderMirrorProtocolForm, version string) (*resps.ProviderMirrorArchives, e.Error) {
+	return services.GetProviderMirrorArchives(c.DB(), strings.ToLower(form.Hostname), form.Namespace, form.Type, version)
+}
+
+// ProviderMirrorPackageFile 返回安装包文件在 portal 本地的路径
+func ProviderMirrorPackageFile(c *ctx.ServiceContext, form *forms.ProviderMirrorProtocolForm) (string, e.Error) {
+	pkg, err := services.GetProviderMirrorPackageByFilename(c.DB(), strings.ToLower(form.Hostname), form.Namespace, form.Type, form.File)
+	if err != nil {
+		return "", err
+	}
+	return services.ProviderMirrorFilePath(pkg), nil
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func registryModuleResp(query *db.Session, m *models.RegistryModule, withVersions bool) (*resps.RegistryModuleResp, e.Error) {
+	versions, err := services.GetRegistryModuleVersions(query, m.Id)
+	if err != nil {
+		return nil, err
+	}
+	resp := resps.RegistryModuleResp{
+		RegistryModule: *m,
+		Source:         services.RegistryModuleSource(m),
+	}
+	if latest := services.LatestRegistryModuleVersion(versions); latest != nil {
+		resp.LatestVersion = latest.Version
+	}
+	if withVersions {
+		resp.Versions = versions
+	}
+	return &resp, nil
+}
+
+// SearchRegistryModule 查询组织的私有模块列表
+func SearchRegistryModule(c *ctx.ServiceContext, form *forms.SearchRegistryModuleForm) (interface{}, e.Error) {
+	query := services.QueryRegistryModule(c.DB(), c.OrgId)
+	if form.Q != "" {
+		q := fmt.Sprintf("%%%s%%", form.Q)
+		query = query.Where("(namespace LIKE ? OR name LIKE ? OR provider LIKE ?)", q, q, q)
+	}
+	query = query.Order("created_at DESC")
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	modules := make([]models.RegistryModule, 0)
+	if err := p.Scan(&modules); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	results := make([]*resps.RegistryModuleResp, 0, len(modules))
+	for i := range modules {
+		resp, err := registryModuleResp(c.DB(), &modules[i], false)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, resp)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     results,
+	}, nil
+}
+
+// CreateRegistryModule 创建私有模块，并将代码仓库中 semver 格式的 tag 发布为模块版本
+func CreateRegistryModule(c *ctx.ServiceContext, form *forms.CreateRegistryModuleForm) (resp *resps.RegistryModuleResp, er e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create registry module %s/%s/%s", form.Namespace, form.Name, form.Provider))
+
+	if _, err := checkOrgVcsAuth(c, form.VcsId); err != nil {
+		return nil, err
+	}
+
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		m, err := services.CreateRegistryModule(tx, models.RegistryModule{
+			OrgId:       c.OrgId,
+			Namespace:   form.Namespace,
+			Name:        form.Name,
+			Provider:    form.Provider,
+			Description: form.Description,
+			VcsId:       form.VcsId,
+			RepoId:      form.RepoId,
+			Workdir:     form.Workdir,
+			CreatorId:   c.UserId,
+		})
+		if err != nil {
+			er = err
+			return er
+		}
+		if _, err := services.SyncRegistryModuleVersions(tx, m); err != nil {
+			er = err
+			return er
+		}
+		resp, er = registryModuleResp(tx, m, true)
+		return er
+	})
+	return resp, er
+}
+
+// RegistryModuleDetail 私有模块详情，包含所有版本
+func RegistryModuleDetail(c *ctx.ServiceContext, form *forms.DetailRegistryModuleForm) (*resps.RegistryModuleResp, e.Error) {
+	m, err := services.GetRegistryModuleById(c.DB(), c.OrgId, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return registryModuleResp(c.DB(), m, true)
+}
+
+// UpdateRegistryModule 修改私有模块
+func UpdateRegistryModule(c *ctx.ServiceContext, form *forms.UpdateRegistryModuleForm) (*models.RegistryModule, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update registry module %s", form.Id))
+
+	if _, err := services.GetRegistryModuleById(c.DB(), c.OrgId, form.Id); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+	if form.HasKey("workdir") {
+		attrs["workdir"] = form.Workdir
+	}
+	return services.UpdateRegistryModule(c.DB(), c.OrgId, form.Id, attrs)
+}
+
+// DeleteRegistryModule 删除私有模块
+func DeleteRegistryModule(c *ctx.ServiceContext, form *forms.DeleteRegistryModuleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete registry module %s", form.Id))
+
+	if _, err := services.GetRegistryModuleById(c.DB(), c.OrgId, form.Id); err != nil {
+		return nil, err
+	}
+	if err := c.DB().Transaction(func(tx *db.Session) error {
+		return services.DeleteRegistryModule(tx, c.OrgId, form.Id)
+	}); err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+	return nil, nil
+}
+
+// SyncRegistryModule 将代码仓库中新增的 semver 格式 tag 发布为模块版本，返回新增的版本
+func SyncRegistryModule(c *ctx.ServiceContext, form *forms.SyncRegistryModuleForm) ([]models.RegistryModuleVersion, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("sync registry module %s versions", form.Id))
+
+	m, err := services.GetRegistryModuleById(c.DB(), c.OrgId, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return services.SyncRegistryModuleVersions(c.DB(), m)
+}
+
+// SearchRegistryModuleUsage 查询使用私有模块的云模板及版本
+func SearchRegistryModuleUsage(c *ctx.ServiceContext, form *forms.SearchRegistryModuleUsageForm) (interface{}, e.Error) {
+	if _, err := services.GetRegistryModuleById(c.DB(), c.OrgId, form.Id); err != nil {
+		return nil, err
+	}
+
+	query := services.QueryRegistryModuleUsage(c.DB(), form.Id)
+	if form.Version != "" {
+		query = query.Where("iac_registry_module_usage.version = ?", strings.TrimPrefix(form.Version, "v"))
+	}
+	query = query.Order("iac_registry_module_usage.last_used_at DESC")
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	usages := make([]resps.RegistryModuleUsageResp, 0)
+	if err := p.Scan(&usages); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     usages,
+	}, nil
+}
+
+// RegistryProtocolList 按 registry 协议返回组织的模块列表，每个模块返回最新版本
+func RegistryProtocolList(c *ctx.ServiceContext, form *forms.RegistryProtocolListForm) (*resps.RegistryProtocolModuleList, e.Error) {
+	limit := form.Limit
+	if limit == 0 {
+		limit = 10
+	}
+
+	query := services.QueryRegistryModule(c.DB(), c.OrgId)
+	if form.Namespace != "" {
+		query = query.Where("namespace = ?", form.Namespace)
+	}
+	if form.Provider != "" {
+		query = query.Where("provider = ?", form.Provider)
+	}
+	total, err := query.Count()
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	modules := make([]models.RegistryModule, 0)
+	if err := query.Order("namespace, name, provider").Offset(form.Offset).Limit(limit).Find(&modules); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	result := resps.RegistryProtocolModuleList{
+		Meta: resps.RegistryProtocolMeta{
+			Limit:         limit,
+			CurrentOffset: form.Offset,
+		},
+		Modules: make([]resps.RegistryProtocolModule, 0, len(modules)),
+	}
+	if next := form.Offset + limit; int64(next) < total {
+		result.Meta.NextOffset = &next
+	}
+	if form.Offset > 0 {
+		prev := form.Offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		result.Meta.PrevOffset = &prev
+	}
+
+	for i := range modules {
+		versions, er := services.GetRegistryModuleVersions(c.DB(), modules[i].Id)
+		if er != nil {
+			return nil, er
+		}
+		if latest := services.LatestRegistryModuleVersion(versions); latest != nil {
+			result.Modules = append(result.Modules, services.RegistryProtocolModule(&modules[i], latest))
+		}
+	}
+	return &result, nil
+}
+
+// RegistryProtocolVersions 按 registry 协议返回模块的所有版本
+func RegistryProtocolVersions(c *ctx.ServiceContext, form *forms.RegistryProtocolModuleForm) (*resps.RegistryProtocolVersionList, e.Error) {
+	m, err := services.GetRegistryModuleBySource(c.DB(), c.OrgId, form.Namespace, form.Name, form.Provider)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := services.GetRegistryModuleVersions(c.DB(), m.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	mv := resps.RegistryProtocolModuleVersions{
+		Source:   services.RegistryModuleSource(m),
+		Versions: make([]resps.RegistryProtocolVersion, 0, len(versions)),
+	}
+	for _, v := range versions {
+		mv.Versions = append(mv.Versions, resps.RegistryProtocolVersion{Version: v.Version})
+	}
+	return &resps.RegistryProtocolVersionList{Modules: []resps.RegistryProtocolModuleVersions{mv}}, nil
+}
+
+// RegistryProtocolLatestVersion 返回模块的最新版本号
+func RegistryProtocolLatestVersion(c *ctx.ServiceContext, form *forms.RegistryProtocolModuleForm) (string, e.Error) {
+	m, err := services.GetRegistryModuleBySource(c.DB(), c.OrgId, form.Namespace, form.Name, form.Provider)
+	if err != nil {
+		return "", err
+	}
+	versions, err := services.GetRegistryModuleVersions(c.DB(), m.Id)
+	if err != nil {
+		return "", err
+	}
+	latest := services.LatestRegistryModuleVersion(versions)
+	if latest == nil {
+		return "", e.New(e.RegistryModuleVersionNotExist, fmt.Errorf("module '%s' has no version", m.Source()), http.StatusNotFound)
+	}
+	return latest.Version, nil
+}
+
+// RegistryModuleArchive 校验下载链接中的 token 并将模块版本打包写入 w
+func RegistryModuleArchive(c *ctx.ServiceContext, form *forms.RegistryModuleArchiveForm, w io.Writer) e.Error {
+	claims, err := services.VerifyRegistryArchiveToken(form.Token)
+	if err != nil {
+		return err
+	}
+	m, err := services.GetRegistryModuleById(c.DB(), claims.OrgId, claims.ModuleId)
+	if err != nil {
+		return err
+	}
+	v, err := services.GetRegistryModuleVersion(c.DB(), m.Id, claims.Version)
+	if err != nil {
+		return err
+	}
+	return services.WriteRegistryModuleArchive(c.DB(), m, v, w)
+}
+
+// RegistryProtocolDownload 返回模块版本的下载地址，并记录云模板对该版本的使用
+func RegistryProtocolDownload(c *ctx.ServiceContext, form *forms.RegistryProtocolModuleForm,
+	version string, claims *services.RegistryClaims) (string, e.Error) {
+	m, err := services.GetRegistryModuleBySource(c.DB(), c.OrgId, form.Namespace, form.Name, form.Provider)
+	if err != nil {
+		return "", err
+	}
+	v, err := services.GetRegistryModuleVersion(c.DB(), m.Id, version)
+	if err != nil {
+		return "", err
+	}
+	source, err := services.GetRegistryModuleDownloadSource(m, v)
+	if err != nil {
+		return "", err
+	}
+
+	if er := services.RecordRegistryModuleDownload(c.DB(), v, claims); er != nil {
+		// 使用记录失败不影响模块下载
+		c.Logger().Warnf("record registry module download: %v", er)
+	}
+	return source, nil
+}
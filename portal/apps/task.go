@@ -14,6 +14,7 @@ import (
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/models/resps"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"context"
@@ -21,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"path"
 	"sort"
 	"strconv"
@@ -101,6 +103,9 @@ func TaskDetail(c *ctx.ServiceContext, form forms.DetailTaskForm) (*resps.TaskDe
 		Task:    desensitize.NewTask(*task),
 		Creator: user.Name,
 	}
+	if o.Approval, err = getTaskApprovalResp(c.DB(), task); err != nil {
+		return nil, err
+	}
 
 	// 清除url token
 	// o.RepoAddr, err = replaceVcsToken(o.RepoAddr)
@@ -112,6 +117,85 @@ func TaskDetail(c *ctx.ServiceContext, form forms.DetailTaskForm) (*resps.TaskDe
 	return &o, nil
 }
 
+// getTaskApprovalResp 获取任务的审批策略、待审批人及审批记录
+func getTaskApprovalResp(query *db.Session, task *models.Task) (*resps.TaskApprovalResp, e.Error) {
+	approvals, err := services.GetTaskApprovals(query, task.Id)
+	if err != nil {
+		return nil, err
+	}
+	var policy *models.ApprovalPolicy
+	if task.ApprovalPolicyId != "" {
+		policy, err = services.GetApprovalPolicyById(query, task.ApprovalPolicyId)
+		if err != nil && err.Code() != e.ApprovalPolicyNotExist {
+			return nil, err
+		}
+	}
+	if policy == nil && len(approvals) == 0 {
+		return nil, nil
+	}
+
+	resp := &resps.TaskApprovalResp{
+		RequiredApprovals: 1,
+		PendingApprovers:  make([]resps.TaskApprover, 0),
+		Approvals:         make([]resps.TaskApprovalRecord, 0, len(approvals)),
+	}
+	if policy != nil {
+		resp.PolicyId = policy.Id
+		resp.PolicyName = policy.Name
+		resp.RequiredApprovals = policy.RequiredApprovals
+	}
+
+	userIds := make([]models.Id, 0)
+	acted := make(map[models.Id]bool)
+	for _, a := range approvals {
+		userIds = append(userIds, a.UserId)
+		if a.Step == task.CurrStep {
+			acted[a.UserId] = true
+			if a.Action == models.TaskApprovalApproved {
+				resp.Approved += 1
+			}
+		}
+	}
+
+	pending := make([]models.Id, 0)
+	if policy != nil && task.Status == models.TaskApproving {
+		approvers, err := services.GetApprovalPolicyApprovers(query, policy)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range approvers {
+			if acted[id] || (!policy.AllowSelfApproval && id == task.CreatorId) {
+				continue
+			}
+			pending = append(pending, id)
+		}
+		userIds = append(userIds, pending...)
+
+		if step, err := services.GetTaskStep(query, task.Id, task.CurrStep); err == nil {
+			resp.ExpireAt = step.ApprovalExpireAt
+		}
+	}
+
+	users := make([]models.User, 0)
+	if len(userIds) > 0 {
+		if err := query.Model(&models.User{}).Where("id IN (?)", userIds).Find(&users); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	userNames := make(map[models.Id]string, len(users))
+	for _, u := range users {
+		userNames[u.Id] = u.Name
+	}
+
+	for _, id := range pending {
+		resp.PendingApprovers = append(resp.PendingApprovers, resps.TaskApprover{UserId: id, Name: userNames[id]})
+	}
+	for _, a := range approvals {
+		resp.Approvals = append(resp.Approvals, resps.TaskApprovalRecord{TaskApproval: a, Username: userNames[a.UserId]})
+	}
+	return resp, nil
+}
+
 // func replaceVcsToken(old string) (string, e.Error) {
 // 	u, err := url.Parse(old)
 // 	if err != nil {
@@ -204,14 +288,20 @@ func ApproveTask(c *ctx.ServiceContext, form *forms.ApproveTaskForm) (interface{
 		return nil, e.New(e.TaskApproveNotPending, http.StatusBadRequest)
 	}
 
-	// 更新审批状态
+	// 更新审批状态，审批策略在 ApproveTaskStep 中检查
 	step.ApproverId = c.UserId
-	switch form.Action {
-	case forms.TaskActionApproved:
-		err = services.ApproveTaskStep(c.DB(), task.Id, step.Index, c.UserId)
-	case forms.TaskActionRejected:
-		err = services.RejectTaskStep(c.DB(), task.Id, step.Index, c.UserId)
-	}
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		switch form.Action {
+		case forms.TaskActionApproved:
+			err = services.ApproveTaskStep(tx, task.Id, step.Index, c.UserId, form.Comment)
+		case forms.TaskActionRejected:
+			err = services.RejectTaskStep(tx, task.Id, step.Index, c.UserId, form.Comment)
+		}
+		if err != nil {
+			return err
+		}
+		return nil
+	})
 	if err != nil {
 		c.Logger().Errorf("error approve task, err %s", err)
 		return nil, err
@@ -220,6 +310,97 @@ func ApproveTask(c *ctx.ServiceContext, form *forms.ApproveTaskForm) (interface{
 	return nil, nil
 }
 
+// RerunTask 使用源任务的参数重新执行任务
+func RerunTask(c *ctx.ServiceContext, form *forms.RerunTaskForm) (*resps.TaskDetailResp, e.Error) { //nolint:cyclop
+	c.AddLogField("action", fmt.Sprintf("rerun task %s", form.Id))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	var (
+		task     *models.Task
+		env      *models.Env
+		override bool
+	)
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		taskQuery := services.QueryWithProjectId(services.QueryWithOrgId(tx, c.OrgId), c.ProjectId)
+		src, err := services.GetTaskById(taskQuery, form.Id)
+		if err != nil {
+			return e.AutoNew(err, e.TaskNotExists, http.StatusNotFound)
+		}
+		if !src.Exited() {
+			return e.New(e.TaskCannotRerun, fmt.Errorf("task status is '%s'", src.Status), http.StatusConflict)
+		}
+
+		env, err = envCheck(tx, c.OrgId, c.ProjectId, src.EnvId, c.Logger())
+		if err != nil {
+			return err
+		}
+		if src.IsEffectTask() && env.Locked {
+			return e.New(e.EnvLocked, http.StatusBadRequest)
+		}
+
+		resumeStep := 0
+		if form.Resume {
+			if resumeStep, err = getTaskResumeStep(tx, src); err != nil {
+				return err
+			}
+		}
+
+		override, err = checkEnvDeployFreeze(c, tx, env, src.Type, form.FreezeOverrideReason)
+		if err != nil {
+			return err
+		}
+
+		overrideReason := ""
+		if override {
+			overrideReason = form.FreezeOverrideReason
+		}
+		task, err = services.CloneRerunTask(tx, *src, env, c.UserId, resumeStep, overrideReason)
+		if err != nil {
+			c.Logger().Errorf("error rerun task, err %s", err)
+			return err
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.InternalError)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "rerun", env.Name,
+		models.ResAttrs{
+			"taskId":       task.Id,
+			"sourceTaskId": task.SourceTaskId,
+			"resumeStep":   task.ResumeStep,
+		})
+	if override {
+		recordDeployFreezeOverride(c, env, task)
+	}
+	// 设置 commit 状态需要请求 vcs，在事务提交后执行
+	services.SendVcsCommitStatus(c.DB(), task, task.Status)
+
+	return &resps.TaskDetailResp{
+		Task:    desensitize.NewTask(*task),
+		Creator: c.Username,
+	}, nil
+}
+
+// getTaskResumeStep 获取源任务可以恢复执行的步骤，只有执行失败的任务可以从失败的步骤恢复
+func getTaskResumeStep(tx *db.Session, src *models.Task) (int, e.Error) {
+	if src.Status != models.TaskFailed || src.CurrStep <= 0 {
+		return 0, e.New(e.TaskCannotResume, fmt.Errorf("task status is '%s'", src.Status), http.StatusConflict)
+	}
+	step, err := services.GetTaskStep(tx, src.Id, src.CurrStep)
+	if err != nil {
+		return 0, err
+	}
+	if !utils.StrInArray(step.Status, models.TaskStepFailed, models.TaskStepTimeout) {
+		return 0, e.New(e.TaskCannotResume, fmt.Errorf("step status is '%s'", step.Status), http.StatusConflict)
+	}
+	return step.Index, nil
+}
+
 func getTask(sc *ctx.ServiceContext, id models.Id) (models.Tasker, e.Error) {
 	query := services.QueryWithProjectId(services.QueryWithOrgId(sc.DB(), sc.OrgId), sc.ProjectId)
 
@@ -366,6 +547,105 @@ func SearchTaskResources(c *ctx.ServiceContext, form *forms.SearchTaskResourceFo
 	}, nil
 }
 
+// TaskPlanDiff 任务执行计划的资源属性变更
+func TaskPlanDiff(c *ctx.ServiceContext, form *forms.TaskPlanDiffForm) (*resps.PlanDiffResp, e.Error) {
+	query := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	task, err := services.GetTaskById(query, form.Id)
+	if err != nil {
+		return nil, e.AutoNew(err, e.TaskNotExists, http.StatusNotFound)
+	}
+
+	content, er := logstorage.Get().Read(task.PlanJsonPath())
+	if er != nil {
+		if os.IsNotExist(er) {
+			return nil, e.New(e.TaskPlanNotExists, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, er)
+	}
+	diffs, er := services.BuildPlanDiff(content)
+	if er != nil {
+		return nil, e.New(e.InternalError, fmt.Errorf("parse plan json: %v", er))
+	}
+
+	filtered := make([]resps.PlanResourceDiff, 0, len(diffs))
+	for _, d := range diffs {
+		if form.HasKey("module") && d.ModuleAddress != form.Module {
+			continue
+		}
+		if form.Action != "" && d.Action != form.Action {
+			continue
+		}
+		if form.Q != "" && !strings.Contains(d.Address, form.Q) {
+			continue
+		}
+		filtered = append(filtered, d)
+	}
+
+	start := (form.CurrentPage() - 1) * form.PageSize()
+	end := start + form.PageSize()
+	if start > len(filtered) {
+		start = len(filtered)
+	}
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+	return &resps.PlanDiffResp{
+		Total:    int64(len(filtered)),
+		PageSize: form.PageSize(),
+		List:     filtered[start:end],
+		Modules:  services.GroupPlanDiffByModule(diffs),
+	}, nil
+}
+
+// TaskVariablesDiff 对比任务与基准任务生效的变量及执行参数
+func TaskVariablesDiff(c *ctx.ServiceContext, form *forms.TaskVariablesDiffForm) (*resps.TaskVariablesDiffResp, e.Error) {
+	query := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	task, err := services.GetTaskById(query, form.Id)
+	if err != nil {
+		return nil, e.AutoNew(err, e.TaskNotExists, http.StatusNotFound)
+	}
+	base, err := services.GetTaskById(query, form.Base)
+	if err != nil {
+		return nil, e.AutoNew(err, e.TaskNotExists, http.StatusNotFound)
+	}
+
+	diffs := services.DiffTaskVariables(base.Variables, task.Variables)
+
+	// 补充变量修改人名称
+	userIds := make([]models.Id, 0)
+	for _, d := range diffs {
+		for _, v := range []*resps.TaskVariableValue{d.Base, d.Target} {
+			if v != nil && v.UpdaterId != "" {
+				userIds = append(userIds, v.UpdaterId)
+			}
+		}
+	}
+	if len(userIds) > 0 {
+		users := make([]models.User, 0)
+		if err := services.QueryUser(c.DB()).Where("id IN (?)", userIds).Find(&users); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		names := make(map[models.Id]string, len(users))
+		for _, u := range users {
+			names[u.Id] = u.Name
+		}
+		for _, d := range diffs {
+			for _, v := range []*resps.TaskVariableValue{d.Base, d.Target} {
+				if v != nil {
+					v.UpdaterName = names[v.UpdaterId]
+				}
+			}
+		}
+	}
+
+	return &resps.TaskVariablesDiffResp{
+		BaseTaskId: base.Id,
+		TaskId:     task.Id,
+		Fields:     services.DiffTaskFields(base, task),
+		Variables:  diffs,
+	}, nil
+}
+
 func SearchTaskSteps(c *ctx.ServiceContext, form *forms.DetailTaskStepForm) (interface{}, e.Error) {
 	query := services.QueryTaskStepsById(c.DB(), form.TaskId)
 	details := make([]*resps.TaskStepDetail, 0)
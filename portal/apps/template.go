@@ -75,6 +75,10 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 		Triggers:     form.TplTriggers,
 		KeyId:        form.KeyId,
 		Source:       form.Source,
+
+		PreviewEnable:    form.PreviewEnable,
+		PreviewProjectId: form.PreviewProjectId,
+		PreviewTTL:       form.PreviewTTL,
 	})
 
 	if err != nil {
@@ -104,6 +108,10 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 		_ = tx.Rollback()
 		return nil, err
 	}
+	if err := services.CheckTemplatePreview(tx, template); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
 	{
 		updateVarsForm := forms.UpdateObjectVarsForm{
 			Scope:     consts.ScopeTemplate,
@@ -139,7 +147,7 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 	}
 
 	// 设置 webhook
-	if err := setVcsRepoWebhook(c, template.VcsId, template.RepoId, form.TplTriggers); err != nil {
+	if err := setVcsRepoWebhook(c, template.VcsId, template.RepoId, getTplWebhookTriggers(template)); err != nil {
 		c.Logger().Errorf("set webhook err :%v", err)
 	}
 
@@ -187,6 +195,23 @@ func setAttrsByFormKeys(attrs models.Attrs, form *forms.UpdateTemplateForm) {
 	if form.HasKey("keyId") {
 		attrs["keyId"] = form.KeyId
 	}
+	if form.HasKey("previewEnable") {
+		attrs["previewEnable"] = form.PreviewEnable
+	}
+	if form.HasKey("previewProjectId") {
+		attrs["previewProjectId"] = form.PreviewProjectId
+	}
+	if form.HasKey("previewTTL") {
+		attrs["previewTTL"] = form.PreviewTTL
+	}
+}
+
+// getTplWebhookTriggers 获取云模板需要设置的 webhook 触发器，开启 PR 预览环境时需要接收 PR 事件
+func getTplWebhookTriggers(tpl *models.Template) pq.StringArray {
+	if tpl.PreviewEnable && !utils.StrInArray(consts.EnvTriggerPRMR, tpl.Triggers...) {
+		return append(pq.StringArray{consts.EnvTriggerPRMR}, tpl.Triggers...)
+	}
+	return tpl.Triggers
 }
 
 func setAttrsVcsInfoByForm(attrs models.Attrs, form *forms.UpdateTemplateForm) {
@@ -240,7 +265,7 @@ func updatetplByFormKey(c *ctx.ServiceContext, tx *db.Session, tpl *models.Templ
 
 	if form.HasKey("varGroupIds") || form.HasKey("delVarGroupIds") {
 		// 创建变量组与实例的关系
-		err = services.BatchUpdateRelationship(tx, form.VarGroupIds, form.DelVarGroupIds, consts.ScopeTemplate, form.Id.String())
+		err = updateVarGroupRelationship(c, tx, form.VarGroupIds, form.DelVarGroupIds, consts.ScopeTemplate, form.Id)
 	}
 	return err
 }
@@ -272,10 +297,15 @@ func UpdateTemplate(c *ctx.ServiceContext, form *forms.UpdateTemplateForm) (*mod
 			panic(r)
 		}
 	}()
+	tplBefore := *tpl
 	if tpl, err = services.UpdateTemplate(tx, form.Id, attrs); err != nil {
 		_ = tx.Rollback()
 		return nil, err
 	}
+	if err = services.RecordTemplateChanges(tx, &tplBefore, tpl, c.UserId, c.RequestId); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
 
 	// 更新和策略组的绑定关系
 	err = updatetplByFormKey(c, tx, tpl, form)
@@ -283,6 +313,10 @@ func UpdateTemplate(c *ctx.ServiceContext, form *forms.UpdateTemplateForm) (*mod
 		_ = tx.Rollback()
 		return nil, err
 	}
+	if err = services.CheckTemplatePreview(tx, tpl); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -303,7 +337,7 @@ func UpdateTemplate(c *ctx.ServiceContext, form *forms.UpdateTemplateForm) (*mod
 	}
 
 	// 设置 webhook
-	if err := setVcsRepoWebhook(c, tpl.VcsId, tpl.RepoId, tpl.Triggers); err != nil {
+	if err := setVcsRepoWebhook(c, tpl.VcsId, tpl.RepoId, getTplWebhookTriggers(tpl)); err != nil {
 		c.Logger().Errorf("set webhook err :%v", err)
 	}
 
@@ -612,3 +646,32 @@ func setVcsRepoWebhook(c *ctx.ServiceContext, vcsId models.Id, repoId string, tr
 func delVcsRepoWebhook(c *ctx.ServiceContext, vcsId models.Id, repoId string) error {
 	return setVcsRepoWebhook(c, vcsId, repoId, []string{})
 }
+
+// TemplateVariableSchema 解析云模板代码中的 terraform 变量定义并生成 JSON Schema
+func TemplateVariableSchema(c *ctx.ServiceContext, form *forms.TemplateVariableSchemaForm) (*services.TfVariableSchemaResult, e.Error) {
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, workdir := tpl.RepoRevision, tpl.Workdir
+	if form.HasKey("revision") {
+		revision = form.Revision
+	}
+	if form.HasKey("workdir") {
+		workdir = form.Workdir
+	}
+
+	repo, err := services.GetVcsRepoByTplId(c.DB(), tpl.Id)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := services.GetTfVariableSchemas(repo, revision, workdir)
+	if err != nil {
+		return nil, err
+	}
+	return &services.TfVariableSchemaResult{
+		Variables:  schemas,
+		JSONSchema: services.TfVariablesJSONSchema(schemas),
+	}, nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// getOrgTemplate 查询当前组织下的云模板
+func getOrgTemplate(c *ctx.ServiceContext, tplId models.Id) (*models.Template, e.Error) {
+	tpl, err := services.GetTemplateById(c.DB(), tplId)
+	if err != nil {
+		if err.Code() == e.TemplateNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if tpl.OrgId != c.OrgId {
+		return nil, e.New(e.TemplateNotExists, http.StatusNotFound)
+	}
+	return tpl, nil
+}
+
+// SearchTemplateVersion 查询云模板版本列表，按版本号从高到低排序
+func SearchTemplateVersion(c *ctx.ServiceContext, form *forms.SearchTemplateVersionForm) (interface{}, e.Error) {
+	if _, err := getOrgTemplate(c, form.Id); err != nil {
+		return nil, err
+	}
+	return services.GetTemplateVersions(c.DB(), form.Id)
+}
+
+// CreateTemplateVersion 发布云模板版本
+func CreateTemplateVersion(c *ctx.ServiceContext, form *forms.CreateTemplateVersionForm) (*models.TemplateVersion, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create template %s version %s", form.Id, form.Version))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := form.Revision
+	if revision == "" {
+		revision = form.Version
+	}
+	return services.CreateTemplateVersion(c.DB(), models.TemplateVersion{
+		OrgId:     tpl.OrgId,
+		TplId:     tpl.Id,
+		Version:   form.Version,
+		Revision:  revision,
+		Changelog: form.Changelog,
+		Source:    models.TemplateVersionSourceRelease,
+		CreatorId: c.UserId,
+	})
+}
+
+// UpdateTemplateVersion 修改云模板版本的变更说明
+func UpdateTemplateVersion(c *ctx.ServiceContext, form *forms.UpdateTemplateVersionForm) (*models.TemplateVersion, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update template %s version %s", form.Id, form.VersionId))
+
+	if _, err := getOrgTemplate(c, form.Id); err != nil {
+		return nil, err
+	}
+	if _, err := services.GetTemplateVersionById(c.DB(), form.Id, form.VersionId); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("changelog") {
+		attrs["changelog"] = form.Changelog
+	}
+	return services.UpdateTemplateVersion(c.DB(), form.Id, form.VersionId, attrs)
+}
+
+// DeleteTemplateVersion 删除云模板版本，已锁定该版本的环境不受影响
+func DeleteTemplateVersion(c *ctx.ServiceContext, form *forms.DeleteTemplateVersionForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete template %s version %s", form.Id, form.VersionId))
+
+	if _, err := getOrgTemplate(c, form.Id); err != nil {
+		return nil, err
+	}
+	if _, err := services.GetTemplateVersionById(c.DB(), form.Id, form.VersionId); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteTemplateVersion(c.DB(), form.VersionId); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// SyncTemplateVersion 从代码仓库同步 semver 格式的 tag 作为云模板版本
+func SyncTemplateVersion(c *ctx.ServiceContext, form *forms.SyncTemplateVersionForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("sync template %s versions", form.Id))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []models.TemplateVersion
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		var err e.Error
+		if versions, err = services.SyncTemplateVersionTags(tx, tpl, c.UserId); err != nil {
+			return err
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.DBError)
+	}
+	return versions, nil
+}
+
+// TemplateOutdatedEnvs 查询锁定的版本落后于云模板最新版本的环境
+func TemplateOutdatedEnvs(c *ctx.ServiceContext, form *forms.TemplateOutdatedEnvsForm) (interface{}, e.Error) {
+	if _, err := getOrgTemplate(c, form.Id); err != nil {
+		return nil, err
+	}
+	return services.GetOutdatedEnvs(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+}
@@ -25,6 +25,22 @@ func BatchUpdate(c *ctx.ServiceContext, form *forms.BatchUpdateVariableForm) (in
 			panic(r)
 		}
 	}()
+	for scope, objectId := range map[string]models.Id{consts.ScopeTemplate: form.TplId, consts.ScopeEnv: form.EnvId} {
+		if objectId == "" {
+			continue
+		}
+		vars := make([]models.VariableBody, 0)
+		for _, v := range form.Variables {
+			if v.Scope == scope {
+				vars = append(vars, models.VariableBody{Type: v.Type, Name: v.Name, Value: v.Value, Sensitive: v.Sensitive})
+			}
+		}
+		if err := checkObjectTfVars(tx, scope, objectId, vars); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
 	err := services.OperationVariables(tx, c.OrgId, c.ProjectId, form.TplId, form.EnvId, form.Variables, form.DeleteVariablesId)
 	if err != nil {
 		c.Logger().Errorf("error creating variable, err %s", err)
@@ -111,6 +127,41 @@ func getObjectVars(tx *db.Session, form *forms.UpdateObjectVarsForm, orgId, proj
 	return vars, nil
 }
 
+// checkObjectTfVars 使用云模板代码中的变量定义检查云模板、环境的 terraform 变量值
+func checkObjectTfVars(tx *db.Session, scope string, objectId models.Id, vars []models.VariableBody) e.Error {
+	var (
+		tplId             models.Id
+		revision, workdir string
+	)
+	switch scope {
+	case consts.ScopeTemplate:
+		tpl, err := services.GetTemplateById(tx, objectId)
+		if err != nil {
+			return err
+		}
+		tplId, revision, workdir = tpl.Id, tpl.RepoRevision, tpl.Workdir
+	case consts.ScopeEnv:
+		env, err := services.GetEnvById(tx, objectId)
+		if err != nil {
+			return err
+		}
+		tplId, revision, workdir = env.TplId, env.Revision, env.Workdir
+	default:
+		// 组织、项目变量在创建任务时检查
+		return nil
+	}
+
+	checkVars := make([]models.VariableBody, 0, len(vars))
+	for _, v := range vars {
+		// sensitive 变量传入空值表示不修改其值
+		if v.Sensitive && v.Value == "" {
+			continue
+		}
+		checkVars = append(checkVars, v)
+	}
+	return services.CheckTplTfVariables(tx, tplId, revision, workdir, checkVars)
+}
+
 func updateObjectVars(c *ctx.ServiceContext, tx *db.Session, form *forms.UpdateObjectVarsForm) (interface{}, e.Error) {
 	var (
 		orgId     = c.OrgId
@@ -134,13 +185,32 @@ func updateObjectVars(c *ctx.ServiceContext, tx *db.Session, form *forms.UpdateO
 	if err != nil {
 		return nil, err
 	}
+	for i := range vars {
+		vars[i].UpdaterId = c.UserId
+	}
+
+	bodies := make([]models.VariableBody, 0, len(vars))
+	for _, v := range vars {
+		bodies = append(bodies, v.VariableBody)
+	}
+	if err := checkObjectTfVars(tx, scope, objectId, bodies); err != nil {
+		return nil, err
+	}
 
 	tx = services.QueryWithOrgId(tx, c.OrgId)
+	beforeVars, err := services.GetObjectVariables(tx, scope, objectId)
+	if err != nil {
+		return nil, err
+	}
 	retVars, err := services.UpdateObjectVars(tx, scope, objectId, vars)
 	if err != nil {
 		c.Logger().Warnf("update object %s(%s) vars error: %v", form.Scope, form.ObjectId, err)
 		return nil, e.AutoNew(err, e.InternalError)
 	}
+	changes := services.DiffVariables(beforeVars, retVars)
+	if err := services.CreateChangeHistory(tx, c.OrgId, scope, objectId, c.UserId, c.RequestId, changes); err != nil {
+		return nil, err
+	}
 	return services.VarsDesensitization(retVars), nil
 }
 
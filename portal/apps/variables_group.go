@@ -308,6 +308,12 @@ func BatchUpdateRelationship(c *ctx.ServiceContext, form *forms.BatchUpdateRelat
 		}
 	}()
 
+	vgIdsBefore, err := services.GetObjectVarGroupIds(tx, form.ObjectType, form.ObjectId)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
 	if err := services.DeleteRelationship(tx, form.DelVarGroupIds); err != nil {
 		_ = tx.Rollback()
 		return nil, err
@@ -329,6 +335,10 @@ func BatchUpdateRelationship(c *ctx.ServiceContext, form *forms.BatchUpdateRelat
 		_ = tx.Rollback()
 		return nil, err
 	}
+	if err := recordVarGroupChanges(c, tx, vgIdsBefore, form.ObjectType, form.ObjectId); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -302,6 +302,31 @@ func VcsVariableSearch(c *ctx.ServiceContext, form *forms.TemplateVariableSearch
 	return tvl, nil
 }
 
+// VcsVariableSchema 解析代码仓库中的 terraform 变量定义并生成 JSON Schema
+func VcsVariableSchema(c *ctx.ServiceContext, form *forms.TemplateVariableSearchForm) (*services.TfVariableSchemaResult, e.Error) {
+	vcs, err := services.QueryVcsByVcsId(form.VcsId, c.DB())
+	if err != nil {
+		return nil, err
+	}
+
+	vcsService, er := vcsrv.GetVcsInstance(vcs)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+	repo, er := vcsService.GetRepo(form.RepoId)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+	schemas, err := services.GetTfVariableSchemas(repo, form.RepoRevision, form.Workdir)
+	if err != nil {
+		return nil, err
+	}
+	return &services.TfVariableSchemaResult{
+		Variables:  schemas,
+		JSONSchema: services.TfVariablesJSONSchema(schemas),
+	}, nil
+}
+
 func GetVcsRepoFile(c *ctx.ServiceContext, form *forms.GetVcsRepoFileForm) (interface{}, e.Error) {
 	vcs, err := checkOrgVcsAuth(c, form.Id)
 	if err != nil {
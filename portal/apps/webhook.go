@@ -12,6 +12,7 @@ import (
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
 	"net/http"
 	"strconv"
 	"strings"
@@ -33,9 +34,14 @@ type webhookOptions struct {
 	AfterCommit  string
 	BeforeCommit string
 	PrId         int
+
+	PrAction   string // 统一后的 PR 事件类型，用于处理预览环境
+	HeadCommit string // PR 源分支最新 commit
 }
 
-func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOptions) {
+// searchTplEnv 处理云模板及其环境的 webhook 触发，返回 PR 触发的 plan 任务
+func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOptions) []*models.Task {
+	prPlanTasks := make([]*models.Task, 0)
 
 	for tIndex, tpl := range tplList {
 		sysUserId := models.Id(consts.SysUserId)
@@ -44,6 +50,13 @@ func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOpti
 			createTplScan(sysUserId, &tplList[tIndex], options)
 		}
 
+		if tpl.PreviewEnable && options.PrId != 0 && options.PrAction != "" {
+			if er := actionPreviewEnv(tx, sysUserId, &tplList[tIndex], options); er != nil {
+				logs.Get().WithField("webhook", "previewEnv").
+					Errorf("process preview env er: %v, tplId: %s, prId: %d", er, tpl.Id, options.PrId)
+			}
+		}
+
 		envs, err := services.GetEnvByTplId(tx, tpl.Id)
 		if err != nil {
 			logs.Get().WithField("webhook", "searchEnv").
@@ -58,16 +71,25 @@ func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOpti
 				continue
 			}
 			for _, v := range env.Triggers {
-				if er := actionPrOrPush(tx, v, sysUserId, &envs[eIndex], &tplList[tIndex], options); er != nil {
+				task, er := actionPrOrPush(tx, v, sysUserId, &envs[eIndex], &tplList[tIndex], options)
+				if er != nil {
 					logs.Get().WithField("webhook", "createTask").
 						Errorf("create task er: %v, envId: %s", er, env.Id)
+				} else if task != nil && task.Type == models.TaskTypePlan && options.PrId != 0 {
+					prPlanTasks = append(prPlanTasks, task)
 				}
 			}
 		}
 	}
+	return prPlanTasks
 }
 
-func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (interface{}, e.Error) {
+func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (_ interface{}, er e.Error) {
+	vcsType := "unknown"
+	defer func() {
+		metrics.WebhookDeliveries.WithLabelValues(vcsType, metrics.Result(er)).Inc()
+	}()
+
 	tx := c.Tx()
 	defer func() {
 		if r := recover(); r != nil {
@@ -83,6 +105,7 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		c.Logger().Errorf("webhook get vcs err: %s", err)
 		return nil, e.New(e.DBError, err)
 	}
+	vcsType = vcs.VcsType
 
 	// 根据VcsId & 仓库Id查询对应的云模板
 	tplList, err := services.QueryTemplateByVcsIdAndRepoId(tx, form.VcsId, getVcsRepoId(vcs.VcsType, form))
@@ -99,6 +122,8 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		AfterCommit:  form.After,
 		BeforeCommit: form.Before,
 		PrId:         form.PullRequest.Number,
+		PrAction:     getPrAction(vcs.VcsType, form),
+		HeadCommit:   form.PullRequest.Head.Sha,
 	}
 
 	if vcs.VcsType == consts.GitTypeGitLab {
@@ -106,10 +131,11 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		options.HeadRef = form.ObjectAttributes.SourceBranch
 		options.PrStatus = form.ObjectAttributes.State
 		options.PrId = form.ObjectAttributes.Iid
+		options.HeadCommit = form.ObjectAttributes.LastCommit.Id
 	}
 
 	// 查询云模板对应的环境
-	searchTplEnv(tx, tplList, options)
+	prPlanTasks := searchTplEnv(tx, tplList, options)
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -117,6 +143,11 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		return nil, e.New(e.DBError, err)
 	}
 
+	// 设置 commit 状态需要请求 vcs，在事务提交后执行
+	for _, task := range prPlanTasks {
+		services.SendVcsCommitStatus(c.DB(), task, task.Status)
+	}
+
 	return nil, err
 }
 
@@ -132,13 +163,13 @@ type CreateWebhookTaskParam struct {
 }
 
 //nolint
-func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
+func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) (*models.Task, error) {
 	env := param.Env
 	// 计算变量列表
 	vars, er := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
 	if er != nil {
 		_ = tx.Rollback()
-		return e.New(e.DBError, er, http.StatusInternalServerError)
+		return nil, e.New(e.DBError, er, http.StatusInternalServerError)
 	}
 	task := &models.Task{
 		Name:        models.Task{}.GetTaskNameByType(param.TaskType),
@@ -161,10 +192,11 @@ func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
 	if err != nil {
 		_ = tx.Rollback()
 		logs.Get().Errorf("error creating task, err %s", err)
-		return e.New(err.Code(), err, http.StatusInternalServerError)
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 
-	if param.PrId != 0 && param.TaskType == models.TaskTypePlan {
+	// 预览环境的任务结果同样需要写入 PR 评论
+	if param.PrId != 0 && (param.TaskType == models.TaskTypePlan || env.PreviewPrId != 0) {
 		// 创建pr与作业的关系
 		if err := services.CreateVcsPr(tx, models.VcsPr{
 			PrId:   param.PrId,
@@ -173,11 +205,11 @@ func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
 			VcsId:  param.Tpl.VcsId,
 		}); err != nil {
 			logs.Get().Errorf("error creating vcs pr, err %s", err)
-			return e.New(err.Code(), err, http.StatusInternalServerError)
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 		}
 	}
 	logs.Get().Infof("create webhook task success. envId:%s, task type: %s", env.Id, param.TaskType)
-	return nil
+	return task, nil
 }
 
 func checkVcsCallbackMessage(revision, pushRef, baseRef string) bool {
@@ -191,13 +223,13 @@ func checkVcsCallbackMessage(revision, pushRef, baseRef string) bool {
 }
 
 func actionPrOrPush(tx *db.Session, trigger string, userId models.Id,
-	env *models.Env, tpl *models.Template, options webhookOptions) error {
+	env *models.Env, tpl *models.Template, options webhookOptions) (*models.Task, error) {
 
 	if !checkVcsCallbackMessage(env.Revision, options.PushRef, options.BaseRef) {
 		logs.Get().WithField("webhook", "createTask").
 			Infof("tplId: %s, envId: %s, revision don't match, env.revision: %s, %s or %s",
 				env.TplId, env.Id, env.Revision, options.PushRef, options.BaseRef)
-		return nil
+		return nil, nil
 	}
 
 	// 判断pr类型并确认动作
@@ -220,7 +252,7 @@ func actionPrOrPush(tx *db.Session, trigger string, userId models.Id,
 	if trigger == consts.EnvTriggerCommit && options.BeforeCommit != "" {
 		if env.Locked {
 			logs.Get().WithField("webhook", "createTask").Errorf("env %s is locked don't allow apply", env.Id)
-			return nil
+			return nil, nil
 		}
 
 		param := CreateWebhookTaskParam{
@@ -236,7 +268,7 @@ func actionPrOrPush(tx *db.Session, trigger string, userId models.Id,
 		return CreateWebhookTask(tx, param)
 	}
 
-	return nil
+	return nil, nil
 }
 
 func getVcsRepoId(vcsType string, form forms.WebhooksApiHandler) string {
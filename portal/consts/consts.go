@@ -43,13 +43,27 @@ const (
 	UserEmailINActivate = "inactive" // 用于账号激活
 	UserEmailActivate   = "active"   // 用于账号激活
 
+	JwtSubjectEnvExtend       = "envExtend"       // 用于环境延期链接
+	JwtSubjectRegistry        = "registry"        // 用于 runner 访问私有模块 registry
+	JwtSubjectRegistryArchive = "registryArchive" // 用于私有模块的下载链接
+
 	DirRoot                          = "/"
 	PolicyGroupDownloadTimeoutSecond = 20 * time.Second
 	PolicySeverityHigh               = "HIGH"
 	PolicySeverityMedium             = "MEDIUM"
 	PolicySeverityLow                = "LOW"
 
-	RegistryMirrorUri = "/v1/mirrors/providers/"
+	RegistryMirrorUri  = "/v1/mirrors/providers/"
+	RegistryModulesUri = "/v1/modules/"
+	RegistryArchiveUri = "/v1/module_archives/"
+	// provider 地址中省略 hostname 时默认的 registry
+	ProviderDefaultHostname = "registry.terraform.io"
+	// runner 访问私有 registry 的 token 有效期，需要覆盖任务等待审批的时间
+	RegistryTokenExpire = 7 * 24 * time.Hour
+	// 私有模块下载链接的有效期，链接在 registry 协议的 download 请求中生成并立即使用
+	RegistryArchiveExpire = 10 * time.Minute
+
+	CtxKeyRegistryClaims = "registryClaims" // 私有 registry 请求中 runner token 的 claims
 
 	AuthRegisterActivationPath = "/activation/"
 	AuthPasswordResetPath      = "/find-password/"
@@ -142,8 +156,9 @@ const (
 
 	EnvAbortManager = ""
 
-	EnvMaxTagLength = 20
-	EnvMaxTagNum    = 5
+	EnvMaxTagLength    = 64 // 标签 value 的最大长度
+	EnvMaxTagKeyLength = 64
+	EnvMaxTagNum       = 10
 
 	EventTaskFailed    = "task.failed"
 	EventTaskComplete  = "task.complete"
@@ -152,22 +167,43 @@ const (
 	EventTaskRejected  = "task.rejected"
 	EvenvtCronDrift    = "task.crondrift"
 
+	EventDriftRemediation = "task.driftremediation" // 检测到漂移，纠偏任务等待审批
+
+	EventBudgetThreshold = "budget.threshold" // 费用达到预算阈值
+	EventEnvExpiring     = "env.expiring"     // 环境即将自动销毁
+
+	EnvExtendDefaultDuration = "1d" // 销毁提醒中延期链接的默认延期时间
+
+	EnvBatchMaxEnvs     = 200 // 单次批量操作最多包含的环境数量
+	EnvBatchDefaultRate = 10  // 批量操作默认每分钟创建的任务数
+	EnvBatchMaxRate     = 60
+
+	EnvDriftRunKeepDuration = 90 * 24 * time.Hour // 漂移检测记录的保留时间
+
+	DriftRemediationDefaultTimeout = 24 * 60 // 纠偏任务默认的审批超时时间(分钟)
+	DriftRemediationMaxTimeout     = 30 * 24 * 60
+	DriftRemediationSummaryMaxRes  = 20 // 漂移摘要中最多列出的资源数量
+
 	DefaultTfMirror   = "https://releases.hashicorp.com/terraform"
 	HttpClientTimeout = 20
 
 	TaskCallbackKafka = "kafka"
 
-	TaskSourceManual       = "manual"
-	TaskSourceDriftPlan    = "driftPlan"
-	TaskSourceDriftApply   = "driftApply"
-	TaskSourceWebhookPlan  = "webhookPlan"
-	TaskSourceWebhookApply = "webhookApply"
-	TaskSourceAutoDestroy  = "autoDestroy"
-	TaskSourceAutoDeploy   = "autoDeploy"
-	TaskSourceApi          = "api"
+	TaskSourceManual         = "manual"
+	TaskSourceDriftPlan      = "driftPlan"
+	TaskSourceDriftApply     = "driftApply"
+	TaskSourceWebhookPlan    = "webhookPlan"
+	TaskSourceWebhookApply   = "webhookApply"
+	TaskSourceWebhookDestroy = "webhookDestroy"
+	TaskSourceAutoDestroy    = "autoDestroy"
+	TaskSourceAutoDeploy     = "autoDeploy"
+	TaskSourceApi            = "api"
+	TaskSourceEnvBatch       = "envBatch"
+	TaskSourceDriftRepair    = "driftRepair"
 
 	TaskAutoDestroyName = "Auto Destroy"
 	TaskAutoDeployName  = "Auto Deploy"
+	TaskDriftRepairName = "Drift Remediation"
 
 	BillCollectAli = "alicloud"
 
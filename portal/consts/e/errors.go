@@ -130,6 +130,7 @@ const (
 	InvalidVarName         = 30513
 	EmptyVarName           = 30514
 	EmptyVarValue          = 30515
+	VariableValueInvalid   = 30516
 
 	//// token 306
 	TokenAlreadyExists  = 30610
@@ -145,6 +146,10 @@ const (
 	TemplateDemoNotAllowDelete           = 30715
 	TemplateActiveEnvExists              = 30730
 	TemplateKeyIdNotSet                  = 30731
+	TemplatePreviewProjectInvalid        = 30732
+	TemplateVersionNotExists             = 30733
+	TemplateVersionExists                = 30734
+	TemplateVersionInvalid               = 30735
 
 	//// environment 308
 	EnvAlreadyExists         = 30810
@@ -161,6 +166,25 @@ const (
 	EnvTagNumLimited         = 30821
 	EnvTagLengthLimited      = 30822
 	TemplateNotBind          = 30823
+	EnvPromoteTplMismatch    = 30824
+	EnvPromoteNoSuccessTask  = 30825
+	EnvImportAddressInvalid  = 30826
+	EnvImportTfVersion       = 30827
+	EnvStateOpInvalid        = 30828
+	EnvDeployModeInvalid     = 30829
+	EnvExtendNotAllowed      = 30830
+	EnvExtendExceedLimit     = 30831
+	EnvBatchNotExists        = 30832
+	EnvBatchNoEnvMatched     = 30833
+	EnvBatchTooManyEnvs      = 30834
+	EnvTagInvalid            = 30835
+	EnvTagKeyDuplicate       = 30836
+	EnvTagRequired           = 30837
+	EnvTagValueNotAllowed    = 30838
+	EnvTagSchemaNotExists    = 30839
+	EnvTagSchemaExists       = 30840
+	EnvDriftRunNotExists     = 30841
+	DriftIgnoreRuleNotExists = 30842
 
 	//// task 309
 	TaskAlreadyExists     = 30910
@@ -171,6 +195,10 @@ const (
 	TaskAborting          = 30917
 	TaskAborted           = 30918
 	TaskCannotAbort       = 30919
+	TaskCannotRerun       = 30920
+	TaskCannotResume      = 30921
+	TaskPlanNotExists     = 30922
+	TaskCannotRollback    = 30923
 
 	//// ssh key 310
 	KeyAlreadyExists  = 31010
@@ -229,4 +257,37 @@ const (
 	LdapBindError      = 31713
 	LdapUnknowError    = 31714
 	LdapUserNotExist   = 31715
+
+	// deploy freeze 318
+	DeployFreezeNotExist        = 31810
+	DeployFreezeActive          = 31811
+	DeployFreezeInvalidSchedule = 31812
+	DeployFreezeOverrideDeny    = 31813
+	DeployFreezeReasonRequired  = 31814
+
+	// approval policy 319
+	ApprovalPolicyNotExist = 31910
+	ApprovalPolicyExists   = 31911
+	ApprovalPolicyInvalid  = 31912
+	TaskApproveSelfDeny    = 31913
+	TaskApproveNotAllowed  = 31914
+	TaskApproveDuplicate   = 31915
+
+	// budget 320
+	BudgetNotExist = 32010
+	BudgetExists   = 32011
+	BudgetInvalid  = 32012
+	BudgetExceeded = 32013
+
+	// registry module 321
+	RegistryModuleNotExist        = 32110
+	RegistryModuleExists          = 32111
+	RegistryModuleInvalid         = 32112
+	RegistryModuleVersionNotExist = 32113
+
+	// provider mirror 322
+	ProviderMirrorNotExist   = 32210
+	ProviderMirrorExists     = 32211
+	ProviderMirrorInvalid    = 32212
+	ProviderMirrorSyncFailed = 32213
 )
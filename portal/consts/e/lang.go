@@ -318,6 +318,10 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "variable value is empty",
 		"zh-CN": "变量值不可为空",
 	},
+	VariableValueInvalid: {
+		"en-US": "variable value does not match the terraform variable type or validation",
+		"zh-CN": "变量值与 Terraform 变量定义的类型或校验规则不匹配",
+	},
 	ProjectAlreadyExists: {
 		"en-US": "project already exists",
 		"zh-CN": "项目已存在",
@@ -574,6 +578,22 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "ssh keypair is not setup",
 		"zh-CN": "SSH 密钥未配置",
 	},
+	TemplatePreviewProjectInvalid: {
+		"en-US": "the preview project is not associated with the template",
+		"zh-CN": "预览环境项目未关联当前云模板",
+	},
+	TemplateVersionNotExists: {
+		"en-US": "template version not exists",
+		"zh-CN": "云模板版本不存在",
+	},
+	TemplateVersionExists: {
+		"en-US": "template version already exists",
+		"zh-CN": "云模板版本已存在",
+	},
+	TemplateVersionInvalid: {
+		"en-US": "template version is not a valid semver",
+		"zh-CN": "云模板版本号不是有效的 semver 格式",
+	},
 	PolicyGroupDirError: {
 		"en-US": "policy not found in the repository",
 		"zh-CN": "仓库在当前目录找不到策略文件",
@@ -594,4 +614,188 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "template is not bound to the project",
 		"zh-CN": "云模板未绑定当前项目",
 	},
+	EnvPromoteTplMismatch: {
+		"en-US": "the target environment uses a different template",
+		"zh-CN": "目标环境与源环境使用的云模板不一致",
+	},
+	EnvPromoteNoSuccessTask: {
+		"en-US": "the source environment has no successful deploy task",
+		"zh-CN": "源环境没有执行成功的部署任务",
+	},
+	EnvImportAddressInvalid: {
+		"en-US": "the import resource address is invalid or duplicated",
+		"zh-CN": "导入的资源地址无效或重复",
+	},
+	EnvImportTfVersion: {
+		"en-US": "importing resources with import blocks requires terraform 1.5 or later",
+		"zh-CN": "通过 import 块导入资源需要 terraform 1.5 及以上版本",
+	},
+	EnvStateOpInvalid: {
+		"en-US": "invalid state operation",
+		"zh-CN": "state 操作参数无效",
+	},
+	EnvDeployModeInvalid: {
+		"en-US": "invalid deploy mode",
+		"zh-CN": "部署模式参数无效",
+	},
+	EnvExtendNotAllowed: {
+		"en-US": "env has no pending auto destroy to extend",
+		"zh-CN": "环境未设置自动销毁或正在销毁，无法延期",
+	},
+	EnvExtendExceedLimit: {
+		"en-US": "exceeds the env extension limit of the project",
+		"zh-CN": "超出项目的环境延期限制",
+	},
+	EnvBatchNotExists: {
+		"en-US": "env batch not exists",
+		"zh-CN": "批量操作不存在",
+	},
+	EnvBatchNoEnvMatched: {
+		"en-US": "no env matched the filters",
+		"zh-CN": "没有符合条件的环境",
+	},
+	EnvBatchTooManyEnvs: {
+		"en-US": "too many envs in one batch",
+		"zh-CN": "批量操作的环境数量超出限制",
+	},
+	EnvTagInvalid: {
+		"en-US": "invalid env tag",
+		"zh-CN": "环境标签格式错误",
+	},
+	EnvTagKeyDuplicate: {
+		"en-US": "duplicate env tag key",
+		"zh-CN": "环境标签 key 重复",
+	},
+	EnvTagRequired: {
+		"en-US": "missing required env tag",
+		"zh-CN": "缺少组织要求的环境标签",
+	},
+	EnvTagValueNotAllowed: {
+		"en-US": "env tag value is not allowed",
+		"zh-CN": "环境标签的值不在允许范围内",
+	},
+	EnvTagSchemaNotExists: {
+		"en-US": "env tag schema not exists",
+		"zh-CN": "环境标签规范不存在",
+	},
+	EnvTagSchemaExists: {
+		"en-US": "env tag schema already exists",
+		"zh-CN": "环境标签规范已存在",
+	},
+	EnvDriftRunNotExists: {
+		"en-US": "drift run not exists",
+		"zh-CN": "漂移检测记录不存在",
+	},
+	DriftIgnoreRuleNotExists: {
+		"en-US": "drift ignore rule not exists",
+		"zh-CN": "漂移忽略规则不存在",
+	},
+	DeployFreezeNotExist: {
+		"en-US": "deploy freeze does not exist",
+		"zh-CN": "部署冻结规则不存在",
+	},
+	DeployFreezeActive: {
+		"en-US": "deployment is frozen now",
+		"zh-CN": "当前处于部署冻结期，不允许执行部署或销毁",
+	},
+	DeployFreezeInvalidSchedule: {
+		"en-US": "invalid deploy freeze schedule",
+		"zh-CN": "部署冻结时间配置无效",
+	},
+	DeployFreezeOverrideDeny: {
+		"en-US": "permission denied to override deploy freeze",
+		"zh-CN": "无权限跳过部署冻结",
+	},
+	DeployFreezeReasonRequired: {
+		"en-US": "reason is required to override deploy freeze",
+		"zh-CN": "跳过部署冻结必须填写原因",
+	},
+	TaskCannotRerun: {
+		"en-US": "task cannot rerun",
+		"zh-CN": "任务未结束，无法重新执行",
+	},
+	TaskCannotResume: {
+		"en-US": "task cannot resume from failed step",
+		"zh-CN": "任务无法从失败步骤恢复执行",
+	},
+	TaskPlanNotExists: {
+		"en-US": "task plan does not exist",
+		"zh-CN": "任务没有执行计划",
+	},
+	TaskCannotRollback: {
+		"en-US": "can only roll back to a successful apply task of the environment",
+		"zh-CN": "只能回滚到环境执行成功的部署任务",
+	},
+	ApprovalPolicyNotExist: {
+		"en-US": "approval policy does not exist",
+		"zh-CN": "审批策略不存在",
+	},
+	ApprovalPolicyExists: {
+		"en-US": "approval policy already exists",
+		"zh-CN": "该范围下已存在审批策略",
+	},
+	ApprovalPolicyInvalid: {
+		"en-US": "invalid approval policy",
+		"zh-CN": "审批策略配置无效",
+	},
+	TaskApproveSelfDeny: {
+		"en-US": "task creator cannot approve the task",
+		"zh-CN": "不允许审批自己发起的任务",
+	},
+	TaskApproveNotAllowed: {
+		"en-US": "user is not an approver of the task",
+		"zh-CN": "当前用户不在审批人列表中",
+	},
+	TaskApproveDuplicate: {
+		"en-US": "task has already been approved by the user",
+		"zh-CN": "已审批过该任务",
+	},
+	BudgetNotExist: {
+		"en-US": "budget does not exist",
+		"zh-CN": "预算不存在",
+	},
+	BudgetExists: {
+		"en-US": "budget already exists",
+		"zh-CN": "该范围下已存在预算",
+	},
+	BudgetInvalid: {
+		"en-US": "invalid budget",
+		"zh-CN": "预算配置无效",
+	},
+	BudgetExceeded: {
+		"en-US": "forecast cost exceeds the budget",
+		"zh-CN": "部署后预计费用超出预算",
+	},
+	RegistryModuleNotExist: {
+		"en-US": "module not exists",
+		"zh-CN": "模块不存在",
+	},
+	RegistryModuleExists: {
+		"en-US": "module already exists",
+		"zh-CN": "模块已存在",
+	},
+	RegistryModuleInvalid: {
+		"en-US": "module namespace/name/provider is invalid",
+		"zh-CN": "模块命名空间、名称或 provider 格式错误",
+	},
+	RegistryModuleVersionNotExist: {
+		"en-US": "module version not exists",
+		"zh-CN": "模块版本不存在",
+	},
+	ProviderMirrorNotExist: {
+		"en-US": "provider not exists",
+		"zh-CN": "Provider 不存在",
+	},
+	ProviderMirrorExists: {
+		"en-US": "provider version already exists",
+		"zh-CN": "Provider 版本已存在",
+	},
+	ProviderMirrorInvalid: {
+		"en-US": "invalid provider address or package",
+		"zh-CN": "Provider 地址或安装包格式错误",
+	},
+	ProviderMirrorSyncFailed: {
+		"en-US": "provider sync failed",
+		"zh-CN": "Provider 同步失败",
+	},
 }
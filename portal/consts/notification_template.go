@@ -103,6 +103,67 @@ var IacCronDriftApplyTaskTpl = `
 </html>
 `
 
+var IacBudgetThresholdTpl = `
+<html>
+<body>
+<p>尊敬的 CloudIaC 用户：</p>
+<br />
+<p>	{{if .EnvName}}{{.EnvName}}环境{{else}}{{.ProjectName}}项目{{end}}本月费用已达到预算的 {{.Threshold}}%，详情如下：</p>
+<br />
+<p>	所属组织：{{.OrgName}}</p>
+<p>	所属项目：{{.ProjectName}}</p>
+<p>	账单月：{{.Cycle}}</p>
+<p>	月度预算：{{printf "%.2f" .Amount}}</p>
+<p>	已产生费用：{{printf "%.2f" .Spent}}</p>
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
+var IacEnvExpiringTpl = `
+<html>
+<body>
+<p>尊敬的 CloudIaC 用户：</p>
+<br />
+<p>	{{.EnvName}}环境即将被自动销毁，详情如下：</p>
+<br />
+<p>	所属组织：{{.OrgName}}</p>
+<p>	所属项目：{{.ProjectName}}</p>
+<p>	环境名称：{{.EnvName}}</p>
+<p>	销毁时间：{{.DestroyAt}}</p>
+<br />
+{{- if .ExtendAddr}}
+<p>	如需继续使用，请点击链接将环境延期 {{.ExtendDuration}}：<a href="{{.ExtendAddr}}">{{.ExtendAddr}}</a></p>
+{{- end}}
+<p>	更多详情请点击：{{.Addr}}</p>
+<br />
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
+var IacDriftRemediationTpl = `
+<html>
+<body>
+<p>尊敬的 CloudIaC 用户：</p>
+<br />
+<p>	{{.EnvName}}环境检测到资源配置发生漂移，已创建纠偏任务，请及时审批，详情如下：</p>
+<br />
+<p>	所属组织：{{.OrgName}}</p>
+<p>	所属项目：{{.ProjectName}}</p>
+<p>	环境名称：{{.EnvName}}</p>
+<p>	漂移资源数量：{{.DriftCount}}</p>
+<p>	审批超时时间：{{.ExpireAt}}（超时未审批任务将被自动驳回）</p>
+<p>	漂移摘要：</p>
+<pre>{{.Summary}}</pre>
+<br />
+<p>	审批请点击：{{.Addr}}</p>
+<br />
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
 var IacTaskFailedTpl = `
 <html>
 <body>
@@ -276,6 +337,71 @@ const (
   分支/tag：{{.Revision}}
 
 
+  -----该消息由系统自动发出，请勿回复-----
+`
+	IacBudgetThresholdMarkdown = `
+尊敬的CloudIaC用户：
+
+  {{if .EnvName}}{{.EnvName}}环境{{else}}{{.ProjectName}}项目{{end}}本月费用已达到预算的 {{.Threshold}}%，详情如下：
+
+  所属组织：{{.OrgName}}
+
+  所属项目：{{.ProjectName}}
+
+  账单月：{{.Cycle}}
+
+  月度预算：{{printf "%.2f" .Amount}}
+
+  已产生费用：{{printf "%.2f" .Spent}}
+
+
+  -----该消息由系统自动发出，请勿回复-----
+`
+
+	IacEnvExpiringMarkdown = `
+尊敬的CloudIaC用户：
+
+  {{.EnvName}}环境即将被自动销毁，详情如下：
+
+  所属组织：{{.OrgName}}
+
+  所属项目：{{.ProjectName}}
+
+  环境名称：{{.EnvName}}
+
+  销毁时间：{{.DestroyAt}}
+{{if .ExtendAddr}}
+  如需继续使用，请点击链接将环境延期 {{.ExtendDuration}}：{{.ExtendAddr}}
+{{end}}
+  更多详情请点击：{{.Addr}}
+
+
+  -----该消息由系统自动发出，请勿回复-----
+`
+	IacDriftRemediationMarkdown = `
+尊敬的CloudIaC用户：
+
+  {{.EnvName}}环境检测到资源配置发生漂移，已创建纠偏任务，请及时审批，详情如下：
+
+  所属组织：{{.OrgName}}
+
+  所属项目：{{.ProjectName}}
+
+  环境名称：{{.EnvName}}
+
+  漂移资源数量：{{.DriftCount}}
+
+  审批超时时间：{{.ExpireAt}}（超时未审批任务将被自动驳回）
+
+  漂移摘要：
+
+` + "```" + `
+{{.Summary}}
+` + "```" + `
+
+  审批请点击：{{.Addr}}
+
+
   -----该消息由系统自动发出，请勿回复-----
 `
 )
@@ -5,10 +5,45 @@ package consts
 var PrCommentTpl = `
 🤖&nbsp;&nbsp;PR Plan for CloudIac environment <a href="{{.Addr}}">{{.Name}}</a><br>
 ` + "```Plan {{.Status}}```" + `
+{{if .HasChanges}}
+**Resource changes:** {{.Added}} to add, {{.Changed}} to change, {{.Destroyed}} to destroy
+
+| Action | Resource |
+| --- | --- |
+{{range .Changes}}| {{.Action}} | ` + "`{{.Address}}`" + ` |
+{{end}}{{if .MoreChanges}}| ... | {{.MoreChanges}} more |
+{{end}}{{end}}
+{{if .Violations}}
+**Policy violations:** {{len .Violations}}
+
+| Severity | Policy | Resource |
+| --- | --- | --- |
+{{range .Violations}}| {{.Severity}} | {{.PolicyName}} | ` + "`{{.Resource}}`" + ` |
+{{end}}{{end}}
+{{if .HasCost}}
+**Monthly cost delta:** {{.CostDelta}}
+{{end}}
 <details>
 <summary>Plan Details</summary>
 <pre><code>
 {{.Content}}
 </code></pre>
 </details>
+
+<a href="{{.Addr}}">View task in CloudIac</a>
+`
+
+var PrPreviewCommentTpl = `
+🚀&nbsp;&nbsp;PR preview environment <a href="{{.EnvAddr}}">{{.Name}}</a><br>
+` + "```{{.TaskType}} {{.Status}}```" + `
+{{if .Archived}}
+The preview environment has been destroyed and archived.
+{{else if .Outputs}}
+**Outputs:**
+
+| Name | Value |
+| --- | --- |
+{{range .Outputs}}| {{.Name}} | ` + "`{{.Value}}`" + ` |
+{{end}}{{end}}
+<a href="{{.Addr}}">View task in CloudIac</a>
 `
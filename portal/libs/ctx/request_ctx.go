@@ -8,6 +8,7 @@ import (
 	"cloudiac/portal/libs/validate"
 	"cloudiac/portal/models/forms"
 	"cloudiac/utils/logs"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -27,6 +28,7 @@ type RequestContext interface {
 	BindService(sc *ServiceContext)
 	Service() *ServiceContext
 	Logger() logs.Logger
+	RequestCtx() context.Context
 }
 
 type GinRequest struct {
@@ -60,6 +62,11 @@ func (c *GinRequest) Logger() logs.Logger {
 	return c.sc.Logger()
 }
 
+// RequestCtx 返回请求的 context，其中包含了请求的链路追踪信息
+func (c *GinRequest) RequestCtx() context.Context {
+	return c.Request.Context()
+}
+
 type JSONResult struct {
 	Code           int               `json:"code" example:"200"`
 	Message        string            `json:"message" example:"ok"`
@@ -6,6 +6,8 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/tracing"
+	"context"
 	"crypto/rand"
 	"fmt"
 	"math/big"
@@ -23,6 +25,7 @@ type ServiceContext struct {
 	Username     string    // 用户名称
 	IsSuperAdmin bool      // 是否平台管理员
 	UserIpAddr   string
+	RequestId    string // 请求ID，与日志中的 req 字段一致
 }
 
 func NewServiceContext(rc RequestContext) *ServiceContext {
@@ -30,12 +33,14 @@ func NewServiceContext(rc RequestContext) *ServiceContext {
 	if err != nil {
 		panic(fmt.Errorf("get random number err: %+v", err))
 	}
-	logger := logs.Get().WithField("req", fmt.Sprintf("%08d", bigNum))
+	requestId := fmt.Sprintf("%08d", bigNum)
+	logger := logs.Get().WithField("req", requestId)
 
 	sc := &ServiceContext{
-		rc:     rc,
-		dbSess: nil,
-		logger: logger,
+		rc:        rc,
+		dbSess:    nil,
+		logger:    logger,
+		RequestId: requestId,
 	}
 
 	rc.BindService(sc)
@@ -44,11 +49,20 @@ func NewServiceContext(rc RequestContext) *ServiceContext {
 
 func (c *ServiceContext) DB() *db.Session {
 	if c.dbSess == nil {
-		c.dbSess = db.Get()
+		// 请求结束后 context 会被取消，这里只继承链路追踪信息，避免影响异步执行的 db 操作
+		c.dbSess = db.Get().WithContext(tracing.Detach(c.Ctx()))
 	}
 	return c.dbSess
 }
 
+// Ctx 返回请求的 context
+func (c *ServiceContext) Ctx() context.Context {
+	if c.rc == nil {
+		return context.Background()
+	}
+	return c.rc.RequestCtx()
+}
+
 func (c *ServiceContext) Tx() *db.Session {
 	return c.DB().Begin()
 }
@@ -3,6 +3,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -19,6 +20,7 @@ import (
 	"cloudiac/portal/consts/e"
 	dbLogger "cloudiac/portal/libs/db/logger"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
 
 	"github.com/go-testfixtures/testfixtures/v3"
 	"github.com/pkg/errors"
@@ -27,7 +29,11 @@ import (
 	gormLogger "gorm.io/gorm/logger"
 )
 
-const DBCtxKeyLazySelects = "app:lazySelects"
+const (
+	DBCtxKeyLazySelects = "app:lazySelects"
+
+	dbInstanceKeyStartAt = "app:metricsStartAt"
+)
 
 var (
 	defaultDB      *gorm.DB
@@ -58,6 +64,18 @@ func (s *Session) Transaction(fc func(tx *Session) error) error {
 	})
 }
 
+// WithContext 返回使用指定 context 的新 session，用于在 db 操作间传递链路追踪信息
+func (s *Session) WithContext(ctx context.Context) *Session {
+	return ToSess(s.db.WithContext(ctx))
+}
+
+func (s *Session) Context() context.Context {
+	if s.db.Statement == nil || s.db.Statement.Context == nil {
+		return context.Background()
+	}
+	return s.db.Statement.Context
+}
+
 func (s *Session) GormDB() *gorm.DB {
 	return s.db
 }
@@ -263,6 +281,11 @@ func (s *Session) Set(name string, value interface{}) *Session {
 	return ToSess(s.db.Set(name, value))
 }
 
+// ForUpdate 查询时使用 SELECT ... FOR UPDATE 锁定记录，需要在事务中使用
+func (s *Session) ForUpdate() *Session {
+	return ToSess(s.db.Clauses(clause.Locking{Strength: "UPDATE"}))
+}
+
 func (s *Session) Count() (cnt int64, err error) {
 	qs := s.autoLazySelect()
 	err = qs.db.Count(&cnt).Error
@@ -488,6 +511,10 @@ func openDB(dsn string, driverNames ...string) error {
 		return err
 	}
 
+	if err = registerMetricsCallbacks(db); err != nil {
+		return err
+	}
+
 	defaultDB = db
 	return nil
 }
@@ -529,6 +556,46 @@ func beforeCreateCallback(db *gorm.DB) {
 	}
 }
 
+// registerMetricsCallbacks 注册统计 db 操作耗时的回调
+func registerMetricsCallbacks(db *gorm.DB) error {
+	before := func(db *gorm.DB) {
+		db.InstanceSet(dbInstanceKeyStartAt, time.Now())
+	}
+	after := func(operation string) func(db *gorm.DB) {
+		return func(db *gorm.DB) {
+			v, ok := db.InstanceGet(dbInstanceKeyStartAt)
+			if !ok {
+				return
+			}
+			if startAt, ok := v.(time.Time); ok {
+				metrics.DBQuerySeconds.WithLabelValues(operation, db.Statement.Table).
+					Observe(time.Since(startAt).Seconds())
+			}
+		}
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("*").Register("metrics:before_create", before),
+		cb.Create().After("*").Register("metrics:after_create", after("create")),
+		cb.Query().Before("*").Register("metrics:before_query", before),
+		cb.Query().After("*").Register("metrics:after_query", after("query")),
+		cb.Update().Before("*").Register("metrics:before_update", before),
+		cb.Update().After("*").Register("metrics:after_update", after("update")),
+		cb.Delete().Before("*").Register("metrics:before_delete", before),
+		cb.Delete().After("*").Register("metrics:after_delete", after("delete")),
+		cb.Row().Before("*").Register("metrics:before_row", before),
+		cb.Row().After("*").Register("metrics:after_row", after("row")),
+		cb.Raw().Before("*").Register("metrics:before_raw", before),
+		cb.Raw().After("*").Register("metrics:after_raw", after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func Init(dsn string) {
 	if err := openDB(dsn); err != nil {
 		logs.Get().Fatalln(err)
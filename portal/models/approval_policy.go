@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// ApprovalPolicy 部署审批策略，作用于项目(envId 为空)或环境，环境级策略优先
+type ApprovalPolicy struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null;index"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null;index"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null;default:''"` // 为空表示项目级策略
+
+	Name              string   `json:"name" gorm:"not null"`
+	RequiredApprovals int      `json:"requiredApprovals" gorm:"default:1"`                                           // 需要通过审批的人数
+	Approvers         StrSlice `json:"approvers" gorm:"type:json" swaggertype:"array,string"`                        // 可审批的用户 id
+	ApproverRoles     StrSlice `json:"approverRoles" gorm:"type:json" swaggertype:"array,string" example:"approver"` // 可审批的项目角色
+	AllowSelfApproval bool     `json:"allowSelfApproval" gorm:"default:false"`                                       // 是否允许任务创建者审批
+	Timeout           int      `json:"timeout" gorm:"default:0"`                                                     // 审批超时时间(分钟)，超时后自动驳回，0 表示不超时
+	Enabled           bool     `json:"enabled" gorm:"default:true"`
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (ApprovalPolicy) TableName() string {
+	return "iac_approval_policy"
+}
+
+func (p *ApprovalPolicy) CustomBeforeCreate(*db.Session) error {
+	if p.Id == "" {
+		p.Id = NewId("apl")
+	}
+	return nil
+}
+
+const (
+	TaskApprovalApproved = "approved"
+	TaskApprovalRejected = "rejected"
+)
+
+// TaskApproval 任务步骤的审批记录
+type TaskApproval struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"`
+
+	Step    int    `json:"step" gorm:"not null"`                                    // 审批的步骤
+	UserId  Id     `json:"userId" gorm:"size:32;not null"`                          // 审批人，超时自动驳回时为系统用户
+	Action  string `json:"action" gorm:"type:enum('approved','rejected');not null"` // 审批动作
+	Comment string `json:"comment" gorm:"type:text"`                                // 审批意见
+}
+
+func (TaskApproval) TableName() string {
+	return "iac_task_approval"
+}
+
+func (a *TaskApproval) CustomBeforeCreate(*db.Session) error {
+	if a.Id == "" {
+		a.Id = NewId("apv")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	BudgetPolicyApproval = "approval" // 超出预算时部署需要审批
+	BudgetPolicyBlock    = "block"    // 超出预算时禁止部署
+)
+
+// Budget 项目(envId 为空)或环境的月度费用预算
+type Budget struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null;index"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null;index"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null;default:''"` // 为空表示项目级预算
+
+	Amount  float64 `json:"amount" gorm:"not null"`                                                  // 月度预算金额
+	Policy  string  `json:"policy" gorm:"type:enum('approval','block');not null;default:'approval'"` // 部署超出预算时的处理方式
+	Enabled bool    `json:"enabled" gorm:"default:true"`
+
+	NotifiedCycle string `json:"notifiedCycle" gorm:"size:16;default:''"` // 最近一次发送阈值通知的账单月
+	NotifiedLevel int    `json:"notifiedLevel" gorm:"default:0"`          // 该账单月已通知的阈值(百分比)
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (Budget) TableName() string {
+	return "iac_budget"
+}
+
+func (b *Budget) CustomBeforeCreate(*db.Session) error {
+	if b.Id == "" {
+		b.Id = NewId("bgt")
+	}
+	return nil
+}
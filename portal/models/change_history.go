@@ -0,0 +1,30 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// ChangeHistory 环境、云模板等对象配置的字段级变更记录
+type ChangeHistory struct {
+	TimedModel
+
+	OrgId      Id     `json:"orgId" gorm:"size:32;not null"`
+	ObjectType string `json:"objectType" gorm:"size:32;not null" enums:"env,template,project,org"` // 变更对象类型
+	ObjectId   Id     `json:"objectId" gorm:"size:32;not null;index"`                              // 变更对象ID
+	Field      string `json:"field" gorm:"size:255;not null" example:"autoApproval"`               // 变更的字段，变量为 variables.<type>.<name>，变量组关联为 varGroups
+	OldValue   string `json:"oldValue" gorm:"type:text"`                                           // 变更前的值(json 格式)，敏感变量不记录值
+	NewValue   string `json:"newValue" gorm:"type:text"`                                           // 变更后的值(json 格式)，敏感变量不记录值
+	OperatorId Id     `json:"operatorId" gorm:"size:32;default:''"`                                // 操作人
+	RequestId  string `json:"requestId" gorm:"size:32;default:''"`                                 // 发起变更的请求ID，与日志中的 req 字段一致
+}
+
+func (ChangeHistory) TableName() string {
+	return "iac_change_history"
+}
+
+func (h *ChangeHistory) CustomBeforeCreate(*db.Session) error {
+	if h.Id == "" {
+		h.Id = NewId("chg")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	DeployFreezeKindFreeze = "freeze" // 冻结期，时间段内不允许部署
+	DeployFreezeKindWindow = "window" // 部署窗口，只允许在时间段内部署
+
+	DeployFreezeTypeRecurring = "recurring" // 按周循环的时间段
+	DeployFreezeTypeOnce      = "once"      // 一次性的时间段
+
+	DeployFreezeActionBlock = "block" // 拒绝创建任务
+	DeployFreezeActionHold  = "hold"  // 任务保持 pending，冻结结束后再执行
+)
+
+// DeployFreeze 部署冻结规则，作用于组织(projectId 为空)、项目(envId 为空)或环境
+type DeployFreeze struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null;index"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null;default:''"` // 为空表示组织级规则
+	EnvId     Id `json:"envId" gorm:"size:32;not null;default:''"`     // 为空表示项目级规则
+
+	Name        string `json:"name" gorm:"not null"`
+	Description string `json:"description" gorm:"type:text"`
+	Kind        string `json:"kind" gorm:"type:enum('freeze','window');default:'freeze'"`
+	Type        string `json:"type" gorm:"type:enum('recurring','once');default:'recurring'"`
+	Action      string `json:"action" gorm:"type:enum('block','hold');default:'block'"`
+	Enabled     bool   `json:"enabled" gorm:"default:true"`
+
+	// 循环规则，时间按 Timezone 计算。EndTime 小于 StartTime 表示跨天
+	Timezone  string   `json:"timezone" gorm:"size:64;not null;default:''" example:"Asia/Shanghai"`
+	Weekdays  StrSlice `json:"weekdays" gorm:"type:json" swaggertype:"array,string" example:"mon,tue"` // 为空表示每天
+	StartTime string   `json:"startTime" gorm:"size:5;not null;default:''" example:"18:00"`
+	EndTime   string   `json:"endTime" gorm:"size:5;not null;default:''" example:"09:00"`
+
+	// 一次性规则
+	StartAt *Time `json:"startAt" gorm:"type:datetime"`
+	EndAt   *Time `json:"endAt" gorm:"type:datetime"`
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (DeployFreeze) TableName() string {
+	return "iac_deploy_freeze"
+}
+
+func (f *DeployFreeze) CustomBeforeCreate(*db.Session) error {
+	if f.Id == "" {
+		f.Id = NewId("dfz")
+	}
+	return nil
+}
@@ -17,6 +17,9 @@ const (
 	EnvStatusInactive  = "inactive"  // 资源未部署
 	EnvStatusDestroyed = "destroyed" // 已销毁
 
+	EnvDriftRepairModeAuto     = "auto"     // 发生漂移时直接执行纠偏
+	EnvDriftRepairModeApproval = "approval" // 发生漂移时创建待审批的纠偏任务
+
 	//EnvStatusDeploying = "deploying" // apply 运行中(plan 作业不改变状态)
 	//EnvStatusApproving = "approving" // 等待审批
 )
@@ -53,11 +56,12 @@ type Env struct {
 	Playbook     string `json:"playbook" gorm:"default:''"`     // Ansible playbook 入口文件路径
 
 	// 任务相关参数，获取详情的时候，如果有 last_task_id 则返回 last_task_id 相关参数
-	RunnerId   string `json:"runnerId" gorm:"size:32"`            //部署通道ID
-	RunnerTags string `json:"runnerTags" gorm:"size:256"`         //部署通道Tags,逗号分割
-	Revision   string `json:"revision" gorm:"size:64;default:''"` // Vcs仓库分支/标签
-	KeyId      Id     `json:"keyId" gorm:"size:32"`               // 部署密钥ID
-	Workdir    string `json:"workdir" gorm:"size:32;default:''"`  // 工作目录
+	RunnerId   string `json:"runnerId" gorm:"size:32"`              //部署通道ID
+	RunnerTags string `json:"runnerTags" gorm:"size:256"`           //部署通道Tags,逗号分割
+	Revision   string `json:"revision" gorm:"size:64;default:''"`   // Vcs仓库分支/标签
+	KeyId      Id     `json:"keyId" gorm:"size:32"`                 // 部署密钥ID
+	Workdir    string `json:"workdir" gorm:"size:32;default:''"`    // 工作目录
+	TplVersion string `json:"tplVersion" gorm:"size:64;default:''"` // 锁定的云模板版本，为空表示跟随 revision
 
 	LastTaskId    Id `json:"lastTaskId" gorm:"size:32"`          // 最后一次部署或销毁任务的 id(plan 任务不记录)
 	LastResTaskId Id `json:"lastResTaskId" gorm:"index;size:32"` // 最后一次进行了资源列表统计的部署任务的 id
@@ -73,6 +77,11 @@ type Env struct {
 	// 该 id 在创建自动销毁任务后保存，并在销毁任务执行完成后清除
 	AutoDestroyTaskId Id `json:"-"  gorm:"default:''"` // 自动销毁任务 id
 
+	// 自动销毁提醒及延期
+	ExtendCount        int   `json:"extendCount" gorm:"default:0"` // 设置自动销毁时间后的延期次数
+	ExpireNotifiedAt   *Time `json:"-" gorm:"type:datetime"`       // 最近一次发送销毁提醒时的自动销毁时间
+	ExpireNotifiedLead int   `json:"-" gorm:"default:0"`           // 最近一次发送销毁提醒的提前时间(秒)
+
 	// 触发器设置
 	Triggers pq.StringArray `json:"triggers" gorm:"type:text" swaggertype:"array,string"` // 触发器。commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 
@@ -90,6 +99,9 @@ type Env struct {
 	OpenCronDrift     bool       `json:"openCronDrift" gorm:"default:false"`     // 是否开启偏移检测
 	NextDriftTaskTime *time.Time `json:"nextDriftTaskTime" gorm:"type:datetime"` // 下次执行偏移检测任务的时间
 
+	DriftRepairMode    string `json:"driftRepairMode" gorm:"size:16;default:'auto'" enums:"auto,approval"` // 纠偏方式: auto 直接执行纠偏，approval 检测到漂移后创建待审批的纠偏任务
+	DriftRepairTimeout int    `json:"driftRepairTimeout" gorm:"default:0"`                                 // 纠偏任务的审批超时时间(分钟)，超时后自动驳回，0 表示使用默认值
+
 	// 合规相关
 	PolicyEnable bool `json:"policyEnable" gorm:"default:false"` // 是否开启合规检测
 
@@ -107,12 +119,20 @@ type Env struct {
 	// 自动销毁相关
 	AutoDestroyCron string `json:"autoDestroyCron" gorm:"default:''"` // 自动销毁任务的Cron表达式
 	// 下次执行自动部署任务的时间 和 自动部署任务id 复用之前的
+
+	// PR 预览环境对应的 PR 编号，非 0 表示该环境是由 PR 自动创建的预览环境
+	PreviewPrId int `json:"previewPrId" gorm:"index;default:0"`
 }
 
 func (Env) TableName() string {
 	return "iac_env"
 }
 
+// DriftRepairApproval 环境开启了自动纠偏，且纠偏任务需要审批
+func (e *Env) DriftRepairApproval() bool {
+	return e.AutoRepairDrift && e.DriftRepairMode == EnvDriftRepairModeApproval
+}
+
 func (e *Env) Migrate(sess *db.Session) (err error) {
 	if err = sess.RemoveIndex("iac_env", "unique__tpl__env__name"); err != nil {
 		return err
@@ -0,0 +1,108 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+const (
+	EnvBatchActionDeploy  = "deploy"
+	EnvBatchActionPlan    = "plan"
+	EnvBatchActionDestroy = "destroy"
+	EnvBatchActionLock    = "lock"
+	EnvBatchActionUnlock  = "unlock"
+	EnvBatchActionArchive = "archive"
+
+	EnvBatchPending  = "pending"  // 等待创建子任务
+	EnvBatchRunning  = "running"  // 子任务执行中
+	EnvBatchComplete = "complete" // 全部成功
+	EnvBatchFailed   = "failed"   // 全部失败
+	EnvBatchPartial  = "partial"  // 部分成功
+
+	EnvBatchItemPending  = "pending"  // 等待创建任务(限速)
+	EnvBatchItemRunning  = "running"  // 任务己创建，执行中
+	EnvBatchItemComplete = "complete" // 执行成功
+	EnvBatchItemFailed   = "failed"   // 执行失败或任务创建失败
+	EnvBatchItemSkipped  = "skipped"  // 环境当前状态不允许执行该操作
+)
+
+var EnvBatchTaskActions = []string{EnvBatchActionDeploy, EnvBatchActionPlan, EnvBatchActionDestroy}
+
+// EnvBatchFilter 批量操作的环境筛选条件
+type EnvBatchFilter struct {
+	EnvIds []Id     `json:"envIds,omitempty"`
+	TplId  Id       `json:"tplId,omitempty"`
+	Status string   `json:"status,omitempty"` // 环境状态，多个以逗号分隔
+	Tags   StrSlice `json:"tags,omitempty"`   // 环境需要包含所有标签
+}
+
+func (v EnvBatchFilter) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *EnvBatchFilter) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// EnvBatch 项目下环境的批量操作
+type EnvBatch struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null;index"`
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+
+	Action  string         `json:"action" gorm:"size:16;not null" enums:"deploy,plan,destroy,lock,unlock,archive"`
+	Filters EnvBatchFilter `json:"filters" gorm:"type:json"`
+	Rate    int            `json:"rate" gorm:"default:0"` // 每分钟最多创建的任务数
+	Status  string         `json:"status" gorm:"size:16;not null;default:'pending'" enums:"pending,running,complete,failed,partial"`
+
+	Total    int `json:"total" gorm:"default:0"`
+	Complete int `json:"complete" gorm:"default:0"`
+	Failed   int `json:"failed" gorm:"default:0"`
+	Skipped  int `json:"skipped" gorm:"default:0"`
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" gorm:"size:255;default:''"` // 子任务跳过部署冻结的原因
+}
+
+func (EnvBatch) TableName() string {
+	return "iac_env_batch"
+}
+
+func (b *EnvBatch) CustomBeforeCreate(*db.Session) error {
+	if b.Id == "" {
+		b.Id = NewId("eb")
+	}
+	return nil
+}
+
+// EnvBatchItem 批量操作中单个环境的执行记录
+type EnvBatchItem struct {
+	TimedModel
+
+	BatchId Id     `json:"batchId" gorm:"size:32;not null;index"`
+	EnvId   Id     `json:"envId" gorm:"size:32;not null"`
+	EnvName string `json:"envName" gorm:"size:255;default:''"`
+	TaskId  Id     `json:"taskId" gorm:"size:32;default:''"`
+	Status  string `json:"status" gorm:"size:16;not null;default:'pending'" enums:"pending,running,complete,failed,skipped"`
+	Message string `json:"message" gorm:"type:text"`
+
+	StartedAt *Time `json:"startedAt" gorm:"type:datetime"` // 开始执行的时间，用于计算任务创建速率
+}
+
+func (EnvBatchItem) TableName() string {
+	return "iac_env_batch_item"
+}
+
+func (i *EnvBatchItem) CustomBeforeCreate(*db.Session) error {
+	if i.Id == "" {
+		i.Id = NewId("ebi")
+	}
+	return nil
+}
+
+func (i EnvBatchItem) Exited() bool {
+	return i.Status != EnvBatchItemPending && i.Status != EnvBatchItemRunning
+}
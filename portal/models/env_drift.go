@@ -0,0 +1,141 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+// DriftAttr 资源漂移的属性，Before 为资源的实际值，After 为配置中的值
+type DriftAttr struct {
+	Name      string      `json:"name"`
+	Before    interface{} `json:"before"`
+	After     interface{} `json:"after"`
+	Sensitive bool        `json:"sensitive"` // 敏感属性，值已被隐藏
+	Ignored   bool        `json:"ignored"`   // 匹配了忽略规则
+}
+
+type DriftAttrs []DriftAttr
+
+func (v DriftAttrs) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *DriftAttrs) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// DriftResourceDiff 单个资源的漂移信息
+type DriftResourceDiff struct {
+	Address string     `json:"address"`
+	Type    string     `json:"type"`
+	Action  string     `json:"action" enums:"create,update,delete,replace"` // 纠正漂移需要执行的动作
+	Attrs   DriftAttrs `json:"attrs"`
+	Ignored bool       `json:"ignored"` // 资源或资源的所有漂移属性都匹配了忽略规则
+}
+
+type DriftResourceDiffs []DriftResourceDiff
+
+func (v DriftResourceDiffs) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *DriftResourceDiffs) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// EnvDriftRun 环境每次漂移检测的结果
+type EnvDriftRun struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null;index"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null"` // 漂移检测任务ID
+
+	Drifted      bool `json:"drifted" gorm:"default:false"` // 是否存在未被忽略的漂移
+	DriftCount   int  `json:"driftCount" gorm:"default:0"`  // 发生漂移的资源数量(不包含被忽略的资源)
+	IgnoredCount int  `json:"ignoredCount" gorm:"default:0"`
+
+	Resources DriftResourceDiffs `json:"resources,omitempty" gorm:"type:json"`
+}
+
+func (EnvDriftRun) TableName() string {
+	return "iac_env_drift_run"
+}
+
+func (r *EnvDriftRun) CustomBeforeCreate(*db.Session) error {
+	if r.Id == "" {
+		r.Id = NewId("edr")
+	}
+	return nil
+}
+
+// DriftIgnoreRule 漂移忽略规则，作用于组织(projectId 为空)、项目(envId 为空)或环境。
+// 匹配规则的属性发生漂移时不会触发通知和自动纠偏
+type DriftIgnoreRule struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null;index"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null;default:''"` // 为空表示组织级规则
+	EnvId     Id `json:"envId" gorm:"size:32;not null;default:''"`     // 为空表示项目级规则
+
+	ResourceType string `json:"resourceType" gorm:"size:128;not null;default:''" example:"aws_autoscaling_group"` // 资源类型，支持通配符，为空表示所有类型
+	Attribute    string `json:"attribute" gorm:"size:128;not null;default:''" example:"desired_capacity"`         // 属性名，支持通配符，为空表示忽略整个资源
+	Description  string `json:"description" gorm:"size:255;default:''"`
+	Enabled      bool   `json:"enabled" gorm:"default:true"`
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (DriftIgnoreRule) TableName() string {
+	return "iac_drift_ignore_rule"
+}
+
+func (r *DriftIgnoreRule) CustomBeforeCreate(*db.Session) error {
+	if r.Id == "" {
+		r.Id = NewId("dir")
+	}
+	return nil
+}
+
+const (
+	DriftRemediationPending    = "pending"    // 纠偏任务等待审批或执行中
+	DriftRemediationRemediated = "remediated" // 纠偏完成
+	DriftRemediationFailed     = "failed"
+	DriftRemediationRejected   = "rejected"
+	DriftRemediationExpired    = "expired" // 审批超时被自动驳回
+)
+
+// DriftRemediation 需要审批的漂移纠偏记录，用于统计环境的平均纠偏时间
+type DriftRemediation struct {
+	TimedModel
+
+	OrgId       Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId   Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId       Id `json:"envId" gorm:"size:32;not null;index"`
+	DriftRunId  Id `json:"driftRunId" gorm:"size:32;not null"`  // 发现漂移的检测记录
+	DriftTaskId Id `json:"driftTaskId" gorm:"size:32;not null"` // 漂移检测任务ID
+	TaskId      Id `json:"taskId" gorm:"size:32;not null"`      // 纠偏任务ID
+
+	Status     string `json:"status" gorm:"size:16;not null;default:'pending'" enums:"pending,remediated,failed,rejected,expired"`
+	DriftCount int    `json:"driftCount" gorm:"default:0"` // 需要纠偏的资源数量
+	Summary    string `json:"summary" gorm:"type:text"`    // 漂移摘要
+
+	DetectedAt   Time  `json:"detectedAt" gorm:"type:datetime"`   // 发现漂移的时间
+	ExpireAt     *Time `json:"expireAt" gorm:"type:datetime"`     // 审批超时时间
+	RemediatedAt *Time `json:"remediatedAt" gorm:"type:datetime"` // 纠偏完成时间
+	Duration     int64 `json:"duration" gorm:"default:0"`         // 从发现漂移到纠偏完成的时间(秒)
+}
+
+func (DriftRemediation) TableName() string {
+	return "iac_drift_remediation"
+}
+
+func (r *DriftRemediation) CustomBeforeCreate(*db.Session) error {
+	if r.Id == "" {
+		r.Id = NewId("drm")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"strings"
+)
+
+// EnvTag 环境标签，以 key=value 的格式保存在 Env.Tags 中，多个标签以逗号分隔。
+// 不包含 "=" 的标签(旧格式)视为 value 为空的标签
+type EnvTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (t EnvTag) String() string {
+	if t.Value == "" {
+		return t.Key
+	}
+	return t.Key + "=" + t.Value
+}
+
+// ParseEnvTags 解析 Env.Tags 字符串，忽略空标签
+func ParseEnvTags(s string) []EnvTag {
+	tags := make([]EnvTag, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		tag := EnvTag{Key: strings.TrimSpace(kv[0])}
+		if len(kv) == 2 {
+			tag.Value = strings.TrimSpace(kv[1])
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func FormatEnvTags(tags []EnvTag) string {
+	ss := make([]string, 0, len(tags))
+	for _, t := range tags {
+		ss = append(ss, t.String())
+	}
+	return strings.Join(ss, ",")
+}
+
+// EnvTagsMap 将 Env.Tags 字符串转为 key -> value 的 map
+func EnvTagsMap(s string) map[string]string {
+	m := make(map[string]string)
+	for _, t := range ParseEnvTags(s) {
+		m[t.Key] = t.Value
+	}
+	return m
+}
+
+// EnvTagSchema 组织级环境标签规范，约束环境必须设置的标签及允许的取值
+type EnvTagSchema struct {
+	TimedModel
+
+	OrgId       Id       `json:"orgId" gorm:"size:32;not null"`
+	Key         string   `json:"key" gorm:"column:tag_key;size:64;not null" example:"cost-center"`
+	Required    bool     `json:"required" gorm:"default:false"`                      // 是否为必填标签
+	Values      StrSlice `json:"values" gorm:"type:json" example:"[\"rd\",\"ops\"]"` // 允许的取值，为空表示不限制
+	Description string   `json:"description" gorm:"size:255;default:''"`
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (EnvTagSchema) TableName() string {
+	return "iac_env_tag_schema"
+}
+
+func (s *EnvTagSchema) CustomBeforeCreate(*db.Session) error {
+	if s.Id == "" {
+		s.Id = NewId("ets")
+	}
+	return nil
+}
+
+func (s EnvTagSchema) Migrate(sess *db.Session) error {
+	return s.AddUniqueIndex(sess, "unique__org__tag_key", "org_id", "tag_key")
+}
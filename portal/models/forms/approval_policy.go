@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchApprovalPolicyForm struct {
+	PageForm
+
+	EnvId models.Id `form:"envId" json:"envId" binding:"omitempty,startswith=env-,max=32"` // 环境ID，不传则返回项目下所有策略
+}
+
+type CreateApprovalPolicyForm struct {
+	BaseForm
+
+	EnvId             models.Id `json:"envId" form:"envId" binding:"omitempty,startswith=env-,max=32"` // 环境ID，为空时创建项目级策略
+	Name              string    `json:"name" form:"name" binding:"required,gte=2,lte=255"`
+	RequiredApprovals int       `json:"requiredApprovals" form:"requiredApprovals" binding:"required,min=1"`                               // 需要通过审批的人数
+	Approvers         []string  `json:"approvers" form:"approvers" binding:"omitempty,dive,startswith=u-,max=32"`                          // 可审批的用户ID
+	ApproverRoles     []string  `json:"approverRoles" form:"approverRoles" binding:"omitempty,dive,oneof=manager approver operator guest"` // 可审批的项目角色
+	AllowSelfApproval bool      `json:"allowSelfApproval" form:"allowSelfApproval"`                                                        // 是否允许任务创建者审批
+	Timeout           int       `json:"timeout" form:"timeout" binding:"min=0"`                                                            // 审批超时时间(分钟)，0 表示不超时
+}
+
+type UpdateApprovalPolicyForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=apl-,max=32"`
+
+	Name              string   `json:"name" form:"name" binding:"omitempty,gte=2,lte=255"`
+	RequiredApprovals int      `json:"requiredApprovals" form:"requiredApprovals" binding:"omitempty,min=1"`
+	Approvers         []string `json:"approvers" form:"approvers" binding:"omitempty,dive,startswith=u-,max=32"`
+	ApproverRoles     []string `json:"approverRoles" form:"approverRoles" binding:"omitempty,dive,oneof=manager approver operator guest"`
+	AllowSelfApproval bool     `json:"allowSelfApproval" form:"allowSelfApproval" enums:"true,false"`
+	Timeout           int      `json:"timeout" form:"timeout" binding:"min=0"`
+	Enabled           bool     `json:"enabled" form:"enabled" enums:"true,false"`
+}
+
+type DetailApprovalPolicyForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=apl-,max=32"`
+}
+
+type DeleteApprovalPolicyForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=apl-,max=32"`
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchBudgetForm struct {
+	PageForm
+
+	EnvId models.Id `form:"envId" json:"envId" binding:"omitempty,startswith=env-,max=32"` // 环境ID，不传则返回项目下所有预算
+}
+
+type CreateBudgetForm struct {
+	BaseForm
+
+	EnvId  models.Id `json:"envId" form:"envId" binding:"omitempty,startswith=env-,max=32"`                        // 环境ID，为空时创建项目级预算
+	Amount float64   `json:"amount" form:"amount" binding:"required,gt=0"`                                         // 月度预算金额
+	Policy string    `json:"policy" form:"policy" binding:"omitempty,oneof=approval block" enums:"approval,block"` // 超出预算时的处理方式，approval 需要审批(默认)，block 禁止部署
+}
+
+type UpdateBudgetForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=bgt-,max=32"`
+
+	Amount  float64 `json:"amount" form:"amount" binding:"omitempty,gt=0"`
+	Policy  string  `json:"policy" form:"policy" binding:"omitempty,oneof=approval block" enums:"approval,block"`
+	Enabled bool    `json:"enabled" form:"enabled" enums:"true,false"`
+}
+
+type DetailBudgetForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=bgt-,max=32"`
+}
+
+type DeleteBudgetForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=bgt-,max=32"`
+}
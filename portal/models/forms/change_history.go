@@ -0,0 +1,12 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type ObjectHistoryForm struct {
+	PageForm
+
+	Id    models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"`
+	Field string    `form:"field" json:"field" binding:"omitempty,max=255"` // 按字段过滤，如 variables 返回所有变量的变更
+}
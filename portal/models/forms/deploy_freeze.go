@@ -0,0 +1,59 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchDeployFreezeForm struct {
+	PageForm
+
+	EnvId models.Id `form:"envId" json:"envId" binding:"omitempty,startswith=env-,max=32"` // 环境ID，不传则返回组织或项目下所有规则
+}
+
+type CreateDeployFreezeForm struct {
+	BaseForm
+
+	EnvId       models.Id `json:"envId" form:"envId" binding:"omitempty,startswith=env-,max=32"` // 环境ID，为空时根据是否传入项目ID创建组织或项目级规则
+	Name        string    `json:"name" form:"name" binding:"required,gte=2,lte=255"`
+	Description string    `json:"description" form:"description" binding:"max=255"`
+	Kind        string    `json:"kind" form:"kind" binding:"required,oneof=freeze window" enums:"freeze,window"`       // freeze 冻结期，window 部署窗口
+	Type        string    `json:"type" form:"type" binding:"required,oneof=recurring once" enums:"recurring,once"`     // recurring 每周循环，once 一次性
+	Action      string    `json:"action" form:"action" binding:"omitempty,oneof=block hold" enums:"block,hold"`        // block 拒绝创建任务，hold 任务等待冻结结束后执行
+	Timezone    string    `json:"timezone" form:"timezone" binding:"max=64" example:"Asia/Shanghai"`                   // 循环规则使用的时区
+	Weekdays    []string  `json:"weekdays" form:"weekdays" binding:"omitempty,dive,oneof=sun mon tue wed thu fri sat"` // 循环规则生效的星期，为空表示每天
+	StartTime   string    `json:"startTime" form:"startTime" binding:"max=5" example:"18:00"`                          // 循环规则开始时间
+	EndTime     string    `json:"endTime" form:"endTime" binding:"max=5" example:"09:00"`                              // 循环规则结束时间
+	StartAt     string    `json:"startAt" form:"startAt" binding:""`                                                   // 一次性规则开始时间
+	EndAt       string    `json:"endAt" form:"endAt" binding:""`                                                       // 一次性规则结束时间
+}
+
+type UpdateDeployFreezeForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=dfz-,max=32"`
+
+	Name        string   `json:"name" form:"name" binding:"omitempty,gte=2,lte=255"`
+	Description string   `json:"description" form:"description" binding:"max=255"`
+	Kind        string   `json:"kind" form:"kind" binding:"omitempty,oneof=freeze window" enums:"freeze,window"`
+	Type        string   `json:"type" form:"type" binding:"omitempty,oneof=recurring once" enums:"recurring,once"`
+	Action      string   `json:"action" form:"action" binding:"omitempty,oneof=block hold" enums:"block,hold"`
+	Enabled     bool     `json:"enabled" form:"enabled" enums:"true,false"`
+	Timezone    string   `json:"timezone" form:"timezone" binding:"max=64"`
+	Weekdays    []string `json:"weekdays" form:"weekdays" binding:"omitempty,dive,oneof=sun mon tue wed thu fri sat"`
+	StartTime   string   `json:"startTime" form:"startTime" binding:"max=5"`
+	EndTime     string   `json:"endTime" form:"endTime" binding:"max=5"`
+	StartAt     string   `json:"startAt" form:"startAt" binding:""`
+	EndAt       string   `json:"endAt" form:"endAt" binding:""`
+}
+
+type DetailDeployFreezeForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=dfz-,max=32"`
+}
+
+type DeleteDeployFreezeForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=dfz-,max=32"`
+}
@@ -26,7 +26,7 @@ type CreateEnvForm struct {
 	OneTime  bool      `form:"oneTime" json:"oneTime" binding:""`                                            // 一次性环境标识
 	Triggers []string  `form:"triggers" json:"triggers" binding:"omitempty,dive,required,oneof=commit prmr"` // 启用触发器，触发器：commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 
-	Tags string `form:"tags" json:"tags" binding:"max=255"` // 环境的 tags，多个 tag 以 "," 分隔
+	Tags string `form:"tags" json:"tags" binding:"max=2048"` // 环境的 tags，格式为 key=value，多个 tag 以 "," 分隔
 
 	AutoApproval    bool       `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
 	StopOnViolation bool       `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`       // 合规不通过是否中止任务
@@ -35,6 +35,7 @@ type CreateEnvForm struct {
 	RunnerId        string     `form:"runnerId" json:"runnerId" binding:"max=32"`                       // 环境默认部署通道
 	RunnerTags      []string   `form:"runnerTags" json:"runnerTags" binding:"omitempty,dive,max=256"`   // 环境默认部署通道tags
 	Revision        string     `form:"revision" json:"revision" binding:"max=64"`                       // 分支/标签
+	TplVersion      string     `form:"tplVersion" json:"tplVersion" binding:"max=64"`                   // 锁定的云模板版本，指定后使用版本对应的分支/标签
 	StepTimeout     int        `form:"stepTimeout" json:"stepTimeout" binding:""`                       // 部署超时时间（单位：秒）
 	Variables       []Variable `form:"variables" json:"variables" binding:"omitempty,dive,required"`    // 自定义变量列表，该变量列表会覆盖现有的变量
 
@@ -56,9 +57,11 @@ type CreateEnvForm struct {
 
 	Callback string `json:"callback" form:"callback" binding:"max=255"` // 外部请求的回调方式
 
-	CronDriftExpress string `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"` // 偏移检测表达式
-	AutoRepairDrift  bool   `json:"autoRepairDrift" form:"autoRepairDrift"`                     // 是否进行自动纠偏
-	OpenCronDrift    bool   `json:"openCronDrift" form:"openCronDrift" binding:""`              // 是否开启偏移检测
+	CronDriftExpress   string `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"`                                           // 偏移检测表达式
+	AutoRepairDrift    bool   `json:"autoRepairDrift" form:"autoRepairDrift"`                                                               // 是否进行自动纠偏
+	DriftRepairMode    string `json:"driftRepairMode" form:"driftRepairMode" binding:"omitempty,oneof=auto approval" enums:"auto,approval"` // 纠偏方式: auto 直接执行纠偏，approval 创建待审批的纠偏任务
+	DriftRepairTimeout int    `json:"driftRepairTimeout" form:"driftRepairTimeout" binding:"omitempty,min=0,max=43200"`                     // 纠偏任务的审批超时时间(分钟)，默认 1440
+	OpenCronDrift      bool   `json:"openCronDrift" form:"openCronDrift" binding:""`                                                        // 是否开启偏移检测
 
 	PolicyEnable bool        `json:"policyEnable" form:"policyEnable" binding:""`                                             // 是否开启合规检测
 	PolicyGroup  []models.Id `json:"policyGroup" form:"policyGroup" binding:"omitempty,dive,required,startswith=pog-,max=32"` // 绑定策略组集合
@@ -67,6 +70,8 @@ type CreateEnvForm struct {
 
 	AutoDeployCron  string `json:"autoDeployCron" form:"autoDeployCron"`   // 自动部署任务的Cron表达式
 	AutoDestroyCron string `json:"autoDestroyCron" form:"autoDestroyCron"` // 自动销毁任务的Cron表达式
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" form:"freezeOverrideReason" binding:"max=255"` // 部署冻结期内强制执行的原因，需要组织管理员或项目管理者权限
 }
 
 type SampleVariables struct {
@@ -77,9 +82,11 @@ type SampleVariables struct {
 
 type CronDriftForm struct {
 	BaseForm
-	CronDriftExpress string `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"` // 偏移检测表达式
-	AutoRepairDrift  bool   `json:"autoRepairDrift" form:"autoRepairDrift"`                     // 是否进行自动纠偏
-	OpenCronDrift    bool   `json:"openCronDrift" form:"openCronDrift"`                         // 是否开启偏移检测
+	CronDriftExpress   string `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"`                                           // 偏移检测表达式
+	AutoRepairDrift    bool   `json:"autoRepairDrift" form:"autoRepairDrift"`                                                               // 是否进行自动纠偏
+	DriftRepairMode    string `json:"driftRepairMode" form:"driftRepairMode" binding:"omitempty,oneof=auto approval" enums:"auto,approval"` // 纠偏方式: auto 直接执行纠偏，approval 创建待审批的纠偏任务
+	DriftRepairTimeout int    `json:"driftRepairTimeout" form:"driftRepairTimeout" binding:"omitempty,min=0,max=43200"`                     // 纠偏任务的审批超时时间(分钟)，默认 1440
+	OpenCronDrift      bool   `json:"openCronDrift" form:"openCronDrift"`                                                                   // 是否开启偏移检测
 }
 
 type UpdateEnvForm struct {
@@ -94,19 +101,21 @@ type UpdateEnvForm struct {
 	KeyId       models.Id `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"` // 部署密钥ID
 	RunnerId    string    `form:"runnerId" json:"runnerId" binding:"max=32"`                   // 环境默认部署通道
 	Archived    bool      `form:"archived" json:"archived" enums:"true,false"`                 // 归档状态，默认返回未归档环境
-	Tags        string    `form:"tags" json:"tags" binding:"max=255"`                          // 环境的 tags，多个 tag 以 "," 分隔
+	Tags        string    `form:"tags" json:"tags" binding:"max=2048"`                         // 环境的 tags，格式为 key=value，多个 tag 以 "," 分隔
 	StepTimeout int       `form:"stepTimeout" json:"stepTimeout" binding:""`                   // 部署超时时间（单位：秒）
 
 	AutoApproval    bool `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
 	StopOnViolation bool `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`       // 合规不通过是否中止任务
 
-	Triggers         []string `form:"triggers" json:"triggers" binding:"omitempty,dive,required,oneof=commit prmr"` // 启用触发器，触发器：commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
-	RetryNumber      int      `form:"retryNumber" json:"retryNumber" binding:""`                                    // 重试总次数
-	RetryDelay       int      `form:"retryDelay" json:"retryDelay" binding:""`                                      // 重试时间间隔
-	RetryAble        bool     `form:"retryAble" json:"retryAble" binding:""`                                        // 是否允许任务进行重试
-	CronDriftExpress string   `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"`                   // 偏移检测表达式
-	AutoRepairDrift  bool     `json:"autoRepairDrift" form:"autoRepairDrift"`                                       // 是否进行自动纠偏
-	OpenCronDrift    bool     `json:"openCronDrift" form:"openCronDrift"`                                           // 是否开启偏移检测
+	Triggers           []string `form:"triggers" json:"triggers" binding:"omitempty,dive,required,oneof=commit prmr"`                         // 启用触发器，触发器：commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
+	RetryNumber        int      `form:"retryNumber" json:"retryNumber" binding:""`                                                            // 重试总次数
+	RetryDelay         int      `form:"retryDelay" json:"retryDelay" binding:""`                                                              // 重试时间间隔
+	RetryAble          bool     `form:"retryAble" json:"retryAble" binding:""`                                                                // 是否允许任务进行重试
+	CronDriftExpress   string   `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"`                                           // 偏移检测表达式
+	AutoRepairDrift    bool     `json:"autoRepairDrift" form:"autoRepairDrift"`                                                               // 是否进行自动纠偏
+	DriftRepairMode    string   `json:"driftRepairMode" form:"driftRepairMode" binding:"omitempty,oneof=auto approval" enums:"auto,approval"` // 纠偏方式: auto 直接执行纠偏，approval 创建待审批的纠偏任务
+	DriftRepairTimeout int      `json:"driftRepairTimeout" form:"driftRepairTimeout" binding:"omitempty,min=0,max=43200"`                     // 纠偏任务的审批超时时间(分钟)，默认 1440
+	OpenCronDrift      bool     `json:"openCronDrift" form:"openCronDrift"`                                                                   // 是否开启偏移检测
 
 	PolicyEnable bool        `json:"policyEnable" form:"policyEnable"`                                                        // 是否开启合规检测
 	PolicyGroup  []models.Id `json:"policyGroup" form:"policyGroup" binding:"omitempty,dive,required,startswith=pog-,max=32"` // 绑定策略组集合
@@ -132,6 +141,7 @@ type DeployEnvForm struct {
 	RunnerId    string   `form:"runnerId" json:"runnerId" binding:"max=32"`                                                       // 环境默认部署通道
 	RunnerTags  []string `form:"runnerTags" json:"runnerTags" binding:"omitempty,dive,required,max=256"`                          // 环境默认部署通道Tags
 	Revision    string   `form:"revision" json:"revision" binding:"max=64"`                                                       // 分支/标签
+	TplVersion  string   `form:"tplVersion" json:"tplVersion" binding:"max=64"`                                                   // 锁定的云模板版本，指定后使用版本对应的分支/标签
 	StepTimeout int      `form:"stepTimeout" json:"stepTimeout" binding:""`                                                       // 部署超时时间（单位：秒）
 
 	RetryNumber int  `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
@@ -151,9 +161,11 @@ type DeployEnvForm struct {
 	VarGroupIds    []models.Id `json:"varGroupIds" form:"varGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
 	DelVarGroupIds []models.Id `json:"delVarGroupIds" form:"delVarGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
 
-	CronDriftExpress string `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"` // 偏移检测表达式
-	AutoRepairDrift  bool   `json:"autoRepairDrift" form:"autoRepairDrift"`                     // 是否进行自动纠偏
-	OpenCronDrift    bool   `json:"openCronDrift" form:"openCronDrift" binding:""`              // 是否开启偏移检测
+	CronDriftExpress   string `json:"cronDriftExpress" form:"cronDriftExpress" binding:"max=255"`                                           // 偏移检测表达式
+	AutoRepairDrift    bool   `json:"autoRepairDrift" form:"autoRepairDrift"`                                                               // 是否进行自动纠偏
+	DriftRepairMode    string `json:"driftRepairMode" form:"driftRepairMode" binding:"omitempty,oneof=auto approval" enums:"auto,approval"` // 纠偏方式: auto 直接执行纠偏，approval 创建待审批的纠偏任务
+	DriftRepairTimeout int    `json:"driftRepairTimeout" form:"driftRepairTimeout" binding:"omitempty,min=0,max=43200"`                     // 纠偏任务的审批超时时间(分钟)，默认 1440
+	OpenCronDrift      bool   `json:"openCronDrift" form:"openCronDrift" binding:""`                                                        // 是否开启偏移检测
 
 	PolicyEnable bool        `json:"policyEnable" form:"policyEnable" binding:""`                                             // 是否开启合规检测
 	PolicyGroup  []models.Id `json:"policyGroup" form:"policyGroup" binding:"omitempty,dive,required,startswith=pog-,max=32"` // 绑定策略组集合
@@ -165,6 +177,11 @@ type DeployEnvForm struct {
 
 	// 部署plan任务时生效，进行漂移检测时，从最后一次任务获取配置信息进行检测
 	IsDriftTask bool `json:"isDriftTask" form:"isDriftTask" `
+
+	Replaces    []string `json:"replaces" form:"replaces" binding:"omitempty,max=100,dive,required,max=512"` // 强制替换的资源地址列表(-replace)，仅 plan、apply 任务支持
+	RefreshOnly bool     `json:"refreshOnly" form:"refreshOnly"`                                             // 只同步 state 不变更资源(-refresh-only)，仅 plan、apply 任务支持
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" form:"freezeOverrideReason" binding:"max=255"` // 部署冻结期内强制执行的原因，需要组织管理员或项目管理者权限
 }
 
 type ArchiveEnvForm struct {
@@ -184,6 +201,8 @@ type SearchEnvForm struct {
 
 	Deploying *bool `form:"deploying" json:"deploying" binding:""` // 环境部署状态，不传则表示不过滤部署状态
 
+	Tags string `form:"tags" json:"tags" binding:"max=2048" example:"env=prod,owner"` // 按标签过滤，格式为 key=value 或 key(只要求包含该标签)，多个以 "," 分隔
+
 	StartTime *time.Time `json:"startTime" form:"startTime" `
 	EndTime   *time.Time `json:"endTime" form:"endTime" `
 }
@@ -219,6 +238,8 @@ type DestroyEnvForm struct {
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
 
 	Source string `json:"source" form:"source" binding:"required"` // 调用来源
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" form:"freezeOverrideReason" binding:"max=255"` // 部署冻结期内强制执行的原因，需要组织管理员或项目管理者权限
 }
 
 type SearchEnvVariableForm struct {
@@ -245,7 +266,35 @@ type UpdateEnvTagsForm struct {
 	BaseForm
 
 	Id   models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
-	Tags string    `json:"tags" form:"tags" binding:"max=255"`
+	Tags string    `json:"tags" form:"tags" binding:"max=2048"`                                        // 环境的 tags，格式为 key=value，多个 tag 以 "," 分隔
+}
+
+type EnvExtendForm struct {
+	BaseForm
+
+	Id       models.Id `uri:"id" json:"id" swaggerignore:"true"`            // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Duration string    `json:"duration" form:"duration" binding:"required"` // 延长时间，格式同 ttl，如 1h、1d
+}
+
+type EnvSignedExtendForm struct {
+	BaseForm
+
+	Token string `json:"token" form:"token" binding:"required"` // 提醒消息中延期链接携带的 token
+}
+
+type EnvRollbackForm struct {
+	BaseForm
+
+	Id                   models.Id `uri:"id" json:"id" swaggerignore:"true"`                                   // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	TaskId               models.Id `form:"taskId" json:"taskId" binding:"required,startswith=run-,max=32"`     // 回滚到的历史部署任务ID
+	FreezeOverrideReason string    `form:"freezeOverrideReason" json:"freezeOverrideReason" binding:"max=255"` // 部署冻结期内强制执行的原因
+}
+
+type EnvUpgradeForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`                                  // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Version string    `form:"version" json:"version" binding:"required,max=64" example:"v1.2.0"` // 升级到的云模板版本
 }
 
 type EnvLockForm struct {
@@ -266,3 +315,57 @@ type EnvUnLockConfirmForm struct {
 
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
 }
+
+type PromoteEnvForm struct {
+	BaseForm
+
+	Id              models.Id `uri:"id" json:"id" swaggerignore:"true"`                                          // 源环境ID，swagger 参数通过 param path 指定，这里忽略
+	TargetProjectId models.Id `json:"targetProjectId" form:"targetProjectId" binding:"required,max=32"`          // 目标项目ID
+	TargetEnvId     models.Id `json:"targetEnvId" form:"targetEnvId" binding:"omitempty,startswith=env-,max=32"` // 目标环境ID，不传则在目标项目中新建环境
+	TargetEnvName   string    `json:"targetEnvName" form:"targetEnvName" binding:"max=255"`                      // 新建环境的名称，默认与源环境同名
+
+	PinCommit bool `json:"pinCommit" form:"pinCommit"` // 是否将目标环境的 revision 固定为源环境最后一次成功部署的 commit
+	DryRun    bool `json:"dryRun" form:"dryRun"`       // 只返回配置差异，不做修改
+	Plan      bool `json:"plan" form:"plan"`           // 复制完成后是否在目标环境发起 plan 任务
+}
+
+type ImportResource struct {
+	Address string `json:"address" form:"address" binding:"required,max=512"` // 资源在 terraform 配置中的地址，如 aws_instance.web
+	Id      string `json:"id" form:"id" binding:"required,max=512"`           // 云资源 ID
+}
+
+type ImportEnvForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+
+	Resources []ImportResource `json:"resources" form:"resources" binding:"required,min=1,max=100,dive"`       // 需要导入的资源列表
+	Mode      string           `json:"mode" form:"mode" binding:"omitempty,oneof=cli block" enums:"cli,block"` // 导入方式，cli 逐个执行 terraform import，block 生成 import 块并自动生成资源配置(需要 terraform >= 1.5)，默认为 cli
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" form:"freezeOverrideReason" binding:"max=255"` // 部署冻结期内强制执行的原因，需要组织管理员或项目管理者权限
+}
+
+type StateOp struct {
+	Action      string `json:"action" form:"action" binding:"required,oneof=mv rm taint untaint forceUnlock" enums:"mv,rm,taint,untaint,forceUnlock"` // 操作类型
+	Address     string `json:"address" form:"address" binding:"max=512"`                                                                              // 资源地址，mv 操作时为源地址，forceUnlock 操作不需要
+	Destination string `json:"destination" form:"destination" binding:"max=512"`                                                                      // mv 操作的目标地址
+	LockId      string `json:"lockId" form:"lockId" binding:"max=128"`                                                                                // forceUnlock 操作的锁 ID
+}
+
+type EnvStateOpsForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+
+	Ops []StateOp `json:"ops" form:"ops" binding:"required,min=1,max=50,dive"` // 按顺序执行的 state 操作列表
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" form:"freezeOverrideReason" binding:"max=255"` // 部署冻结期内强制执行的原因，需要组织管理员或项目管理者权限
+}
+
+type EnvStateSnapshotForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"`     // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	TaskId models.Id `form:"taskId" json:"taskId" binding:"required,startswith=run-,max=32"`                 // state 操作任务ID
+	Stage  string    `form:"stage" json:"stage" binding:"omitempty,oneof=before after" enums:"before,after"` // 快照阶段，默认为 before
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+// EnvBatchFilterForm 批量操作的环境筛选条件，不传任何条件时为项目下所有未归档环境
+type EnvBatchFilterForm struct {
+	EnvIds []models.Id `json:"envIds" form:"envIds" binding:"omitempty,dive,required,startswith=env-,max=32"` // 环境ID列表
+	TplId  models.Id   `json:"tplId" form:"tplId" binding:"omitempty,startswith=tpl-,max=32"`                 // 云模板ID
+	Status string      `json:"status" form:"status" example:"active,failed"`                                  // 环境状态，多个以逗号分隔
+	Tags   []string    `json:"tags" form:"tags" binding:"omitempty,dive,required"`                            // 环境标签，格式为 key=value 或 key，需要包含所有标签
+}
+
+type PreviewEnvBatchForm struct {
+	BaseForm
+	EnvBatchFilterForm
+
+	Action string `json:"action" form:"action" binding:"required,oneof=deploy plan destroy lock unlock archive" enums:"deploy,plan,destroy,lock,unlock,archive"`
+}
+
+type CreateEnvBatchForm struct {
+	BaseForm
+	EnvBatchFilterForm
+
+	Action string `json:"action" form:"action" binding:"required,oneof=deploy plan destroy lock unlock archive" enums:"deploy,plan,destroy,lock,unlock,archive"`
+	Rate   int    `json:"rate" form:"rate" binding:"omitempty,min=1,max=60" example:"10"` // 每分钟最多创建的任务数，默认 10
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" form:"freezeOverrideReason" binding:"omitempty,max=255"` // 部署冻结期内强制执行的原因
+}
+
+type SearchEnvBatchForm struct {
+	PageForm
+
+	Status string `json:"status" form:"status" enums:"pending,running,complete,failed,partial"`
+}
+
+type DetailEnvBatchForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=eb-,max=32"`
+}
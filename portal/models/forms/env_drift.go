@@ -0,0 +1,70 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchEnvDriftRunForm struct {
+	PageForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Drifted *bool     `form:"drifted" json:"drifted"`                                                     // 只返回发生(或未发生)漂移的记录，不传则返回全部
+}
+
+type DetailEnvDriftRunForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"`           // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	DriftId models.Id `uri:"driftId" json:"driftId" swaggerignore:"true" binding:"required,startswith=edr-,max=32"` // 漂移检测记录ID
+}
+
+type SearchDriftRemediationForm struct {
+	PageForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"`                                                                   // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Status string    `form:"status" json:"status" binding:"omitempty,oneof=pending remediated failed rejected expired" enums:"pending,remediated,failed,rejected,expired"` // 纠偏状态
+}
+
+type DriftRemediationStatForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SearchDriftIgnoreRuleForm struct {
+	PageForm
+
+	EnvId models.Id `form:"envId" json:"envId" binding:"omitempty,startswith=env-,max=32"` // 环境ID，不传则返回组织或项目下所有规则
+}
+
+type CreateDriftIgnoreRuleForm struct {
+	BaseForm
+
+	EnvId        models.Id `json:"envId" form:"envId" binding:"omitempty,startswith=env-,max=32"`                                 // 环境ID，为空时根据是否传入项目ID创建组织或项目级规则
+	ResourceType string    `json:"resourceType" form:"resourceType" binding:"max=128" example:"aws_autoscaling_group"`            // 资源类型，支持通配符，为空表示所有类型
+	Attribute    string    `json:"attribute" form:"attribute" binding:"required_without=ResourceType,max=128" example:"tags_all"` // 属性名，支持通配符，为空表示忽略整个资源
+	Description  string    `json:"description" form:"description" binding:"max=255"`
+}
+
+type UpdateDriftIgnoreRuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=dir-,max=32"`
+
+	ResourceType string `json:"resourceType" form:"resourceType" binding:"max=128"`
+	Attribute    string `json:"attribute" form:"attribute" binding:"max=128"`
+	Description  string `json:"description" form:"description" binding:"max=255"`
+	Enabled      bool   `json:"enabled" form:"enabled" enums:"true,false"`
+}
+
+type DetailDriftIgnoreRuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=dir-,max=32"`
+}
+
+type DeleteDriftIgnoreRuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=dir-,max=32"`
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchEnvTagSchemaForm struct {
+	PageForm
+}
+
+type CreateEnvTagSchemaForm struct {
+	BaseForm
+
+	Key         string   `json:"key" form:"key" binding:"required,max=64,excludesall=0x2C=" example:"cost-center"` // 标签名，不能包含 "," 和 "="
+	Required    bool     `json:"required" form:"required" enums:"true,false"`                                      // 环境是否必须设置该标签
+	Values      []string `json:"values" form:"values" binding:"omitempty,dive,required,max=64,excludesall=0x2C="`  // 允许的取值，为空表示不限制
+	Description string   `json:"description" form:"description" binding:"max=255"`
+}
+
+type UpdateEnvTagSchemaForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=ets-,max=32"`
+
+	Required    bool     `json:"required" form:"required" enums:"true,false"`
+	Values      []string `json:"values" form:"values" binding:"omitempty,dive,required,max=64,excludesall=0x2C="`
+	Description string   `json:"description" form:"description" binding:"max=255"`
+}
+
+type DetailEnvTagSchemaForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=ets-,max=32"`
+}
+
+type DeleteEnvTagSchemaForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=ets-,max=32"`
+}
+
+type OrgTagCostStatForm struct {
+	BaseForm
+
+	TagKey     string `form:"tagKey" json:"tagKey" binding:"required,max=64" example:"cost-center"` // 按该标签的值分组统计
+	ProjectIds string `form:"projectIds" json:"projectIds"`                                         // 项目id列表，多个以 "," 分隔，为空统计组织下所有项目
+	Cycle      string `form:"cycle" json:"cycle" binding:"omitempty,len=7" example:"2022-06"`       // 账单月，默认为当前月
+}
@@ -12,7 +12,7 @@ type UpdateNotificationForm struct {
 	Secret    string    `json:"secret" form:"secret" binding:"max=255"`
 	Url       string    `json:"url" form:"url" binding:"omitempty,url,max=255"` //url格式
 	UserIds   []string  `form:"userIds" json:"userIds" binding:"omitempty,dive,required,startswith=u-,max=32"`
-	EventType []string  `form:"eventType" json:"eventType" binding:"omitempty,dive,required,startswith=task."` //enum('task.failed', 'task.complete', 'task.approving', 'task.running', "task.crondrift")
+	EventType []string  `form:"eventType" json:"eventType" binding:"omitempty,dive,required,startswith=task.|eq=budget.threshold|eq=env.expiring"` //enum('task.failed', 'task.complete', 'task.approving', 'task.running', "task.crondrift", "budget.threshold", "env.expiring", "task.driftremediation")
 }
 
 type CreateNotificationForm struct {
@@ -22,7 +22,7 @@ type CreateNotificationForm struct {
 	Secret    string   `json:"secret" form:"secret" binding:"max=255"`
 	Url       string   `json:"url" form:"url" binding:"omitempty,url,max=255"`
 	UserIds   []string `form:"userIds" json:"userIds" binding:"omitempty,dive,required,startswith=u-,max=32"`
-	EventType []string `form:"eventType" json:"eventType" binding:"omitempty,dive,required,startswith=task."` //enum('task.failed', 'task.complete', 'task.approving', 'task.running', "task.crondrift")
+	EventType []string `form:"eventType" json:"eventType" binding:"omitempty,dive,required,startswith=task.|eq=budget.threshold|eq=env.expiring"` //enum('task.failed', 'task.complete', 'task.approving', 'task.running', "task.crondrift", "budget.threshold", "env.expiring", "task.driftremediation")
 }
 
 type DeleteNotificationForm struct {
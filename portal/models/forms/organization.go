@@ -73,6 +73,7 @@ type SearchOrgResourceForm struct {
 	Q          string `form:"q" json:"q" binding:""`                   // 资源名称，支持模糊查询
 	ProjectIds string `form:"projectIds" json:"projectIds" binding:""` // 项目id列表
 	Providers  string `form:"providers" json:"providers" binding:""`   // provider 名称列表
+	Tags       string `form:"tags" json:"tags" binding:"max=2048"`     // 环境标签，格式为 key=value 或 key，多个以 "," 分隔
 }
 
 type InviteUsersBatchForm struct {
@@ -33,6 +33,10 @@ type UpdateProjectForm struct {
 	Status      string    `json:"status" form:"status" binding:"omitempty,oneof=enable disable"` // 项目状态 ('enable','disable')
 	Name        string    `json:"name" form:"name" binding:"omitempty,gte=2,lte=64" `            // 项目名称
 	Description string    `json:"description" form:"description" binding:"max=255"`              // 项目描述
+
+	EnvExpireNotify []string `json:"envExpireNotify" form:"envExpireNotify" binding:"omitempty,max=10,dive,required"` // 环境自动销毁前发送提醒的提前时间，如 ["1d","1h"]
+	EnvExtendMax    string   `json:"envExtendMax" form:"envExtendMax"`                                                // 环境单次延期的最长时间，为空表示不限制
+	EnvExtendLimit  int      `json:"envExtendLimit" form:"envExtendLimit" binding:"omitempty,min=0"`                  // 环境最多延期次数，0 表示不限制
 }
 
 type DeleteProjectForm struct {
@@ -58,4 +62,5 @@ type SearchProjectResourceForm struct {
 	Q         string `form:"q" json:"q" binding:""`                 // 资源名称，支持模糊查询
 	EnvIds    string `form:"envIds" json:"envIds" binding:""`       // 环境id列表
 	Providers string `form:"providers" json:"providers" binding:""` // provider 名称列表
+	Tags      string `form:"tags" json:"tags" binding:"max=2048"`   // 环境标签，格式为 key=value 或 key，多个以 "," 分隔
 }
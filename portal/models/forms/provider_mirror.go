@@ -0,0 +1,55 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import (
+	"cloudiac/portal/models"
+	"mime/multipart"
+)
+
+type SearchProviderMirrorForm struct {
+	PageForm
+
+	Q      string `form:"q" json:"q" binding:""`                                               // 模糊搜索，支持 provider namespace/type
+	Status string `form:"status" json:"status" binding:"omitempty,oneof=syncing ready failed"` // 按同步状态过滤
+}
+
+type UploadProviderMirrorForm struct {
+	BaseForm
+
+	Hostname  string `form:"hostname" json:"hostname" binding:"max=128" example:"registry.terraform.io"` // 为空时使用 registry.terraform.io
+	Namespace string `form:"namespace" json:"namespace" binding:"required,max=64" example:"hashicorp"`
+	Type      string `form:"type" json:"type" binding:"max=64" example:"random"`      // 为空时从安装包文件名中解析
+	Version   string `form:"version" json:"version" binding:"max=64" example:"3.1.0"` // 为空时从安装包文件名中解析
+	Os        string `form:"os" json:"os" binding:"max=32" example:"linux"`           // 为空时从安装包文件名中解析
+	Arch      string `form:"arch" json:"arch" binding:"max=32" example:"amd64"`       // 为空时从安装包文件名中解析
+
+	File *multipart.FileHeader `form:"file" json:"-" swaggerignore:"true" binding:"required"` // provider 安装包(zip 格式)
+}
+
+type SyncProviderMirrorForm struct {
+	BaseForm
+
+	Hostname  string   `form:"hostname" json:"hostname" binding:"max=128" example:"registry.terraform.io"` // 为空时使用 registry.terraform.io
+	Namespace string   `form:"namespace" json:"namespace" binding:"required,max=64" example:"hashicorp"`
+	Type      string   `form:"type" json:"type" binding:"required,max=64" example:"random"`
+	Version   string   `form:"version" json:"version" binding:"required,max=64" example:"3.1.0"`
+	Platforms []string `form:"platforms" json:"platforms" binding:"max=20" example:"linux_amd64"` // 同步的平台，默认为 linux_amd64
+}
+
+type DeleteProviderMirrorForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 安装包ID
+}
+
+// 以下为 terraform provider network mirror 协议的请求参数
+
+type ProviderMirrorProtocolForm struct {
+	BaseForm
+
+	Hostname  string `uri:"hostname" json:"hostname" swaggerignore:"true" binding:"required"`
+	Namespace string `uri:"namespace" json:"namespace" swaggerignore:"true" binding:"required"`
+	Type      string `uri:"type" json:"type" swaggerignore:"true" binding:"required"`
+	File      string `uri:"file" json:"file" swaggerignore:"true"` // index.json | <version>.json | <安装包文件名>
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchRegistryModuleForm struct {
+	PageForm
+
+	Q string `form:"q" json:"q" binding:""` // 模糊搜索，支持模块 namespace/name/provider
+}
+
+type CreateRegistryModuleForm struct {
+	BaseForm
+
+	Namespace   string    `form:"namespace" json:"namespace" binding:"required,max=64" example:"idcos"`
+	Name        string    `form:"name" json:"name" binding:"required,max=64" example:"vpc"`
+	Provider    string    `form:"provider" json:"provider" binding:"required,max=64" example:"alicloud"`
+	Description string    `form:"description" json:"description" binding:"max=255"`
+	VcsId       models.Id `form:"vcsId" json:"vcsId" binding:"required,max=32"`
+	RepoId      string    `form:"repoId" json:"repoId" binding:"required,max=128"`
+	Workdir     string    `form:"workdir" json:"workdir" binding:"max=255"` // 模块在代码仓库中的目录
+}
+
+type DetailRegistryModuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 模块ID
+}
+
+type UpdateRegistryModuleForm struct {
+	BaseForm
+
+	Id          models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 模块ID
+	Description string    `form:"description" json:"description" binding:"max=255"`
+	Workdir     string    `form:"workdir" json:"workdir" binding:"max=255"`
+}
+
+type DeleteRegistryModuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 模块ID
+}
+
+type SyncRegistryModuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 模块ID
+}
+
+type SearchRegistryModuleUsageForm struct {
+	PageForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 模块ID
+	Version string    `form:"version" json:"version" binding:"max=64"`                    // 按版本过滤
+}
+
+// 以下为 terraform module registry 协议的请求参数
+
+type RegistryProtocolListForm struct {
+	BaseForm
+
+	Namespace string `uri:"namespace" json:"namespace" swaggerignore:"true"`
+	Provider  string `form:"provider" json:"provider"`
+	Offset    int    `form:"offset" json:"offset" binding:"min=0"`
+	Limit     int    `form:"limit" json:"limit" binding:"min=0,max=100"`
+}
+
+type RegistryProtocolModuleForm struct {
+	BaseForm
+
+	Namespace string `uri:"namespace" json:"namespace" swaggerignore:"true" binding:"required"`
+	Name      string `uri:"name" json:"name" swaggerignore:"true" binding:"required"`
+	Provider  string `uri:"provider" json:"provider" swaggerignore:"true" binding:"required"`
+	Action    string `uri:"action" json:"action" swaggerignore:"true"` // versions | download | <version>/download
+}
+
+type RegistryModuleArchiveForm struct {
+	BaseForm
+
+	Token string `uri:"token" json:"token" swaggerignore:"true" binding:"required"` // 下载链接中的 token
+}
@@ -71,8 +71,17 @@ const (
 type ApproveTaskForm struct {
 	BaseForm
 
-	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"`                // 任务ID，swagger 参数通过 param path 指定，这里忽略
-	Action string    `form:"action" json:"action" binding:"required,oneof=approved rejected" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"`                // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Action  string    `form:"action" json:"action" binding:"required,oneof=approved rejected" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
+	Comment string    `form:"comment" json:"comment" binding:"max=1024"`                                                 // 审批意见
+}
+
+type RerunTaskForm struct {
+	BaseForm
+
+	Id                   models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Resume               bool      `form:"resume" json:"resume"`                                                       // 是否从源任务失败的步骤恢复执行(需要源任务工作目录仍然可用)
+	FreezeOverrideReason string    `form:"freezeOverrideReason" json:"freezeOverrideReason" binding:"max=255"`         // 部署冻结期内强制执行的原因
 }
 
 type AbortTaskForm struct {
@@ -84,10 +93,10 @@ type AbortTaskForm struct {
 type SearchEnvTasksForm struct {
 	NoPageSizeForm
 
-	Id       models.Id `uri:"id" json:"id" swaggerignore:"true" bingding:"omitempty,startswith=env-,max=32"`                                        // 环境ID，swagger 参数通过 param path 指定，这里忽略
-	TaskType string    `form:"taskType" json:"taskType" binding:"omitempty,oneof=plan apply destroy scan"`                                          // 任务类型
-	Source   string    `form:"source" json:"source" binding:"omitempty,oneof=manual driftPlan driftApply webhookPlan webhookApply autoDestroy api"` // 触发类型
-	User     string    `form:"user" json:"user"`                                                                                                    // 可根据执行人姓名或邮箱模糊查询
+	Id       models.Id `uri:"id" json:"id" swaggerignore:"true" bingding:"omitempty,startswith=env-,max=32"`                                                                   // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	TaskType string    `form:"taskType" json:"taskType" binding:"omitempty,oneof=plan apply destroy scan import stateOp"`                                                      // 任务类型
+	Source   string    `form:"source" json:"source" binding:"omitempty,oneof=manual driftPlan driftApply webhookPlan webhookApply webhookDestroy autoDestroy api driftRepair"` // 触发类型
+	User     string    `form:"user" json:"user"`                                                                                                                               // 可根据执行人姓名或邮箱模糊查询
 }
 
 type SearchTaskResourceForm struct {
@@ -110,6 +119,22 @@ type GetTaskStepLogForm struct {
 	StepId models.Id `uri:"stepId" json:"stepId" binding:"required,startswith=step-,max=32"` //步骤ID
 }
 
+type TaskPlanDiffForm struct {
+	PageForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"`                                                 // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Module string    `form:"module" json:"module" binding:""`                                                                                            // 模块地址，传空字符串时只返回根模块的资源
+	Action string    `form:"action" json:"action" binding:"omitempty,oneof=create update delete replace read" enums:"create,update,delete,replace,read"` // 资源变更动作
+	Q      string    `form:"q" json:"q" binding:""`                                                                                                      // 资源地址，支持模糊查询
+}
+
+type TaskVariablesDiffForm struct {
+	BaseForm
+
+	Id   models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Base models.Id `form:"base" json:"base" binding:"required,startswith=run-,max=32"`                 // 做为对比基准的任务ID
+}
+
 type SearchTaskResourceGraphForm struct {
 	BaseForm
 
@@ -42,6 +42,10 @@ type CreateTemplateForm struct {
 
 	KeyId models.Id `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"` // 部署密钥ID
 
+	PreviewEnable    bool      `json:"previewEnable" form:"previewEnable"`                                                // 是否开启 PR 预览环境
+	PreviewProjectId models.Id `json:"previewProjectId" form:"previewProjectId" binding:"omitempty,startswith=p-,max=32"` // 预览环境所属项目
+	PreviewTTL       string    `json:"previewTTL" form:"previewTTL" binding:"omitempty,max=64" example:"1d"`              // 预览环境生命周期
+
 	Source string `json:"source" form:"source" ` //云模板来源
 }
 
@@ -76,6 +80,10 @@ type UpdateTemplateForm struct {
 	PolicyGroup    []models.Id `json:"policyGroup" form:"policyGroup" binding:"omitempty,dive,required,startswith=pog-,max=32"` // 绑定的合规策略组
 	TplTriggers    []string    `json:"tplTriggers" form:"tplTriggers" binding:"omitempty,dive,required,max=255"`                // 分之推送自动触发合规 例如 ["commit"]
 	KeyId          models.Id   `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"`                             // 部署密钥ID
+
+	PreviewEnable    bool      `json:"previewEnable" form:"previewEnable"`                                                // 是否开启 PR 预览环境
+	PreviewProjectId models.Id `json:"previewProjectId" form:"previewProjectId" binding:"omitempty,startswith=p-,max=32"` // 预览环境所属项目
+	PreviewTTL       string    `json:"previewTTL" form:"previewTTL" binding:"omitempty,max=64" example:"1d"`              // 预览环境生命周期
 }
 
 type DeleteTemplateForm struct {
@@ -115,6 +123,14 @@ type TemplateVariableSearchForm struct {
 	Workdir      string    `json:"workdir" form:"workdir" binding:"max=255"`
 }
 
+type TemplateVariableSchemaForm struct {
+	BaseForm
+
+	Id       models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 云模板ID
+	Revision string    `json:"revision" form:"revision" binding:"max=64"`                  // 分支/标签，默认使用云模板的分支/标签
+	Workdir  string    `json:"workdir" form:"workdir" binding:"max=255"`                   // 工作目录，默认使用云模板的工作目录
+}
+
 type TemplateTfVersionSearchForm struct {
 	BaseForm
 	VcsId     models.Id `json:"vcsId" form:"vcsId" binding:"required,max=32"`
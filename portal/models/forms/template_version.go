@@ -0,0 +1,47 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchTemplateVersionForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 云模板ID
+}
+
+type CreateTemplateVersionForm struct {
+	BaseForm
+
+	Id        models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"`        // 云模板ID
+	Version   string    `form:"version" json:"version" binding:"required,max=64" example:"v1.2.0"` // 版本号，semver 格式
+	Revision  string    `form:"revision" json:"revision" binding:"max=64"`                         // 版本对应的分支/tag，为空时与版本号相同
+	Changelog string    `form:"changelog" json:"changelog" binding:"max=65535"`                    // 版本变更说明
+}
+
+type UpdateTemplateVersionForm struct {
+	BaseForm
+
+	Id        models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"`               // 云模板ID
+	VersionId models.Id `uri:"versionId" json:"versionId" swaggerignore:"true" binding:"required,max=32"` // 版本ID
+	Changelog string    `form:"changelog" json:"changelog" binding:"max=65535"`                           // 版本变更说明
+}
+
+type DeleteTemplateVersionForm struct {
+	BaseForm
+
+	Id        models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"`               // 云模板ID
+	VersionId models.Id `uri:"versionId" json:"versionId" swaggerignore:"true" binding:"required,max=32"` // 版本ID
+}
+
+type SyncTemplateVersionForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 云模板ID
+}
+
+type TemplateOutdatedEnvsForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,max=32"` // 云模板ID
+}
@@ -15,6 +15,7 @@ type WebhooksApiHandler struct {
 	User             User             `json:"user"`                                                                           // 用户信息
 	PullRequest      PullRequest      `json:"pull_request"`                                                                   //gitea
 	Action           string           `json:"action"`                                                                         // gitea pr状态，示例：open
+	ActionDesc       string           `json:"action_desc"`                                                                    // gitee pr 更新类型，示例：source_branch_changed
 	Before           string           `json:"before"`                                                                         //gitea push时回调的commitid
 	After            string           `json:"after"`                                                                          //gitea push时回调的commitid
 	Repository       Repository       `json:"repository"`                                                                     //gitea pr回调仓库信息
@@ -30,6 +31,13 @@ type ObjectAttributes struct {
 	TargetBranch string `json:"target_branch"`   // 目标分支
 	State        string `json:"state"`           // mr/pr动作(open、close)
 	Iid          int    `json:"iid" form:"iid" ` // prId
+	Action       string `json:"action"`          // mr 事件类型(open、reopen、update、close、merge)
+	Oldrev       string `json:"oldrev"`          // mr 有新的提交时为更新前的 commit id
+	LastCommit   Commit `json:"last_commit"`     // mr 最新提交
+}
+
+type Commit struct {
+	Id string `json:"id"`
 }
 
 type User struct {
@@ -52,6 +60,7 @@ type Base struct {
 //Head gitea
 type Head struct {
 	Ref string `json:"ref"`
+	Sha string `json:"sha"`
 }
 
 type Repository struct {
@@ -245,6 +245,22 @@ func Init(migrate bool) {
 	autoMigrate(&LdapOUProject{}, sess)
 
 	autoMigrate(&UserOperationLog{}, sess)
+	autoMigrate(&DeployFreeze{}, sess)
+	autoMigrate(&ApprovalPolicy{}, sess)
+	autoMigrate(&TaskApproval{}, sess)
+	autoMigrate(&Budget{}, sess)
+	autoMigrate(&ChangeHistory{}, sess)
+	autoMigrate(&EnvBatch{}, sess)
+	autoMigrate(&EnvBatchItem{}, sess)
+	autoMigrate(&EnvTagSchema{}, sess)
+	autoMigrate(&EnvDriftRun{}, sess)
+	autoMigrate(&DriftIgnoreRule{}, sess)
+	autoMigrate(&DriftRemediation{}, sess)
+	autoMigrate(&TemplateVersion{}, sess)
+	autoMigrate(&RegistryModule{}, sess)
+	autoMigrate(&RegistryModuleVersion{}, sess)
+	autoMigrate(&RegistryModuleUsage{}, sess)
+	autoMigrate(&ProviderMirrorPackage{}, sess)
 
 	dbMigrate(sess)
 }
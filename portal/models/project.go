@@ -14,6 +14,11 @@ type Project struct {
 	Status      string `json:"status" gorm:"type:enum('enable','disable');default:'enable';comment:状态"`
 
 	IsDemo bool `json:"isDemo"`
+
+	// 环境自动销毁提醒及延期规则
+	EnvExpireNotify StrSlice `json:"envExpireNotify" gorm:"type:json" swaggertype:"array,string" example:"1d,1h"` // 自动销毁前发送提醒的提前时间，为空时使用默认值
+	EnvExtendMax    string   `json:"envExtendMax" gorm:"default:''" example:"3d"`                                 // 单次延期的最长时间，为空表示不限制
+	EnvExtendLimit  int      `json:"envExtendLimit" gorm:"default:0"`                                             // 最多延期次数，0 表示不限制
 }
 
 func (Project) TableName() string {
@@ -0,0 +1,62 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	ProviderMirrorSourceUpload = "upload" // 手动上传
+	ProviderMirrorSourceSync   = "sync"   // 从 registry 同步
+
+	ProviderMirrorStatusSyncing = "syncing"
+	ProviderMirrorStatusReady   = "ready"
+	ProviderMirrorStatusFailed  = "failed"
+)
+
+// ProviderMirrorPackage portal 提供的 provider network mirror 中的安装包，每个平台(os_arch)一条记录
+type ProviderMirrorPackage struct {
+	TimedModel
+
+	Hostname  string `json:"hostname" gorm:"size:128;not null" example:"registry.terraform.io"`
+	Namespace string `json:"namespace" gorm:"size:64;not null" example:"hashicorp"`
+	Type      string `json:"type" gorm:"size:64;not null" example:"random"`
+	Version   string `json:"version" gorm:"size:64;not null" example:"3.1.0"`
+	Os        string `json:"os" gorm:"size:32;not null" example:"linux"`
+	Arch      string `json:"arch" gorm:"size:32;not null" example:"amd64"`
+
+	Filename string `json:"filename" gorm:"size:255;not null" example:"terraform-provider-random_3.1.0_linux_amd64.zip"`
+	Size     int64  `json:"size" gorm:"default:0"`
+	Sha256   string `json:"sha256" gorm:"size:64;default:''"` // 安装包的 sha256，用于生成 zh: 格式的 hash
+
+	Source  string `json:"source" gorm:"size:32;not null" enums:"upload,sync"`
+	Status  string `json:"status" gorm:"size:32;not null" enums:"syncing,ready,failed"`
+	Message string `json:"message" gorm:"type:text"` // 同步失败的原因
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (ProviderMirrorPackage) TableName() string {
+	return "iac_provider_mirror_package"
+}
+
+func (p *ProviderMirrorPackage) CustomBeforeCreate(*db.Session) error {
+	if p.Id == "" {
+		p.Id = NewId("pmp")
+	}
+	return nil
+}
+
+func (p ProviderMirrorPackage) Migrate(sess *db.Session) error {
+	return p.AddUniqueIndex(sess, "unique__provider__version__platform",
+		"hostname", "namespace", "type", "version", "os", "arch")
+}
+
+// Provider provider 地址，格式为 <hostname>/<namespace>/<type>
+func (p *ProviderMirrorPackage) Provider() string {
+	return p.Hostname + "/" + p.Namespace + "/" + p.Type
+}
+
+// Platform 安装包对应的平台，格式为 <os>_<arch>
+func (p *ProviderMirrorPackage) Platform() string {
+	return p.Os + "_" + p.Arch
+}
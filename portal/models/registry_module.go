@@ -0,0 +1,99 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// RegistryModule portal 私有 registry 中的 terraform 模块，模块地址为 <host>/<namespace>/<name>/<provider>
+type RegistryModule struct {
+	TimedModel
+
+	OrgId Id `json:"orgId" gorm:"size:32;not null"`
+
+	Namespace   string `json:"namespace" gorm:"size:64;not null" example:"idcos"`
+	Name        string `json:"name" gorm:"size:64;not null" example:"vpc"`
+	Provider    string `json:"provider" gorm:"size:64;not null" example:"alicloud"`
+	Description string `json:"description" gorm:"type:text"`
+
+	VcsId   Id     `json:"vcsId" gorm:"size:32;not null"`
+	RepoId  string `json:"repoId" gorm:"size:128;not null"`
+	Workdir string `json:"workdir" gorm:"default:''"` // 模块在代码仓库中的目录
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (RegistryModule) TableName() string {
+	return "iac_registry_module"
+}
+
+func (m *RegistryModule) CustomBeforeCreate(*db.Session) error {
+	if m.Id == "" {
+		m.Id = NewId("rm")
+	}
+	return nil
+}
+
+func (m RegistryModule) Migrate(sess *db.Session) error {
+	return m.AddUniqueIndex(sess, "unique__namespace__name__provider", "namespace", "name", "provider")
+}
+
+// Source 模块在 registry 中的地址(不包含 host)
+func (m *RegistryModule) Source() string {
+	return m.Namespace + "/" + m.Name + "/" + m.Provider
+}
+
+// RegistryModuleVersion 模块版本，由代码仓库中 semver 格式的 tag 发布
+type RegistryModuleVersion struct {
+	TimedModel
+
+	OrgId    Id     `json:"orgId" gorm:"size:32;not null"`
+	ModuleId Id     `json:"moduleId" gorm:"size:32;not null"`
+	Version  string `json:"version" gorm:"size:64;not null" example:"1.2.0"` // semver 格式的版本号
+	Tag      string `json:"tag" gorm:"size:64;not null" example:"v1.2.0"`    // 版本对应的代码仓库 tag
+
+	Downloads int64 `json:"downloads" gorm:"default:0"` // 下载次数
+}
+
+func (RegistryModuleVersion) TableName() string {
+	return "iac_registry_module_version"
+}
+
+func (v *RegistryModuleVersion) CustomBeforeCreate(*db.Session) error {
+	if v.Id == "" {
+		v.Id = NewId("rmv")
+	}
+	return nil
+}
+
+func (v RegistryModuleVersion) Migrate(sess *db.Session) error {
+	return v.AddUniqueIndex(sess, "unique__module__version", "module_id", "version")
+}
+
+// RegistryModuleUsage 记录云模板使用的模块版本，在 runner 下载模块时更新
+type RegistryModuleUsage struct {
+	TimedModel
+
+	OrgId    Id     `json:"orgId" gorm:"size:32;not null"`
+	ModuleId Id     `json:"moduleId" gorm:"size:32;not null"`
+	Version  string `json:"version" gorm:"size:64;not null"`
+	TplId    Id     `json:"tplId" gorm:"size:32;not null"`
+
+	LastEnvId  Id    `json:"lastEnvId" gorm:"size:32;default:''"`  // 最后一次使用该版本的环境
+	LastTaskId Id    `json:"lastTaskId" gorm:"size:32;default:''"` // 最后一次使用该版本的任务
+	LastUsedAt *Time `json:"lastUsedAt" gorm:"type:datetime"`
+}
+
+func (RegistryModuleUsage) TableName() string {
+	return "iac_registry_module_usage"
+}
+
+func (u *RegistryModuleUsage) CustomBeforeCreate(*db.Session) error {
+	if u.Id == "" {
+		u.Id = NewId("rmu")
+	}
+	return nil
+}
+
+func (u RegistryModuleUsage) Migrate(sess *db.Session) error {
+	return u.AddUniqueIndex(sess, "unique__module__version__tpl", "module_id", "version", "tpl_id")
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package resps
+
+import "cloudiac/portal/models"
+
+type ChangeHistoryResp struct {
+	models.ChangeHistory
+	Operator string `json:"operator" example:"超级管理员"` // 操作人名称
+}
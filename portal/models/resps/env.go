@@ -2,6 +2,8 @@
 
 package resps
 
+import "cloudiac/portal/models"
+
 type EnvUnLockConfirmResp struct {
 	AutoDestroyPass bool `json:"autoDestroyPass"`
 }
@@ -29,3 +31,46 @@ type EnvStatisticsResp struct {
 	CostTrendStat []EnvCostTrendStatResp `json:"costTrendStat"`
 	CostList      []EnvCostDetailResp    `json:"costList"`
 }
+
+type EnvConfigChange struct {
+	Field  string      `json:"field"`  // 配置项，变量为 variables.{type}.{name}
+	Action string      `json:"action"` // create, update, delete
+	Before interface{} `json:"before"` // 修改前的值，敏感变量值不返回
+	After  interface{} `json:"after"`  // 修改后的值，敏感变量值不返回
+}
+
+type PromoteEnvResp struct {
+	SourceEnvId  models.Id         `json:"sourceEnvId"`
+	TargetEnvId  models.Id         `json:"targetEnvId"`            // 目标环境ID，新建环境且 dryRun 时为空
+	Created      bool              `json:"created"`                // 是否新建环境
+	PinnedCommit string            `json:"pinnedCommit,omitempty"` // 固定的 commit id
+	PinnedTaskId models.Id         `json:"pinnedTaskId,omitempty"` // commit 来源的部署任务
+	Changes      []EnvConfigChange `json:"changes"`
+	TaskId       models.Id         `json:"taskId,omitempty"` // 发起的 plan 任务ID
+}
+
+type TagCostStatResp struct {
+	Key      string  `json:"key" example:"cost-center"`
+	Value    string  `json:"value" example:"rd"` // 标签值，为空表示未设置该标签的环境
+	Amount   float64 `json:"amount"`             // 费用
+	EnvCount int     `json:"envCount"`           // 环境数量
+}
+
+// DriftRemediationStatResp 环境漂移纠偏统计
+type DriftRemediationStatResp struct {
+	Total      int `json:"total"`
+	Pending    int `json:"pending"`
+	Remediated int `json:"remediated"`
+	Failed     int `json:"failed"`
+	Rejected   int `json:"rejected"`
+	Expired    int `json:"expired"`
+
+	MeanTimeToRemediate int64 `json:"meanTimeToRemediate"` // 平均纠偏时间(秒)，只统计纠偏完成的记录
+}
+
+type EnvSignedExtendInfoResp struct {
+	EnvId     models.Id    `json:"envId"`
+	EnvName   string       `json:"envName"`
+	DestroyAt *models.Time `json:"destroyAt"` // 当前的自动销毁时间
+	Duration  string       `json:"duration"`  // 确认后延长的时间
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package resps
+
+import "cloudiac/portal/models"
+
+type EnvBatchPreviewEnv struct {
+	Id         models.Id `json:"id"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	TaskStatus string    `json:"taskStatus"`
+	Locked     bool      `json:"locked"`
+	Tags       string    `json:"tags"`
+	Allowed    bool      `json:"allowed"`          // 是否会执行该操作
+	Reason     string    `json:"reason,omitempty"` // 不执行的原因
+}
+
+type EnvBatchPreviewResp struct {
+	Action  string               `json:"action"`
+	Total   int                  `json:"total"`   // 匹配的环境数量
+	Allowed int                  `json:"allowed"` // 会执行操作的环境数量
+	Envs    []EnvBatchPreviewEnv `json:"envs"`
+}
+
+type EnvBatchResp struct {
+	models.EnvBatch
+	Creator string `json:"creator"`
+}
+
+type EnvBatchItemResp struct {
+	models.EnvBatchItem
+	TaskStatus string `json:"taskStatus"` // 子任务的当前状态
+}
+
+type EnvBatchDetailResp struct {
+	EnvBatchResp
+	Items []EnvBatchItemResp `json:"items"`
+}
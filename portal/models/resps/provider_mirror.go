@@ -0,0 +1,19 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package resps
+
+// 以下为 terraform provider network mirror 协议的返回结构
+// https://www.terraform.io/internals/provider-network-mirror-protocol
+
+type ProviderMirrorVersions struct {
+	Versions map[string]struct{} `json:"versions"`
+}
+
+type ProviderMirrorArchive struct {
+	Url    string   `json:"url"`
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+type ProviderMirrorArchives struct {
+	Archives map[string]ProviderMirrorArchive `json:"archives"`
+}
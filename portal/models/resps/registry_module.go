@@ -0,0 +1,62 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package resps
+
+import "cloudiac/portal/models"
+
+type RegistryModuleResp struct {
+	models.RegistryModule
+
+	Source        string                         `json:"source" example:"iac.example.com/idcos/vpc/alicloud"` // 在 terraform 中引用模块使用的地址
+	LatestVersion string                         `json:"latestVersion" example:"1.2.0"`
+	Versions      []models.RegistryModuleVersion `json:"versions,omitempty"`
+}
+
+type RegistryModuleUsageResp struct {
+	models.RegistryModuleUsage
+
+	TplName string `json:"tplName"`
+}
+
+// 以下为 terraform module registry 协议的返回结构
+// https://www.terraform.io/internals/module-registry-protocol
+
+type RegistryProtocolModule struct {
+	Id          string `json:"id" example:"idcos/vpc/alicloud/1.2.0"`
+	Owner       string `json:"owner"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Provider    string `json:"provider"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+	PublishedAt string `json:"published_at"`
+	Downloads   int64  `json:"downloads"`
+	Verified    bool   `json:"verified"`
+}
+
+type RegistryProtocolMeta struct {
+	Limit         int    `json:"limit"`
+	CurrentOffset int    `json:"current_offset"`
+	NextOffset    *int   `json:"next_offset,omitempty"`
+	PrevOffset    *int   `json:"prev_offset,omitempty"`
+	NextUrl       string `json:"next_url,omitempty"`
+}
+
+type RegistryProtocolModuleList struct {
+	Meta    RegistryProtocolMeta     `json:"meta"`
+	Modules []RegistryProtocolModule `json:"modules"`
+}
+
+type RegistryProtocolVersion struct {
+	Version string `json:"version"`
+}
+
+type RegistryProtocolModuleVersions struct {
+	Source   string                    `json:"source"`
+	Versions []RegistryProtocolVersion `json:"versions"`
+}
+
+type RegistryProtocolVersionList struct {
+	Modules []RegistryProtocolModuleVersions `json:"modules"`
+}
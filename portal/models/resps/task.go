@@ -9,7 +9,28 @@ import (
 
 type TaskDetailResp struct {
 	desensitize.Task
-	Creator string `json:"creator" example:"超级管理员"`
+	Creator  string            `json:"creator" example:"超级管理员"`
+	Approval *TaskApprovalResp `json:"approval,omitempty"` // 审批信息，任务没有审批记录且未配置审批策略时为空
+}
+
+type TaskApprover struct {
+	UserId models.Id `json:"userId"`
+	Name   string    `json:"name"`
+}
+
+type TaskApprovalRecord struct {
+	models.TaskApproval
+	Username string `json:"username"`
+}
+
+type TaskApprovalResp struct {
+	PolicyId          models.Id            `json:"policyId"`
+	PolicyName        string               `json:"policyName"`
+	RequiredApprovals int                  `json:"requiredApprovals"` // 需要通过审批的人数
+	Approved          int                  `json:"approved"`          // 当前步骤已通过审批的人数
+	ExpireAt          *models.Time         `json:"expireAt"`          // 审批超时时间
+	PendingApprovers  []TaskApprover       `json:"pendingApprovers"`  // 待审批的用户
+	Approvals         []TaskApprovalRecord `json:"approvals"`         // 审批记录
 }
 
 type TSResource struct {
@@ -43,3 +64,74 @@ type TaskStepDetail struct {
 	EndAt   *models.Time `json:"endAt"`
 	Type    string       `json:"type"`
 }
+
+type PlanAttrDiff struct {
+	Name      string      `json:"name"`
+	Before    interface{} `json:"before"`
+	After     interface{} `json:"after"`
+	Sensitive bool        `json:"sensitive"` // 敏感属性，值已被隐藏
+	Unknown   bool        `json:"unknown"`   // 属性值在 apply 后才能确定
+	ForceNew  bool        `json:"forceNew"`  // 该属性的变更导致资源重建
+}
+
+type PlanResourceDiff struct {
+	Address       string         `json:"address" example:"module.web.alicloud_instance.web[0]"`
+	ModuleAddress string         `json:"moduleAddress" example:"module.web"`
+	Type          string         `json:"type"`
+	Name          string         `json:"name"`
+	Index         interface{}    `json:"index"`
+	ProviderName  string         `json:"providerName"`
+	Action        string         `json:"action" enums:"create,update,delete,replace,read"` // 资源变更动作
+	ActionReason  string         `json:"actionReason"`                                     // 执行该动作的原因
+	ReplacePaths  []string       `json:"replacePaths"`                                     // 导致资源重建的属性
+	Attrs         []PlanAttrDiff `json:"attrs"`                                            // 变更的属性，创建和删除时为全部属性
+}
+
+type PlanDiffModule struct {
+	Module  string `json:"module"` // 模块地址，根模块为空
+	Create  int    `json:"create"`
+	Update  int    `json:"update"`
+	Delete  int    `json:"delete"`
+	Replace int    `json:"replace"`
+	Read    int    `json:"read"`
+}
+
+// TaskVariableValue 变量在任务中的生效值及来源，敏感变量不返回值
+type TaskVariableValue struct {
+	Scope        string    `json:"scope" enums:"org,template,project,env"` // 变量生效的 scope
+	Value        string    `json:"value"`
+	Sensitive    bool      `json:"sensitive"`
+	VarGroupId   models.Id `json:"varGroupId,omitempty"`   // 来自变量组时为变量组ID
+	VarGroupName string    `json:"varGroupName,omitempty"` // 来自变量组时为变量组名称
+	UpdaterId    models.Id `json:"updaterId,omitempty"`    // 最后修改变量的用户
+	UpdaterName  string    `json:"updaterName,omitempty"`
+}
+
+type TaskVariableDiff struct {
+	Type         string             `json:"type" enums:"environment,terraform,ansible"`
+	Name         string             `json:"name"`
+	Action       string             `json:"action" enums:"added,removed,changed"`
+	ValueChanged bool               `json:"valueChanged"` // 变量值是否变化，敏感变量只通过该字段判断是否修改
+	Base         *TaskVariableValue `json:"base"`         // 基准任务中的变量，新增变量为 null
+	Target       *TaskVariableValue `json:"target"`       // 当前任务中的变量，删除的变量为 null
+}
+
+type TaskFieldDiff struct {
+	Field  string `json:"field" enums:"revision,commitId,tfVarsFile,playVarsFile,tfVersion"`
+	Base   string `json:"base"`
+	Target string `json:"target"`
+}
+
+type TaskVariablesDiffResp struct {
+	BaseTaskId models.Id          `json:"baseTaskId"`
+	TaskId     models.Id          `json:"taskId"`
+	Fields     []TaskFieldDiff    `json:"fields"`    // 代码版本、tfvars 文件、terraform 版本等执行参数的差异
+	Variables  []TaskVariableDiff `json:"variables"` // 有差异的变量
+}
+
+type PlanDiffResp struct {
+	Total    int64              `json:"total" example:"1"`
+	PageSize int                `json:"pageSize" example:"15"`
+	List     []PlanResourceDiff `json:"list"`
+	Modules  []PlanDiffModule   `json:"modules"` // 按模块分组的变更统计
+}
@@ -35,3 +35,13 @@ type TemplateDetailResp struct {
 	ProjectList []models.Id            `json:"projectId"`
 	PolicyGroup []string               `json:"policyGroup"`
 }
+
+// OutdatedEnvResp 锁定的版本落后于云模板最新版本的环境
+type OutdatedEnvResp struct {
+	EnvId         models.Id `json:"envId"`
+	EnvName       string    `json:"envName"`
+	ProjectId     models.Id `json:"projectId"`
+	Status        string    `json:"status"`
+	TplVersion    string    `json:"tplVersion" example:"1.1.0"`    // 环境锁定的版本
+	LatestVersion string    `json:"latestVersion" example:"1.2.0"` // 云模板最新版本
+}
@@ -53,6 +53,28 @@ func (v *TaskResult) Scan(value interface{}) error {
 	return UnmarshalValue(value, v)
 }
 
+// TaskImports 导入任务需要导入的资源列表
+type TaskImports []runner.TaskImport
+
+func (v TaskImports) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TaskImports) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TaskStateOps state 操作任务需要执行的操作列表
+type TaskStateOps []runner.TaskStateOp
+
+func (v TaskStateOps) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TaskStateOps) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
 type TaskExtra struct {
 	Source       string `json:"source,omitempty"`
 	TransitionId string `json:"transitionId,omitempty"`
@@ -76,6 +98,8 @@ const (
 	TaskTypeEnvParse = common.TaskTypeEnvParse
 	TaskTypeTplScan  = common.TaskTypeTplScan
 	TaskTypeTplParse = common.TaskTypeTplParse
+	TaskTypeImport   = common.TaskTypeImport
+	TaskTypeStateOp  = common.TaskTypeStateOp
 
 	TaskPending   = common.TaskPending
 	TaskRunning   = common.TaskRunning
@@ -86,6 +110,11 @@ const (
 	TaskComplete  = common.TaskComplete
 )
 
+const (
+	StateSnapshotBefore = "before"
+	StateSnapshotAfter  = "after"
+)
+
 var (
 	ErrTaskNoSteps = fmt.Errorf("task has no steps")
 )
@@ -126,6 +155,14 @@ type Task struct {
 	PlayVarsFile string   `json:"playVarsFile" gorm:"default:''"`
 	Targets      StrSlice `json:"targets" gorm:"type:json"` // 指定 terraform target 参数
 
+	Imports    TaskImports `json:"imports" gorm:"type:json"`     // 导入任务需要导入的资源
+	ImportMode string      `json:"importMode" gorm:"default:''"` // 资源导入方式: cli, block
+
+	StateOps TaskStateOps `json:"stateOps" gorm:"type:json"` // state 操作任务需要执行的操作
+
+	Replaces    StrSlice `json:"replaces" gorm:"type:json"`        // 强制替换的资源地址(-replace)
+	RefreshOnly bool     `json:"refreshOnly" gorm:"default:false"` // 只同步 state，不变更资源(-refresh-only)
+
 	Variables TaskVariables `json:"variables" gorm:"type:json"` // 本次执行使用的所有变量(继承、覆盖计算之后的)
 
 	StatePath string `json:"statePath" gorm:"not null"`
@@ -146,8 +183,22 @@ type Task struct {
 	Callback    string     `json:"callback" gorm:"default:''"`       // 外部请求的回调方式
 	IsDriftTask bool       `json:"isDriftTask" gorm:"default:false"` // 是否是偏移检测任务
 	Applied     bool       `json:"applied" gorm:"default:false"`     // 是否漂移执行了terraformApply
-	Source      string     `json:"source" gorm:"not null;default:manual;enum('manual','driftPlan','driftApply','webhookPlan', 'webhookApply', 'autoDestroy', 'api')"`
+	Source      string     `json:"source" gorm:"not null;default:manual;enum('manual','driftPlan','driftApply','webhookPlan', 'webhookApply', 'webhookDestroy', 'autoDestroy', 'api')"`
 	SourceSys   string     `json:"sourceSys" gorm:"not null;default:''"`
+
+	FreezeOverrideReason string `json:"freezeOverrideReason" gorm:"default:''"` // 冻结期内强制执行的原因
+
+	SourceTaskId Id       `json:"sourceTaskId" gorm:"size:32;default:''"` // 重新执行时的源任务ID
+	ResumeStep   int      `json:"resumeStep" gorm:"default:0"`            // 大于 0 表示从源任务的该步骤恢复执行
+	RunnerTags   StrSlice `json:"runnerTags" gorm:"type:json"`            // 创建任务时使用的部署通道 tags
+
+	ApprovalPolicyId Id `json:"approvalPolicyId" gorm:"size:32;default:''"` // 创建任务时生效的审批策略
+
+	BudgetExceeded bool `json:"budgetExceeded" gorm:"default:false"` // plan 预估费用超出预算，部署需要审批或被禁止
+
+	RollbackTaskId Id `json:"rollbackTaskId" gorm:"size:32;default:''"` // 回滚任务回滚到的历史部署任务ID
+
+	TplVersion string `json:"tplVersion" gorm:"size:64;default:''"` // 升级任务的目标云模板版本，部署成功后环境锁定到该版本
 }
 
 func (Task) TableName() string {
@@ -209,7 +260,7 @@ func (t *BaseTask) IsEffectTask() bool {
 
 // IsEffectTaskType 是否产生实际数据变动的任务类型
 func (BaseTask) IsEffectTaskType(typ string) bool {
-	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy)
+	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy, TaskTypeImport, TaskTypeStateOp)
 }
 
 func (BaseTask) GetTaskNameByType(typ string) string {
@@ -232,11 +283,26 @@ func (BaseTask) GetTaskNameByType(typ string) string {
 		return common.TaskTypeTplScanName
 	case TaskTypeTplParse:
 		return common.TaskTypeTplParseName
+	case TaskTypeImport:
+		return common.TaskTypeImportName
+	case TaskTypeStateOp:
+		return common.TaskTypeStateOpName
 	default:
 		panic("invalid task type")
 	}
 }
 
+// GetTaskRunModeName 返回带执行模式标识的任务名称，便于在任务列表中区分 refresh-only、replace 任务
+func (b BaseTask) GetTaskRunModeName(typ string, refreshOnly bool, replaces []string) string {
+	name := b.GetTaskNameByType(typ)
+	if refreshOnly {
+		return fmt.Sprintf("%s (refresh-only)", name)
+	} else if len(replaces) > 0 {
+		return fmt.Sprintf("%s (replace %d)", name, len(replaces))
+	}
+	return name
+}
+
 func (t *Task) StateJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFStateJsonFile)
 }
@@ -249,6 +315,15 @@ func (t *Task) PlanJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFPlanJsonFile)
 }
 
+// StateSnapshotPath state 操作任务的 state 快照路径，stage 为 before 或 after
+func (t *Task) StateSnapshotPath(stage string) string {
+	name := runner.TFStateBeforeFile
+	if stage == StateSnapshotAfter {
+		name = runner.TFStateAfterFile
+	}
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), name)
+}
+
 func (t *Task) TfParseJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.ScanInputFile)
 }
@@ -6,6 +6,8 @@ type ResourceDrift struct {
 	TimedModel
 	ResId       Id     `json:"resId" gorm:"size:32;not null"`
 	DriftDetail string `json:"driftDetail" gorm:"type:text"`
+	// 结构化的属性漂移信息，不包含被忽略的属性
+	Attrs DriftAttrs `json:"attrs" gorm:"type:json"`
 }
 
 func (ResourceDrift) TableName() string {
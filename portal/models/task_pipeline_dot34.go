@@ -119,6 +119,28 @@ destroy:
   - type: terraformDestroy
     name: Terraform Destroy
 
+import:
+  steps:
+    - type: checkout
+      name: Checkout Code
+
+    - type: terraformInit
+      name: Terraform Init
+
+    - type: terraformImport
+      name: Terraform Import
+
+stateOp:
+  steps:
+    - type: checkout
+      name: Checkout Code
+
+    - type: terraformInit
+      name: Terraform Init
+
+    - type: terraformStateOp
+      name: Terraform State
+
 # scan 和 parse 暂不开发自定义工作流
 envScan:
   steps:
@@ -157,6 +179,8 @@ type PipelineDot34 struct {
 	Plan    PipelineTaskDot34 `json:"plan" yaml:"plan"`
 	Apply   PipelineTaskDot34 `json:"apply" yaml:"apply"`
 	Destroy PipelineTaskDot34 `json:"destroy" yaml:"destroy"`
+	Import  PipelineTaskDot34 `json:"import" yaml:"import"`
+	StateOp PipelineTaskDot34 `json:"stateOp" yaml:"stateOp"`
 
 	// 0.3 pipeline 扫描步骤
 	PolicyScan  PipelineTaskDot34 `json:"scan" yaml:"scan"`
@@ -185,6 +209,10 @@ func (p PipelineDot34) GetTask(typ string) PipelineTaskDot34 {
 		return p.Apply
 	case common.TaskJobDestroy:
 		return p.Destroy
+	case common.TaskJobImport:
+		return p.Import
+	case common.TaskJobStateOp:
+		return p.StateOp
 	case common.TaskJobScan:
 		return p.PolicyScan
 	case common.TaskJobParse:
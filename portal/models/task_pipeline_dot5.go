@@ -66,6 +66,28 @@ destroy:
 
     terraformDestroy:
       name: Terraform Apply
+
+import:
+  steps:
+    checkout:
+      name: Checkout Code
+
+    terraformInit:
+      name: Terraform Init
+
+    terraformImport:
+      name: Terraform Import
+
+stateOp:
+  steps:
+    checkout:
+      name: Checkout Code
+
+    terraformInit:
+      name: Terraform Init
+
+    terraformStateOp:
+      name: Terraform State
 `
 
 type PipelineDot5 struct {
@@ -73,6 +95,8 @@ type PipelineDot5 struct {
 	Plan    PipelineDot5Task `json:"plan" yaml:"plan"`
 	Apply   PipelineDot5Task `json:"apply" yaml:"apply"`
 	Destroy PipelineDot5Task `json:"destroy" yaml:"destroy"`
+	Import  PipelineDot5Task `json:"import" yaml:"import"`
+	StateOp PipelineDot5Task `json:"stateOp" yaml:"stateOp"`
 
 	PolicyScan PipelineDot5Task `json:"scan" yaml:"scan"`
 	EnvScan    PipelineDot5Task `json:"envScan" yaml:"envScan"`
@@ -94,6 +118,10 @@ func (p PipelineDot5) GetTask(typ string) PipelineDot5Task {
 		return p.Apply
 	case common.TaskJobDestroy:
 		return p.Destroy
+	case common.TaskJobImport:
+		return p.Import
+	case common.TaskJobStateOp:
+		return p.StateOp
 	case common.TaskJobScan:
 		return p.PolicyScan
 	case common.TaskJobEnvScan:
@@ -146,6 +174,8 @@ var mTaskStepNames = map[string][]string{
 	common.TaskJobPlan:    {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepEnvScan},
 	common.TaskJobApply:   {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepEnvScan, common.TaskStepTfApply, common.TaskStepAnsiblePlay},
 	common.TaskJobDestroy: {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepEnvScan, common.TaskStepTfDestroy},
+	common.TaskJobImport:  {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfImport},
+	common.TaskJobStateOp: {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfStateOp},
 }
 
 func NewPipelineDot5(content string) (PipelineDot5, error) {
@@ -208,4 +238,24 @@ func CompletePipelineDot5(p *PipelineDot5) {
 			p.Destroy.Steps[stepName].Args = args
 		}
 	}
+
+	// import
+	if p.Import.Steps == nil {
+		p.Import.Steps = make(map[string]*PipelineStep)
+	}
+	for _, stepName := range mTaskStepNames[common.TaskJobImport] {
+		if _, ok := p.Import.Steps[stepName]; !ok {
+			p.Import.Steps[stepName] = &PipelineStep{Name: stepName}
+		}
+	}
+
+	// stateOp
+	if p.StateOp.Steps == nil {
+		p.StateOp.Steps = make(map[string]*PipelineStep)
+	}
+	for _, stepName := range mTaskStepNames[common.TaskJobStateOp] {
+		if _, ok := p.StateOp.Steps[stepName]; !ok {
+			p.StateOp.Steps[stepName] = &PipelineStep{Name: stepName}
+		}
+	}
 }
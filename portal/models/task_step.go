@@ -16,6 +16,8 @@ const (
 	TaskStepPlan     = common.TaskStepTfPlan
 	TaskStepApply    = common.TaskStepTfApply
 	TaskStepDestroy  = common.TaskStepTfDestroy
+	TaskStepImport   = common.TaskStepTfImport
+	TaskStepStateOp  = common.TaskStepTfStateOp
 	TaskStepPlay     = common.TaskStepAnsiblePlay
 	TaskStepCommand  = common.TaskStepCommand
 	TaskStepCollect  = common.TaskStepCollect
@@ -53,8 +55,9 @@ type TaskStep struct {
 	EndAt     *Time  `json:"endAt" gorm:"type:datetime"`
 	LogPath   string `json:"logPath" gorm:""`
 
-	MustApproval bool `json:"requireApproval" gorm:""`            // 步骤需要审批
-	ApproverId   Id   `json:"approverId" gorm:"size:32;not null"` // 审批者用户 id
+	MustApproval     bool  `json:"requireApproval" gorm:""`               // 步骤需要审批
+	ApproverId       Id    `json:"approverId" gorm:"size:32;not null"`    // 审批者用户 id
+	ApprovalExpireAt *Time `json:"approvalExpireAt" gorm:"type:datetime"` // 审批超时时间，超时后自动驳回
 
 	CurrentRetryCount int   `json:"currentRetryCount" gorm:"size:32;default:0"` // 当前重试次数
 	NextRetryTime     int64 `json:"nextRetryTime" gorm:"default:0"`             // 下次重试时间
@@ -49,6 +49,11 @@ type Template struct {
 
 	KeyId Id `json:"keyId" gorm:"size:32"` // 部署密钥ID
 
+	// PR 预览环境设置，开启后每个 PR 都会在 PreviewProjectId 项目下创建独立的预览环境，PR 关闭或合并后自动销毁
+	PreviewEnable    bool   `json:"previewEnable" gorm:"default:false"` // 是否开启 PR 预览环境
+	PreviewProjectId Id     `json:"previewProjectId" gorm:"size:32"`    // 预览环境所属项目
+	PreviewTTL       string `json:"previewTTL" gorm:"default:''"`       // 预览环境生命周期，为空表示 PR 关闭前不自动销毁
+
 	IsDemo bool   `json:"isDemo"`
 	Source string `json:"source"  gorm:"type:enum('registry','vcs');default:'vcs';comment:云模板来源"`
 }
@@ -0,0 +1,40 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	TemplateVersionSourceTag     = "tag"     // 从代码仓库的 semver tag 同步
+	TemplateVersionSourceRelease = "release" // 手动发布
+)
+
+// TemplateVersion 云模板的发布版本，环境可以锁定到某个版本
+type TemplateVersion struct {
+	TimedModel
+
+	OrgId Id `json:"orgId" gorm:"size:32;not null"`
+	TplId Id `json:"tplId" gorm:"size:32;not null"`
+
+	Version   string `json:"version" gorm:"size:64;not null" example:"1.2.0"`   // semver 格式的版本号
+	Revision  string `json:"revision" gorm:"size:64;not null" example:"v1.2.0"` // 版本对应的分支/标签/commit
+	Changelog string `json:"changelog" gorm:"type:text"`                        // 版本更新说明
+	Source    string `json:"source" gorm:"size:16;not null;default:'release'" enums:"tag,release"`
+
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+}
+
+func (TemplateVersion) TableName() string {
+	return "iac_template_version"
+}
+
+func (v *TemplateVersion) CustomBeforeCreate(*db.Session) error {
+	if v.Id == "" {
+		v.Id = NewId("tplv")
+	}
+	return nil
+}
+
+func (v TemplateVersion) Migrate(sess *db.Session) error {
+	return v.AddUniqueIndex(sess, "unique__tpl__version", "tpl_id", "version")
+}
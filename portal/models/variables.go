@@ -19,6 +19,12 @@ type VariableBody struct {
 
 	// 继承关系依赖数据创建枚举的顺序，后续新增枚举值时请按照新的继承顺序增加
 	Options StrSlice `yaml:"options" json:"options" gorm:"type:json"` // 可选值列表
+
+	UpdaterId Id `yaml:"-" json:"updaterId,omitempty" gorm:"size:32;default:''"` // 最后修改变量的用户
+
+	// 变量组变量的来源，只记录在任务的变量快照中
+	VarGroupId   Id     `yaml:"-" json:"varGroupId,omitempty" gorm:"-"`
+	VarGroupName string `yaml:"-" json:"varGroupName,omitempty" gorm:"-"`
 }
 
 func (v *VariableBody) Key() string {
@@ -64,6 +64,8 @@ type VcsPr struct {
 	TaskId Id  `json:"taskId" form:"taskId" `
 	EnvId  Id  `json:"envId" form:"envId" `
 	VcsId  Id  `json:"vcsId" form:"vcsId" `
+
+	CommentId int64 `json:"commentId" gorm:"default:0"` // PR 评论 id，同一 PR 重新 plan 时更新该评论
 }
 
 func (VcsPr) TableName() string {
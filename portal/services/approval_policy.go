@@ -0,0 +1,295 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func QueryApprovalPolicy(query *db.Session, orgId, projectId, envId models.Id) *db.Session {
+	query = QueryWithOrgProject(query.Model(&models.ApprovalPolicy{}), orgId, projectId)
+	if envId != "" {
+		query = query.Where("env_id = ?", envId)
+	}
+	return query.Order("created_at DESC")
+}
+
+func GetApprovalPolicyById(query *db.Session, id models.Id) (*models.ApprovalPolicy, e.Error) {
+	p := models.ApprovalPolicy{}
+	if err := query.Where("id = ?", id).First(&p); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ApprovalPolicyNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+// CheckApprovalPolicy 检查审批策略配置是否有效
+func CheckApprovalPolicy(p *models.ApprovalPolicy) e.Error {
+	newErr := func(format string, args ...interface{}) e.Error {
+		return e.New(e.ApprovalPolicyInvalid, fmt.Errorf(format, args...), http.StatusBadRequest)
+	}
+
+	if p.RequiredApprovals < 1 {
+		return newErr("'requiredApprovals' must be greater than 0")
+	}
+	if p.Timeout < 0 {
+		return newErr("'timeout' must not be negative")
+	}
+	if len(p.Approvers) == 0 && len(p.ApproverRoles) == 0 {
+		return newErr("'approvers' or 'approverRoles' is required")
+	}
+	for _, r := range p.ApproverRoles {
+		if !utils.StrInArray(r, consts.ProjectRoleManager, consts.ProjectRoleApprover,
+			consts.ProjectRoleOperator, consts.ProjectRoleGuest) {
+			return newErr("invalid approver role '%s'", r)
+		}
+	}
+	if len(p.ApproverRoles) == 0 && p.RequiredApprovals > len(p.Approvers) {
+		return newErr("'requiredApprovals' is greater than the number of approvers")
+	}
+	return nil
+}
+
+// checkApprovalPolicyScope 每个项目或环境只允许配置一个审批策略
+func checkApprovalPolicyScope(tx *db.Session, p *models.ApprovalPolicy) e.Error {
+	query := tx.Model(&models.ApprovalPolicy{}).
+		Where("project_id = ? AND env_id = ?", p.ProjectId, p.EnvId)
+	if p.Id != "" {
+		query = query.Where("id != ?", p.Id)
+	}
+	if exists, err := query.Exists(); err != nil {
+		return e.New(e.DBError, err)
+	} else if exists {
+		return e.New(e.ApprovalPolicyExists, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func CreateApprovalPolicy(tx *db.Session, p models.ApprovalPolicy) (*models.ApprovalPolicy, e.Error) {
+	if err := CheckApprovalPolicy(&p); err != nil {
+		return nil, err
+	}
+	if err := checkApprovalPolicyScope(tx, &p); err != nil {
+		return nil, err
+	}
+	if err := models.Create(tx, &p); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+func UpdateApprovalPolicy(tx *db.Session, id models.Id, attrs models.Attrs) (*models.ApprovalPolicy, e.Error) {
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.ApprovalPolicy{}, attrs); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update approval policy error: %v", err))
+	}
+	p, err := GetApprovalPolicyById(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckApprovalPolicy(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func DeleteApprovalPolicy(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.ApprovalPolicy{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete approval policy error: %v", err))
+	}
+	return nil
+}
+
+// GetEnvApprovalPolicy 获取环境生效的审批策略，优先使用环境级策略，没有配置时返回 nil
+func GetEnvApprovalPolicy(query *db.Session, projectId, envId models.Id) (*models.ApprovalPolicy, e.Error) {
+	p := models.ApprovalPolicy{}
+	err := query.Model(&models.ApprovalPolicy{}).
+		Where("project_id = ? AND enabled = ?", projectId, true).
+		Where("env_id = '' OR env_id = ?", envId).
+		Order("env_id DESC").First(&p)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+// getTaskApprovalPolicy 获取任务创建时生效的审批策略，策略被删除或禁用后按单人审批处理
+func getTaskApprovalPolicy(query *db.Session, task *models.Task) (*models.ApprovalPolicy, e.Error) {
+	if task.ApprovalPolicyId == "" {
+		return nil, nil
+	}
+	p, err := GetApprovalPolicyById(query, task.ApprovalPolicyId)
+	if err != nil {
+		if err.Code() == e.ApprovalPolicyNotExist {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !p.Enabled {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// IsApprovalPolicyApprover 用户是否为审批策略指定的审批人
+func IsApprovalPolicyApprover(query *db.Session, p *models.ApprovalPolicy, userId models.Id) (bool, e.Error) {
+	if utils.StrInArray(userId.String(), p.Approvers...) {
+		return true, nil
+	}
+	if len(p.ApproverRoles) == 0 {
+		return false, nil
+	}
+	exists, err := query.Model(&models.UserProject{}).
+		Where("user_id = ? AND project_id = ? AND role IN (?)", userId, p.ProjectId, []string(p.ApproverRoles)).
+		Exists()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return exists, nil
+}
+
+// GetApprovalPolicyApprovers 获取审批策略的所有审批人
+func GetApprovalPolicyApprovers(query *db.Session, p *models.ApprovalPolicy) ([]models.Id, e.Error) {
+	userIds := make([]models.Id, 0, len(p.Approvers))
+	for _, id := range p.Approvers {
+		userIds = append(userIds, models.Id(id))
+	}
+	if len(p.ApproverRoles) > 0 {
+		roleUserIds := make([]models.Id, 0)
+		if err := query.Model(&models.UserProject{}).
+			Where("project_id = ? AND role IN (?)", p.ProjectId, []string(p.ApproverRoles)).
+			Pluck("user_id", &roleUserIds); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		userIds = append(userIds, roleUserIds...)
+	}
+
+	seen := make(map[models.Id]bool, len(userIds))
+	approvers := make([]models.Id, 0, len(userIds))
+	for _, id := range userIds {
+		if !seen[id] {
+			seen[id] = true
+			approvers = append(approvers, id)
+		}
+	}
+	return approvers, nil
+}
+
+// GetTaskApprovals 查询任务的审批记录
+func GetTaskApprovals(query *db.Session, taskId models.Id) ([]models.TaskApproval, e.Error) {
+	approvals := make([]models.TaskApproval, 0)
+	if err := query.Model(&models.TaskApproval{}).Where("task_id = ?", taskId).
+		Order("created_at").Find(&approvals); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return approvals, nil
+}
+
+// ApprovalExpireAt 计算步骤进入待审批状态后的超时时间，策略未配置超时返回 nil
+func ApprovalExpireAt(p *models.ApprovalPolicy, now time.Time) *models.Time {
+	if p == nil || p.Timeout <= 0 {
+		return nil
+	}
+	t := models.Time(now.Add(time.Duration(p.Timeout) * time.Minute))
+	return &t
+}
+
+// SetTaskStepApprovalExpireAt 步骤进入待审批状态时按任务的审批策略设置超时时间
+func SetTaskStepApprovalExpireAt(tx *db.Session, task *models.Task, taskStep *models.TaskStep, now time.Time) e.Error {
+	policy, err := getTaskApprovalPolicy(tx, task)
+	if err != nil {
+		return err
+	}
+	expireAt := ApprovalExpireAt(policy, now)
+	if expireAt == nil {
+		return nil
+	}
+	if _, err := tx.Model(&models.TaskStep{}).Where("id = ?", taskStep.Id).
+		UpdateAttrs(models.Attrs{"approval_expire_at": expireAt}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	taskStep.ApprovalExpireAt = expireAt
+	return nil
+}
+
+// checkTaskApprover 检查用户是否可以审批任务步骤
+func checkTaskApprover(tx *db.Session, task *models.Task, p *models.ApprovalPolicy,
+	step int, userId models.Id, action string) e.Error {
+	if p == nil {
+		return nil
+	}
+
+	if action == models.TaskApprovalApproved && !p.AllowSelfApproval && task.CreatorId == userId {
+		return e.New(e.TaskApproveSelfDeny, http.StatusForbidden)
+	}
+	// 任务创建者可以驳回自己的任务
+	if action == models.TaskApprovalApproved || task.CreatorId != userId {
+		if ok, err := IsApprovalPolicyApprover(tx, p, userId); err != nil {
+			return err
+		} else if !ok {
+			return e.New(e.TaskApproveNotAllowed, http.StatusForbidden)
+		}
+	}
+
+	exists, err := tx.Model(&models.TaskApproval{}).
+		Where("task_id = ? AND step = ? AND user_id = ?", task.Id, step, userId).Exists()
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if exists {
+		return e.New(e.TaskApproveDuplicate, http.StatusConflict)
+	}
+	return nil
+}
+
+func createTaskApproval(tx *db.Session, task *models.Task, step int, userId models.Id, action, comment string) e.Error {
+	approval := models.TaskApproval{
+		OrgId:     task.OrgId,
+		ProjectId: task.ProjectId,
+		EnvId:     task.EnvId,
+		TaskId:    task.Id,
+		Step:      step,
+		UserId:    userId,
+		Action:    action,
+		Comment:   comment,
+	}
+	if err := models.Create(tx, &approval); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// ExpireTaskStepApproval 审批超时，自动驳回任务，需要在事务中调用
+// 步骤已被审批或驳回时不做修改，taskStep 更新为步骤的最新状态
+func ExpireTaskStepApproval(tx *db.Session, task *models.Task, taskStep *models.TaskStep) e.Error {
+	locked, err := GetTaskStep(tx.ForUpdate(), taskStep.TaskId, taskStep.Index)
+	if err != nil {
+		return err
+	}
+	*taskStep = *locked
+	if taskStep.Status != models.TaskStepApproving || taskStep.ApproverId != "" {
+		return nil
+	}
+
+	message := "approval timeout"
+	if err := createTaskApproval(tx, task, taskStep.Index, consts.SysUserId,
+		models.TaskApprovalRejected, message); err != nil {
+		return err
+	}
+	taskStep.ApproverId = consts.SysUserId
+	if _, err := tx.Model(&models.TaskStep{}).Where("id = ?", taskStep.Id).
+		UpdateAttrs(models.Attrs{"approver_id": consts.SysUserId}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return ChangeTaskStepStatus(tx, task, taskStep, models.TaskStepRejected, message)
+}
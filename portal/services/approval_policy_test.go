@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckApprovalPolicy(t *testing.T) {
+	cases := []struct {
+		policy models.ApprovalPolicy
+		valid  bool
+	}{
+		{models.ApprovalPolicy{RequiredApprovals: 1, Approvers: models.StrSlice{"u-1"}}, true},
+		{models.ApprovalPolicy{RequiredApprovals: 2, ApproverRoles: models.StrSlice{"approver", "manager"}}, true},
+		{models.ApprovalPolicy{RequiredApprovals: 0, Approvers: models.StrSlice{"u-1"}}, false},
+		{models.ApprovalPolicy{RequiredApprovals: 1}, false},
+		{models.ApprovalPolicy{RequiredApprovals: 3, Approvers: models.StrSlice{"u-1", "u-2"}}, false},
+		{models.ApprovalPolicy{RequiredApprovals: 1, ApproverRoles: models.StrSlice{"admin"}}, false},
+		{models.ApprovalPolicy{RequiredApprovals: 1, Approvers: models.StrSlice{"u-1"}, Timeout: -1}, false},
+	}
+
+	for i, c := range cases {
+		err := CheckApprovalPolicy(&c.policy)
+		if c.valid {
+			assert.Nil(t, err, "case %d", i)
+		} else if assert.NotNil(t, err, "case %d", i) {
+			assert.Equal(t, e.ApprovalPolicyInvalid, err.Code(), "case %d", i)
+		}
+	}
+}
+
+func TestApprovalExpireAt(t *testing.T) {
+	now := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, ApprovalExpireAt(nil, now))
+	assert.Nil(t, ApprovalExpireAt(&models.ApprovalPolicy{Timeout: 0}, now))
+
+	expireAt := ApprovalExpireAt(&models.ApprovalPolicy{Timeout: 90}, now)
+	if assert.NotNil(t, expireAt) {
+		assert.Equal(t, now.Add(90*time.Minute), time.Time(*expireAt))
+	}
+}
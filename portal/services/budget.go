@@ -0,0 +1,312 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/notificationrc"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 预算阈值通知的百分比，从高到低排列
+var budgetThresholds = []int{100, 80}
+
+func QueryBudget(query *db.Session, orgId, projectId, envId models.Id) *db.Session {
+	query = QueryWithOrgProject(query.Model(&models.Budget{}), orgId, projectId)
+	if envId != "" {
+		query = query.Where("env_id = ?", envId)
+	}
+	return query.Order("created_at DESC")
+}
+
+func GetBudgetById(query *db.Session, id models.Id) (*models.Budget, e.Error) {
+	b := models.Budget{}
+	if err := query.Where("id = ?", id).First(&b); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.BudgetNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &b, nil
+}
+
+// CheckBudget 检查预算配置是否有效
+func CheckBudget(b *models.Budget) e.Error {
+	if b.Amount <= 0 {
+		return e.New(e.BudgetInvalid, fmt.Errorf("'amount' must be greater than 0"), http.StatusBadRequest)
+	}
+	if !utils.StrInArray(b.Policy, models.BudgetPolicyApproval, models.BudgetPolicyBlock) {
+		return e.New(e.BudgetInvalid, fmt.Errorf("invalid policy '%s'", b.Policy), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// checkBudgetScope 每个项目或环境只允许配置一个预算
+func checkBudgetScope(tx *db.Session, b *models.Budget) e.Error {
+	query := tx.Model(&models.Budget{}).
+		Where("project_id = ? AND env_id = ?", b.ProjectId, b.EnvId)
+	if b.Id != "" {
+		query = query.Where("id != ?", b.Id)
+	}
+	if exists, err := query.Exists(); err != nil {
+		return e.New(e.DBError, err)
+	} else if exists {
+		return e.New(e.BudgetExists, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func CreateBudget(tx *db.Session, b models.Budget) (*models.Budget, e.Error) {
+	if err := CheckBudget(&b); err != nil {
+		return nil, err
+	}
+	if err := checkBudgetScope(tx, &b); err != nil {
+		return nil, err
+	}
+	if err := models.Create(tx, &b); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &b, nil
+}
+
+func UpdateBudget(tx *db.Session, id models.Id, attrs models.Attrs) (*models.Budget, e.Error) {
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.Budget{}, attrs); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update budget error: %v", err))
+	}
+	b, err := GetBudgetById(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckBudget(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func DeleteBudget(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.Budget{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete budget error: %v", err))
+	}
+	return nil
+}
+
+// GetBudgetSpent 查询预算范围(项目或环境)在账单月内已产生的费用
+func GetBudgetSpent(query *db.Session, b *models.Budget, cycle string) (float64, e.Error) {
+	var spent float64
+	query = query.Model(&models.Bill{}).Where("project_id = ? AND cycle = ?", b.ProjectId, cycle)
+	if b.EnvId != "" {
+		query = query.Where("env_id = ?", b.EnvId)
+	}
+	if err := query.Select("COALESCE(SUM(pretax_amount), 0)").Row().Scan(&spent); err != nil {
+		return 0, e.New(e.DBError, err)
+	}
+	return spent, nil
+}
+
+// GetTaskForecastCost 计算 plan 预估的月度费用变化，未进行费用预估时返回 0
+func GetTaskForecastCost(r models.TaskResult) float64 {
+	var cost float64
+	for _, c := range []*float32{r.ResAddedCost, r.ResDestroyedCost, r.ResUpdatedCost} {
+		if c != nil {
+			cost += float64(*c)
+		}
+	}
+	return cost
+}
+
+// BudgetUsage 预算的使用情况
+type BudgetUsage struct {
+	Budget   *models.Budget
+	Spent    float64 // 本月已产生的费用
+	Forecast float64 // 本次部署预计增加的月度费用
+}
+
+func (u BudgetUsage) Exceeded() bool {
+	return u.Spent+u.Forecast > u.Budget.Amount
+}
+
+func (u BudgetUsage) String() string {
+	scope := fmt.Sprintf("project %s", u.Budget.ProjectId)
+	if u.Budget.EnvId != "" {
+		scope = fmt.Sprintf("env %s", u.Budget.EnvId)
+	}
+	return fmt.Sprintf("%s budget %.2f, spent %.2f, forecast %+.2f", scope, u.Budget.Amount, u.Spent, u.Forecast)
+}
+
+// GetTaskExceededBudgets 获取部署后预计会超出的预算，包括环境预算及所在项目的预算
+func GetTaskExceededBudgets(query *db.Session, task *models.Task, cycle string) ([]BudgetUsage, e.Error) {
+	budgets := make([]*models.Budget, 0)
+	if err := query.Model(&models.Budget{}).
+		Where("project_id = ? AND enabled = ?", task.ProjectId, true).
+		Where("env_id = '' OR env_id = ?", task.EnvId).
+		Find(&budgets); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	forecast := GetTaskForecastCost(task.PlanResult)
+	exceeded := make([]BudgetUsage, 0)
+	for _, b := range budgets {
+		spent, err := GetBudgetSpent(query, b, cycle)
+		if err != nil {
+			return nil, err
+		}
+		u := BudgetUsage{Budget: b, Spent: spent, Forecast: forecast}
+		if u.Exceeded() {
+			exceeded = append(exceeded, u)
+		}
+	}
+	return exceeded, nil
+}
+
+// IsBudgetBlocked 超出的预算中有任一预算配置为禁止部署时返回 true
+func IsBudgetBlocked(usages []BudgetUsage) bool {
+	for _, u := range usages {
+		if u.Budget.Policy == models.BudgetPolicyBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBudgetApprover 用户是否可以审批超出预算的部署，即可以管理预算的项目管理者、组织管理员或平台管理员
+func IsBudgetApprover(query *db.Session, orgId, projectId, userId models.Id) (bool, e.Error) {
+	if UserIsSuperAdmin(query, userId) {
+		return true, nil
+	}
+	if ok, err := GetUserRoleByOrg(query, userId, orgId, consts.OrgRoleAdmin); err != nil || ok {
+		return ok, err
+	}
+	return GetUserRoleByProject(query, userId, projectId, consts.ProjectRoleManager)
+}
+
+// hasTaskBudgetApproval 步骤的审批人中是否有预算审批人
+func hasTaskBudgetApproval(query *db.Session, task *models.Task, step int) (bool, e.Error) {
+	userIds := make([]models.Id, 0)
+	if err := query.Model(&models.TaskApproval{}).
+		Where("task_id = ? AND step = ? AND action = ?", task.Id, step, models.TaskApprovalApproved).
+		Pluck("user_id", &userIds); err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	for _, userId := range userIds {
+		if ok, err := IsBudgetApprover(query, task.OrgId, task.ProjectId, userId); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// BudgetUsagesMessage 生成超出预算的提示信息
+func BudgetUsagesMessage(usages []BudgetUsage) string {
+	msgs := make([]string, 0, len(usages))
+	for _, u := range usages {
+		msgs = append(msgs, u.String())
+	}
+	return fmt.Sprintf("budget exceeded: %s", strings.Join(msgs, "; "))
+}
+
+// GetBudgetThreshold 返回费用达到的最高通知阈值，未达到任何阈值返回 0
+func GetBudgetThreshold(amount, spent float64) int {
+	if amount <= 0 {
+		return 0
+	}
+	for _, t := range budgetThresholds {
+		if spent*100 >= amount*float64(t) {
+			return t
+		}
+	}
+	return 0
+}
+
+// needBudgetNotify 每个账单月每个阈值只通知一次
+func needBudgetNotify(b *models.Budget, cycle string, threshold int) bool {
+	if threshold == 0 {
+		return false
+	}
+	return b.NotifiedCycle != cycle || threshold > b.NotifiedLevel
+}
+
+// BudgetThresholdAlert 待发送的预算阈值通知
+type BudgetThresholdAlert struct {
+	Budget *models.Budget
+	Alert  notificationrc.BudgetAlert
+}
+
+// ProcessBudgetThresholds 检查所有启用的预算，返回费用达到阈值需要发送的通知，
+// 调用方需要在事务提交后通过 SendBudgetThresholdAlerts 发送
+func ProcessBudgetThresholds(tx *db.Session, cycle string, lg logs.Logger) []BudgetThresholdAlert {
+	alerts := make([]BudgetThresholdAlert, 0)
+	budgets := make([]*models.Budget, 0)
+	if err := tx.Model(&models.Budget{}).Where("enabled = ?", true).Find(&budgets); err != nil {
+		lg.Errorf("query budgets error: %v", err)
+		return alerts
+	}
+
+	for _, b := range budgets {
+		spent, err := GetBudgetSpent(tx, b, cycle)
+		if err != nil {
+			lg.Errorf("get budget %s spent error: %v", b.Id, err)
+			continue
+		}
+		threshold := GetBudgetThreshold(b.Amount, spent)
+		if !needBudgetNotify(b, cycle, threshold) {
+			continue
+		}
+
+		if _, err := tx.Model(&models.Budget{}).Where("id = ?", b.Id).UpdateAttrs(models.Attrs{
+			"notified_cycle": cycle,
+			"notified_level": threshold,
+		}); err != nil {
+			lg.Errorf("update budget %s notified level error: %v", b.Id, err)
+			continue
+		}
+		lg.Infof("budget %s reached %d%%, spent %.2f of %.2f", b.Id, threshold, spent, b.Amount)
+		alerts = append(alerts, BudgetThresholdAlert{
+			Budget: b,
+			Alert: notificationrc.BudgetAlert{
+				Cycle:     cycle,
+				Amount:    b.Amount,
+				Spent:     spent,
+				Threshold: threshold,
+			},
+		})
+	}
+	return alerts
+}
+
+// SendBudgetThresholdAlerts 发送预算阈值通知
+func SendBudgetThresholdAlerts(query *db.Session, alerts []BudgetThresholdAlert) {
+	for i := range alerts {
+		sendBudgetThresholdMessage(query, alerts[i].Budget, &alerts[i].Alert)
+	}
+}
+
+func sendBudgetThresholdMessage(query *db.Session, b *models.Budget, alert *notificationrc.BudgetAlert) {
+	org, _ := GetOrganizationById(query, b.OrgId)
+	project, _ := GetProjectsById(query, b.ProjectId)
+	if org == nil || project == nil {
+		logs.Get().Warnf("budget %s: org or project not exists", b.Id)
+		return
+	}
+	var env *models.Env
+	if b.EnvId != "" {
+		env, _ = GetEnv(query, b.EnvId)
+	}
+
+	ns := notificationrc.NewNotificationService(&notificationrc.NotificationOptions{
+		OrgId:     b.OrgId,
+		ProjectId: b.ProjectId,
+		Project:   project,
+		Org:       org,
+		Env:       env,
+		EventType: consts.EventBudgetThreshold,
+		Budget:    alert,
+	})
+	ns.SendMessage()
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckBudget(t *testing.T) {
+	assert.Nil(t, CheckBudget(&models.Budget{Amount: 100, Policy: models.BudgetPolicyApproval}))
+	assert.Nil(t, CheckBudget(&models.Budget{Amount: 100, Policy: models.BudgetPolicyBlock}))
+
+	for _, b := range []models.Budget{{Amount: 0, Policy: models.BudgetPolicyBlock}, {Amount: 1, Policy: "deny"}} {
+		err := CheckBudget(&b)
+		if assert.NotNil(t, err) {
+			assert.Equal(t, e.BudgetInvalid, err.Code())
+		}
+	}
+}
+
+func TestGetTaskForecastCost(t *testing.T) {
+	added, destroyed := float32(30), float32(-10)
+	assert.Equal(t, float64(0), GetTaskForecastCost(models.TaskResult{}))
+	assert.Equal(t, float64(20), GetTaskForecastCost(models.TaskResult{ResAddedCost: &added, ResDestroyedCost: &destroyed}))
+}
+
+func TestBudgetUsage(t *testing.T) {
+	approval := &models.Budget{ProjectId: "p-1", Amount: 100, Policy: models.BudgetPolicyApproval}
+	block := &models.Budget{ProjectId: "p-1", EnvId: "env-1", Amount: 50, Policy: models.BudgetPolicyBlock}
+
+	assert.False(t, BudgetUsage{Budget: approval, Spent: 80, Forecast: 20}.Exceeded())
+	assert.True(t, BudgetUsage{Budget: approval, Spent: 80, Forecast: 20.5}.Exceeded())
+	// 删除资源后费用降低时不超出
+	assert.False(t, BudgetUsage{Budget: approval, Spent: 110, Forecast: -20}.Exceeded())
+
+	usages := []BudgetUsage{{Budget: approval, Spent: 90, Forecast: 20}}
+	assert.False(t, IsBudgetBlocked(usages))
+	usages = append(usages, BudgetUsage{Budget: block, Spent: 40, Forecast: 20})
+	assert.True(t, IsBudgetBlocked(usages))
+	assert.Equal(t, "budget exceeded: project p-1 budget 100.00, spent 90.00, forecast +20.00; "+
+		"env env-1 budget 50.00, spent 40.00, forecast +20.00", BudgetUsagesMessage(usages))
+}
+
+func TestBudgetThreshold(t *testing.T) {
+	assert.Equal(t, 0, GetBudgetThreshold(100, 79.9))
+	assert.Equal(t, 80, GetBudgetThreshold(100, 80))
+	assert.Equal(t, 80, GetBudgetThreshold(100, 99))
+	assert.Equal(t, 100, GetBudgetThreshold(100, 120))
+	assert.Equal(t, 0, GetBudgetThreshold(0, 120))
+
+	b := &models.Budget{}
+	assert.False(t, needBudgetNotify(b, "2022-05", 0))
+	assert.True(t, needBudgetNotify(b, "2022-05", 80))
+
+	b.NotifiedCycle, b.NotifiedLevel = "2022-05", 80
+	assert.False(t, needBudgetNotify(b, "2022-05", 80))
+	assert.True(t, needBudgetNotify(b, "2022-05", 100))
+	// 新的账单月重新通知
+	assert.True(t, needBudgetNotify(b, "2022-06", 80))
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 敏感变量的值不记录到变更历史中
+const changeHistorySensitiveValue = "(sensitive value)"
+
+var (
+	// 环境中由任务执行或定时任务维护的字段，不做为配置变更记录
+	envHistoryIgnoreFields = []string{
+		"createdAt", "updatedAt", "deletedAt", "deletedAtT", "status", "taskStatus", "deploying",
+		"lastTaskId", "lastResTaskId", "lastScanTaskId", "nextDriftTaskTime", "autoDeployAt", "statePath",
+	}
+	templateHistoryIgnoreFields = []string{
+		"createdAt", "updatedAt", "deletedAt", "deletedAtT", "lastScanTaskId",
+	}
+)
+
+type FieldChange struct {
+	Field    string
+	OldValue string
+	NewValue string
+}
+
+// DiffObjectFields 按 json 字段对比对象变更前后的值，返回有变化的字段
+func DiffObjectFields(before, after interface{}, ignores ...string) ([]FieldChange, error) {
+	bm, err := objectToJsonMap(before)
+	if err != nil {
+		return nil, err
+	}
+	am, err := objectToJsonMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(am))
+	for k := range am {
+		keys = append(keys, k)
+	}
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]FieldChange, 0)
+	for _, k := range keys {
+		if utils.StrInArray(k, ignores...) {
+			continue
+		}
+		if reflect.DeepEqual(bm[k], am[k]) {
+			continue
+		}
+		changes = append(changes, FieldChange{
+			Field:    k,
+			OldValue: jsonValueString(bm[k]),
+			NewValue: jsonValueString(am[k]),
+		})
+	}
+	return changes, nil
+}
+
+func objectToJsonMap(o interface{}) (map[string]interface{}, error) {
+	bs, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func jsonValueString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	bs, _ := json.Marshal(v)
+	return string(bs)
+}
+
+// DiffVariables 对比变量更新前后的变化，敏感变量只记录修改，不记录值
+func DiffVariables(before, after []models.Variable) []FieldChange {
+	bm := make(map[string]models.VariableBody, len(before))
+	for _, v := range before {
+		bm[v.Key()] = v.VariableBody
+	}
+	am := make(map[string]models.VariableBody, len(after))
+	for _, v := range after {
+		am[v.Key()] = v.VariableBody
+	}
+
+	keys := make([]string, 0, len(am))
+	for k := range am {
+		keys = append(keys, k)
+	}
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]FieldChange, 0)
+	for _, k := range keys {
+		bv, bok := bm[k]
+		av, aok := am[k]
+		// 敏感变量未提交新值时密文不变
+		if bok && aok && bv.Value == av.Value && bv.Sensitive == av.Sensitive &&
+			bv.Description == av.Description && utils.SliceEqualStr(bv.Options, av.Options) {
+			continue
+		}
+
+		c := FieldChange{}
+		if bok {
+			c.Field = fmt.Sprintf("variables.%s.%s", bv.Type, bv.Name)
+			c.OldValue = variableHistoryValue(bv)
+		}
+		if aok {
+			c.Field = fmt.Sprintf("variables.%s.%s", av.Type, av.Name)
+			c.NewValue = variableHistoryValue(av)
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func variableHistoryValue(v models.VariableBody) string {
+	value := v.Value
+	if v.Sensitive {
+		value = changeHistorySensitiveValue
+	}
+	return jsonValueString(map[string]interface{}{
+		"value":       value,
+		"sensitive":   v.Sensitive,
+		"description": v.Description,
+		"options":     v.Options,
+	})
+}
+
+// DiffVarGroupIds 对比对象关联的变量组变化
+func DiffVarGroupIds(before, after []models.Id) []FieldChange {
+	toStr := func(ids []models.Id) string {
+		ss := make([]string, 0, len(ids))
+		for _, id := range ids {
+			ss = append(ss, id.String())
+		}
+		sort.Strings(ss)
+		return strings.Join(ss, ",")
+	}
+	b, a := toStr(before), toStr(after)
+	if a == b {
+		return nil
+	}
+	return []FieldChange{{Field: "varGroups", OldValue: b, NewValue: a}}
+}
+
+// CreateChangeHistory 记录对象的字段变更
+func CreateChangeHistory(tx *db.Session, orgId models.Id, objectType string, objectId models.Id,
+	operatorId models.Id, requestId string, changes []FieldChange) e.Error {
+	for _, c := range changes {
+		h := models.ChangeHistory{
+			OrgId:      orgId,
+			ObjectType: objectType,
+			ObjectId:   objectId,
+			Field:      c.Field,
+			OldValue:   c.OldValue,
+			NewValue:   c.NewValue,
+			OperatorId: operatorId,
+			RequestId:  requestId,
+		}
+		if err := models.Create(tx, &h); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
+
+// RecordEnvChanges 记录环境配置的变更
+func RecordEnvChanges(tx *db.Session, before, after *models.Env, operatorId models.Id, requestId string) e.Error {
+	changes, err := DiffObjectFields(before, after, envHistoryIgnoreFields...)
+	if err != nil {
+		return e.New(e.InternalError, err)
+	}
+	return CreateChangeHistory(tx, after.OrgId, consts.ScopeEnv, after.Id, operatorId, requestId, changes)
+}
+
+// RecordTemplateChanges 记录云模板配置的变更
+func RecordTemplateChanges(tx *db.Session, before, after *models.Template, operatorId models.Id, requestId string) e.Error {
+	changes, err := DiffObjectFields(before, after, templateHistoryIgnoreFields...)
+	if err != nil {
+		return e.New(e.InternalError, err)
+	}
+	return CreateChangeHistory(tx, after.OrgId, consts.ScopeTemplate, after.Id, operatorId, requestId, changes)
+}
+
+// GetObjectVariables 查询对象直接定义的变量
+func GetObjectVariables(sess *db.Session, scope string, objectId models.Id) ([]models.Variable, e.Error) {
+	vars := make([]models.Variable, 0)
+	if err := WithVarScopeIdWhere(sess, models.Variable{}.TableName(), scope, objectId).Find(&vars); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return vars, nil
+}
+
+// GetObjectVarGroupIds 查询对象直接关联的变量组
+func GetObjectVarGroupIds(sess *db.Session, objectType string, objectId models.Id) ([]models.Id, e.Error) {
+	ids := make([]models.Id, 0)
+	if err := sess.Model(&models.VariableGroupRel{}).
+		Where("object_type = ? AND object_id = ?", objectType, objectId).
+		Pluck("var_group_id", &ids); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return ids, nil
+}
+
+// QueryChangeHistory 查询对象的变更记录，field 不为空时只查询该字段(前缀匹配)的变更
+func QueryChangeHistory(query *db.Session, orgId models.Id, objectType string, objectId models.Id, field string) *db.Session {
+	query = query.Model(&models.ChangeHistory{}).
+		Where("iac_change_history.org_id = ? AND iac_change_history.object_type = ? AND iac_change_history.object_id = ?",
+			orgId, objectType, objectId)
+	if field != "" {
+		query = query.Where("iac_change_history.field LIKE ?", fmt.Sprintf("%s%%", field))
+	}
+	query = query.Joins("left join iac_user as u on u.id = iac_change_history.operator_id").
+		LazySelectAppend("iac_change_history.*, u.name as operator")
+	return query.Order("iac_change_history.created_at DESC, iac_change_history.id DESC")
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffObjectFields(t *testing.T) {
+	before := models.Env{Name: "env", AutoApproval: false, Status: models.EnvStatusInactive, Tags: "a"}
+	after := before
+	after.AutoApproval = true
+	after.Status = models.EnvStatusActive
+	after.Tags = "a,b"
+
+	changes, err := DiffObjectFields(&before, &after, envHistoryIgnoreFields...)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldChange{
+		{Field: "autoApproval", OldValue: "false", NewValue: "true"},
+		{Field: "tags", OldValue: "a", NewValue: "a,b"},
+	}, changes)
+
+	changes, err = DiffObjectFields(&before, &before)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestDiffVariables(t *testing.T) {
+	newVar := func(name, value string, sensitive bool) models.Variable {
+		return models.Variable{VariableBody: models.VariableBody{
+			Scope: consts.ScopeEnv, Type: consts.VarTypeEnv, Name: name, Value: value, Sensitive: sensitive,
+		}}
+	}
+
+	before := []models.Variable{
+		newVar("keep", "1", false),
+		newVar("change", "1", false),
+		newVar("remove", "1", false),
+		newVar("secret", "cipher-1", true),
+		newVar("secret_keep", "cipher-2", true),
+	}
+	after := []models.Variable{
+		newVar("keep", "1", false),
+		newVar("change", "2", false),
+		newVar("add", "1", false),
+		newVar("secret", "cipher-3", true),
+		newVar("secret_keep", "cipher-2", true),
+	}
+
+	changes := DiffVariables(before, after)
+	fields := make([]string, 0, len(changes))
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+		assert.NotContains(t, c.OldValue, "cipher")
+		assert.NotContains(t, c.NewValue, "cipher")
+	}
+	assert.Equal(t, []string{
+		"variables.environment.add",
+		"variables.environment.change",
+		"variables.environment.remove",
+		"variables.environment.secret",
+	}, fields)
+
+	assert.Equal(t, "", changes[0].OldValue)
+	assert.Equal(t, "", changes[2].NewValue)
+	assert.True(t, strings.Contains(changes[3].NewValue, changeHistorySensitiveValue))
+}
+
+func TestDiffVarGroupIds(t *testing.T) {
+	assert.Empty(t, DiffVarGroupIds([]models.Id{"vg-b", "vg-a"}, []models.Id{"vg-a", "vg-b"}))
+	assert.Equal(t, []FieldChange{{Field: "varGroups", OldValue: "vg-a", NewValue: "vg-a,vg-c"}},
+		DiffVarGroupIds([]models.Id{"vg-a"}, []models.Id{"vg-c", "vg-a"}))
+}
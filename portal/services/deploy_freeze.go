@@ -0,0 +1,257 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// QueryDeployFreeze 查询组织或项目下配置的冻结规则，projectId 为空时只返回组织级规则
+func QueryDeployFreeze(query *db.Session, orgId, projectId, envId models.Id) *db.Session {
+	query = QueryWithOrgProject(query.Model(&models.DeployFreeze{}), orgId, projectId)
+	if envId != "" {
+		query = query.Where("env_id = ?", envId)
+	}
+	return query.Order("created_at DESC")
+}
+
+func GetDeployFreezeById(query *db.Session, id models.Id) (*models.DeployFreeze, e.Error) {
+	f := models.DeployFreeze{}
+	if err := query.Where("id = ?", id).First(&f); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.DeployFreezeNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &f, nil
+}
+
+func CreateDeployFreeze(tx *db.Session, f models.DeployFreeze) (*models.DeployFreeze, e.Error) {
+	if err := CheckDeployFreezeSchedule(&f); err != nil {
+		return nil, err
+	}
+	if err := models.Create(tx, &f); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &f, nil
+}
+
+func UpdateDeployFreeze(tx *db.Session, id models.Id, attrs models.Attrs) (*models.DeployFreeze, e.Error) {
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.DeployFreeze{}, attrs); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update deploy freeze error: %v", err))
+	}
+	f, err := GetDeployFreezeById(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	// 更新后整体校验一次时间配置
+	if err := CheckDeployFreezeSchedule(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func DeleteDeployFreeze(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.DeployFreeze{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete deploy freeze error: %v", err))
+	}
+	return nil
+}
+
+var deployFreezeWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// CheckDeployFreezeSchedule 检查冻结规则的时间配置是否有效
+func CheckDeployFreezeSchedule(f *models.DeployFreeze) e.Error {
+	newErr := func(format string, args ...interface{}) e.Error {
+		return e.New(e.DeployFreezeInvalidSchedule, fmt.Errorf(format, args...), http.StatusBadRequest)
+	}
+
+	switch f.Type {
+	case models.DeployFreezeTypeRecurring:
+		if _, err := time.LoadLocation(f.Timezone); err != nil {
+			return newErr("invalid timezone '%s'", f.Timezone)
+		}
+		if _, ok := parseClock(f.StartTime); !ok {
+			return newErr("invalid start time '%s'", f.StartTime)
+		}
+		if _, ok := parseClock(f.EndTime); !ok {
+			return newErr("invalid end time '%s'", f.EndTime)
+		}
+		for _, d := range f.Weekdays {
+			if !utils.StrInArray(d, deployFreezeWeekdays...) {
+				return newErr("invalid weekday '%s'", d)
+			}
+		}
+	case models.DeployFreezeTypeOnce:
+		if f.StartAt == nil || f.EndAt == nil {
+			return newErr("'startAt' and 'endAt' are required")
+		}
+		if !time.Time(*f.EndAt).After(time.Time(*f.StartAt)) {
+			return newErr("'endAt' must be after 'startAt'")
+		}
+	default:
+		return newErr("invalid type '%s'", f.Type)
+	}
+	return nil
+}
+
+// parseClock 解析 "HH:MM" 格式的时间，返回当天的分钟数
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// IsDeployFreezeInRange 判断 now 是否处于规则配置的时间段内
+func IsDeployFreezeInRange(f *models.DeployFreeze, now time.Time) bool {
+	if f.Type == models.DeployFreezeTypeOnce {
+		if f.StartAt == nil || f.EndAt == nil {
+			return false
+		}
+		return !now.Before(time.Time(*f.StartAt)) && now.Before(time.Time(*f.EndAt))
+	}
+
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return false
+	}
+	start, ok1 := parseClock(f.StartTime)
+	end, ok2 := parseClock(f.EndTime)
+	if !ok1 || !ok2 {
+		return false
+	}
+
+	t := now.In(loc)
+	cur := t.Hour()*60 + t.Minute()
+	matchDay := func(t time.Time) bool {
+		if len(f.Weekdays) == 0 {
+			return true
+		}
+		return utils.StrInArray(deployFreezeWeekdays[t.Weekday()], f.Weekdays...)
+	}
+
+	switch {
+	case start == end:
+		// 开始和结束时间相同表示全天
+		return matchDay(t)
+	case start < end:
+		return matchDay(t) && cur >= start && cur < end
+	default:
+		// 跨天的时间段，如 22:00 - 06:00，凌晨部分属于前一天的规则
+		return (matchDay(t) && cur >= start) || (matchDay(t.AddDate(0, 0, -1)) && cur < end)
+	}
+}
+
+// MatchDeployFreeze 从规则列表中找出当前生效的冻结规则，没有则返回 nil。
+// 处于任一 freeze 时间段内，或者配置了部署窗口但当前不在任何窗口内，都视为冻结。
+// 同时命中多条规则时优先返回 block 类型的规则
+func MatchDeployFreeze(freezes []models.DeployFreeze, now time.Time) *models.DeployFreeze {
+	var (
+		matched     []*models.DeployFreeze
+		windows     []*models.DeployFreeze
+		inAnyWindow bool
+	)
+	for i := range freezes {
+		f := &freezes[i]
+		if !f.Enabled {
+			continue
+		}
+		inRange := IsDeployFreezeInRange(f, now)
+		if f.Kind == models.DeployFreezeKindWindow {
+			windows = append(windows, f)
+			inAnyWindow = inAnyWindow || inRange
+		} else if inRange {
+			matched = append(matched, f)
+		}
+	}
+	if len(windows) > 0 && !inAnyWindow {
+		matched = append(matched, windows...)
+	}
+
+	for _, f := range matched {
+		if f.Action == models.DeployFreezeActionBlock {
+			return f
+		}
+	}
+	if len(matched) > 0 {
+		return matched[0]
+	}
+	return nil
+}
+
+// GetActiveDeployFreeze 获取环境当前生效的冻结规则(包括组织、项目和环境级别的规则)
+func GetActiveDeployFreeze(query *db.Session, orgId, projectId, envId models.Id, now time.Time) (*models.DeployFreeze, e.Error) {
+	freezes := make([]models.DeployFreeze, 0)
+	err := query.Model(&models.DeployFreeze{}).
+		Where("org_id = ? AND enabled = ?", orgId, true).
+		Where("project_id = '' OR (project_id = ? AND (env_id = '' OR env_id = ?))", projectId, envId).
+		Find(&freezes)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return MatchDeployFreeze(freezes, now), nil
+}
+
+// isDeployFreezeHoldSource 系统自动触发的任务在冻结期内不直接报错，而是保持 pending 等待冻结结束
+func isDeployFreezeHoldSource(source string) bool {
+	return !utils.StrInArray(source, consts.TaskSourceManual, consts.TaskSourceApi)
+}
+
+// CheckDeployFreezeOverridePerm 检查用户是否可以在冻结期内强制执行任务，需要平台管理员、组织管理员或项目管理者
+func CheckDeployFreezeOverridePerm(query *db.Session, orgId, projectId, userId models.Id) e.Error {
+	if userId == consts.SysUserId || UserIsSuperAdmin(query, userId) {
+		return nil
+	}
+	if ok, err := GetUserRoleByOrg(query, userId, orgId, consts.OrgRoleAdmin); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+	if projectId != "" {
+		if ok, err := GetUserRoleByProject(query, userId, projectId, consts.ProjectRoleManager); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+	}
+	return e.New(e.DeployFreezeOverrideDeny, http.StatusForbidden)
+}
+
+// checkTaskDeployFreeze 创建部署、销毁任务时检查冻结规则，
+// 需要等待冻结结束的任务会在 message 中记录原因，强制执行的任务需要创建者有强制执行权限
+func checkTaskDeployFreeze(tx *db.Session, task *models.Task) e.Error {
+	if !task.IsEffectTask() {
+		return nil
+	}
+	if task.FreezeOverrideReason != "" {
+		return CheckDeployFreezeOverridePerm(tx, task.OrgId, task.ProjectId, task.CreatorId)
+	}
+
+	freeze, err := GetActiveDeployFreeze(tx, task.OrgId, task.ProjectId, task.EnvId, time.Now())
+	if err != nil || freeze == nil {
+		return err
+	}
+
+	if freeze.Action == models.DeployFreezeActionHold || isDeployFreezeHoldSource(task.Source) {
+		task.Message = fmt.Sprintf("held by deploy freeze '%s'", freeze.Name)
+		return nil
+	}
+	return e.New(e.DeployFreezeActive, fmt.Errorf("deploy freeze '%s' is active", freeze.Name), http.StatusForbidden)
+}
+
+// GetTaskHoldingDeployFreeze 返回阻止任务开始执行的冻结规则，没有则返回 nil
+func GetTaskHoldingDeployFreeze(query *db.Session, task *models.Task) (*models.DeployFreeze, e.Error) {
+	if !task.IsEffectTask() || task.FreezeOverrideReason != "" {
+		return nil, nil
+	}
+	return GetActiveDeployFreeze(query, task.OrgId, task.ProjectId, task.EnvId, time.Now())
+}
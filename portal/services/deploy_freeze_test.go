@@ -0,0 +1,117 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDeployFreezeInRange(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("timezone data not available")
+	}
+	// 2022-06-06 为周一
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2022, 6, day, hour, min, 0, 0, loc)
+	}
+
+	workHours := &models.DeployFreeze{
+		Type:      models.DeployFreezeTypeRecurring,
+		Timezone:  "Asia/Shanghai",
+		Weekdays:  models.StrSlice{"mon", "tue", "wed", "thu", "fri"},
+		StartTime: "09:00",
+		EndTime:   "18:00",
+	}
+	overnight := &models.DeployFreeze{
+		Type:      models.DeployFreezeTypeRecurring,
+		Timezone:  "Asia/Shanghai",
+		Weekdays:  models.StrSlice{"fri"},
+		StartTime: "22:00",
+		EndTime:   "06:00",
+	}
+	start, end := models.Time(at(6, 0, 0)), models.Time(at(7, 0, 0))
+	once := &models.DeployFreeze{
+		Type:    models.DeployFreezeTypeOnce,
+		StartAt: &start,
+		EndAt:   &end,
+	}
+
+	cases := []struct {
+		name   string
+		freeze *models.DeployFreeze
+		now    time.Time
+		want   bool
+	}{
+		{"work hours", workHours, at(6, 10, 0), true},
+		{"work hours end", workHours, at(6, 18, 0), false},
+		{"weekend", workHours, at(11, 10, 0), false},
+		{"other timezone", workHours, at(6, 10, 0).UTC(), true},
+		{"overnight start", overnight, at(10, 23, 0), true},
+		{"overnight next day", overnight, at(11, 5, 59), true},
+		{"overnight other day", overnight, at(7, 5, 0), false},
+		{"once", once, at(6, 12, 0), true},
+		{"once end", once, at(7, 0, 0), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, IsDeployFreezeInRange(c.freeze, c.now))
+		})
+	}
+}
+
+func TestMatchDeployFreeze(t *testing.T) {
+	now := time.Date(2022, 6, 6, 10, 0, 0, 0, time.UTC)
+	newFreeze := func(id, kind, action, start, end string) models.DeployFreeze {
+		f := models.DeployFreeze{
+			Kind:      kind,
+			Type:      models.DeployFreezeTypeRecurring,
+			Action:    action,
+			Enabled:   true,
+			Timezone:  "UTC",
+			StartTime: start,
+			EndTime:   end,
+		}
+		f.Id = models.Id(id)
+		return f
+	}
+
+	assert.Nil(t, MatchDeployFreeze(nil, now))
+
+	// 不在冻结时间段内
+	assert.Nil(t, MatchDeployFreeze([]models.DeployFreeze{
+		newFreeze("f1", models.DeployFreezeKindFreeze, models.DeployFreezeActionBlock, "12:00", "13:00"),
+	}, now))
+
+	// 同时命中多条规则时优先返回 block 规则
+	f := MatchDeployFreeze([]models.DeployFreeze{
+		newFreeze("f1", models.DeployFreezeKindFreeze, models.DeployFreezeActionHold, "09:00", "11:00"),
+		newFreeze("f2", models.DeployFreezeKindFreeze, models.DeployFreezeActionBlock, "09:00", "11:00"),
+	}, now)
+	if assert.NotNil(t, f) {
+		assert.Equal(t, models.Id("f2"), f.Id)
+	}
+
+	// 在部署窗口内
+	assert.Nil(t, MatchDeployFreeze([]models.DeployFreeze{
+		newFreeze("w1", models.DeployFreezeKindWindow, models.DeployFreezeActionBlock, "01:00", "02:00"),
+		newFreeze("w2", models.DeployFreezeKindWindow, models.DeployFreezeActionBlock, "09:00", "11:00"),
+	}, now))
+
+	// 不在任何部署窗口内
+	f = MatchDeployFreeze([]models.DeployFreeze{
+		newFreeze("w1", models.DeployFreezeKindWindow, models.DeployFreezeActionHold, "01:00", "02:00"),
+	}, now)
+	if assert.NotNil(t, f) {
+		assert.Equal(t, models.Id("w1"), f.Id)
+	}
+
+	// 禁用的规则不生效
+	disabled := newFreeze("f1", models.DeployFreezeKindFreeze, models.DeployFreezeActionBlock, "09:00", "11:00")
+	disabled.Enabled = false
+	assert.Nil(t, MatchDeployFreeze([]models.DeployFreeze{disabled}, now))
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services/notificationrc"
+	"cloudiac/utils/logs"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var driftActionSymbols = map[string]string{
+	PlanActionCreate:  "+",
+	PlanActionUpdate:  "~",
+	PlanActionDelete:  "-",
+	PlanActionReplace: "-/+",
+}
+
+// BuildDriftSummary 生成漂移摘要，每行一个未被忽略的漂移资源及其漂移的属性
+func BuildDriftSummary(resources models.DriftResourceDiffs, maxRes int) string {
+	lines := make([]string, 0)
+	total := 0
+	for _, r := range resources {
+		if r.Ignored {
+			continue
+		}
+		total++
+		if len(lines) >= maxRes {
+			continue
+		}
+
+		line := fmt.Sprintf("%s %s", driftActionSymbols[r.Action], r.Address)
+		attrs := make([]string, 0, len(r.Attrs))
+		for _, a := range r.Attrs {
+			if !a.Ignored {
+				attrs = append(attrs, a.Name)
+			}
+		}
+		if len(attrs) > 0 && (r.Action == PlanActionUpdate || r.Action == PlanActionReplace) {
+			line = fmt.Sprintf("%s: %s", line, strings.Join(attrs, ", "))
+		}
+		lines = append(lines, line)
+	}
+	if total > len(lines) {
+		lines = append(lines, fmt.Sprintf("... and %d more", total-len(lines)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// GetDriftRemediationTimeout 纠偏任务的审批超时时间，环境未配置时使用默认值
+func GetDriftRemediationTimeout(env *models.Env) time.Duration {
+	timeout := env.DriftRepairTimeout
+	if timeout <= 0 {
+		timeout = consts.DriftRemediationDefaultTimeout
+	}
+	return time.Duration(timeout) * time.Minute
+}
+
+// driftRemediationStatus 根据纠偏任务的状态计算纠偏记录的状态，审批超时被驳回的任务记录为 expired
+func driftRemediationStatus(taskStatus string, expireAt *models.Time, endAt time.Time) string {
+	switch taskStatus {
+	case models.TaskComplete:
+		return models.DriftRemediationRemediated
+	case models.TaskRejected:
+		if expireAt != nil && !endAt.Before(time.Time(*expireAt)) {
+			return models.DriftRemediationExpired
+		}
+		return models.DriftRemediationRejected
+	case models.TaskFailed, models.TaskAborted:
+		return models.DriftRemediationFailed
+	default:
+		return models.DriftRemediationPending
+	}
+}
+
+// computeDriftRemediationStat 统计各状态的纠偏次数及平均纠偏时间
+func computeDriftRemediationStat(records []models.DriftRemediation) resps.DriftRemediationStatResp {
+	stat := resps.DriftRemediationStatResp{Total: len(records)}
+	var totalDuration int64
+	for _, r := range records {
+		switch r.Status {
+		case models.DriftRemediationPending:
+			stat.Pending++
+		case models.DriftRemediationRemediated:
+			stat.Remediated++
+			totalDuration += r.Duration
+		case models.DriftRemediationFailed:
+			stat.Failed++
+		case models.DriftRemediationRejected:
+			stat.Rejected++
+		case models.DriftRemediationExpired:
+			stat.Expired++
+		}
+	}
+	if stat.Remediated > 0 {
+		stat.MeanTimeToRemediate = totalDuration / int64(stat.Remediated)
+	}
+	return stat
+}
+
+// CloneDriftRemediationTask 基于漂移检测任务创建需要审批的纠偏任务
+func CloneDriftRemediationTask(tx *db.Session, src models.Task, env *models.Env) (*models.Task, e.Error) {
+	tpl, err := GetTemplateById(tx, src.TplId)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+
+	// 获取最新 repoAddr(带 token)，确保 vcs 更新后任务还可以正常 checkout 代码
+	repoAddr, _, err := GetTaskRepoAddrAndCommitId(tx, tpl, src.Revision)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+
+	task, er := newCommonTask(tpl, env, src)
+	if er != nil {
+		return nil, er
+	}
+
+	task.Name = consts.TaskDriftRepairName
+	task.Type = models.TaskTypeApply
+	task.IsDriftTask = false
+	task.RepoAddr = repoAddr
+	task.CommitId = src.CommitId
+	task.CreatorId = consts.SysUserId
+	// 纠偏任务总是需要人工审批
+	task.AutoApprove = false
+	task.StopOnViolation = env.StopOnViolation
+	task.Source = consts.TaskSourceDriftRepair
+	task.FreezeOverrideReason = ""
+
+	task.RunnerId, er = GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+	if er != nil {
+		return nil, er
+	}
+
+	return doCreateTask(tx, *task, tpl, env)
+}
+
+func GetPendingDriftRemediation(query *db.Session, envId models.Id) (*models.DriftRemediation, e.Error) {
+	r := models.DriftRemediation{}
+	if err := query.Model(&models.DriftRemediation{}).
+		Where("env_id = ? AND status = ?", envId, models.DriftRemediationPending).
+		First(&r); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// CreateDriftRemediation 环境发生漂移后创建待审批的纠偏任务，环境已有未完成的纠偏任务时不重复创建
+func CreateDriftRemediation(tx *db.Session, env *models.Env, driftTask *models.Task, run *models.EnvDriftRun,
+	now time.Time) (*models.DriftRemediation, e.Error) {
+	if pending, err := GetPendingDriftRemediation(tx, env.Id); err != nil {
+		return nil, err
+	} else if pending != nil {
+		return nil, nil
+	}
+
+	task, err := CloneDriftRemediationTask(tx, *driftTask, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// 审批超时时间从发现漂移开始计算，到期未审批的任务会被自动驳回
+	expireAt := models.Time(now.Add(GetDriftRemediationTimeout(env)))
+	if _, err := tx.Model(&models.TaskStep{}).
+		Where("task_id = ? AND must_approval = ?", task.Id, true).
+		UpdateAttrs(models.Attrs{"approval_expire_at": &expireAt}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	r := models.DriftRemediation{
+		OrgId:       env.OrgId,
+		ProjectId:   env.ProjectId,
+		EnvId:       env.Id,
+		DriftRunId:  run.Id,
+		DriftTaskId: driftTask.Id,
+		TaskId:      task.Id,
+		Status:      models.DriftRemediationPending,
+		DriftCount:  run.DriftCount,
+		Summary:     BuildDriftSummary(run.Resources, consts.DriftRemediationSummaryMaxRes),
+		DetectedAt:  models.Time(now),
+		ExpireAt:    &expireAt,
+	}
+	if err := models.Create(tx, &r); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// SyncDriftRemediation 纠偏任务结束后更新纠偏记录的状态及纠偏时间
+func SyncDriftRemediation(tx *db.Session, r *models.DriftRemediation, now time.Time) e.Error {
+	task, err := GetTaskById(tx, r.TaskId)
+	if err != nil {
+		if err.Code() != e.TaskNotExists {
+			return err
+		}
+		r.Status = models.DriftRemediationFailed
+	} else if !task.Exited() {
+		return nil
+	} else {
+		endAt := now
+		if task.EndAt != nil {
+			endAt = time.Time(*task.EndAt)
+		}
+		r.Status = driftRemediationStatus(task.Status, r.ExpireAt, endAt)
+		if r.Status == models.DriftRemediationRemediated {
+			at := models.Time(endAt)
+			r.RemediatedAt = &at
+			r.Duration = int64(endAt.Sub(time.Time(r.DetectedAt)) / time.Second)
+		}
+	}
+
+	if _, err := models.UpdateAttr(tx.Where("id = ?", r.Id), &models.DriftRemediation{}, models.Attrs{
+		"status": r.Status, "remediated_at": r.RemediatedAt, "duration": r.Duration,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// ProcessDriftRemediations 同步所有未完成的纠偏记录
+func ProcessDriftRemediations(tx *db.Session, now time.Time, lg logs.Logger) {
+	records := make([]models.DriftRemediation, 0)
+	if err := tx.Model(&models.DriftRemediation{}).
+		Where("status = ?", models.DriftRemediationPending).
+		Find(&records); err != nil {
+		lg.Errorf("query pending drift remediations error: %v", err)
+		return
+	}
+	for i := range records {
+		if err := SyncDriftRemediation(tx, &records[i], now); err != nil {
+			lg.Errorf("sync drift remediation %s error: %v", records[i].Id, err)
+		}
+	}
+}
+
+func QueryDriftRemediation(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.DriftRemediation{}).
+		Where("env_id = ?", envId).
+		Order("created_at DESC")
+}
+
+// GetEnvDriftRemediationStat 统计环境的纠偏情况及平均纠偏时间
+func GetEnvDriftRemediationStat(query *db.Session, envId models.Id) (*resps.DriftRemediationStatResp, e.Error) {
+	records := make([]models.DriftRemediation, 0)
+	if err := query.Model(&models.DriftRemediation{}).
+		Select("status, duration").
+		Where("env_id = ?", envId).
+		Find(&records); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	stat := computeDriftRemediationStat(records)
+	return &stat, nil
+}
+
+// getEnvOwnerIds 环境的负责人，包括环境创建者和项目管理者
+func getEnvOwnerIds(query *db.Session, env *models.Env) ([]string, e.Error) {
+	userIds := make([]string, 0)
+	if err := query.Model(&models.UserProject{}).
+		Where("project_id = ? AND role = ?", env.ProjectId, consts.ProjectRoleManager).
+		Pluck("user_id", &userIds); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if env.CreatorId != "" && env.CreatorId != consts.SysUserId {
+		userIds = append(userIds, env.CreatorId.String())
+	}
+	return userIds, nil
+}
+
+// SendDriftRemediationMessage 通知环境负责人审批纠偏任务
+func SendDriftRemediationMessage(query *db.Session, env *models.Env, task *models.Task, r *models.DriftRemediation) {
+	lg := logs.Get().WithField("envId", env.Id).WithField("taskId", task.Id)
+	org, err := GetOrganizationById(query, env.OrgId)
+	if err != nil {
+		lg.Warnf("get org %s error: %v", env.OrgId, err)
+		return
+	}
+	project, err := GetProjectsById(query, env.ProjectId)
+	if err != nil {
+		lg.Warnf("get project %s error: %v", env.ProjectId, err)
+		return
+	}
+	userIds, err := getEnvOwnerIds(query, env)
+	if err != nil {
+		lg.Warnf("get env owners error: %v", err)
+	}
+
+	alert := &notificationrc.DriftRemediationAlert{
+		DriftCount: r.DriftCount,
+		Summary:    r.Summary,
+	}
+	if r.ExpireAt != nil {
+		alert.ExpireAt = time.Time(*r.ExpireAt).Format("2006-01-02 15:04:05")
+	}
+
+	ns := notificationrc.NewNotificationService(&notificationrc.NotificationOptions{
+		OrgId:            env.OrgId,
+		ProjectId:        env.ProjectId,
+		Project:          project,
+		Org:              org,
+		Env:              env,
+		Task:             task,
+		EventType:        consts.EventDriftRemediation,
+		DriftRemediation: alert,
+		UserIds:          userIds,
+	})
+	ns.SendMessage()
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDriftSummary(t *testing.T) {
+	resources := models.DriftResourceDiffs{
+		{Address: "aws_instance.web", Type: "aws_instance", Action: PlanActionUpdate,
+			Attrs: models.DriftAttrs{{Name: "tags", Ignored: true}, {Name: "instance_type"}, {Name: "ami"}}},
+		{Address: "aws_autoscaling_group.web", Type: "aws_autoscaling_group", Action: PlanActionUpdate, Ignored: true,
+			Attrs: models.DriftAttrs{{Name: "desired_capacity", Ignored: true}}},
+		{Address: "aws_s3_bucket.logs", Type: "aws_s3_bucket", Action: PlanActionCreate,
+			Attrs: models.DriftAttrs{{Name: "bucket"}}},
+		{Address: "aws_db_instance.db", Type: "aws_db_instance", Action: PlanActionReplace,
+			Attrs: models.DriftAttrs{{Name: "engine_version"}}},
+	}
+
+	assert.Equal(t, "~ aws_instance.web: instance_type, ami\n"+
+		"+ aws_s3_bucket.logs\n"+
+		"-/+ aws_db_instance.db: engine_version", BuildDriftSummary(resources, 10))
+	assert.Equal(t, "~ aws_instance.web: instance_type, ami\n... and 2 more", BuildDriftSummary(resources, 1))
+	assert.Equal(t, "", BuildDriftSummary(nil, 10))
+}
+
+func TestGetDriftRemediationTimeout(t *testing.T) {
+	assert.Equal(t, time.Duration(consts.DriftRemediationDefaultTimeout)*time.Minute,
+		GetDriftRemediationTimeout(&models.Env{}))
+	assert.Equal(t, 30*time.Minute, GetDriftRemediationTimeout(&models.Env{DriftRepairTimeout: 30}))
+}
+
+func TestDriftRemediationStatus(t *testing.T) {
+	now := time.Now()
+	expireAt := models.Time(now)
+
+	cases := []struct {
+		taskStatus string
+		expireAt   *models.Time
+		endAt      time.Time
+		expect     string
+	}{
+		{models.TaskComplete, &expireAt, now, models.DriftRemediationRemediated},
+		{models.TaskFailed, &expireAt, now, models.DriftRemediationFailed},
+		{models.TaskAborted, &expireAt, now, models.DriftRemediationFailed},
+		{models.TaskRejected, &expireAt, now.Add(-time.Minute), models.DriftRemediationRejected},
+		{models.TaskRejected, &expireAt, now.Add(time.Second), models.DriftRemediationExpired},
+		{models.TaskRejected, nil, now, models.DriftRemediationRejected},
+		{models.TaskApproving, &expireAt, now, models.DriftRemediationPending},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expect, driftRemediationStatus(c.taskStatus, c.expireAt, c.endAt), c.taskStatus)
+	}
+}
+
+func TestComputeDriftRemediationStat(t *testing.T) {
+	stat := computeDriftRemediationStat([]models.DriftRemediation{
+		{Status: models.DriftRemediationRemediated, Duration: 600},
+		{Status: models.DriftRemediationRemediated, Duration: 1800},
+		{Status: models.DriftRemediationExpired},
+		{Status: models.DriftRemediationRejected},
+		{Status: models.DriftRemediationPending},
+	})
+	assert.Equal(t, 5, stat.Total)
+	assert.Equal(t, 2, stat.Remediated)
+	assert.Equal(t, 1, stat.Expired)
+	assert.Equal(t, 1, stat.Rejected)
+	assert.Equal(t, 1, stat.Pending)
+	assert.Equal(t, int64(1200), stat.MeanTimeToRemediate)
+
+	assert.Equal(t, int64(0), computeDriftRemediationStat(nil).MeanTimeToRemediate)
+}
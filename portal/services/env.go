@@ -10,7 +10,6 @@ import (
 	"sync"
 	"time"
 	"sort"
-	"unicode/utf8"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
@@ -210,8 +209,11 @@ func ChangeEnvStatusWithTaskAndStep(tx *db.Session, id models.Id, task *models.T
 				return e.New(e.InternalError, errors.Wrap(err, "getEnvStatusOnTaskAborted"))
 			}
 		case models.TaskComplete:
-			if task.Type == models.TaskTypeApply {
+			if task.Type == models.TaskTypeApply || task.Type == models.TaskTypeImport {
 				envStatus = models.EnvStatusActive
+				if err := applyEnvUpgrade(tx, task); err != nil {
+					return err
+				}
 			} else if task.Type == models.TaskTypeDestroy {
 				envStatus = models.EnvStatusDestroyed
 			}
@@ -252,7 +254,8 @@ func getEnvStatusOnTaskAborted(db *db.Session, taskId models.Id) (string, error)
 
 	for _, s := range steps {
 		// 如果执行了 apply 步骤则环境变为 failed 状态
-		if (s.Type == models.TaskStepApply || s.Type == models.TaskStepDestroy) && s.IsStarted() {
+		if utils.StrInArray(s.Type, models.TaskStepApply, models.TaskStepDestroy,
+			models.TaskStepImport, models.TaskStepStateOp) && s.IsStarted() {
 			return models.EnvStatusFailed, nil
 		}
 	}
@@ -449,21 +452,6 @@ func CheckoutAutoApproval(autoApproval, autoDrift bool, triggers []string) bool
 	return true
 }
 
-func CheckEnvTags(tags string) e.Error {
-	parts := strings.Split(tags, ",")
-
-	if len(parts) > consts.EnvMaxTagNum {
-		return e.New(e.EnvTagNumLimited)
-	}
-
-	for _, t := range parts {
-		if utf8.RuneCountInString(t) > consts.EnvMaxTagLength {
-			return e.New(e.EnvTagLengthLimited)
-		}
-	}
-	return nil
-}
-
 func EnvLock(dbSess *db.Session, id models.Id) e.Error {
 	if _, err := dbSess.Model(models.Env{}).
 		Where("id =?", id).
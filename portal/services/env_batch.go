@@ -0,0 +1,458 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var envBatchTaskTypes = map[string]string{
+	models.EnvBatchActionDeploy:  models.TaskTypeApply,
+	models.EnvBatchActionPlan:    models.TaskTypePlan,
+	models.EnvBatchActionDestroy: models.TaskTypeDestroy,
+}
+
+// QueryEnvBatchEnvs 按筛选条件查询项目下未归档的环境
+func QueryEnvBatchEnvs(query *db.Session, orgId, projectId models.Id, f models.EnvBatchFilter) (*db.Session, e.Error) {
+	query = query.Model(&models.Env{}).
+		Where("iac_env.org_id = ? AND iac_env.project_id = ?", orgId, projectId).
+		Where("iac_env.archived = 0")
+	if len(f.EnvIds) > 0 {
+		query = query.Where("iac_env.id IN (?)", f.EnvIds)
+	}
+	if f.TplId != "" {
+		query = query.Where("iac_env.tpl_id = ?", f.TplId)
+	}
+	query = FilterEnvTags(query, models.ParseEnvTags(strings.Join(f.Tags, ",")))
+
+	query, er := FilterEnvStatus(query, f.Status, nil)
+	if er != nil {
+		return nil, er
+	}
+	return query.Order("iac_env.created_at"), nil
+}
+
+// CheckEnvBatchAction 检查环境当前状态是否允许执行批量操作，不允许时返回原因
+func CheckEnvBatchAction(env *models.Env, action string) string {
+	if env.Archived {
+		return "env is archived"
+	}
+
+	switch action {
+	case models.EnvBatchActionPlan:
+		// 与单个环境一致，锁定的环境允许执行 plan
+	case models.EnvBatchActionDeploy:
+		if env.Locked {
+			return "env is locked"
+		}
+	case models.EnvBatchActionDestroy:
+		if env.Locked {
+			return "env is locked"
+		}
+		if env.Status != models.EnvStatusActive && env.Status != models.EnvStatusFailed {
+			return fmt.Sprintf("env is %s, nothing to destroy", env.Status)
+		}
+	case models.EnvBatchActionLock:
+		if env.Locked {
+			return "env is already locked"
+		}
+		if env.IsDemo {
+			return "demo env can not be locked"
+		}
+	case models.EnvBatchActionUnlock:
+		if !env.Locked {
+			return "env is not locked"
+		}
+	case models.EnvBatchActionArchive:
+		if env.Locked {
+			return "env is locked"
+		}
+		if env.Deploying || !utils.StrInArray(env.Status,
+			models.EnvStatusInactive, models.EnvStatusDestroyed, models.EnvStatusFailed) {
+			return fmt.Sprintf("env can't be archived while env is %s", env.Status)
+		}
+	default:
+		return fmt.Sprintf("unknown action '%s'", action)
+	}
+	return ""
+}
+
+// CreateEnvBatch 创建批量操作及每个环境的执行记录，不允许执行操作的环境直接标记为 skipped
+func CreateEnvBatch(tx *db.Session, batch *models.EnvBatch, envs []models.Env) (*models.EnvBatch, e.Error) {
+	if len(envs) == 0 {
+		return nil, e.New(e.EnvBatchNoEnvMatched, http.StatusBadRequest)
+	}
+	if len(envs) > consts.EnvBatchMaxEnvs {
+		return nil, e.New(e.EnvBatchTooManyEnvs,
+			fmt.Errorf("%d envs matched, max %d", len(envs), consts.EnvBatchMaxEnvs), http.StatusBadRequest)
+	}
+
+	batch.Status = models.EnvBatchPending
+	batch.Total = len(envs)
+	if err := models.Create(tx, batch); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	for i := range envs {
+		item := models.EnvBatchItem{
+			BatchId: batch.Id,
+			EnvId:   envs[i].Id,
+			EnvName: envs[i].Name,
+			Status:  models.EnvBatchItemPending,
+		}
+		if reason := CheckEnvBatchAction(&envs[i], batch.Action); reason != "" {
+			item.Status = models.EnvBatchItemSkipped
+			item.Message = reason
+		}
+		if err := models.Create(tx, &item); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	return batch, nil
+}
+
+func QueryEnvBatch(query *db.Session, orgId, projectId models.Id) *db.Session {
+	return query.Model(&models.EnvBatch{}).
+		Where("iac_env_batch.org_id = ? AND iac_env_batch.project_id = ?", orgId, projectId).
+		Joins("left join iac_user as u on u.id = iac_env_batch.creator_id").
+		LazySelectAppend("iac_env_batch.*, u.name as creator").
+		Order("iac_env_batch.created_at DESC")
+}
+
+// QueryEnvBatchItemDetail 查询批量操作的子项及子任务状态
+func QueryEnvBatchItemDetail(query *db.Session, batchId models.Id) *db.Session {
+	return query.Model(&models.EnvBatchItem{}).
+		Where("iac_env_batch_item.batch_id = ?", batchId).
+		Joins("left join iac_task as t on t.id = iac_env_batch_item.task_id").
+		LazySelectAppend("iac_env_batch_item.*, t.status as task_status").
+		Order("iac_env_batch_item.created_at, iac_env_batch_item.id")
+}
+
+// GetProcessingEnvBatches 查询未结束的批量操作
+func GetProcessingEnvBatches(query *db.Session) ([]models.EnvBatch, e.Error) {
+	batches := make([]models.EnvBatch, 0)
+	if err := query.Model(&models.EnvBatch{}).
+		Where("status IN (?)", []string{models.EnvBatchPending, models.EnvBatchRunning}).
+		Order("created_at").Find(&batches); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return batches, nil
+}
+
+func GetEnvBatchById(query *db.Session, id models.Id) (*models.EnvBatch, e.Error) {
+	batch := models.EnvBatch{}
+	if err := query.Model(&models.EnvBatch{}).Where("id = ?", id).First(&batch); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvBatchNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &batch, nil
+}
+
+func GetEnvBatchItems(query *db.Session, batchId models.Id) ([]models.EnvBatchItem, e.Error) {
+	items := make([]models.EnvBatchItem, 0)
+	if err := query.Model(&models.EnvBatchItem{}).Where("batch_id = ?", batchId).
+		Order("created_at, id").Find(&items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return items, nil
+}
+
+// GetEnvBatchStatus 根据子项状态计算批量操作的整体状态
+func GetEnvBatchStatus(items []models.EnvBatchItem) (status string, complete, failed, skipped int) {
+	pending, running := 0, 0
+	for _, item := range items {
+		switch item.Status {
+		case models.EnvBatchItemPending:
+			pending++
+		case models.EnvBatchItemRunning:
+			running++
+		case models.EnvBatchItemComplete:
+			complete++
+		case models.EnvBatchItemFailed:
+			failed++
+		case models.EnvBatchItemSkipped:
+			skipped++
+		}
+	}
+
+	switch {
+	case pending == len(items):
+		status = models.EnvBatchPending
+	case pending+running > 0:
+		status = models.EnvBatchRunning
+	case complete == 0:
+		status = models.EnvBatchFailed
+	case failed > 0:
+		status = models.EnvBatchPartial
+	default:
+		status = models.EnvBatchComplete
+	}
+	return status, complete, failed, skipped
+}
+
+// envBatchStartLimit 计算本次最多可以开始执行的子项数量，任务类操作按每分钟 rate 限速
+func envBatchStartLimit(sess *db.Session, batch *models.EnvBatch, now time.Time) (int, e.Error) {
+	if !utils.StrInArray(batch.Action, models.EnvBatchTaskActions...) {
+		return consts.EnvBatchMaxEnvs, nil
+	}
+
+	rate := batch.Rate
+	if rate <= 0 {
+		rate = consts.EnvBatchDefaultRate
+	}
+	started, err := sess.Model(&models.EnvBatchItem{}).
+		Where("batch_id = ? AND started_at > ?", batch.Id, now.Add(-time.Minute)).Count()
+	if err != nil {
+		return 0, e.New(e.DBError, err)
+	}
+	return rate - int(started), nil
+}
+
+// ProcessEnvBatch 执行批量操作中等待执行的环境，同步子任务状态并更新批量操作的整体状态
+func ProcessEnvBatch(sess *db.Session, batch *models.EnvBatch, now time.Time, lg logs.Logger) e.Error {
+	logger := lg.WithField("batchId", batch.Id)
+
+	limit, er := envBatchStartLimit(sess, batch, now)
+	if er != nil {
+		return er
+	}
+	items, er := GetEnvBatchItems(sess, batch.Id)
+	if er != nil {
+		return er
+	}
+
+	for i := range items {
+		item := &items[i]
+		switch item.Status {
+		case models.EnvBatchItemPending:
+			if limit <= 0 {
+				continue
+			}
+			limit--
+			if err := startEnvBatchItem(sess, batch, item, now); err != nil {
+				logger.Warnf("start env batch item %s error: %v", item.Id, err)
+			}
+		case models.EnvBatchItemRunning:
+			if err := syncEnvBatchItem(sess, item); err != nil {
+				logger.Warnf("sync env batch item %s error: %v", item.Id, err)
+			}
+		}
+	}
+
+	status, complete, failed, skipped := GetEnvBatchStatus(items)
+	if status == batch.Status && complete == batch.Complete && failed == batch.Failed && skipped == batch.Skipped {
+		return nil
+	}
+	batch.Status, batch.Complete, batch.Failed, batch.Skipped = status, complete, failed, skipped
+	if _, err := models.UpdateAttr(sess.Where("id = ?", batch.Id), &models.EnvBatch{}, models.Attrs{
+		"status": status, "complete": complete, "failed": failed, "skipped": skipped,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// startEnvBatchItem 对单个环境执行批量操作，执行出错时记录到子项中
+func startEnvBatchItem(sess *db.Session, batch *models.EnvBatch, item *models.EnvBatchItem, now time.Time) e.Error {
+	startedAt := models.Time(now)
+	pendingQuery := func(q *db.Session) *db.Session {
+		return q.Where("id = ? AND status = ? AND started_at IS NULL", item.Id, models.EnvBatchItemPending)
+	}
+
+	tx := sess.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	// 先标记开始时间，避免同一子项被重复执行
+	if n, err := models.UpdateAttr(pendingQuery(tx), &models.EnvBatchItem{}, models.Attrs{"started_at": startedAt}); err != nil {
+		_ = tx.Rollback()
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		_ = tx.Rollback()
+		return nil
+	}
+
+	item.StartedAt = &startedAt
+	if er := execEnvBatchItem(tx, batch, item); er != nil {
+		_ = tx.Rollback()
+		item.Status = models.EnvBatchItemFailed
+		item.Message = er.Error()
+		if _, err := models.UpdateAttr(pendingQuery(sess), &models.EnvBatchItem{}, models.Attrs{
+			"status": item.Status, "message": item.Message, "started_at": startedAt,
+		}); err != nil {
+			return e.New(e.DBError, err)
+		}
+		return er
+	}
+
+	if _, err := models.UpdateAttr(tx.Where("id = ?", item.Id), &models.EnvBatchItem{}, models.Attrs{
+		"status": item.Status, "message": item.Message, "task_id": item.TaskId,
+	}); err != nil {
+		_ = tx.Rollback()
+		return e.New(e.DBError, err)
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func execEnvBatchItem(tx *db.Session, batch *models.EnvBatch, item *models.EnvBatchItem) e.Error {
+	env, er := GetEnvById(tx, item.EnvId)
+	if er != nil {
+		return er
+	}
+	if reason := CheckEnvBatchAction(env, batch.Action); reason != "" {
+		item.Status = models.EnvBatchItemSkipped
+		item.Message = reason
+		return nil
+	}
+
+	var updated *models.Env
+	switch batch.Action {
+	case models.EnvBatchActionDeploy, models.EnvBatchActionPlan, models.EnvBatchActionDestroy:
+		task, er := CreateEnvBatchTask(tx, env, batch)
+		if er != nil {
+			return er
+		}
+		item.TaskId = task.Id
+		item.Status = models.EnvBatchItemRunning
+		item.Message = task.Message
+		return nil
+	case models.EnvBatchActionLock:
+		tasks, er := GetActiveTaskByEnvId(tx, env.Id)
+		if er != nil {
+			return er
+		}
+		if len(tasks) > 0 {
+			return e.New(e.EnvLockFailedTaskActive)
+		}
+		if er := EnvLock(tx, env.Id); er != nil {
+			return er
+		}
+		newEnv := *env
+		newEnv.Locked = true
+		updated = &newEnv
+	case models.EnvBatchActionUnlock:
+		if updated, er = UpdateEnv(tx, env.Id, models.Attrs{"locked": false}); er != nil {
+			return er
+		}
+	case models.EnvBatchActionArchive:
+		if env.Status == models.EnvStatusFailed && env.LastResTaskId != "" {
+			count, er := GetTaskResourceCount(tx, env.LastResTaskId)
+			if er != nil {
+				return er
+			}
+			if count > 0 {
+				return e.New(e.EnvCannotArchiveActive, fmt.Errorf("env has %d resources", count))
+			}
+		}
+		if updated, er = UpdateEnv(tx, env.Id, models.Attrs{
+			"archived": true,
+			"name":     env.Name + "-archived-" + time.Now().Format("20060102150405"),
+		}); er != nil {
+			return er
+		}
+	}
+	// 变更记录的请求ID使用批量操作ID
+	if er := RecordEnvChanges(tx, env, updated, batch.CreatorId, batch.Id.String()); er != nil {
+		return er
+	}
+	item.Status = models.EnvBatchItemComplete
+	return nil
+}
+
+// syncEnvBatchItem 根据子任务状态更新子项状态
+func syncEnvBatchItem(sess *db.Session, item *models.EnvBatchItem) e.Error {
+	task, er := GetTaskById(sess, item.TaskId)
+	if er != nil {
+		if er.Code() != e.TaskNotExists {
+			return er
+		}
+		item.Status = models.EnvBatchItemFailed
+		item.Message = "task not exists"
+	} else if !task.Exited() {
+		return nil
+	} else if task.Status == models.TaskComplete {
+		item.Status = models.EnvBatchItemComplete
+		item.Message = ""
+	} else {
+		item.Status = models.EnvBatchItemFailed
+		item.Message = fmt.Sprintf("task %s: %s", task.Status, task.Message)
+	}
+
+	if _, err := models.UpdateAttr(sess.Where("id = ?", item.Id), &models.EnvBatchItem{}, models.Attrs{
+		"status": item.Status, "message": item.Message,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// CreateEnvBatchTask 为批量操作中的环境创建部署、plan 或销毁任务，任务配置与环境当前配置一致
+func CreateEnvBatchTask(tx *db.Session, env *models.Env, batch *models.EnvBatch) (*models.Task, e.Error) {
+	tpl, er := GetTemplateById(tx, env.TplId)
+	if er != nil {
+		return nil, er
+	}
+	vars, err := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+
+	runnerId, er := GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+	if er != nil {
+		return nil, er
+	}
+
+	taskType := envBatchTaskTypes[batch.Action]
+	paramTask := models.Task{
+		Name:            fmt.Sprintf("%s (batch %s)", models.Task{}.GetTaskNameByType(taskType), batch.Id),
+		Targets:         env.Targets,
+		CreatorId:       batch.CreatorId,
+		KeyId:           env.KeyId,
+		Variables:       vars,
+		AutoApprove:     env.AutoApproval,
+		Revision:        env.Revision,
+		StopOnViolation: env.StopOnViolation,
+		ExtraData:       env.ExtraData,
+		BaseTask: models.BaseTask{
+			Type:        taskType,
+			StepTimeout: env.StepTimeout,
+			RunnerId:    runnerId,
+		},
+		Source:               consts.TaskSourceEnvBatch,
+		FreezeOverrideReason: batch.FreezeOverrideReason,
+	}
+
+	if taskType == models.TaskTypeDestroy {
+		paramTask.Targets = nil
+		if env.LastResTaskId != "" {
+			// 销毁任务使用环境最后一次部署时的 pipeline 和 commit
+			lastResTask, er := GetTaskById(tx, env.LastResTaskId)
+			if er != nil {
+				return nil, er
+			}
+			paramTask.Pipeline = lastResTask.Pipeline
+			paramTask.CommitId = lastResTask.CommitId
+		}
+	}
+
+	return CreateTask(tx, tpl, env, paramTask)
+}
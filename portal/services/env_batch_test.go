@@ -0,0 +1,70 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEnvBatchAction(t *testing.T) {
+	cases := []struct {
+		env     models.Env
+		action  string
+		allowed bool
+	}{
+		{models.Env{Status: models.EnvStatusActive}, models.EnvBatchActionDeploy, true},
+		{models.Env{Status: models.EnvStatusActive, Locked: true}, models.EnvBatchActionPlan, true},
+		{models.Env{Status: models.EnvStatusActive, Locked: true}, models.EnvBatchActionDeploy, false},
+		{models.Env{Status: models.EnvStatusActive, Archived: true}, models.EnvBatchActionDeploy, false},
+		{models.Env{Status: models.EnvStatusFailed}, models.EnvBatchActionDestroy, true},
+		{models.Env{Status: models.EnvStatusInactive}, models.EnvBatchActionDestroy, false},
+		{models.Env{Status: models.EnvStatusActive}, models.EnvBatchActionLock, true},
+		{models.Env{Status: models.EnvStatusActive, IsDemo: true}, models.EnvBatchActionLock, false},
+		{models.Env{Status: models.EnvStatusActive, Locked: true}, models.EnvBatchActionLock, false},
+		{models.Env{Status: models.EnvStatusActive, Locked: true}, models.EnvBatchActionUnlock, true},
+		{models.Env{Status: models.EnvStatusActive}, models.EnvBatchActionUnlock, false},
+		{models.Env{Status: models.EnvStatusDestroyed}, models.EnvBatchActionArchive, true},
+		{models.Env{Status: models.EnvStatusActive}, models.EnvBatchActionArchive, false},
+		{models.Env{Status: models.EnvStatusInactive, Deploying: true}, models.EnvBatchActionArchive, false},
+		{models.Env{Status: models.EnvStatusActive}, "unknown", false},
+	}
+
+	for _, c := range cases {
+		reason := CheckEnvBatchAction(&c.env, c.action)
+		assert.Equal(t, c.allowed, reason == "", "%s %+v: %s", c.action, c.env, reason)
+	}
+}
+
+func TestGetEnvBatchStatus(t *testing.T) {
+	items := func(status ...string) []models.EnvBatchItem {
+		rs := make([]models.EnvBatchItem, 0, len(status))
+		for _, s := range status {
+			rs = append(rs, models.EnvBatchItem{Status: s})
+		}
+		return rs
+	}
+
+	cases := []struct {
+		items  []models.EnvBatchItem
+		status string
+	}{
+		{items(models.EnvBatchItemPending, models.EnvBatchItemPending), models.EnvBatchPending},
+		{items(models.EnvBatchItemPending, models.EnvBatchItemComplete), models.EnvBatchRunning},
+		{items(models.EnvBatchItemRunning, models.EnvBatchItemSkipped), models.EnvBatchRunning},
+		{items(models.EnvBatchItemComplete, models.EnvBatchItemSkipped), models.EnvBatchComplete},
+		{items(models.EnvBatchItemComplete, models.EnvBatchItemFailed), models.EnvBatchPartial},
+		{items(models.EnvBatchItemFailed, models.EnvBatchItemSkipped), models.EnvBatchFailed},
+		{items(models.EnvBatchItemSkipped), models.EnvBatchFailed},
+	}
+	for _, c := range cases {
+		status, _, _, _ := GetEnvBatchStatus(c.items)
+		assert.Equal(t, c.status, status)
+	}
+
+	_, complete, failed, skipped := GetEnvBatchStatus(items(models.EnvBatchItemComplete,
+		models.EnvBatchItemComplete, models.EnvBatchItemFailed, models.EnvBatchItemSkipped))
+	assert.Equal(t, []int{2, 1, 1}, []int{complete, failed, skipped})
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+)
+
+// BuildDriftResources 解析漂移检测任务的 plan json，生成每个漂移资源的属性变更，敏感属性值会被隐藏
+func BuildDriftResources(planJson []byte) (models.DriftResourceDiffs, error) {
+	diffs, err := BuildPlanDiff(planJson)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make(models.DriftResourceDiffs, 0, len(diffs))
+	for _, d := range diffs {
+		if d.Action == PlanActionRead {
+			continue
+		}
+		attrs := make(models.DriftAttrs, 0, len(d.Attrs))
+		for _, a := range d.Attrs {
+			attrs = append(attrs, models.DriftAttr{
+				Name:      a.Name,
+				Before:    a.Before,
+				After:     a.After,
+				Sensitive: a.Sensitive,
+			})
+		}
+		resources = append(resources, models.DriftResourceDiff{
+			Address: d.Address,
+			Type:    d.Type,
+			Action:  d.Action,
+			Attrs:   attrs,
+		})
+	}
+	return resources, nil
+}
+
+// matchDriftIgnorePattern 规则为空时匹配所有值，否则按通配符匹配
+func matchDriftIgnorePattern(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, s)
+	return err == nil && matched
+}
+
+// ApplyDriftIgnoreRules 根据忽略规则标记被忽略的资源及属性，返回未被忽略和被忽略的资源数量。
+// 属性级的规则只作用于资源的更新和重建，资源被删除或需要新建时只能通过资源级规则忽略
+func ApplyDriftIgnoreRules(resources models.DriftResourceDiffs, rules []models.DriftIgnoreRule) (drifted int, ignored int) {
+	for i := range resources {
+		r := &resources[i]
+		for _, rule := range rules {
+			if rule.Attribute == "" && matchDriftIgnorePattern(rule.ResourceType, r.Type) {
+				r.Ignored = true
+				break
+			}
+		}
+
+		if !r.Ignored && (r.Action == PlanActionUpdate || r.Action == PlanActionReplace) && len(r.Attrs) > 0 {
+			allIgnored := true
+			for j := range r.Attrs {
+				for _, rule := range rules {
+					if rule.Attribute != "" && matchDriftIgnorePattern(rule.ResourceType, r.Type) &&
+						matchDriftIgnorePattern(rule.Attribute, r.Attrs[j].Name) {
+						r.Attrs[j].Ignored = true
+						break
+					}
+				}
+				allIgnored = allIgnored && r.Attrs[j].Ignored
+			}
+			r.Ignored = allIgnored
+		}
+
+		if r.Ignored {
+			ignored++
+		} else {
+			drifted++
+		}
+	}
+	return drifted, ignored
+}
+
+func QueryDriftIgnoreRule(query *db.Session, orgId, projectId, envId models.Id) *db.Session {
+	query = QueryWithOrgProject(query.Model(&models.DriftIgnoreRule{}), orgId, projectId)
+	if envId != "" {
+		query = query.Where("env_id = ?", envId)
+	}
+	return query.Order("created_at DESC")
+}
+
+// GetEnvDriftIgnoreRules 获取对环境生效的组织、项目及环境级忽略规则
+func GetEnvDriftIgnoreRules(query *db.Session, env *models.Env) ([]models.DriftIgnoreRule, e.Error) {
+	rules := make([]models.DriftIgnoreRule, 0)
+	err := query.Model(&models.DriftIgnoreRule{}).
+		Where("org_id = ? AND enabled = ?", env.OrgId, true).
+		Where("project_id = '' OR (project_id = ? AND (env_id = '' OR env_id = ?))", env.ProjectId, env.Id).
+		Find(&rules)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return rules, nil
+}
+
+func GetDriftIgnoreRuleById(query *db.Session, id models.Id) (*models.DriftIgnoreRule, e.Error) {
+	r := models.DriftIgnoreRule{}
+	if err := query.Model(&models.DriftIgnoreRule{}).Where("id = ?", id).First(&r); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.DriftIgnoreRuleNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+func checkDriftIgnoreRule(r *models.DriftIgnoreRule) e.Error {
+	if r.ResourceType == "" && r.Attribute == "" {
+		return e.New(e.BadParam, fmt.Errorf("resourceType or attribute is required"), http.StatusBadRequest)
+	}
+	for _, p := range []string{r.ResourceType, r.Attribute} {
+		if _, err := path.Match(p, ""); err != nil {
+			return e.New(e.BadParam, fmt.Errorf("invalid pattern '%s': %v", p, err), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+func CreateDriftIgnoreRule(tx *db.Session, r models.DriftIgnoreRule) (*models.DriftIgnoreRule, e.Error) {
+	if err := checkDriftIgnoreRule(&r); err != nil {
+		return nil, err
+	}
+	if err := models.Create(tx, &r); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+func UpdateDriftIgnoreRule(tx *db.Session, id models.Id, attrs models.Attrs) (*models.DriftIgnoreRule, e.Error) {
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.DriftIgnoreRule{}, attrs); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update drift ignore rule error: %v", err))
+	}
+	r, err := GetDriftIgnoreRuleById(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDriftIgnoreRule(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func DeleteDriftIgnoreRule(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.DriftIgnoreRule{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete drift ignore rule error: %v", err))
+	}
+	return nil
+}
+
+func CreateEnvDriftRun(tx *db.Session, run *models.EnvDriftRun) e.Error {
+	if err := models.Create(tx, run); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// QueryEnvDriftRun 查询环境的漂移检测历史，列表不返回资源详情
+func QueryEnvDriftRun(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.EnvDriftRun{}).
+		Omit("resources").
+		Where("env_id = ?", envId).
+		Order("created_at DESC")
+}
+
+func GetEnvDriftRun(query *db.Session, envId, id models.Id) (*models.EnvDriftRun, e.Error) {
+	run := models.EnvDriftRun{}
+	if err := query.Model(&models.EnvDriftRun{}).Where("env_id = ? AND id = ?", envId, id).First(&run); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvDriftRunNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &run, nil
+}
+
+// DeleteExpiredEnvDriftRun 清理过期的漂移检测记录
+func DeleteExpiredEnvDriftRun(tx *db.Session, keep time.Duration) e.Error {
+	if _, err := tx.Where("created_at < ?", time.Now().Add(-keep)).Delete(&models.EnvDriftRun{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
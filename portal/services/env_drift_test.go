@@ -0,0 +1,80 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDriftResources(t *testing.T) {
+	resources, err := BuildDriftResources(testPlanJson)
+	if !assert.NoError(t, err) || !assert.Len(t, resources, 3) {
+		return
+	}
+
+	db := resources[1]
+	assert.Equal(t, "module.db.alicloud_db_instance.db", db.Address)
+	assert.Equal(t, "alicloud_db_instance", db.Type)
+	assert.Equal(t, PlanActionUpdate, db.Action)
+	assert.Equal(t, models.DriftAttrs{{Name: "instance_type", Before: "small", After: "large"}}, db.Attrs)
+
+	for _, a := range resources[0].Attrs {
+		if a.Name == "password" {
+			assert.True(t, a.Sensitive)
+			assert.NotEqual(t, "old", a.Before)
+		}
+	}
+}
+
+func TestApplyDriftIgnoreRules(t *testing.T) {
+	newResources := func() models.DriftResourceDiffs {
+		return models.DriftResourceDiffs{
+			{Address: "aws_autoscaling_group.web", Type: "aws_autoscaling_group", Action: PlanActionUpdate,
+				Attrs: models.DriftAttrs{{Name: "desired_capacity"}}},
+			{Address: "aws_instance.web", Type: "aws_instance", Action: PlanActionUpdate,
+				Attrs: models.DriftAttrs{{Name: "tags"}, {Name: "tags_all"}, {Name: "instance_type"}}},
+			{Address: "aws_instance.db", Type: "aws_instance", Action: PlanActionCreate,
+				Attrs: models.DriftAttrs{{Name: "tags"}}},
+			{Address: "aws_s3_bucket.logs", Type: "aws_s3_bucket", Action: PlanActionDelete},
+		}
+	}
+
+	resources := newResources()
+	drifted, ignored := ApplyDriftIgnoreRules(resources, nil)
+	assert.Equal(t, 4, drifted)
+	assert.Equal(t, 0, ignored)
+
+	resources = newResources()
+	drifted, ignored = ApplyDriftIgnoreRules(resources, []models.DriftIgnoreRule{
+		{ResourceType: "aws_autoscaling_group", Attribute: "desired_capacity"},
+		{Attribute: "tags*"},
+		{ResourceType: "aws_s3_*"},
+	})
+	assert.Equal(t, 2, drifted)
+	assert.Equal(t, 2, ignored)
+
+	assert.True(t, resources[0].Ignored)
+	assert.True(t, resources[0].Attrs[0].Ignored)
+
+	// 部分属性被忽略时资源仍视为漂移
+	assert.False(t, resources[1].Ignored)
+	assert.True(t, resources[1].Attrs[0].Ignored)
+	assert.True(t, resources[1].Attrs[1].Ignored)
+	assert.False(t, resources[1].Attrs[2].Ignored)
+
+	// 属性级规则不会忽略需要重新创建的资源
+	assert.False(t, resources[2].Ignored)
+	assert.False(t, resources[2].Attrs[0].Ignored)
+
+	assert.True(t, resources[3].Ignored)
+}
+
+func TestCheckDriftIgnoreRule(t *testing.T) {
+	assert.Error(t, checkDriftIgnoreRule(&models.DriftIgnoreRule{}))
+	assert.Error(t, checkDriftIgnoreRule(&models.DriftIgnoreRule{Attribute: "tags["}))
+	assert.NoError(t, checkDriftIgnoreRule(&models.DriftIgnoreRule{ResourceType: "aws_*"}))
+	assert.NoError(t, checkDriftIgnoreRule(&models.DriftIgnoreRule{Attribute: "tags"}))
+}
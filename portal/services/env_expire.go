@@ -0,0 +1,253 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/notificationrc"
+	"cloudiac/utils/logs"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// 项目未配置时，在自动销毁前 1 天和 1 小时发送提醒
+var defaultEnvExpireNotify = []string{"1d", "1h"}
+
+// ParseEnvExpireNotify 解析销毁提醒的提前时间，按从长到短排序
+func ParseEnvExpireNotify(leads []string) ([]time.Duration, error) {
+	if len(leads) == 0 {
+		leads = defaultEnvExpireNotify
+	}
+	ds := make([]time.Duration, 0, len(leads))
+	for _, l := range leads {
+		d, err := ParseTTL(l)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid duration: %v", l)
+		}
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] > ds[j] })
+	return ds, nil
+}
+
+// GetEnvExpireNotifyLead 返回距离自动销毁的剩余时间所处的提醒阶段(即不小于剩余时间的最短提前时间)，不需要提醒时返回 0
+func GetEnvExpireNotifyLead(leads []time.Duration, remaining time.Duration) time.Duration {
+	lead := time.Duration(0)
+	for _, l := range leads {
+		if remaining <= l && (lead == 0 || l < lead) {
+			lead = l
+		}
+	}
+	return lead
+}
+
+// needEnvExpireNotify 同一个自动销毁时间在每个提醒阶段只提醒一次
+func needEnvExpireNotify(env *models.Env, lead time.Duration) bool {
+	if lead == 0 || env.AutoDestroyAt == nil {
+		return false
+	}
+	if env.ExpireNotifiedAt == nil || env.ExpireNotifiedAt.Unix() != env.AutoDestroyAt.Unix() {
+		return true
+	}
+	return int(lead/time.Second) < env.ExpireNotifiedLead
+}
+
+// CheckEnvExtend 检查环境能否延期，返回延期后的自动销毁时间
+func CheckEnvExtend(env *models.Env, project *models.Project, duration time.Duration, now time.Time) (*models.Time, e.Error) {
+	if env.AutoDestroyAt == nil || env.AutoDestroyTaskId != "" {
+		return nil, e.New(e.EnvExtendNotAllowed, http.StatusBadRequest)
+	}
+	if duration <= 0 {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid duration"), http.StatusBadRequest)
+	}
+
+	if project.EnvExtendLimit > 0 && env.ExtendCount >= project.EnvExtendLimit {
+		return nil, e.New(e.EnvExtendExceedLimit,
+			fmt.Errorf("env can be extended at most %d times", project.EnvExtendLimit), http.StatusBadRequest)
+	}
+	if project.EnvExtendMax != "" {
+		max, err := ParseTTL(project.EnvExtendMax)
+		if err != nil {
+			return nil, e.New(e.InternalError, err)
+		}
+		if duration > max {
+			return nil, e.New(e.EnvExtendExceedLimit,
+				fmt.Errorf("env can be extended at most %s each time", project.EnvExtendMax), http.StatusBadRequest)
+		}
+	}
+
+	// 已过销毁时间但销毁任务还未创建时从当前时间开始延期
+	from := time.Time(*env.AutoDestroyAt)
+	if from.Before(now) {
+		from = now
+	}
+	at := models.Time(from.Add(duration))
+	return &at, nil
+}
+
+// ExtendEnv 延长环境的自动销毁时间
+func ExtendEnv(tx *db.Session, env *models.Env, project *models.Project, duration time.Duration) (*models.Env, e.Error) {
+	at, err := CheckEnvExtend(env, project, duration, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// 以原销毁时间作为更新条件，避免并发延期或重复使用延期链接
+	n, er := models.UpdateAttr(tx.Where("id = ? AND auto_destroy_at = ? AND auto_destroy_task_id = ''",
+		env.Id, env.AutoDestroyAt), &models.Env{}, models.Attrs{
+		"auto_destroy_at": at,
+		"extend_count":    env.ExtendCount + 1,
+	})
+	if er != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update env error: %v", er))
+	} else if n == 0 {
+		return nil, e.New(e.EnvExtendNotAllowed, fmt.Errorf("env auto destroy time changed"), http.StatusConflict)
+	}
+	return GetEnvById(tx, env.Id)
+}
+
+type EnvExtendClaims struct {
+	jwt.RegisteredClaims
+
+	EnvId     models.Id `json:"envId"`
+	DestroyAt int64     `json:"destroyAt"` // 生成链接时的自动销毁时间，延期后链接失效
+	Duration  string    `json:"duration"`
+}
+
+// GenerateEnvExtendToken 生成环境延期链接使用的 token，token 在环境自动销毁时过期
+func GenerateEnvExtendToken(env *models.Env, duration string) (string, error) {
+	if env.AutoDestroyAt == nil {
+		return "", fmt.Errorf("env has no auto destroy time")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, EnvExtendClaims{
+		EnvId:     env.Id,
+		DestroyAt: env.AutoDestroyAt.Unix(),
+		Duration:  duration,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Time(*env.AutoDestroyAt)),
+			Subject:   consts.JwtSubjectEnvExtend,
+		},
+	})
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+func VerifyEnvExtendToken(tokenStr string) (*EnvExtendClaims, e.Error) {
+	claims := EnvExtendClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, e.New(e.InvalidToken, err, http.StatusBadRequest)
+	}
+	if !token.Valid || claims.Subject != consts.JwtSubjectEnvExtend {
+		return nil, e.New(e.InvalidToken, http.StatusBadRequest)
+	}
+	return &claims, nil
+}
+
+// getEnvExtendLinkDuration 延期链接使用默认延期时间，超出项目限制时使用项目允许的最长时间
+func getEnvExtendLinkDuration(project *models.Project) string {
+	if project.EnvExtendMax == "" {
+		return consts.EnvExtendDefaultDuration
+	}
+	max, err := ParseTTL(project.EnvExtendMax)
+	if err != nil {
+		return consts.EnvExtendDefaultDuration
+	}
+	def, _ := ParseTTL(consts.EnvExtendDefaultDuration)
+	if max < def {
+		return project.EnvExtendMax
+	}
+	return consts.EnvExtendDefaultDuration
+}
+
+// ProcessEnvExpireNotify 对即将自动销毁的环境发送提醒
+func ProcessEnvExpireNotify(tx *db.Session, now time.Time, lg logs.Logger) {
+	envs := make([]*models.Env, 0)
+	// 默认提醒时间之外的环境由项目配置决定是否提醒，这里先查询出所有设置了自动销毁的环境
+	if err := tx.Model(&models.Env{}).
+		Where("status IN (?)", []string{models.EnvStatusActive, models.EnvStatusFailed}).
+		Where("archived = ? AND auto_destroy_task_id = ''", false).
+		Where("auto_destroy_at > ?", now).
+		Find(&envs); err != nil {
+		lg.Errorf("query expiring envs error: %v", err)
+		return
+	}
+
+	projects := make(map[models.Id]*models.Project)
+	for _, env := range envs {
+		project, ok := projects[env.ProjectId]
+		if !ok {
+			var err e.Error
+			if project, err = GetProjectsById(tx, env.ProjectId); err != nil {
+				lg.Errorf("get project %s error: %v", env.ProjectId, err)
+				continue
+			}
+			projects[env.ProjectId] = project
+		}
+
+		leads, err := ParseEnvExpireNotify(project.EnvExpireNotify)
+		if err != nil {
+			lg.Warnf("project %s: invalid env expire notify: %v", project.Id, err)
+			continue
+		}
+		lead := GetEnvExpireNotifyLead(leads, time.Time(*env.AutoDestroyAt).Sub(now))
+		if !needEnvExpireNotify(env, lead) {
+			continue
+		}
+
+		if _, err := tx.Model(&models.Env{}).Where("id = ?", env.Id).UpdateAttrs(models.Attrs{
+			"expire_notified_at":   env.AutoDestroyAt,
+			"expire_notified_lead": int(lead / time.Second),
+		}); err != nil {
+			lg.Errorf("update env %s expire notified error: %v", env.Id, err)
+			continue
+		}
+		lg.Infof("env %s will be destroyed at %s", env.Id, time.Time(*env.AutoDestroyAt).Format(time.RFC3339))
+		sendEnvExpireMessage(tx, env, project)
+	}
+}
+
+func sendEnvExpireMessage(query *db.Session, env *models.Env, project *models.Project) {
+	org, err := GetOrganizationById(query, env.OrgId)
+	if err != nil {
+		logs.Get().Warnf("get org %s error: %v", env.OrgId, err)
+		return
+	}
+
+	alert := &notificationrc.EnvExpireAlert{
+		DestroyAt: time.Time(*env.AutoDestroyAt).Format("2006-01-02 15:04:05"),
+	}
+	duration := getEnvExtendLinkDuration(project)
+	if token, err := GenerateEnvExtendToken(env, duration); err != nil {
+		logs.Get().Warnf("generate env extend token error: %v", err)
+	} else {
+		alert.ExtendDuration = duration
+		alert.ExtendAddr = fmt.Sprintf("%s/api/v1/env_extend?token=%s",
+			configs.Get().Portal.Address, url.QueryEscape(token))
+	}
+
+	ns := notificationrc.NewNotificationService(&notificationrc.NotificationOptions{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		Project:   project,
+		Org:       org,
+		Env:       env,
+		EventType: consts.EventEnvExpiring,
+		EnvExpire: alert,
+		// 除通知配置外同时通过邮件提醒环境创建者
+		UserIds: []string{env.CreatorId.String()},
+	})
+	ns.SendMessage()
+}
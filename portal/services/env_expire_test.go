@@ -0,0 +1,122 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnvExpireNotify(t *testing.T) {
+	leads, err := ParseEnvExpireNotify(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{24 * time.Hour, time.Hour}, leads)
+
+	leads, err = ParseEnvExpireNotify([]string{"30m", "3d", "4h"})
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{72 * time.Hour, 4 * time.Hour, 30 * time.Minute}, leads)
+
+	_, err = ParseEnvExpireNotify([]string{"1x"})
+	assert.Error(t, err)
+	_, err = ParseEnvExpireNotify([]string{"0"})
+	assert.Error(t, err)
+}
+
+func TestGetEnvExpireNotifyLead(t *testing.T) {
+	leads := []time.Duration{24 * time.Hour, time.Hour}
+	assert.Equal(t, time.Duration(0), GetEnvExpireNotifyLead(leads, 25*time.Hour))
+	assert.Equal(t, 24*time.Hour, GetEnvExpireNotifyLead(leads, 23*time.Hour))
+	assert.Equal(t, time.Hour, GetEnvExpireNotifyLead(leads, 30*time.Minute))
+}
+
+func TestNeedEnvExpireNotify(t *testing.T) {
+	destroyAt := models.Time(time.Now().Add(time.Hour))
+	env := &models.Env{AutoDestroyAt: &destroyAt}
+	assert.False(t, needEnvExpireNotify(env, 0))
+	assert.True(t, needEnvExpireNotify(env, 24*time.Hour))
+
+	// 同一销毁时间的同一阶段只提醒一次，进入更短的阶段后再次提醒
+	env.ExpireNotifiedAt = &destroyAt
+	env.ExpireNotifiedLead = int((24 * time.Hour) / time.Second)
+	assert.False(t, needEnvExpireNotify(env, 24*time.Hour))
+	assert.True(t, needEnvExpireNotify(env, time.Hour))
+
+	// 延期后销毁时间变化，重新提醒
+	extended := models.Time(time.Time(destroyAt).Add(24 * time.Hour))
+	env.AutoDestroyAt = &extended
+	assert.True(t, needEnvExpireNotify(env, 24*time.Hour))
+}
+
+func TestCheckEnvExtend(t *testing.T) {
+	now := time.Now()
+	destroyAt := models.Time(now.Add(time.Hour))
+	env := &models.Env{AutoDestroyAt: &destroyAt}
+
+	at, err := CheckEnvExtend(env, &models.Project{}, 24*time.Hour, now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Time(destroyAt).Add(24*time.Hour).Unix(), at.Unix())
+
+	// 已过销毁时间时从当前时间开始延期
+	past := models.Time(now.Add(-time.Minute))
+	at, err = CheckEnvExtend(&models.Env{AutoDestroyAt: &past}, &models.Project{}, time.Hour, now)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(time.Hour).Unix(), at.Unix())
+
+	_, err = CheckEnvExtend(&models.Env{}, &models.Project{}, time.Hour, now)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.EnvExtendNotAllowed, err.Code())
+	}
+	_, err = CheckEnvExtend(&models.Env{AutoDestroyAt: &destroyAt, AutoDestroyTaskId: "run-1"}, &models.Project{}, time.Hour, now)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.EnvExtendNotAllowed, err.Code())
+	}
+
+	project := &models.Project{EnvExtendMax: "3d", EnvExtendLimit: 2}
+	_, err = CheckEnvExtend(env, project, 72*time.Hour, now)
+	assert.Nil(t, err)
+	_, err = CheckEnvExtend(env, project, 96*time.Hour, now)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.EnvExtendExceedLimit, err.Code())
+	}
+	_, err = CheckEnvExtend(&models.Env{AutoDestroyAt: &destroyAt, ExtendCount: 2}, project, time.Hour, now)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.EnvExtendExceedLimit, err.Code())
+	}
+}
+
+func TestEnvExtendToken(t *testing.T) {
+	configs.Set(&configs.Config{JwtSecretKey: "secret"})
+
+	destroyAt := models.Time(time.Now().Add(time.Hour))
+	env := &models.Env{AutoDestroyAt: &destroyAt}
+	env.Id = "env-1"
+	token, err := GenerateEnvExtendToken(env, "1d")
+	assert.NoError(t, err)
+
+	claims, er := VerifyEnvExtendToken(token)
+	assert.Nil(t, er)
+	assert.Equal(t, env.Id, claims.EnvId)
+	assert.Equal(t, destroyAt.Unix(), claims.DestroyAt)
+	assert.Equal(t, "1d", claims.Duration)
+
+	_, er = VerifyEnvExtendToken(token + "x")
+	assert.NotNil(t, er)
+
+	// 环境已过销毁时间，链接失效
+	expired := models.Time(time.Now().Add(-time.Minute))
+	token, err = GenerateEnvExtendToken(&models.Env{AutoDestroyAt: &expired}, "1d")
+	assert.NoError(t, err)
+	_, er = VerifyEnvExtendToken(token)
+	assert.NotNil(t, er)
+}
+
+func TestGetEnvExtendLinkDuration(t *testing.T) {
+	assert.Equal(t, "1d", getEnvExtendLinkDuration(&models.Project{}))
+	assert.Equal(t, "1d", getEnvExtendLinkDuration(&models.Project{EnvExtendMax: "3d"}))
+	assert.Equal(t, "4h", getEnvExtendLinkDuration(&models.Project{EnvExtendMax: "4h"}))
+}
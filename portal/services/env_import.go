@@ -0,0 +1,64 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/Masterminds/semver"
+)
+
+// 资源地址格式: [module.NAME[INDEX].]...TYPE.NAME[INDEX]，不支持 data source
+var resourceAddressRegex = regexp.MustCompile(
+	`^(?:module\.[A-Za-z_][\w-]*(?:\[(?:"[^"]*"|\d+)\])?\.)*([A-Za-z_][\w-]*)\.[A-Za-z_][\w-]*(?:\[(?:"[^"]*"|\d+)\])?$`)
+
+// import 块从 terraform 1.5 开始支持
+var importBlockConstraint, _ = semver.NewConstraint(">= 1.5.0")
+
+// CheckImportAddress 检查导入资源的地址是否为合法的 managed resource 地址
+func CheckImportAddress(addr string) bool {
+	m := resourceAddressRegex.FindStringSubmatch(addr)
+	return m != nil && m[1] != "module" && m[1] != "data"
+}
+
+// CheckImportTfVersion 检查 terraform 版本是否支持指定的导入方式
+func CheckImportTfVersion(mode, tfVersion string) e.Error {
+	if mode != common.TaskImportModeBlock {
+		return nil
+	}
+	if tfVersion == "" {
+		tfVersion = consts.DefaultTerraformVersion
+	}
+	v, err := semver.NewVersion(tfVersion)
+	if err != nil {
+		return e.New(e.EnvImportTfVersion, err, http.StatusBadRequest)
+	}
+	if !importBlockConstraint.Check(v) {
+		return e.New(e.EnvImportTfVersion, fmt.Errorf("terraform version %s", tfVersion), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// BuildTaskImports 检查并生成导入任务的资源列表，同一地址只能导入一次
+func BuildTaskImports(items []runner.TaskImport) (models.TaskImports, e.Error) {
+	imports := make(models.TaskImports, 0, len(items))
+	addrs := make(map[string]struct{})
+	for _, item := range items {
+		if !CheckImportAddress(item.Address) {
+			return nil, e.New(e.EnvImportAddressInvalid, fmt.Errorf("invalid address '%s'", item.Address), http.StatusBadRequest)
+		}
+		if _, ok := addrs[item.Address]; ok {
+			return nil, e.New(e.EnvImportAddressInvalid, fmt.Errorf("duplicate address '%s'", item.Address), http.StatusBadRequest)
+		}
+		addrs[item.Address] = struct{}{}
+		imports = append(imports, item)
+	}
+	return imports, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/runner"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckImportAddress(t *testing.T) {
+	cases := []struct {
+		addr   string
+		expect bool
+	}{
+		{"aws_instance.web", true},
+		{"aws_instance.web[0]", true},
+		{`aws_instance.web["a b"]`, true},
+		{`module.vpc["prod"].module.subnet.alicloud_vswitch.this[1]`, true},
+		{"aws_instance", false},
+		{"data.aws_ami.ubuntu", false},
+		{"module.vpc", false},
+		{"aws_instance.web; rm -rf /", false},
+		{"aws_instance.web[a]", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expect, CheckImportAddress(c.addr), c.addr)
+	}
+}
+
+func TestCheckImportTfVersion(t *testing.T) {
+	assert.Nil(t, CheckImportTfVersion(common.TaskImportModeCli, "0.14.0"))
+	assert.Nil(t, CheckImportTfVersion(common.TaskImportModeBlock, "1.5.7"))
+
+	err := CheckImportTfVersion(common.TaskImportModeBlock, "1.3.0")
+	assert.NotNil(t, err)
+	assert.Equal(t, e.EnvImportTfVersion, err.Code())
+
+	// 未指定版本时使用默认版本
+	assert.NotNil(t, CheckImportTfVersion(common.TaskImportModeBlock, ""))
+}
+
+func TestBuildTaskImports(t *testing.T) {
+	imports, err := BuildTaskImports([]runner.TaskImport{
+		{Address: "aws_instance.a", Id: "i-1"},
+		{Address: "aws_instance.b", Id: "i-2"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, imports, 2)
+
+	_, err = BuildTaskImports([]runner.TaskImport{
+		{Address: "aws_instance.a", Id: "i-1"},
+		{Address: "aws_instance.a", Id: "i-2"},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, e.EnvImportAddressInvalid, err.Code())
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+type PreviewEnvOutput struct {
+	Name  string
+	Value string
+}
+
+// GetEnvDetailUrl 环境详情页面地址
+func GetEnvDetailUrl(env *models.Env) string {
+	return fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s",
+		configs.Get().Portal.Address, env.OrgId, env.ProjectId, env.Id)
+}
+
+// GetPreviewEnv 查询云模板在 PR 下创建的预览环境(包含已归档环境)
+func GetPreviewEnv(sess *db.Session, tplId models.Id, prId int) (*models.Env, e.Error) {
+	env := models.Env{}
+	err := sess.Where("tpl_id = ? AND preview_pr_id = ?", tplId, prId).
+		Order("created_at DESC").First(&env)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &env, nil
+}
+
+// CheckTemplatePreview 检查云模板的预览环境配置，预览环境项目需要关联到云模板
+func CheckTemplatePreview(sess *db.Session, tpl *models.Template) e.Error {
+	if !tpl.PreviewEnable {
+		return nil
+	}
+	if tpl.PreviewTTL != "" {
+		if _, err := ParseTTL(tpl.PreviewTTL); err != nil {
+			return e.New(e.BadParam, err, http.StatusBadRequest)
+		}
+	}
+	if tpl.PreviewProjectId == "" {
+		return e.New(e.TemplatePreviewProjectInvalid, http.StatusBadRequest)
+	}
+	ok, err := sess.Model(&models.ProjectTemplate{}).
+		Where("template_id = ? AND project_id = ?", tpl.Id, tpl.PreviewProjectId).Exists()
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if !ok {
+		return e.New(e.TemplatePreviewProjectInvalid, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// GetPreviewEnvOutputs 将任务的 outputs 转为 PR 评论中展示的列表，敏感输出会被隐藏
+func GetPreviewEnvOutputs(outputs map[string]interface{}) []PreviewEnvOutput {
+	rs := make([]PreviewEnvOutput, 0, len(outputs))
+	for name, v := range outputs {
+		// 任务结束时 output 为 TfStateVariable，从 db 中读取时为 map，统一转换处理
+		output := TfStateVariable{}
+		if err := json.Unmarshal(utils.MustJSON(v), &output); err != nil {
+			continue
+		}
+
+		value := sensitiveValueMask
+		if !output.Sensitive {
+			if s, ok := output.Value.(string); ok {
+				value = s
+			} else {
+				value = string(utils.MustJSON(output.Value))
+			}
+		}
+		rs = append(rs, PreviewEnvOutput{Name: name, Value: value})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name < rs[j].Name
+	})
+	return rs
+}
+
+// BuildPreviewCommentAttrs 生成 PR 预览环境评论模板的参数
+func BuildPreviewCommentAttrs(env *models.Env, task *models.Task, taskStatus string) map[string]interface{} {
+	return map[string]interface{}{
+		"Name":     env.Name,
+		"EnvAddr":  GetEnvDetailUrl(env),
+		"Addr":     GetTaskDetailUrl(task),
+		"TaskType": task.Type,
+		"Status":   taskStatus,
+		"Archived": env.Archived,
+		"Outputs":  GetPreviewEnvOutputs(task.Result.Outputs),
+	}
+}
+
+// SendPreviewEnvComment 将预览环境的访问地址及 outputs 写入 PR 评论，同一 PR 下只保留一条评论
+func SendPreviewEnvComment(session *db.Session, env *models.Env, task *models.Task) {
+	logger := logs.Get().WithField("func", "SendPreviewEnvComment").WithField("taskId", task.Id)
+
+	vp, err := GetVcsPrByTaskId(session, task)
+	if err != nil {
+		if !e.IsRecordNotFound(err) {
+			logger.Errorf("get vcs pr data err: %v", err)
+		}
+		return
+	}
+
+	repo, er := GetVcsRepoByTplId(session, task.TplId)
+	if er != nil {
+		logger.Errorf("get vcs repo err: %v", er)
+		return
+	}
+
+	content := utils.SprintTemplate(consts.PrPreviewCommentTpl, BuildPreviewCommentAttrs(env, task, task.Status))
+	upsertPrComment(session, repo, vp, content, logger)
+}
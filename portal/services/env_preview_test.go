@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPreviewEnvOutputs(t *testing.T) {
+	outputs := map[string]interface{}{
+		"url":      TfStateVariable{Value: "http://1.2.3.4"},
+		"password": TfStateVariable{Value: "secret", Sensitive: true},
+		// 从 db 中读取的 outputs
+		"ports": map[string]interface{}{"value": []interface{}{80, 443}},
+	}
+	assert.Equal(t, []PreviewEnvOutput{
+		{Name: "password", Value: sensitiveValueMask},
+		{Name: "ports", Value: "[80,443]"},
+		{Name: "url", Value: "http://1.2.3.4"},
+	}, GetPreviewEnvOutputs(outputs))
+}
+
+func TestBuildPreviewCommentAttrs(t *testing.T) {
+	configs.Set(&configs.Config{Portal: configs.PortalConfig{Address: "http://iac.example.com"}})
+
+	env := &models.Env{Name: "web-pr-3", OrgId: "org-1", ProjectId: "p-1", PreviewPrId: 3}
+	env.Id = "env-1"
+	task := &models.Task{}
+	task.Id = "run-1"
+	task.OrgId, task.ProjectId, task.EnvId = env.OrgId, env.ProjectId, env.Id
+	task.Type = models.TaskTypeApply
+	task.Result.Outputs = map[string]interface{}{"url": TfStateVariable{Value: "http://1.2.3.4"}}
+
+	attrs := BuildPreviewCommentAttrs(env, task, models.TaskComplete)
+	assert.Equal(t, "http://iac.example.com/org/org-1/project/p-1/m-project-env/detail/env-1", attrs["EnvAddr"])
+
+	content := utils.SprintTemplate(consts.PrPreviewCommentTpl, attrs)
+	assert.Contains(t, content, `<a href="http://iac.example.com/org/org-1/project/p-1/m-project-env/detail/env-1">web-pr-3</a>`)
+	assert.Contains(t, content, "| url | `http://1.2.3.4` |")
+
+	env.Archived = true
+	task.Type = models.TaskTypeDestroy
+	content = utils.SprintTemplate(consts.PrPreviewCommentTpl, BuildPreviewCommentAttrs(env, task, models.TaskComplete))
+	assert.Contains(t, content, "destroyed and archived")
+	assert.NotContains(t, content, "Outputs")
+}
@@ -0,0 +1,353 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/utils"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+const (
+	EnvConfigChangeCreate = "create"
+	EnvConfigChangeUpdate = "update"
+	EnvConfigChangeDelete = "delete"
+
+	sensitiveValueMask = "******"
+)
+
+// EnvPromoteConfig 环境提升/克隆时在环境间复制的配置
+type EnvPromoteConfig struct {
+	Revision     string
+	Workdir      string
+	TfVarsFile   string
+	PlayVarsFile string
+	Playbook     string
+	KeyId        models.Id
+	RunnerId     string
+	RunnerTags   string
+	StepTimeout  int
+
+	AutoApproval    bool
+	StopOnViolation bool
+	Triggers        []string
+	RetryAble       bool
+	RetryNumber     int
+	RetryDelay      int
+	PolicyEnable    bool
+
+	PolicyGroups map[models.Id]string // 绑定的策略组, id => name
+	VarGroups    map[models.Id]string // 绑定的变量组, id => name
+	Variables    []models.Variable    // 环境级变量，敏感变量的值为解密后的明文
+}
+
+// GetEnvPromoteConfig 获取环境中可复制的配置
+func GetEnvPromoteConfig(sess *db.Session, env *models.Env) (*EnvPromoteConfig, e.Error) {
+	conf := &EnvPromoteConfig{
+		Revision:        env.Revision,
+		Workdir:         env.Workdir,
+		TfVarsFile:      env.TfVarsFile,
+		PlayVarsFile:    env.PlayVarsFile,
+		Playbook:        env.Playbook,
+		KeyId:           env.KeyId,
+		RunnerId:        env.RunnerId,
+		RunnerTags:      env.RunnerTags,
+		StepTimeout:     env.StepTimeout,
+		AutoApproval:    env.AutoApproval,
+		StopOnViolation: env.StopOnViolation,
+		Triggers:        env.Triggers,
+		RetryAble:       env.RetryAble,
+		RetryNumber:     env.RetryNumber,
+		RetryDelay:      env.RetryDelay,
+		PolicyEnable:    env.PolicyEnable,
+		PolicyGroups:    make(map[models.Id]string),
+		VarGroups:       make(map[models.Id]string),
+	}
+
+	vars := make([]models.Variable, 0)
+	table := models.Variable{}.TableName()
+	if err := WithVarScopeIdWhere(QueryVariable(sess), table, consts.ScopeEnv, env.Id).Find(&vars); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for i := range vars {
+		if vars[i].Sensitive && vars[i].Value != "" {
+			value, err := utils.DecryptSecretVar(vars[i].Value)
+			if err != nil {
+				return nil, e.New(e.InternalError, err)
+			}
+			vars[i].Value = value
+		}
+	}
+	conf.Variables = vars
+
+	vgIds := make([]models.Id, 0)
+	if err := sess.Model(&models.VariableGroupRel{}).
+		Where("object_type = ? AND object_id = ?", consts.ScopeEnv, env.Id).
+		Pluck("var_group_id", &vgIds); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(vgIds) > 0 {
+		vgs, er := GetVariableGroupListByIds(sess, vgIds)
+		if er != nil {
+			return nil, er
+		}
+		for _, vg := range vgs {
+			conf.VarGroups[vg.Id] = vg.Name
+		}
+	}
+
+	pgs := make([]models.PolicyGroup, 0)
+	if err := sess.Model(&models.PolicyGroup{}).
+		Where(fmt.Sprintf("id IN (SELECT group_id FROM %s WHERE scope = ? AND env_id = ?)", models.PolicyRel{}.TableName()),
+			consts.ScopeEnv, env.Id).
+		Find(&pgs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, pg := range pgs {
+		conf.PolicyGroups[pg.Id] = pg.Name
+	}
+	return conf, nil
+}
+
+// GetEnvLastSuccessTask 获取环境最后一次执行成功的部署任务
+func GetEnvLastSuccessTask(sess *db.Session, envId models.Id) (*models.Task, e.Error) {
+	task := models.Task{}
+	err := sess.Where("env_id = ? AND type = ? AND status = ?", envId, models.TaskTypeApply, models.TaskComplete).
+		Order("created_at DESC").First(&task)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvPromoteNoSuccessTask, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &task, nil
+}
+
+// DiffEnvPromoteConfig 对比将 src 配置复制到目标环境时的配置变更，dst 为 nil 表示目标环境为新建环境
+func DiffEnvPromoteConfig(src, dst *EnvPromoteConfig) []resps.EnvConfigChange {
+	action := EnvConfigChangeUpdate
+	if dst == nil {
+		action = EnvConfigChangeCreate
+		dst = &EnvPromoteConfig{}
+	}
+
+	changes := make([]resps.EnvConfigChange, 0)
+	addChange := func(field string, before, after interface{}) {
+		if reflect.DeepEqual(before, after) {
+			return
+		}
+		changes = append(changes, resps.EnvConfigChange{
+			Field:  field,
+			Action: action,
+			Before: before,
+			After:  after,
+		})
+	}
+
+	addChange("revision", dst.Revision, src.Revision)
+	addChange("workdir", dst.Workdir, src.Workdir)
+	addChange("tfVarsFile", dst.TfVarsFile, src.TfVarsFile)
+	addChange("playVarsFile", dst.PlayVarsFile, src.PlayVarsFile)
+	addChange("playbook", dst.Playbook, src.Playbook)
+	addChange("keyId", dst.KeyId, src.KeyId)
+	addChange("runnerId", dst.RunnerId, src.RunnerId)
+	addChange("runnerTags", dst.RunnerTags, src.RunnerTags)
+	addChange("stepTimeout", dst.StepTimeout, src.StepTimeout)
+	addChange("autoApproval", dst.AutoApproval, src.AutoApproval)
+	addChange("stopOnViolation", dst.StopOnViolation, src.StopOnViolation)
+	addChange("triggers", sortedStrings(dst.Triggers), sortedStrings(src.Triggers))
+	addChange("retryAble", dst.RetryAble, src.RetryAble)
+	addChange("retryNumber", dst.RetryNumber, src.RetryNumber)
+	addChange("retryDelay", dst.RetryDelay, src.RetryDelay)
+	addChange("policyEnable", dst.PolicyEnable, src.PolicyEnable)
+	addChange("policyGroups", sortedNames(dst.PolicyGroups), sortedNames(src.PolicyGroups))
+	addChange("varGroups", sortedNames(dst.VarGroups), sortedNames(src.VarGroups))
+
+	return append(changes, diffEnvPromoteVars(src.Variables, dst.Variables)...)
+}
+
+func diffEnvPromoteVars(srcVars, dstVars []models.Variable) []resps.EnvConfigChange {
+	dstMap := make(map[string]models.Variable)
+	for _, v := range dstVars {
+		dstMap[v.Key()] = v
+	}
+
+	changes := make([]resps.EnvConfigChange, 0)
+	srcKeys := make(map[string]struct{})
+	for _, v := range srcVars {
+		srcKeys[v.Key()] = struct{}{}
+		field := fmt.Sprintf("variables.%s.%s", v.Type, v.Name)
+		old, ok := dstMap[v.Key()]
+		if !ok {
+			changes = append(changes, resps.EnvConfigChange{
+				Field: field, Action: EnvConfigChangeCreate, After: varDisplayValue(v),
+			})
+		} else if old.Value != v.Value || old.Sensitive != v.Sensitive ||
+			old.Description != v.Description || !reflect.DeepEqual(old.Options, v.Options) {
+			changes = append(changes, resps.EnvConfigChange{
+				Field: field, Action: EnvConfigChangeUpdate, Before: varDisplayValue(old), After: varDisplayValue(v),
+			})
+		}
+	}
+	for _, v := range dstVars {
+		if _, ok := srcKeys[v.Key()]; !ok {
+			changes = append(changes, resps.EnvConfigChange{
+				Field:  fmt.Sprintf("variables.%s.%s", v.Type, v.Name),
+				Action: EnvConfigChangeDelete,
+				Before: varDisplayValue(v),
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+func varDisplayValue(v models.Variable) string {
+	if v.Sensitive {
+		return sensitiveValueMask
+	}
+	return v.Value
+}
+
+func sortedStrings(ss []string) []string {
+	rs := make([]string, len(ss))
+	copy(rs, ss)
+	sort.Strings(rs)
+	return rs
+}
+
+func sortedNames(m map[models.Id]string) []string {
+	names := make([]string, 0, len(m))
+	for _, name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FilterEnvPromoteGroups 从配置中移除目标项目无法使用的变量组及策略组，
+// 变量组需要属于同一组织且被授权在目标项目下使用，策略组需要属于同一组织
+func FilterEnvPromoteGroups(sess *db.Session, orgId, projectId models.Id, conf *EnvPromoteConfig) e.Error {
+	if len(conf.VarGroups) > 0 {
+		vgs, er := GetProjectVarGroups(sess, projectId)
+		if er != nil {
+			return er
+		}
+		visible := make(map[models.Id]struct{}, len(vgs))
+		for _, vg := range vgs {
+			if vg.OrgId == orgId {
+				visible[vg.Id] = struct{}{}
+			}
+		}
+		for id := range conf.VarGroups {
+			if _, ok := visible[id]; !ok {
+				delete(conf.VarGroups, id)
+			}
+		}
+	}
+
+	if len(conf.PolicyGroups) > 0 {
+		pgIds := make([]models.Id, 0, len(conf.PolicyGroups))
+		for id := range conf.PolicyGroups {
+			pgIds = append(pgIds, id)
+		}
+		visible := make([]models.Id, 0)
+		if err := sess.Model(&models.PolicyGroup{}).Where("org_id = ? AND id IN (?)", orgId, pgIds).
+			Pluck("id", &visible); err != nil {
+			return e.New(e.DBError, err)
+		}
+		visibleMap := make(map[models.Id]struct{}, len(visible))
+		for _, id := range visible {
+			visibleMap[id] = struct{}{}
+		}
+		for id := range conf.PolicyGroups {
+			if _, ok := visibleMap[id]; !ok {
+				delete(conf.PolicyGroups, id)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyEnvPromoteConfig 将配置复制到目标环境，目标环境原有的变量、变量组及策略组绑定关系会被替换，
+// 目标项目无法使用的变量组及策略组不会被绑定
+func ApplyEnvPromoteConfig(tx *db.Session, env *models.Env, conf *EnvPromoteConfig, updaterId models.Id) (*models.Env, e.Error) {
+	if er := FilterEnvPromoteGroups(tx, env.OrgId, env.ProjectId, conf); er != nil {
+		return nil, er
+	}
+
+	attrs := models.Attrs{
+		"revision":          conf.Revision,
+		"workdir":           conf.Workdir,
+		"tf_vars_file":      conf.TfVarsFile,
+		"play_vars_file":    conf.PlayVarsFile,
+		"playbook":          conf.Playbook,
+		"key_id":            conf.KeyId,
+		"runner_id":         conf.RunnerId,
+		"runner_tags":       conf.RunnerTags,
+		"step_timeout":      conf.StepTimeout,
+		"auto_approval":     conf.AutoApproval,
+		"stop_on_violation": conf.StopOnViolation,
+		"triggers":          pq.StringArray(conf.Triggers),
+		"retry_able":        conf.RetryAble,
+		"retry_number":      conf.RetryNumber,
+		"retry_delay":       conf.RetryDelay,
+		"policy_enable":     conf.PolicyEnable,
+	}
+	env, er := UpdateEnv(tx, env.Id, attrs)
+	if er != nil {
+		return nil, er
+	}
+
+	vars := make([]models.Variable, 0, len(conf.Variables))
+	for _, v := range conf.Variables {
+		body := v.VariableBody
+		body.UpdaterId = updaterId
+		vars = append(vars, models.Variable{
+			VariableBody: body,
+			OrgId:        env.OrgId,
+			ProjectId:    env.ProjectId,
+			TplId:        env.TplId,
+			EnvId:        env.Id,
+		})
+	}
+	if _, er := UpdateObjectVars(tx, consts.ScopeEnv, env.Id, vars); er != nil {
+		return nil, er
+	}
+
+	if er := DeleteVarGroupRel(tx, consts.ScopeEnv, env.Id); er != nil {
+		return nil, er
+	}
+	vgIds := make([]models.Id, 0, len(conf.VarGroups))
+	for id := range conf.VarGroups {
+		vgIds = append(vgIds, id)
+	}
+	if er := BatchUpdateRelationship(tx, vgIds, nil, consts.ScopeEnv, env.Id.String()); er != nil {
+		return nil, er
+	}
+
+	pgIds := make([]models.Id, 0, len(conf.PolicyGroups))
+	for id := range conf.PolicyGroups {
+		pgIds = append(pgIds, id)
+	}
+	if _, er := UpdatePolicyRel(tx, &forms.UpdatePolicyRelForm{
+		Id:             env.Id,
+		Scope:          consts.ScopeEnv,
+		PolicyGroupIds: pgIds,
+	}); er != nil {
+		return nil, er
+	}
+	return env, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPromoteVar(name, value string, sensitive bool) models.Variable {
+	return models.Variable{VariableBody: models.VariableBody{
+		Scope:     consts.ScopeEnv,
+		Type:      consts.VarTypeTerraform,
+		Name:      name,
+		Value:     value,
+		Sensitive: sensitive,
+	}}
+}
+
+func TestDiffEnvPromoteConfig(t *testing.T) {
+	src := &EnvPromoteConfig{
+		Revision:     "abc123",
+		Triggers:     []string{"prmr", "commit"},
+		PolicyGroups: map[models.Id]string{"pog-1": "security"},
+		VarGroups:    map[models.Id]string{"vg-1": "aliyun"},
+		Variables: []models.Variable{
+			newPromoteVar("region", "cn-beijing", false),
+			newPromoteVar("password", "new", true),
+			newPromoteVar("size", "small", false),
+		},
+	}
+
+	changes := DiffEnvPromoteConfig(src, nil)
+	for _, c := range changes {
+		assert.Equal(t, EnvConfigChangeCreate, c.Action, c.Field)
+	}
+	assert.Len(t, changes, 7)
+
+	dst := &EnvPromoteConfig{
+		Revision:     "master",
+		Triggers:     []string{"commit", "prmr"},
+		PolicyGroups: map[models.Id]string{"pog-1": "security"},
+		VarGroups:    map[models.Id]string{},
+		Variables: []models.Variable{
+			newPromoteVar("region", "cn-hangzhou", false),
+			newPromoteVar("password", "old", true),
+			newPromoteVar("size", "small", false),
+			newPromoteVar("zone", "a", false),
+		},
+	}
+	changes = DiffEnvPromoteConfig(src, dst)
+	fields := make(map[string]string)
+	for _, c := range changes {
+		fields[c.Field] = c.Action
+	}
+	assert.Equal(t, map[string]string{
+		"revision":                     EnvConfigChangeUpdate,
+		"varGroups":                    EnvConfigChangeUpdate,
+		"variables.terraform.password": EnvConfigChangeUpdate,
+		"variables.terraform.region":   EnvConfigChangeUpdate,
+		"variables.terraform.zone":     EnvConfigChangeDelete,
+	}, fields)
+
+	for _, c := range changes {
+		if c.Field == "variables.terraform.password" {
+			assert.Equal(t, sensitiveValueMask, c.Before)
+			assert.Equal(t, sensitiveValueMask, c.After)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/runner"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+)
+
+var stateLockIdRegex = regexp.MustCompile(`^[\w-]+$`)
+
+// CheckStateAddress 检查 state 操作的地址，除资源地址外也允许 module 地址(如 module.vpc)
+func CheckStateAddress(addr string) bool {
+	m := resourceAddressRegex.FindStringSubmatch(addr)
+	return m != nil && m[1] != "data"
+}
+
+func checkStateOp(op runner.TaskStateOp) error {
+	switch op.Action {
+	case common.StateOpMv:
+		if !CheckStateAddress(op.Address) || !CheckStateAddress(op.Destination) {
+			return fmt.Errorf("invalid address '%s' -> '%s'", op.Address, op.Destination)
+		}
+		if op.Address == op.Destination {
+			return fmt.Errorf("source and destination are the same")
+		}
+	case common.StateOpRm:
+		if !CheckStateAddress(op.Address) {
+			return fmt.Errorf("invalid address '%s'", op.Address)
+		}
+	case common.StateOpTaint, common.StateOpUntaint:
+		// taint 只能作用于资源实例
+		if !CheckImportAddress(op.Address) {
+			return fmt.Errorf("invalid address '%s'", op.Address)
+		}
+	case common.StateOpForceUnlock:
+		if !stateLockIdRegex.MatchString(op.LockId) {
+			return fmt.Errorf("invalid lock id '%s'", op.LockId)
+		}
+	default:
+		return fmt.Errorf("unknown action '%s'", op.Action)
+	}
+	return nil
+}
+
+// BuildTaskStateOps 检查并生成 state 操作任务的操作列表
+func BuildTaskStateOps(ops []runner.TaskStateOp) (models.TaskStateOps, e.Error) {
+	rs := make(models.TaskStateOps, 0, len(ops))
+	for i, op := range ops {
+		if err := checkStateOp(op); err != nil {
+			return nil, e.New(e.EnvStateOpInvalid, fmt.Errorf("ops[%d]: %v", i, err), http.StatusBadRequest)
+		}
+		// 只保留操作需要的字段
+		item := runner.TaskStateOp{Action: op.Action}
+		switch op.Action {
+		case common.StateOpForceUnlock:
+			item.LockId = op.LockId
+		case common.StateOpMv:
+			item.Address, item.Destination = op.Address, op.Destination
+		default:
+			item.Address = op.Address
+		}
+		rs = append(rs, item)
+	}
+	return rs, nil
+}
+
+// GetTaskStateSnapshot 读取 state 操作任务执行前后的 state 快照
+func GetTaskStateSnapshot(task *models.Task, stage string) ([]byte, e.Error) {
+	if task.Type != common.TaskTypeStateOp {
+		return nil, e.New(e.BadParam, fmt.Errorf("task %s is not a state operation task", task.Id), http.StatusBadRequest)
+	}
+	content, err := logstorage.Get().Read(task.StateSnapshotPath(stage))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, e.New(e.ObjectNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.InternalError, err)
+	}
+	return content, nil
+}
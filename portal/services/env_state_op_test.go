@@ -0,0 +1,40 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/runner"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTaskStateOps(t *testing.T) {
+	ops, err := BuildTaskStateOps([]runner.TaskStateOp{
+		{Action: "mv", Address: "aws_instance.a", Destination: "module.web.aws_instance.a", LockId: "x"},
+		{Action: "mv", Address: "module.old", Destination: "module.new"},
+		{Action: "rm", Address: "aws_instance.b", Destination: "aws_instance.c"},
+		{Action: "taint", Address: `aws_instance.c["k"]`},
+		{Action: "forceUnlock", Address: "aws_instance.d", LockId: "6f0c2d7e-0a4e-4e47-b3c1"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, runner.TaskStateOp{Action: "mv", Address: "aws_instance.a", Destination: "module.web.aws_instance.a"}, ops[0])
+	assert.Equal(t, runner.TaskStateOp{Action: "rm", Address: "aws_instance.b"}, ops[2])
+	assert.Equal(t, runner.TaskStateOp{Action: "forceUnlock", LockId: "6f0c2d7e-0a4e-4e47-b3c1"}, ops[4])
+
+	invalid := [][]runner.TaskStateOp{
+		{{Action: "mv", Address: "aws_instance.a", Destination: "aws_instance.a"}},
+		{{Action: "mv", Address: "aws_instance.a"}},
+		{{Action: "rm", Address: "data.aws_ami.x"}},
+		{{Action: "taint", Address: "module.web"}},
+		{{Action: "forceUnlock", LockId: "id; rm -rf /"}},
+		{{Action: "push"}},
+	}
+	for _, ops := range invalid {
+		_, err := BuildTaskStateOps(ops)
+		if assert.NotNil(t, err, ops) {
+			assert.Equal(t, e.EnvStateOpInvalid, err.Code())
+		}
+	}
+}
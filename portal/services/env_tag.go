@@ -0,0 +1,179 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// CheckEnvTags 检查环境标签格式，返回格式化后的标签字符串
+func CheckEnvTags(tags string) (string, e.Error) {
+	parsed := models.ParseEnvTags(tags)
+	if len(parsed) > consts.EnvMaxTagNum {
+		return "", e.New(e.EnvTagNumLimited, http.StatusBadRequest)
+	}
+
+	keys := make(map[string]struct{})
+	for _, t := range parsed {
+		if t.Key == "" {
+			return "", e.New(e.EnvTagInvalid, fmt.Errorf("empty tag key"), http.StatusBadRequest)
+		}
+		if utf8.RuneCountInString(t.Key) > consts.EnvMaxTagKeyLength ||
+			utf8.RuneCountInString(t.Value) > consts.EnvMaxTagLength {
+			return "", e.New(e.EnvTagLengthLimited, fmt.Errorf("tag '%s'", t), http.StatusBadRequest)
+		}
+		if strings.Contains(t.Value, "=") {
+			return "", e.New(e.EnvTagInvalid, fmt.Errorf("tag '%s'", t), http.StatusBadRequest)
+		}
+		if _, ok := keys[t.Key]; ok {
+			return "", e.New(e.EnvTagKeyDuplicate, fmt.Errorf("tag key '%s'", t.Key), http.StatusBadRequest)
+		}
+		keys[t.Key] = struct{}{}
+	}
+	return models.FormatEnvTags(parsed), nil
+}
+
+// CheckEnvTagsSchema 检查环境标签是否满足组织的标签规范
+func CheckEnvTagsSchema(tags []models.EnvTag, schemas []models.EnvTagSchema) e.Error {
+	tagMap := make(map[string]string, len(tags))
+	for _, t := range tags {
+		tagMap[t.Key] = t.Value
+	}
+
+	for _, s := range schemas {
+		value, ok := tagMap[s.Key]
+		if !ok || value == "" {
+			if s.Required {
+				return e.New(e.EnvTagRequired, fmt.Errorf("tag '%s' is required", s.Key), http.StatusBadRequest)
+			}
+			continue
+		}
+		if len(s.Values) > 0 && !utils.StrInArray(value, s.Values...) {
+			return e.New(e.EnvTagValueNotAllowed,
+				fmt.Errorf("value of tag '%s' must be one of %s", s.Key, strings.Join(s.Values, ",")), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// FilterEnvTags 按标签过滤环境，conds 中 value 为空的条件只要求环境包含该 key
+func FilterEnvTags(query *db.Session, conds []models.EnvTag) *db.Session {
+	likeEscaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	for _, c := range conds {
+		if c.Value != "" {
+			query = query.Where("FIND_IN_SET(?, iac_env.tags) > 0", c.String())
+		} else {
+			query = query.Where("(FIND_IN_SET(?, iac_env.tags) > 0 OR CONCAT(',', iac_env.tags) LIKE ?)",
+				c.Key, fmt.Sprintf("%%,%s=%%", likeEscaper.Replace(c.Key)))
+		}
+	}
+	return query
+}
+
+func QueryEnvTagSchema(query *db.Session, orgId models.Id) *db.Session {
+	return query.Model(&models.EnvTagSchema{}).Where("org_id = ?", orgId).Order("tag_key")
+}
+
+func GetOrgEnvTagSchemas(query *db.Session, orgId models.Id) ([]models.EnvTagSchema, e.Error) {
+	schemas := make([]models.EnvTagSchema, 0)
+	if err := QueryEnvTagSchema(query, orgId).Find(&schemas); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return schemas, nil
+}
+
+func GetEnvTagSchemaById(query *db.Session, id models.Id) (*models.EnvTagSchema, e.Error) {
+	s := models.EnvTagSchema{}
+	if err := query.Model(&models.EnvTagSchema{}).Where("id = ?", id).First(&s); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvTagSchemaNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &s, nil
+}
+
+func CreateEnvTagSchema(tx *db.Session, s models.EnvTagSchema) (*models.EnvTagSchema, e.Error) {
+	if err := models.Create(tx, &s); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.EnvTagSchemaExists, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &s, nil
+}
+
+func UpdateEnvTagSchema(tx *db.Session, id models.Id, attrs models.Attrs) (*models.EnvTagSchema, e.Error) {
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.EnvTagSchema{}, attrs); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update env tag schema error: %v", err))
+	}
+	return GetEnvTagSchemaById(tx, id)
+}
+
+func DeleteEnvTagSchema(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.EnvTagSchema{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete env tag schema error: %v", err))
+	}
+	return nil
+}
+
+type envCost struct {
+	EnvId  models.Id
+	Tags   string
+	Amount float64
+}
+
+// GetOrgTagCostStat 按环境标签的值统计组织(或指定项目)下账单月的费用
+func GetOrgTagCostStat(tx *db.Session, orgId models.Id, projectIds []string, tagKey, cycle string) ([]resps.TagCostStatResp, e.Error) {
+	query := tx.Model(&models.Bill{}).
+		Select("iac_bill.env_id as env_id, iac_env.tags as tags, SUM(iac_bill.pretax_amount) as amount").
+		Joins("JOIN iac_env ON iac_env.id = iac_bill.env_id").
+		Where("iac_bill.org_id = ? AND iac_bill.cycle = ?", orgId, cycle)
+	if len(projectIds) > 0 {
+		query = query.Where("iac_bill.project_id IN (?)", projectIds)
+	}
+	query = query.Group("iac_bill.env_id, iac_env.tags")
+
+	costs := make([]envCost, 0)
+	if err := query.Scan(&costs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return groupEnvCostByTag(costs, tagKey), nil
+}
+
+// groupEnvCostByTag 按标签值汇总环境费用，未设置该标签的环境汇总到 value 为空的分组
+func groupEnvCostByTag(costs []envCost, tagKey string) []resps.TagCostStatResp {
+	statMap := make(map[string]*resps.TagCostStatResp)
+	for _, c := range costs {
+		value := models.EnvTagsMap(c.Tags)[tagKey]
+		stat, ok := statMap[value]
+		if !ok {
+			stat = &resps.TagCostStatResp{Key: tagKey, Value: value}
+			statMap[value] = stat
+		}
+		stat.Amount += c.Amount
+		stat.EnvCount++
+	}
+
+	results := make([]resps.TagCostStatResp, 0, len(statMap))
+	for _, s := range statMap {
+		results = append(results, *s)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Amount != results[j].Amount {
+			return results[i].Amount > results[j].Amount
+		}
+		return results[i].Value < results[j].Value
+	})
+	return results
+}
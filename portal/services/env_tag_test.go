@@ -0,0 +1,100 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnvTags(t *testing.T) {
+	tags := models.ParseEnvTags(" env = prod ,owner,, cost-center=rd=1")
+	assert.Equal(t, []models.EnvTag{
+		{Key: "env", Value: "prod"},
+		{Key: "owner"},
+		{Key: "cost-center", Value: "rd=1"},
+	}, tags)
+	assert.Equal(t, "env=prod,owner,cost-center=rd=1", models.FormatEnvTags(tags))
+	assert.Equal(t, map[string]string{"env": "prod", "owner": "", "cost-center": "rd=1"}, models.EnvTagsMap("env=prod,owner,cost-center=rd=1"))
+	assert.Empty(t, models.ParseEnvTags(""))
+}
+
+func TestCheckEnvTags(t *testing.T) {
+	cases := []struct {
+		tags   string
+		expect string
+		code   int
+	}{
+		{"", "", 0},
+		{" env = prod, owner ", "env=prod,owner", 0},
+		{"=prod", "", e.EnvTagInvalid},
+		{"env=a=b", "", e.EnvTagInvalid},
+		{"env=prod,env=test", "", e.EnvTagKeyDuplicate},
+		{"env=" + strings.Repeat("a", 65), "", e.EnvTagLengthLimited},
+		{strings.Repeat("k,", 11), "", e.EnvTagNumLimited},
+	}
+
+	for _, c := range cases {
+		tags, er := CheckEnvTags(c.tags)
+		if c.code == 0 {
+			assert.NoError(t, er, c.tags)
+			assert.Equal(t, c.expect, tags)
+		} else if assert.Error(t, er, c.tags) {
+			assert.Equal(t, c.code, er.Code(), c.tags)
+		}
+	}
+}
+
+func TestCheckEnvTagsSchema(t *testing.T) {
+	schemas := []models.EnvTagSchema{
+		{Key: "cost-center", Required: true, Values: models.StrSlice{"rd", "ops"}},
+		{Key: "owner", Required: true},
+		{Key: "env", Values: models.StrSlice{"prod", "test"}},
+	}
+
+	cases := []struct {
+		tags string
+		code int
+	}{
+		{"cost-center=rd,owner=alice", 0},
+		{"cost-center=ops,owner=bob,env=test,other", 0},
+		{"owner=alice", e.EnvTagRequired},
+		{"cost-center=rd,owner", e.EnvTagRequired},
+		{"cost-center=sales,owner=alice", e.EnvTagValueNotAllowed},
+		{"cost-center=rd,owner=alice,env=dev", e.EnvTagValueNotAllowed},
+	}
+
+	for _, c := range cases {
+		er := CheckEnvTagsSchema(models.ParseEnvTags(c.tags), schemas)
+		if c.code == 0 {
+			assert.NoError(t, er, c.tags)
+		} else if assert.Error(t, er, c.tags) {
+			assert.Equal(t, c.code, er.Code(), c.tags)
+		}
+	}
+}
+
+func TestGroupEnvCostByTag(t *testing.T) {
+	costs := []envCost{
+		{EnvId: "env-1", Tags: "cost-center=rd,env=prod", Amount: 10},
+		{EnvId: "env-2", Tags: "cost-center=rd", Amount: 5.5},
+		{EnvId: "env-3", Tags: "cost-center=ops", Amount: 20},
+		{EnvId: "env-4", Tags: "env=test", Amount: 1},
+	}
+
+	stats := groupEnvCostByTag(costs, "cost-center")
+	if assert.Len(t, stats, 3) {
+		assert.Equal(t, "ops", stats[0].Value)
+		assert.Equal(t, 20.0, stats[0].Amount)
+		assert.Equal(t, "rd", stats[1].Value)
+		assert.Equal(t, 15.5, stats[1].Amount)
+		assert.Equal(t, 2, stats[1].EnvCount)
+		assert.Equal(t, "", stats[2].Value)
+		assert.Equal(t, 1, stats[2].EnvCount)
+	}
+	assert.Empty(t, groupEnvCostByTag(nil, "cost-center"))
+}
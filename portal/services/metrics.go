@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// taskMetricsCollector 在每次采集时统计未结束的任务数量，用于监控任务队列积压、审批长时间未处理等情况
+type taskMetricsCollector struct {
+	desc *prometheus.Desc
+}
+
+func NewTaskMetricsCollector() prometheus.Collector {
+	return &taskMetricsCollector{
+		desc: prometheus.NewDesc(
+			"cloudiac_tasks",
+			"Number of unfinished tasks, by org, task type and status.",
+			[]string{"org", "type", "status"}, nil,
+		),
+	}
+}
+
+func (c *taskMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+type taskStatusCount struct {
+	OrgId  string
+	Type   string
+	Status string
+	Count  int
+}
+
+func (c *taskMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := countUnfinishedTasks(db.Get())
+	if err != nil {
+		logs.Get().Warnf("count unfinished tasks error: %v", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for _, cnt := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue,
+			float64(cnt.Count), cnt.OrgId, cnt.Type, cnt.Status)
+	}
+}
+
+func countUnfinishedTasks(sess *db.Session) ([]taskStatusCount, error) {
+	statuses := []string{common.TaskPending, common.TaskRunning, common.TaskApproving}
+	counts := make([]taskStatusCount, 0)
+	for _, m := range []interface{}{&models.Task{}, &models.ScanTask{}} {
+		rs := make([]taskStatusCount, 0)
+		err := sess.Model(m).
+			Select("org_id, type, status, count(*) as count").
+			Where("status IN (?)", statuses).
+			Group("org_id, type, status").
+			Scan(&rs)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, rs...)
+	}
+	return counts, nil
+}
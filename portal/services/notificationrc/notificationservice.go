@@ -10,7 +10,13 @@ import (
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"cloudiac/utils/mail"
+	"cloudiac/utils/metrics"
+	"cloudiac/utils/tracing"
+	"context"
 	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type NotificationService struct {
@@ -22,6 +28,36 @@ type NotificationService struct {
 	Env       *models.Env          `json:"env" form:"env" `
 	Task      *models.Task         `json:"task" form:"task" `
 	EventType string               `json:"eventType" form:"eventType" `
+
+	Budget    *BudgetAlert    `json:"budget" form:"budget" `       // 预算阈值通知的内容，该类通知不关联任务
+	EnvExpire *EnvExpireAlert `json:"envExpire" form:"envExpire" ` // 环境即将自动销毁的提醒内容，该类通知不关联任务
+	UserIds   []string        `json:"userIds" form:"userIds" `     // 通知配置之外额外发送邮件的用户
+
+	DriftRemediation *DriftRemediationAlert `json:"driftRemediation" form:"driftRemediation" ` // 纠偏任务待审批的提醒内容
+
+	ctx context.Context // 用于传递链路追踪信息
+}
+
+// BudgetAlert 预算阈值通知的内容
+type BudgetAlert struct {
+	Cycle     string  // 账单月
+	Amount    float64 // 月度预算
+	Spent     float64 // 已产生费用
+	Threshold int     // 达到的阈值(百分比)
+}
+
+// EnvExpireAlert 环境即将自动销毁的提醒内容
+type EnvExpireAlert struct {
+	DestroyAt      string // 自动销毁时间
+	ExtendDuration string // 延期链接的延长时间
+	ExtendAddr     string // 延期链接
+}
+
+// DriftRemediationAlert 纠偏任务待审批的提醒内容
+type DriftRemediationAlert struct {
+	DriftCount int    // 需要纠偏的资源数量
+	Summary    string // 漂移摘要
+	ExpireAt   string // 审批超时时间
 }
 
 type NotificationOptions struct {
@@ -33,6 +69,11 @@ type NotificationOptions struct {
 	Env       *models.Env          `json:"env" form:"env" `
 	Task      *models.Task         `json:"task" form:"task" `
 	EventType string               `json:"eventType" form:"eventType" `
+	Budget    *BudgetAlert         `json:"budget" form:"budget" `
+	EnvExpire *EnvExpireAlert      `json:"envExpire" form:"envExpire" `
+	UserIds   []string             `json:"userIds" form:"userIds" `
+
+	DriftRemediation *DriftRemediationAlert `json:"driftRemediation" form:"driftRemediation" `
 }
 
 func NewNotificationService(options *NotificationOptions) NotificationService {
@@ -45,6 +86,11 @@ func NewNotificationService(options *NotificationOptions) NotificationService {
 		Project:   options.Project,
 		Org:       options.Org,
 		EventType: options.EventType,
+		Budget:    options.Budget,
+		EnvExpire: options.EnvExpire,
+		UserIds:   options.UserIds,
+
+		DriftRemediation: options.DriftRemediation,
 	}
 }
 
@@ -56,54 +102,33 @@ func (ns *NotificationService) SendMessage() {
 
 func (ns *NotificationService) SyncSendMessage() {
 	logger := logs.Get().WithField("action", "SyncSendMessage")
+	var span trace.Span
+	ns.ctx, span = tracing.Start(context.Background(), "notification.SyncSendMessage",
+		attribute.String("notification.event_type", ns.EventType))
+	defer span.End()
+	if ns.Task != nil {
+		span.SetAttributes(tracing.AttrTaskId.String(ns.Task.Id.String()))
+	}
+
 	notifications, messageTpl, mdMessageTpl, err := ns.FindNotificationsAndMessageTpl()
 	if err != nil {
 		logger.Warnf("FindNotificationsAndMessageTpl error: %v", err)
 		return
 	}
-	if len(notifications) == 0 {
+	if len(notifications) == 0 && len(ns.UserIds) == 0 {
 		logger.Debugln("no notifications")
 		return
 	}
-	u := models.User{}
-	if err := db.Get().Where("id = ?", ns.Task.CreatorId).First(&u); err != nil {
-		logs.Get().Warnf("get task creator(%s): %v", ns.Task.CreatorId, err)
+	data, err := ns.messageData()
+	if err != nil {
+		logger.Warnf("get message data: %v", err)
 		return
 	}
 
-	data := struct {
-		Creator      string
-		OrgName      string
-		ProjectName  string
-		TemplateName string
-		Revision     string
-		EnvName      string
-		Addr         string
-		ResAdded     *int
-		ResChanged   *int
-		ResDestroyed *int
-		Message      string
-		TaskType     string
-	}{
-		Creator:      u.Name,
-		OrgName:      ns.Org.Name,
-		ProjectName:  ns.Project.Name,
-		TemplateName: ns.Tpl.Name,
-		Revision:     ns.Tpl.RepoRevision,
-		EnvName:      ns.Env.Name,
-		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
-		Addr:         fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, ns.Org.Id, ns.ProjectId, ns.Env.Id, ns.Task.Id),
-		ResAdded:     ns.Task.Result.ResAdded,
-		ResChanged:   ns.Task.Result.ResChanged,
-		ResDestroyed: ns.Task.Result.ResDestroyed,
-		Message:      ns.Task.Message,
-		TaskType:     ns.Task.Type,
-	}
-
 	// 获取消息通知模板
 	mdMessageTpl = utils.SprintTemplate(mdMessageTpl, data)
 	messageTpl = utils.SprintTemplate(messageTpl, data)
-	userIds := make([]string, 0)
+	userIds := append([]string{}, ns.UserIds...)
 	// 判断消息类型，下发至的消息通道
 	for _, notification := range notifications {
 		if notification.Type == models.NotificationTypeEmail {
@@ -135,31 +160,134 @@ func (ns *NotificationService) SyncSendMessage() {
 	}
 }
 
+// messageData 生成渲染消息模板使用的数据
+func (ns *NotificationService) messageData() (interface{}, error) {
+	if ns.Budget != nil {
+		envName := ""
+		if ns.Env != nil {
+			envName = ns.Env.Name
+		}
+		return struct {
+			OrgName     string
+			ProjectName string
+			EnvName     string
+			BudgetAlert
+		}{
+			OrgName:     ns.Org.Name,
+			ProjectName: ns.Project.Name,
+			EnvName:     envName,
+			BudgetAlert: *ns.Budget,
+		}, nil
+	}
+
+	if ns.EnvExpire != nil {
+		return struct {
+			OrgName     string
+			ProjectName string
+			EnvName     string
+			Addr        string
+			EnvExpireAlert
+		}{
+			OrgName:        ns.Org.Name,
+			ProjectName:    ns.Project.Name,
+			EnvName:        ns.Env.Name,
+			Addr:           fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s", configs.Get().Portal.Address, ns.Org.Id, ns.ProjectId, ns.Env.Id),
+			EnvExpireAlert: *ns.EnvExpire,
+		}, nil
+	}
+
+	if ns.DriftRemediation != nil {
+		return struct {
+			OrgName     string
+			ProjectName string
+			EnvName     string
+			Addr        string
+			DriftRemediationAlert
+		}{
+			OrgName:               ns.Org.Name,
+			ProjectName:           ns.Project.Name,
+			EnvName:               ns.Env.Name,
+			Addr:                  fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, ns.Org.Id, ns.ProjectId, ns.Env.Id, ns.Task.Id),
+			DriftRemediationAlert: *ns.DriftRemediation,
+		}, nil
+	}
+
+	u := models.User{}
+	if err := db.Get().Where("id = ?", ns.Task.CreatorId).First(&u); err != nil {
+		return nil, fmt.Errorf("get task creator(%s): %v", ns.Task.CreatorId, err)
+	}
+
+	return struct {
+		Creator      string
+		OrgName      string
+		ProjectName  string
+		TemplateName string
+		Revision     string
+		EnvName      string
+		Addr         string
+		ResAdded     *int
+		ResChanged   *int
+		ResDestroyed *int
+		Message      string
+		TaskType     string
+	}{
+		Creator:      u.Name,
+		OrgName:      ns.Org.Name,
+		ProjectName:  ns.Project.Name,
+		TemplateName: ns.Tpl.Name,
+		Revision:     ns.Tpl.RepoRevision,
+		EnvName:      ns.Env.Name,
+		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
+		Addr:         fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, ns.Org.Id, ns.ProjectId, ns.Env.Id, ns.Task.Id),
+		ResAdded:     ns.Task.Result.ResAdded,
+		ResChanged:   ns.Task.Result.ResChanged,
+		ResDestroyed: ns.Task.Result.ResDestroyed,
+		Message:      ns.Task.Message,
+		TaskType:     ns.Task.Type,
+	}, nil
+}
+
 func (ns *NotificationService) SendDingTalkMessage(n models.Notification, message string) {
+	endSpan := ns.startSendSpan(models.NotificationTypeDingTalk)
 	dingTalk := NewDingTalkRobot(n.Url, n.Secret)
-	if err := dingTalk.SendMarkdownMessage(consts.NotificationMessageTitle, message, nil, false); err != nil {
+	err := dingTalk.SendMarkdownMessage(consts.NotificationMessageTitle, message, nil, false)
+	endSpan(err)
+	if err != nil {
 		logs.Get().Errorf("send dingtalk message err: %v", err)
+		metrics.NotificationSendFailures.WithLabelValues(models.NotificationTypeDingTalk).Inc()
 	}
 }
 
 func (ns *NotificationService) SendWechatMessage(n models.Notification, message string) {
+	endSpan := ns.startSendSpan(models.NotificationTypeWeChat)
 	wechat := WeChatRobot{Url: n.Url}
-	if _, err := wechat.SendMarkdown(message); err != nil {
+	_, err := wechat.SendMarkdown(message)
+	endSpan(err)
+	if err != nil {
 		logs.Get().Errorf("send wechat message err: %v", err)
-
+		metrics.NotificationSendFailures.WithLabelValues(models.NotificationTypeWeChat).Inc()
 	}
 }
 
 func (ns *NotificationService) SendWebhookMessage(n models.Notification, message string) {
+	endSpan := ns.startSendSpan(models.NotificationTypeWebhook)
 	w := Webhook{Url: n.Url}
-	if err := w.Send(message); err != nil {
+	err := w.Send(message)
+	endSpan(err)
+	if err != nil {
 		logs.Get().Errorf("send webhook message err: %v", err)
+		metrics.NotificationSendFailures.WithLabelValues(models.NotificationTypeWebhook).Inc()
 	}
 }
 
 func (ns *NotificationService) SendSlackMessage(n models.Notification, message string) {
+	endSpan := ns.startSendSpan(models.NotificationTypeSlack)
 	if errs := SendSlack(n.Url, Payload{Text: message, Markdown: true}); len(errs) != 0 {
+		endSpan(fmt.Errorf("%v", errs))
 		logs.Get().Errorf("send slack message err: %v", errs)
+		metrics.NotificationSendFailures.WithLabelValues(models.NotificationTypeSlack).Inc()
+	} else {
+		endSpan(nil)
 	}
 }
 
@@ -167,9 +295,23 @@ func (ns *NotificationService) SendEmailMessage(emails []string, message string)
 	if len(emails) < 1 {
 		return
 	}
-	if err := mail.SendMail(emails, consts.NotificationMessageTitle, message); err != nil {
+	endSpan := ns.startSendSpan(models.NotificationTypeEmail)
+	err := mail.SendMail(emails, consts.NotificationMessageTitle, message)
+	endSpan(err)
+	if err != nil {
 		logs.Get().Errorf("send mail message err: %v", err)
+		metrics.NotificationSendFailures.WithLabelValues(models.NotificationTypeEmail).Inc()
+	}
+}
+
+// startSendSpan 创建消息发送的 span，返回结束 span 的函数
+func (ns *NotificationService) startSendSpan(typ string) func(err error) {
+	ctx := ns.ctx
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	_, span := tracing.Start(ctx, "notification.send", attribute.String("notification.type", typ))
+	return func(err error) { tracing.End(span, err) }
 }
 
 func (ns *NotificationService) FindNotificationsAndMessageTpl() ([]models.Notification, string, string, error) {
@@ -198,6 +340,15 @@ func (ns *NotificationService) FindNotificationsAndMessageTpl() ([]models.Notifi
 	case consts.EventTaskComplete:
 		tplNotificationTemplate = consts.IacTaskCompleteTpl
 		markdownNotificationTemplate = consts.IacTaskCompleteMarkdown
+	case consts.EventBudgetThreshold:
+		tplNotificationTemplate = consts.IacBudgetThresholdTpl
+		markdownNotificationTemplate = consts.IacBudgetThresholdMarkdown
+	case consts.EventEnvExpiring:
+		tplNotificationTemplate = consts.IacEnvExpiringTpl
+		markdownNotificationTemplate = consts.IacEnvExpiringMarkdown
+	case consts.EventDriftRemediation:
+		tplNotificationTemplate = consts.IacDriftRemediationTpl
+		markdownNotificationTemplate = consts.IacDriftRemediationMarkdown
 	case consts.EvenvtCronDrift:
 		if ns.Task.Type == models.TaskTypeApply && ns.Task.IsDriftTask {
 			tplNotificationTemplate = consts.IacCronDriftApplyTaskTpl
@@ -0,0 +1,195 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models/resps"
+	"cloudiac/utils"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	PlanActionCreate  = "create"
+	PlanActionUpdate  = "update"
+	PlanActionDelete  = "delete"
+	PlanActionReplace = "replace"
+	PlanActionRead    = "read"
+
+	planSensitiveValue = "(sensitive value)"
+	planUnknownValue   = "(known after apply)"
+)
+
+// GetPlanResourceAction 将 terraform 的 actions 列表转换为单个变更动作，no-op 返回空字符串
+func GetPlanResourceAction(actions []string) string {
+	switch {
+	case utils.SliceEqualStr(actions, []string{"create", "delete"}),
+		utils.SliceEqualStr(actions, []string{"delete", "create"}):
+		return PlanActionReplace
+	case utils.SliceEqualStr(actions, []string{"create"}):
+		return PlanActionCreate
+	case utils.SliceEqualStr(actions, []string{"update"}):
+		return PlanActionUpdate
+	case utils.SliceEqualStr(actions, []string{"delete"}):
+		return PlanActionDelete
+	case utils.SliceEqualStr(actions, []string{"read"}):
+		return PlanActionRead
+	}
+	return ""
+}
+
+// BuildPlanDiff 解析 plan json 生成每个资源的属性变更，敏感属性值会被隐藏
+func BuildPlanDiff(planJson []byte) ([]resps.PlanResourceDiff, error) {
+	plan, err := UnmarshalPlanJson(planJson)
+	if err != nil {
+		return nil, err
+	}
+	sensitiveKeys := GetSensitiveKeysFromTfPlan(planJson)
+
+	diffs := make([]resps.PlanResourceDiff, 0, len(plan.ResourceChanges))
+	for _, r := range plan.ResourceChanges {
+		action := GetPlanResourceAction(r.Change.Actions)
+		if action == "" {
+			continue
+		}
+
+		replacePaths := make([]string, 0, len(r.Change.ReplacePaths))
+		for _, p := range r.Change.ReplacePaths {
+			replacePaths = append(replacePaths, formatPlanAttrPath(p))
+		}
+
+		diffs = append(diffs, resps.PlanResourceDiff{
+			Address:       r.Address,
+			ModuleAddress: r.ModuleAddress,
+			Type:          r.Type,
+			Name:          r.Name,
+			Index:         r.Index,
+			ProviderName:  r.ProviderName,
+			Action:        action,
+			ActionReason:  r.ActionReason,
+			ReplacePaths:  replacePaths,
+			Attrs:         buildPlanAttrDiffs(r.Change, action, sensitiveKeys[r.Address], replacePaths),
+		})
+	}
+	return diffs, nil
+}
+
+// formatPlanAttrPath 将 replace_paths 中的路径转换为 "a.b[0]" 格式
+func formatPlanAttrPath(path []interface{}) string {
+	sb := strings.Builder{}
+	for _, p := range path {
+		switch v := p.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteString(".")
+			}
+			sb.WriteString(v)
+		default:
+			sb.WriteString(fmt.Sprintf("[%v]", v))
+		}
+	}
+	return sb.String()
+}
+
+func buildPlanAttrDiffs(change TfPlanResourceChange, action string, sensitiveKeys, replacePaths []string) []resps.PlanAttrDiff {
+	before, _ := change.Before.(map[string]interface{})
+	after, _ := change.After.(map[string]interface{})
+	unknown, _ := change.AfterUnknown.(map[string]interface{})
+
+	keys := make(map[string]struct{})
+	for k := range before {
+		keys[k] = struct{}{}
+	}
+	for k := range after {
+		keys[k] = struct{}{}
+	}
+	for k, v := range unknown {
+		if b, ok := v.(bool); ok && b {
+			keys[k] = struct{}{}
+		}
+	}
+
+	attrs := make([]resps.PlanAttrDiff, 0, len(keys))
+	for k := range keys {
+		isUnknown := false
+		if b, ok := unknown[k].(bool); ok && b {
+			isUnknown = true
+		}
+		// 更新类的动作只返回有变化的属性
+		if !isUnknown && (action == PlanActionUpdate || action == PlanActionReplace) &&
+			reflect.DeepEqual(before[k], after[k]) {
+			continue
+		}
+
+		// 先基于原始值计算变更，再对敏感值进行隐藏
+		attr := resps.PlanAttrDiff{
+			Name:      k,
+			Before:    maskPlanAttr(k, before[k], sensitiveKeys),
+			After:     maskPlanAttr(k, after[k], sensitiveKeys),
+			Sensitive: utils.StrInArray(k, sensitiveKeys...),
+			Unknown:   isUnknown,
+		}
+		if isUnknown {
+			attr.After = planUnknownValue
+		}
+		for _, p := range replacePaths {
+			if p == k || strings.HasPrefix(p, k+".") || strings.HasPrefix(p, k+"[") {
+				attr.ForceNew = true
+				break
+			}
+		}
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Name < attrs[j].Name
+	})
+	return attrs
+}
+
+// maskPlanAttr 隐藏属性中的敏感值，sensitiveKeys 中嵌套属性使用 "->" 分隔
+func maskPlanAttr(name string, value interface{}, sensitiveKeys []string) interface{} {
+	if value == nil {
+		return nil
+	}
+	for _, k := range sensitiveKeys {
+		if k == name {
+			return planSensitiveValue
+		}
+		if strings.HasPrefix(k, name+"->") {
+			return SensitiveAttrs(map[string]interface{}{name: value}, sensitiveKeys, "")[name]
+		}
+	}
+	return value
+}
+
+// GroupPlanDiffByModule 按模块统计资源变更数量
+func GroupPlanDiffByModule(diffs []resps.PlanResourceDiff) []resps.PlanDiffModule {
+	modules := make([]resps.PlanDiffModule, 0)
+	index := make(map[string]int)
+	for _, d := range diffs {
+		i, ok := index[d.ModuleAddress]
+		if !ok {
+			i = len(modules)
+			index[d.ModuleAddress] = i
+			modules = append(modules, resps.PlanDiffModule{Module: d.ModuleAddress})
+		}
+		switch d.Action {
+		case PlanActionCreate:
+			modules[i].Create += 1
+		case PlanActionUpdate:
+			modules[i].Update += 1
+		case PlanActionDelete:
+			modules[i].Delete += 1
+		case PlanActionReplace:
+			modules[i].Replace += 1
+		case PlanActionRead:
+			modules[i].Read += 1
+		}
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Module < modules[j].Module
+	})
+	return modules
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPlanJson = []byte(`{
+  "format_version": "1.0",
+  "resource_changes": [
+    {
+      "address": "alicloud_instance.web",
+      "mode": "managed", "type": "alicloud_instance", "name": "web",
+      "provider_name": "registry.terraform.io/aliyun/alicloud",
+      "change": {
+        "actions": ["delete", "create"],
+        "before": {"image_id": "img-1", "instance_name": "web", "password": "old", "tags": ["a"]},
+        "after": {"image_id": "img-2", "instance_name": "web", "password": "new", "tags": ["a"]},
+        "after_unknown": {"id": true},
+        "after_sensitive": {"password": true},
+        "replace_paths": [["image_id"]]
+      },
+      "action_reason": "replace_because_cannot_update"
+    },
+    {
+      "address": "module.db.alicloud_db_instance.db",
+      "module_address": "module.db",
+      "mode": "managed", "type": "alicloud_db_instance", "name": "db",
+      "change": {
+        "actions": ["update"],
+        "before": {"instance_type": "small", "engine": "MySQL"},
+        "after": {"instance_type": "large", "engine": "MySQL"},
+        "after_sensitive": {}
+      }
+    },
+    {
+      "address": "module.db.alicloud_vpc.vpc",
+      "module_address": "module.db",
+      "mode": "managed", "type": "alicloud_vpc", "name": "vpc",
+      "change": {"actions": ["no-op"], "before": {"cidr": "10.0.0.0/8"}, "after": {"cidr": "10.0.0.0/8"}}
+    },
+    {
+      "address": "module.db.alicloud_vswitch.sw",
+      "module_address": "module.db",
+      "mode": "managed", "type": "alicloud_vswitch", "name": "sw",
+      "change": {"actions": ["create"], "before": null, "after": {"cidr": "10.1.0.0/16"}, "after_unknown": {"id": true}}
+    }
+  ]
+}`)
+
+func TestBuildPlanDiff(t *testing.T) {
+	diffs, err := BuildPlanDiff(testPlanJson)
+	if !assert.NoError(t, err) || !assert.Len(t, diffs, 3) {
+		return
+	}
+
+	web := diffs[0]
+	assert.Equal(t, PlanActionReplace, web.Action)
+	assert.Equal(t, "replace_because_cannot_update", web.ActionReason)
+	assert.Equal(t, []string{"image_id"}, web.ReplacePaths)
+	if assert.Len(t, web.Attrs, 3) {
+		assert.Equal(t, "id", web.Attrs[0].Name)
+		assert.True(t, web.Attrs[0].Unknown)
+		assert.Equal(t, "image_id", web.Attrs[1].Name)
+		assert.True(t, web.Attrs[1].ForceNew)
+		assert.Equal(t, "password", web.Attrs[2].Name)
+		assert.True(t, web.Attrs[2].Sensitive)
+		assert.Equal(t, planSensitiveValue, web.Attrs[2].Before)
+		assert.Equal(t, planSensitiveValue, web.Attrs[2].After)
+	}
+
+	db := diffs[1]
+	assert.Equal(t, PlanActionUpdate, db.Action)
+	if assert.Len(t, db.Attrs, 1) {
+		assert.Equal(t, "instance_type", db.Attrs[0].Name)
+		assert.Equal(t, "small", db.Attrs[0].Before)
+		assert.Equal(t, "large", db.Attrs[0].After)
+	}
+
+	sw := diffs[2]
+	assert.Equal(t, PlanActionCreate, sw.Action)
+	assert.Len(t, sw.Attrs, 2)
+
+	modules := GroupPlanDiffByModule(diffs)
+	if assert.Len(t, modules, 2) {
+		assert.Equal(t, "", modules[0].Module)
+		assert.Equal(t, 1, modules[0].Replace)
+		assert.Equal(t, "module.db", modules[1].Module)
+		assert.Equal(t, 1, modules[1].Update)
+		assert.Equal(t, 1, modules[1].Create)
+	}
+}
+
+func TestFormatPlanAttrPath(t *testing.T) {
+	assert.Equal(t, "image_id", formatPlanAttrPath([]interface{}{"image_id"}))
+	assert.Equal(t, "network[0].cidr", formatPlanAttrPath([]interface{}{"network", float64(0), "cidr"}))
+}
+
+func TestBuildPlanDiffSensitiveBefore(t *testing.T) {
+	planJson := []byte(`{
+  "format_version": "1.0",
+  "resource_changes": [
+    {
+      "address": "alicloud_vpc.old",
+      "mode": "managed", "type": "alicloud_vpc", "name": "old",
+      "change": {"actions": ["delete"], "before": {"cidr": "10.0.0.0/8"}, "after": null, "after_sensitive": false}
+    },
+    {
+      "address": "alicloud_db_account.old",
+      "mode": "managed", "type": "alicloud_db_account", "name": "old",
+      "change": {
+        "actions": ["delete"],
+        "before": {"account_name": "admin", "account_password": "secret"},
+        "after": null,
+        "before_sensitive": {"account_password": true},
+        "after_sensitive": false
+      }
+    },
+    {
+      "address": "alicloud_instance.web",
+      "mode": "managed", "type": "alicloud_instance", "name": "web",
+      "change": {
+        "actions": ["update"],
+        "before": {"password": "old", "user_data": "init"},
+        "after": {"password": "new", "user_data": "init2"},
+        "before_sensitive": {"user_data": true},
+        "after_sensitive": {"password": true}
+      }
+    }
+  ]
+}`)
+
+	diffs, err := BuildPlanDiff(planJson)
+	if !assert.NoError(t, err) || !assert.Len(t, diffs, 3) {
+		return
+	}
+
+	vpc := diffs[0]
+	assert.Equal(t, PlanActionDelete, vpc.Action)
+	if assert.Len(t, vpc.Attrs, 1) {
+		assert.Equal(t, "10.0.0.0/8", vpc.Attrs[0].Before)
+	}
+
+	// 删除的资源自身属性为敏感值
+	account := diffs[1]
+	assert.Equal(t, PlanActionDelete, account.Action)
+	if assert.Len(t, account.Attrs, 2) {
+		assert.Equal(t, "account_name", account.Attrs[0].Name)
+		assert.Equal(t, "admin", account.Attrs[0].Before)
+		assert.Equal(t, "account_password", account.Attrs[1].Name)
+		assert.True(t, account.Attrs[1].Sensitive)
+		assert.Equal(t, planSensitiveValue, account.Attrs[1].Before)
+	}
+
+	// 排在删除资源之后的资源仍然隐藏敏感值
+	web := diffs[2]
+	if assert.Len(t, web.Attrs, 2) {
+		for _, attr := range web.Attrs {
+			assert.True(t, attr.Sensitive, attr.Name)
+			assert.Equal(t, planSensitiveValue, attr.Before, attr.Name)
+			assert.Equal(t, planSensitiveValue, attr.After, attr.Name)
+		}
+	}
+}
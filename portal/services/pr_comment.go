@@ -0,0 +1,244 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"os"
+
+	"github.com/acarl005/stripansi"
+)
+
+// prCommentMaxChanges PR 评论中最多展示的资源变更数量
+const prCommentMaxChanges = 50
+
+type PrCommentViolation struct {
+	Severity   string `json:"severity"`
+	PolicyName string `json:"policyName"`
+	Resource   string `json:"resource"`
+}
+
+// GetTaskDetailUrl 任务详情页面地址
+func GetTaskDetailUrl(task *models.Task) string {
+	//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
+	return fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s",
+		configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id)
+}
+
+// getTaskPolicyViolations 查询任务合规检测中不通过的策略
+func getTaskPolicyViolations(session *db.Session, taskId models.Id) ([]PrCommentViolation, error) {
+	violations := make([]PrCommentViolation, 0)
+	err := session.Model(&models.PolicyResult{}).
+		Joins("left join iac_policy as p on p.id = iac_policy_result.policy_id").
+		Where("iac_policy_result.task_id = ? AND iac_policy_result.status = ?", taskId, common.PolicyStatusViolated).
+		Select("iac_policy_result.severity, p.name as policy_name, iac_policy_result.resource_name as resource").
+		Order("iac_policy_result.id").
+		Find(&violations)
+	return violations, err
+}
+
+// BuildPrCommentAttrs 生成 PR 评论模板的参数
+func BuildPrCommentAttrs(env *models.Env, task *models.Task, taskStatus string,
+	planJson, logContent []byte, violations []PrCommentViolation) map[string]interface{} {
+	attrs := map[string]interface{}{
+		"Status":     taskStatus,
+		"Name":       env.Name,
+		"Addr":       GetTaskDetailUrl(task),
+		"Content":    stripansi.Strip(string(logContent)),
+		"Violations": violations,
+	}
+
+	if len(planJson) > 0 {
+		if diffs, err := BuildPlanDiff(planJson); err != nil {
+			logs.Get().Warnf("build plan diff of task %s: %v", task.Id, err)
+		} else {
+			added, changed, destroyed := 0, 0, 0
+			changes := make([]map[string]string, 0)
+			for _, d := range diffs {
+				switch d.Action {
+				case PlanActionCreate:
+					added += 1
+				case PlanActionUpdate:
+					changed += 1
+				case PlanActionDelete:
+					destroyed += 1
+				case PlanActionReplace:
+					added += 1
+					destroyed += 1
+				default:
+					continue
+				}
+				if len(changes) < prCommentMaxChanges {
+					changes = append(changes, map[string]string{"Action": d.Action, "Address": d.Address})
+				}
+			}
+			attrs["HasChanges"] = len(changes) > 0
+			attrs["Added"] = added
+			attrs["Changed"] = changed
+			attrs["Destroyed"] = destroyed
+			attrs["Changes"] = changes
+			if more := countPlanChanges(diffs) - len(changes); more > 0 {
+				attrs["MoreChanges"] = more
+			} else {
+				attrs["MoreChanges"] = 0
+			}
+		}
+	}
+
+	r := task.PlanResult
+	if r.ResAddedCost != nil || r.ResDestroyedCost != nil || r.ResUpdatedCost != nil {
+		var delta float32
+		for _, c := range []*float32{r.ResAddedCost, r.ResDestroyedCost, r.ResUpdatedCost} {
+			if c != nil {
+				delta += *c
+			}
+		}
+		attrs["HasCost"] = true
+		attrs["CostDelta"] = fmt.Sprintf("%+.2f", delta)
+	}
+	return attrs
+}
+
+// countPlanChanges 统计有变更的资源数量(不包含 read)
+func countPlanChanges(diffs []resps.PlanResourceDiff) int {
+	n := 0
+	for _, d := range diffs {
+		if d.Action != PlanActionRead {
+			n += 1
+		}
+	}
+	return n
+}
+
+// SendVcsComment 将 PR 触发的 plan 结果写入 PR 评论，同一环境在同一 PR 下只保留一条评论，重新 plan 时更新该评论
+func SendVcsComment(session *db.Session, task *models.Task, taskStatus string) {
+	logger := logs.Get().WithField("func", "SendVcsComment").WithField("taskId", task.Id)
+
+	vp, err := GetVcsPrByTaskId(session, task)
+	if err != nil {
+		if !e.IsRecordNotFound(err) {
+			logger.Errorf("vcs comment err, get vcs pr data err: %v", err)
+		}
+		return
+	}
+
+	env, er := GetEnvById(session, task.EnvId)
+	if er != nil {
+		logger.Errorf("vcs comment err, get env detail data err: %v", er)
+		return
+	}
+
+	repo, er := GetVcsRepoByTplId(session, task.TplId)
+	if er != nil {
+		logger.Errorf("vcs comment err, get vcs data err: %v", er)
+		return
+	}
+
+	var logContent []byte
+	if taskStep, er := GetTaskPlanStep(session, task.Id); er != nil {
+		logger.Errorf("vcs comment err, get task step data err: %v", er)
+		return
+	} else if logContent, err = logstorage.Get().Read(taskStep.LogPath); err != nil {
+		logger.Errorf("vcs comment err, get task plan log err: %v", err)
+		return
+	}
+
+	planJson, err := logstorage.Get().Read(task.PlanJsonPath())
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warnf("vcs comment, read plan json err: %v", err)
+	}
+	violations, err := getTaskPolicyViolations(session, task.Id)
+	if err != nil {
+		logger.Warnf("vcs comment, get policy violations err: %v", err)
+	}
+
+	content := utils.SprintTemplate(consts.PrCommentTpl,
+		BuildPrCommentAttrs(env, task, taskStatus, planJson, logContent, violations))
+	upsertPrComment(session, repo, vp, content, logger)
+}
+
+// upsertPrComment 更新环境在 PR 下已发布的评论，评论不存在时新建
+func upsertPrComment(session *db.Session, repo vcsrv.RepoIface, vp models.VcsPr, content string, logger logs.Logger) {
+	commentId, err := GetVcsPrCommentId(session, vp)
+	if err != nil {
+		logger.Errorf("vcs comment err, get pr comment err: %v", err)
+		return
+	}
+	if commentId != 0 {
+		if err = repo.UpdatePrComment(vp.PrId, commentId, content); err == nil {
+			_ = UpdateVcsPrCommentId(session, vp.Id, commentId)
+			return
+		}
+		// 评论可能己被删除，重新创建
+		logger.Warnf("vcs comment, update comment %d err: %v", commentId, err)
+	}
+
+	if commentId, err = repo.CreatePrComment(vp.PrId, content); err != nil {
+		logger.Errorf("vcs comment err, create comment err: %v", err)
+		return
+	}
+	if err = UpdateVcsPrCommentId(session, vp.Id, commentId); err != nil {
+		logger.Errorf("vcs comment err, save comment id err: %v", err)
+	}
+}
+
+// getCommitStatusState 将任务状态转换为 commit 状态
+func getCommitStatusState(taskStatus string) string {
+	switch taskStatus {
+	case models.TaskComplete:
+		return vcsrv.CommitStatusSuccess
+	case models.TaskFailed:
+		return vcsrv.CommitStatusFailure
+	case models.TaskPending, models.TaskRunning, models.TaskApproving:
+		return vcsrv.CommitStatusPending
+	default:
+		return vcsrv.CommitStatusError
+	}
+}
+
+// SendVcsCommitStatus 设置 PR 触发的 plan 任务对应 commit 的状态
+func SendVcsCommitStatus(session *db.Session, task *models.Task, taskStatus string) {
+	logger := logs.Get().WithField("func", "SendVcsCommitStatus").WithField("taskId", task.Id)
+	if task.CommitId == "" {
+		return
+	}
+
+	if _, err := GetVcsPrByTaskId(session, task); err != nil {
+		if !e.IsRecordNotFound(err) {
+			logger.Errorf("get vcs pr data err: %v", err)
+		}
+		return
+	}
+
+	env, er := GetEnvById(session, task.EnvId)
+	if er != nil {
+		logger.Errorf("get env err: %v", er)
+		return
+	}
+	repo, er := GetVcsRepoByTplId(session, task.TplId)
+	if er != nil {
+		logger.Errorf("get vcs repo err: %v", er)
+		return
+	}
+
+	status := vcsrv.CommitStatus{
+		State:       getCommitStatusState(taskStatus),
+		Context:     fmt.Sprintf("cloudiac/plan (%s)", env.Name),
+		Description: fmt.Sprintf("CloudIaC plan %s", taskStatus),
+		TargetUrl:   GetTaskDetailUrl(task),
+	}
+	if err := repo.SetCommitStatus(task.CommitId, status); err != nil {
+		logger.Errorf("set commit status err: %v", err)
+	}
+}
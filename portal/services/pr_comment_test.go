@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPrCommentAttrs(t *testing.T) {
+	configs.Set(&configs.Config{Portal: configs.PortalConfig{Address: "http://iac.example.com"}})
+
+	added, destroyed, updated := float32(10), float32(-2.5), float32(0)
+	env := &models.Env{Name: "dev"}
+	task := &models.Task{}
+	task.Id = "run-1"
+	task.OrgId = "org-1"
+	task.ProjectId = "p-1"
+	task.EnvId = "env-1"
+	task.PlanResult = models.TaskResult{ResAddedCost: &added, ResDestroyedCost: &destroyed, ResUpdatedCost: &updated}
+
+	violations := []PrCommentViolation{{Severity: "high", PolicyName: "no public ip", Resource: "alicloud_instance.web"}}
+	attrs := BuildPrCommentAttrs(env, task, models.TaskComplete, testPlanJson, []byte("\x1b[32mPlan\x1b[0m"), violations)
+
+	assert.Equal(t, "http://iac.example.com/org/org-1/project/p-1/m-project-env/detail/env-1/task/run-1", attrs["Addr"])
+	assert.Equal(t, "Plan", attrs["Content"])
+	assert.Equal(t, true, attrs["HasChanges"])
+	assert.Equal(t, 2, attrs["Added"])
+	assert.Equal(t, 1, attrs["Changed"])
+	assert.Equal(t, 1, attrs["Destroyed"])
+	assert.Equal(t, "+7.50", attrs["CostDelta"])
+
+	content := utils.SprintTemplate(consts.PrCommentTpl, attrs)
+	assert.True(t, strings.Contains(content, "| replace | `alicloud_instance.web` |"))
+	assert.True(t, strings.Contains(content, "| high | no public ip | `alicloud_instance.web` |"))
+	assert.True(t, strings.Contains(content, "**Monthly cost delta:** +7.50"))
+}
+
+func TestGetCommitStatusState(t *testing.T) {
+	assert.Equal(t, vcsrv.CommitStatusPending, getCommitStatusState(models.TaskPending))
+	assert.Equal(t, vcsrv.CommitStatusPending, getCommitStatusState(models.TaskRunning))
+	assert.Equal(t, vcsrv.CommitStatusSuccess, getCommitStatusState(models.TaskComplete))
+	assert.Equal(t, vcsrv.CommitStatusFailure, getCommitStatusState(models.TaskFailed))
+	assert.Equal(t, vcsrv.CommitStatusError, getCommitStatusState(models.TaskAborted))
+}
@@ -0,0 +1,451 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"archive/zip"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	providerHostnameRegex = regexp.MustCompile(`^[0-9a-z]([0-9a-z.-]*[0-9a-z])?(:[0-9]+)?$`)
+	providerTypeRegex     = regexp.MustCompile(`^[0-9a-z][0-9a-z-]{0,63}$`)
+	providerPlatformRegex = regexp.MustCompile(`^[0-9a-z]{1,32}$`)
+
+	// 从 registry 同步 provider 时使用的协议，测试时可以修改为 http
+	providerRegistryScheme = "https"
+)
+
+// CheckProviderMirrorPackage 检查 provider 地址、版本及平台，并将版本号规范化为 semver 格式
+func CheckProviderMirrorPackage(p *models.ProviderMirrorPackage) e.Error {
+	p.Hostname = strings.ToLower(p.Hostname)
+	if p.Hostname == "" {
+		p.Hostname = consts.ProviderDefaultHostname
+	}
+	if !providerHostnameRegex.MatchString(p.Hostname) ||
+		!registryModuleNameRegex.MatchString(p.Namespace) ||
+		!providerTypeRegex.MatchString(p.Type) {
+		return e.New(e.ProviderMirrorInvalid,
+			fmt.Errorf("invalid provider address '%s/%s/%s'", p.Hostname, p.Namespace, p.Type), http.StatusBadRequest)
+	}
+	if !providerPlatformRegex.MatchString(p.Os) || !providerPlatformRegex.MatchString(p.Arch) {
+		return e.New(e.ProviderMirrorInvalid, fmt.Errorf("invalid platform '%s_%s'", p.Os, p.Arch), http.StatusBadRequest)
+	}
+	v, err := ParseTemplateVersion(p.Version)
+	if err != nil {
+		return e.New(e.ProviderMirrorInvalid, err, http.StatusBadRequest)
+	}
+	p.Version = v.String()
+	p.Filename = ProviderPackageFilename(p.Type, p.Version, p.Os, p.Arch)
+	return nil
+}
+
+// ProviderPackageFilename 返回 provider 安装包的标准文件名
+func ProviderPackageFilename(typ, version, os, arch string) string {
+	return fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", typ, version, os, arch)
+}
+
+// ParseProviderPackageFilename 从标准的安装包文件名中解析 provider 类型、版本及平台
+func ParseProviderPackageFilename(filename string) (typ, version, os, arch string, ok bool) {
+	name := strings.TrimSuffix(filepath.Base(filename), ".zip")
+	if !strings.HasPrefix(name, "terraform-provider-") || !strings.HasSuffix(filename, ".zip") {
+		return "", "", "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(name, "terraform-provider-"), "_")
+	if len(parts) != 4 {
+		return "", "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], parts[3], true
+}
+
+// ParseProviderPlatform 解析 <os>_<arch> 格式的平台
+func ParseProviderPlatform(platform string) (os, arch string, ok bool) {
+	parts := strings.Split(platform, "_")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ProviderMirrorFilePath 返回安装包在 portal 本地的保存路径
+func ProviderMirrorFilePath(p *models.ProviderMirrorPackage) string {
+	dir := configs.Get().Portal.ProviderMirrorPath
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return filepath.Join(dir, p.Hostname, p.Namespace, p.Type, p.Filename)
+}
+
+// checkProviderZip 检查安装包是否为包含 provider 可执行文件的 zip 文件
+func checkProviderZip(path string, typ string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if strings.HasPrefix(f.Name, "terraform-provider-"+typ) {
+			return nil
+		}
+	}
+	return fmt.Errorf("provider executable 'terraform-provider-%s' not found in package", typ)
+}
+
+// SaveProviderMirrorFile 保存安装包并计算大小及 sha256，文件校验失败时不会覆盖已有文件
+func SaveProviderMirrorFile(p *models.ProviderMirrorPackage, r io.Reader) e.Error {
+	path := ProviderMirrorFilePath(p)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil { //nolint:gosec
+		return e.New(e.IOError, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), p.Filename+".*.tmp")
+	if err != nil {
+		return e.New(e.IOError, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	_ = tmp.Close()
+	if err != nil {
+		return e.New(e.IOError, err)
+	}
+	if err := checkProviderZip(tmp.Name(), p.Type); err != nil {
+		return e.New(e.ProviderMirrorInvalid, err, http.StatusBadRequest)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return e.New(e.IOError, err)
+	}
+
+	p.Size = size
+	p.Sha256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+func QueryProviderMirrorPackage(query *db.Session) *db.Session {
+	return query.Model(&models.ProviderMirrorPackage{})
+}
+
+func GetProviderMirrorPackageById(query *db.Session, id models.Id) (*models.ProviderMirrorPackage, e.Error) {
+	p := models.ProviderMirrorPackage{}
+	if err := QueryProviderMirrorPackage(query).Where("id = ?", id).First(&p); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ProviderMirrorNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+func queryProviderMirrorReady(query *db.Session, hostname, namespace, typ string) *db.Session {
+	return QueryProviderMirrorPackage(query).
+		Where("hostname = ? AND namespace = ? AND type = ?", hostname, namespace, typ).
+		Where("status = ?", models.ProviderMirrorStatusReady)
+}
+
+func CreateProviderMirrorPackage(tx *db.Session, p models.ProviderMirrorPackage) (*models.ProviderMirrorPackage, e.Error) {
+	if err := models.Create(tx, &p); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ProviderMirrorExists,
+				fmt.Errorf("provider '%s' %s %s", p.Provider(), p.Version, p.Platform()), http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+// DeleteProviderMirrorPackage 删除安装包记录及文件
+func DeleteProviderMirrorPackage(tx *db.Session, p *models.ProviderMirrorPackage) e.Error {
+	if _, err := tx.Where("id = ?", p.Id).Delete(&models.ProviderMirrorPackage{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete provider mirror package error: %v", err))
+	}
+	if err := os.Remove(ProviderMirrorFilePath(p)); err != nil && !os.IsNotExist(err) {
+		return e.New(e.IOError, err)
+	}
+	return nil
+}
+
+// GetProviderMirrorProviders 返回 mirror 中有可用安装包的 provider，格式为 <hostname>/<namespace>/<type>
+func GetProviderMirrorProviders(query *db.Session) ([]string, e.Error) {
+	pkgs := make([]models.ProviderMirrorPackage, 0)
+	if err := QueryProviderMirrorPackage(query).
+		Where("status = ?", models.ProviderMirrorStatusReady).
+		Group("hostname, namespace, type").
+		Select("hostname, namespace, type").
+		Order("hostname, namespace, type").
+		Find(&pkgs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	providers := make([]string, 0, len(pkgs))
+	for i := range pkgs {
+		providers = append(providers, pkgs[i].Provider())
+	}
+	return providers, nil
+}
+
+// GetTaskProviderMirror 生成任务使用的 provider mirror 配置，未配置 portal 地址或 mirror 中没有 provider 时返回 nil
+func GetTaskProviderMirror(query *db.Session, orgId, tplId, envId, taskId models.Id, expire time.Duration) *runner.TaskProviderMirror {
+	addr := configs.Get().Portal.Address
+	host := RegistryModuleHost()
+	if host == "" {
+		return nil
+	}
+	providers, err := GetProviderMirrorProviders(query)
+	if err != nil {
+		logs.Get().Errorf("get provider mirror providers error: %v", err)
+		return nil
+	}
+	if len(providers) == 0 {
+		return nil
+	}
+	token, er := GenerateRegistryToken(orgId, tplId, envId, taskId, expire)
+	if er != nil {
+		logs.Get().Errorf("generate registry token error: %v", er)
+		return nil
+	}
+	return &runner.TaskProviderMirror{
+		Host:      host,
+		Url:       utils.JoinURL(addr, consts.RegistryMirrorUri),
+		Token:     token,
+		Providers: providers,
+	}
+}
+
+// GetProviderMirrorVersions 按 network mirror 协议返回 provider 的可用版本
+func GetProviderMirrorVersions(query *db.Session, hostname, namespace, typ string) (*resps.ProviderMirrorVersions, e.Error) {
+	versions := make([]string, 0)
+	if err := queryProviderMirrorReady(query, hostname, namespace, typ).Pluck("DISTINCT version", &versions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(versions) == 0 {
+		return nil, e.New(e.ProviderMirrorNotExist,
+			fmt.Errorf("provider '%s/%s/%s'", hostname, namespace, typ), http.StatusNotFound)
+	}
+
+	result := resps.ProviderMirrorVersions{Versions: make(map[string]struct{}, len(versions))}
+	for _, v := range versions {
+		result.Versions[v] = struct{}{}
+	}
+	return &result, nil
+}
+
+// GetProviderMirrorArchives 按 network mirror 协议返回 provider 版本在各平台的安装包，下载地址为相对地址
+func GetProviderMirrorArchives(query *db.Session, hostname, namespace, typ, version string) (*resps.ProviderMirrorArchives, e.Error) {
+	pkgs := make([]models.ProviderMirrorPackage, 0)
+	if err := queryProviderMirrorReady(query, hostname, namespace, typ).
+		Where("version = ?", version).Find(&pkgs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(pkgs) == 0 {
+		return nil, e.New(e.ProviderMirrorNotExist,
+			fmt.Errorf("provider '%s/%s/%s' %s", hostname, namespace, typ, version), http.StatusNotFound)
+	}
+
+	result := resps.ProviderMirrorArchives{Archives: make(map[string]resps.ProviderMirrorArchive, len(pkgs))}
+	for i := range pkgs {
+		archive := resps.ProviderMirrorArchive{Url: pkgs[i].Filename}
+		if pkgs[i].Sha256 != "" {
+			archive.Hashes = []string{"zh:" + pkgs[i].Sha256}
+		}
+		result.Archives[pkgs[i].Platform()] = archive
+	}
+	return &result, nil
+}
+
+func GetProviderMirrorPackageByFilename(query *db.Session, hostname, namespace, typ, filename string) (*models.ProviderMirrorPackage, e.Error) {
+	p := models.ProviderMirrorPackage{}
+	if err := queryProviderMirrorReady(query, hostname, namespace, typ).Where("filename = ?", filename).First(&p); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ProviderMirrorNotExist, fmt.Errorf("package '%s'", filename), http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+// PrepareProviderMirrorSync 创建或重置待同步的安装包记录，已同步成功的平台不会重复同步
+func PrepareProviderMirrorSync(tx *db.Session, tpl models.ProviderMirrorPackage, platforms []string) ([]models.ProviderMirrorPackage, e.Error) {
+	pkgs := make([]models.ProviderMirrorPackage, 0, len(platforms))
+	for _, platform := range platforms {
+		p := tpl
+		var ok bool
+		if p.Os, p.Arch, ok = ParseProviderPlatform(platform); !ok {
+			return nil, e.New(e.ProviderMirrorInvalid, fmt.Errorf("invalid platform '%s'", platform), http.StatusBadRequest)
+		}
+		if err := CheckProviderMirrorPackage(&p); err != nil {
+			return nil, err
+		}
+
+		exist := models.ProviderMirrorPackage{}
+		err := QueryProviderMirrorPackage(tx).
+			Where("hostname = ? AND namespace = ? AND type = ?", p.Hostname, p.Namespace, p.Type).
+			Where("version = ? AND os = ? AND arch = ?", p.Version, p.Os, p.Arch).
+			First(&exist)
+		if err != nil && !e.IsRecordNotFound(err) {
+			return nil, e.New(e.DBError, err)
+		}
+
+		if err == nil {
+			// 已就绪或正在上传的安装包不需要同步
+			if exist.Status == models.ProviderMirrorStatusReady ||
+				(exist.Status == models.ProviderMirrorStatusSyncing && exist.Source == models.ProviderMirrorSourceUpload) {
+				continue
+			}
+			attrs := models.Attrs{
+				"status":     models.ProviderMirrorStatusSyncing,
+				"message":    "",
+				"source":     models.ProviderMirrorSourceSync,
+				"creator_id": p.CreatorId,
+			}
+			if _, err := models.UpdateAttr(tx.Where("id = ?", exist.Id), &models.ProviderMirrorPackage{}, attrs); err != nil {
+				return nil, e.New(e.DBError, err)
+			}
+			p.Id = exist.Id
+		} else {
+			p.Source = models.ProviderMirrorSourceSync
+			p.Status = models.ProviderMirrorStatusSyncing
+			created, er := CreateProviderMirrorPackage(tx, p)
+			if er != nil {
+				return nil, er
+			}
+			p = *created
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+type providerDownloadInfo struct {
+	Filename    string `json:"filename"`
+	DownloadUrl string `json:"download_url"`
+	Shasum      string `json:"shasum"`
+}
+
+// providerRegistryBaseUrl 通过 registry 服务发现获取 providers.v1 服务地址
+func providerRegistryBaseUrl(hostname string) (string, error) {
+	base := fmt.Sprintf("%s://%s/", providerRegistryScheme, hostname)
+	body, err := utils.HttpService(base+".well-known/terraform.json", http.MethodGet, nil, nil, 10, 30)
+	if err != nil {
+		return "", err
+	}
+	services := make(map[string]interface{})
+	if err := json.Unmarshal(body, &services); err != nil {
+		return "", fmt.Errorf("registry service discovery: %v", err)
+	}
+	path, ok := services["providers.v1"].(string)
+	if !ok || path == "" {
+		return "", fmt.Errorf("registry '%s' does not support providers.v1", hostname)
+	}
+	return resolveUrl(base, path)
+}
+
+func resolveUrl(base, ref string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return u.ResolveReference(r).String(), nil
+}
+
+func getProviderDownloadInfo(baseUrl string, p *models.ProviderMirrorPackage) (*providerDownloadInfo, error) {
+	reqUrl := utils.JoinURL(baseUrl, p.Namespace, p.Type, p.Version, "download", p.Os, p.Arch)
+	body, err := utils.HttpService(reqUrl, http.MethodGet, nil, nil, 10, 30)
+	if err != nil {
+		return nil, err
+	}
+	info := providerDownloadInfo{}
+	if err := json.Unmarshal(body, &info); err != nil || info.DownloadUrl == "" {
+		return nil, fmt.Errorf("provider %s %s %s not found in registry", p.Provider(), p.Version, p.Platform())
+	}
+	if info.DownloadUrl, err = resolveUrl(reqUrl, info.DownloadUrl); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// downloadProviderPackage 从 registry 下载安装包并校验 shasum
+func downloadProviderPackage(baseUrl string, p *models.ProviderMirrorPackage) e.Error {
+	info, err := getProviderDownloadInfo(baseUrl, p)
+	if err != nil {
+		return e.New(e.ProviderMirrorSyncFailed, err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(utils.HttpDownload(info.DownloadUrl, pw, 10, 3600))
+	}()
+	if er := SaveProviderMirrorFile(p, pr); er != nil {
+		_ = pr.CloseWithError(er)
+		return e.New(e.ProviderMirrorSyncFailed, er)
+	}
+	if info.Shasum != "" && !strings.EqualFold(info.Shasum, p.Sha256) {
+		_ = os.Remove(ProviderMirrorFilePath(p))
+		return e.New(e.ProviderMirrorSyncFailed, fmt.Errorf("shasum mismatch: expected %s, got %s", info.Shasum, p.Sha256))
+	}
+	return nil
+}
+
+// RunProviderMirrorSync 从 registry 下载安装包并更新同步状态，需要在后台执行
+func RunProviderMirrorSync(dbSess *db.Session, pkgs []models.ProviderMirrorPackage) {
+	logger := logs.Get().WithField("func", "RunProviderMirrorSync")
+
+	baseUrls := make(map[string]string)
+	for i := range pkgs {
+		p := &pkgs[i]
+		attrs := models.Attrs{}
+
+		baseUrl, ok := baseUrls[p.Hostname]
+		var er e.Error
+		if !ok {
+			var err error
+			if baseUrl, err = providerRegistryBaseUrl(p.Hostname); err != nil {
+				er = e.New(e.ProviderMirrorSyncFailed, err)
+			} else {
+				baseUrls[p.Hostname] = baseUrl
+			}
+		}
+		if er == nil {
+			er = downloadProviderPackage(baseUrl, p)
+		}
+
+		if er != nil {
+			logger.Warnf("sync provider %s %s %s: %v", p.Provider(), p.Version, p.Platform(), er)
+			attrs["status"] = models.ProviderMirrorStatusFailed
+			attrs["message"] = er.Error()
+		} else {
+			logger.Infof("provider %s %s %s synced", p.Provider(), p.Version, p.Platform())
+			attrs["status"] = models.ProviderMirrorStatusReady
+			attrs["message"] = ""
+			attrs["size"] = p.Size
+			attrs["sha256"] = p.Sha256
+		}
+		if _, err := models.UpdateAttr(dbSess.Where("id = ?", p.Id), &models.ProviderMirrorPackage{}, attrs); err != nil {
+			logger.Errorf("update provider mirror package %s: %v", p.Id, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckProviderMirrorPackage(t *testing.T) {
+	p := models.ProviderMirrorPackage{Namespace: "hashicorp", Type: "random", Version: "v3.1.0", Os: "linux", Arch: "amd64"}
+	assert.Nil(t, CheckProviderMirrorPackage(&p))
+	assert.Equal(t, "registry.terraform.io", p.Hostname)
+	assert.Equal(t, "3.1.0", p.Version)
+	assert.Equal(t, "terraform-provider-random_3.1.0_linux_amd64.zip", p.Filename)
+
+	p = models.ProviderMirrorPackage{Hostname: "Registry.Example.com:8443", Namespace: "idcos", Type: "ansible", Version: "1.0.0", Os: "darwin", Arch: "arm64"}
+	assert.Nil(t, CheckProviderMirrorPackage(&p))
+	assert.Equal(t, "registry.example.com:8443", p.Hostname)
+
+	assert.NotNil(t, CheckProviderMirrorPackage(&models.ProviderMirrorPackage{Namespace: "hashicorp", Type: "Random", Version: "1.0.0", Os: "linux", Arch: "amd64"}))
+	assert.NotNil(t, CheckProviderMirrorPackage(&models.ProviderMirrorPackage{Namespace: "hashicorp", Type: "random", Version: "latest", Os: "linux", Arch: "amd64"}))
+	assert.NotNil(t, CheckProviderMirrorPackage(&models.ProviderMirrorPackage{Namespace: "hashicorp", Type: "random", Version: "1.0.0", Os: "linux", Arch: ""}))
+}
+
+func TestParseProviderPackageFilename(t *testing.T) {
+	typ, version, goos, goarch, ok := ParseProviderPackageFilename("/tmp/terraform-provider-random_3.1.0_linux_amd64.zip")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"random", "3.1.0", "linux", "amd64"}, []string{typ, version, goos, goarch})
+
+	_, _, _, _, ok = ParseProviderPackageFilename("terraform-provider-random_3.1.0_linux_amd64.tar.gz")
+	assert.False(t, ok)
+	_, _, _, _, ok = ParseProviderPackageFilename("random_3.1.0_linux_amd64.zip")
+	assert.False(t, ok)
+	_, _, _, _, ok = ParseProviderPackageFilename("terraform-provider-random_3.1.0.zip")
+	assert.False(t, ok)
+
+	goos, goarch, ok = ParseProviderPlatform("windows_386")
+	assert.True(t, ok)
+	assert.Equal(t, "windows", goos)
+	assert.Equal(t, "386", goarch)
+	_, _, ok = ParseProviderPlatform("linux")
+	assert.False(t, ok)
+}
+
+func newProviderZip(t *testing.T, name string) []byte {
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	f, err := w.Create(name)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("provider"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestSaveProviderMirrorFile(t *testing.T) {
+	configs.Set(&configs.Config{Portal: configs.PortalConfig{ProviderMirrorPath: t.TempDir()}})
+
+	p := models.ProviderMirrorPackage{Namespace: "hashicorp", Type: "random", Version: "3.1.0", Os: "linux", Arch: "amd64"}
+	assert.Nil(t, CheckProviderMirrorPackage(&p))
+
+	content := newProviderZip(t, "terraform-provider-random_v3.1.0_x5")
+	assert.Nil(t, SaveProviderMirrorFile(&p, bytes.NewReader(content)))
+	assert.Equal(t, int64(len(content)), p.Size)
+	assert.Len(t, p.Sha256, 64)
+	saved, err := os.ReadFile(ProviderMirrorFilePath(&p))
+	assert.NoError(t, err)
+	assert.Equal(t, content, saved)
+
+	// 校验失败时不覆盖已有文件
+	sha := p.Sha256
+	assert.NotNil(t, SaveProviderMirrorFile(&p, strings.NewReader("not a zip")))
+	assert.NotNil(t, SaveProviderMirrorFile(&p, bytes.NewReader(newProviderZip(t, "README.md"))))
+	assert.Equal(t, sha, p.Sha256)
+	saved, err = os.ReadFile(ProviderMirrorFilePath(&p))
+	assert.NoError(t, err)
+	assert.Equal(t, content, saved)
+}
+
+func TestGetProviderDownloadInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/terraform.json":
+			_, _ = w.Write([]byte(`{"providers.v1":"/v1/providers/"}`))
+		case "/v1/providers/hashicorp/random/3.1.0/download/linux/amd64":
+			_, _ = w.Write([]byte(`{"download_url":"/files/random.zip","shasum":"abc"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	scheme := providerRegistryScheme
+	providerRegistryScheme = "http"
+	defer func() { providerRegistryScheme = scheme }()
+
+	hostname := strings.TrimPrefix(server.URL, "http://")
+	baseUrl, err := providerRegistryBaseUrl(hostname)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/v1/providers/", baseUrl)
+
+	p := models.ProviderMirrorPackage{Namespace: "hashicorp", Type: "random", Version: "3.1.0", Os: "linux", Arch: "amd64"}
+	info, err := getProviderDownloadInfo(baseUrl, &p)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/files/random.zip", info.DownloadUrl)
+	assert.Equal(t, "abc", info.Shasum)
+
+	p.Arch = "arm64"
+	_, err = getProviderDownloadInfo(baseUrl, &p)
+	assert.Error(t, err)
+}
+
+func TestGetTaskProviderMirrorWithoutAddress(t *testing.T) {
+	configs.Set(&configs.Config{})
+	assert.Nil(t, GetTaskProviderMirror(nil, "org-1", "tpl-1", "env-1", "run-1", time.Hour))
+}
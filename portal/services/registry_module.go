@@ -0,0 +1,420 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	registryModuleNameRegex     = regexp.MustCompile(`^[0-9A-Za-z](?:[0-9A-Za-z_-]{0,62}[0-9A-Za-z])?$`)
+	registryModuleProviderRegex = regexp.MustCompile(`^[0-9a-z]{1,64}$`)
+)
+
+// CheckRegistryModuleAddr 检查模块地址是否符合 registry 协议的要求
+func CheckRegistryModuleAddr(namespace, name, provider string) e.Error {
+	if !registryModuleNameRegex.MatchString(namespace) ||
+		!registryModuleNameRegex.MatchString(name) ||
+		!registryModuleProviderRegex.MatchString(provider) {
+		return e.New(e.RegistryModuleInvalid,
+			fmt.Errorf("invalid module address '%s/%s/%s'", namespace, name, provider), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// RegistryModuleHost 返回私有 registry 的 host，即 portal 的对外地址的 host 部分
+func RegistryModuleHost() string {
+	addr := configs.Get().Portal.Address
+	if addr == "" {
+		return ""
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// RegistryModuleSource 返回在 terraform 中引用模块使用的完整地址
+func RegistryModuleSource(m *models.RegistryModule) string {
+	if host := RegistryModuleHost(); host != "" {
+		return host + "/" + m.Source()
+	}
+	return m.Source()
+}
+
+func QueryRegistryModule(query *db.Session, orgId models.Id) *db.Session {
+	return query.Model(&models.RegistryModule{}).Where("org_id = ?", orgId)
+}
+
+func GetRegistryModuleById(query *db.Session, orgId, id models.Id) (*models.RegistryModule, e.Error) {
+	m := models.RegistryModule{}
+	if err := QueryRegistryModule(query, orgId).Where("id = ?", id).First(&m); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RegistryModuleNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &m, nil
+}
+
+func GetRegistryModuleBySource(query *db.Session, orgId models.Id, namespace, name, provider string) (*models.RegistryModule, e.Error) {
+	m := models.RegistryModule{}
+	if err := QueryRegistryModule(query, orgId).
+		Where("namespace = ? AND name = ? AND provider = ?", namespace, name, provider).
+		First(&m); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RegistryModuleNotExist,
+				fmt.Errorf("module '%s/%s/%s'", namespace, name, provider), http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &m, nil
+}
+
+func CreateRegistryModule(tx *db.Session, m models.RegistryModule) (*models.RegistryModule, e.Error) {
+	if er := CheckRegistryModuleAddr(m.Namespace, m.Name, m.Provider); er != nil {
+		return nil, er
+	}
+	if err := models.Create(tx, &m); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.RegistryModuleExists, fmt.Errorf("module '%s'", m.Source()), http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &m, nil
+}
+
+func UpdateRegistryModule(tx *db.Session, orgId, id models.Id, attrs models.Attrs) (*models.RegistryModule, e.Error) {
+	if _, err := models.UpdateAttr(tx.Where("org_id = ? AND id = ?", orgId, id), &models.RegistryModule{}, attrs); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update registry module error: %v", err))
+	}
+	return GetRegistryModuleById(tx, orgId, id)
+}
+
+// DeleteRegistryModule 删除模块及其版本和使用记录
+func DeleteRegistryModule(tx *db.Session, orgId, id models.Id) e.Error {
+	if n, err := tx.Where("org_id = ? AND id = ?", orgId, id).Delete(&models.RegistryModule{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete registry module error: %v", err))
+	} else if n == 0 {
+		return e.New(e.RegistryModuleNotExist, http.StatusNotFound)
+	}
+	if _, err := tx.Where("module_id = ?", id).Delete(&models.RegistryModuleUsage{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete registry module usage error: %v", err))
+	}
+	if _, err := tx.Where("module_id = ?", id).Delete(&models.RegistryModuleVersion{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete registry module version error: %v", err))
+	}
+	return nil
+}
+
+// SortRegistryModuleVersions 按版本号从高到低排序
+func SortRegistryModuleVersions(versions []models.RegistryModuleVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareSemver(versions[i].Version, versions[j].Version) > 0
+	})
+}
+
+// LatestRegistryModuleVersion 返回最新的正式版本，没有正式版本时返回最高的预发布版本
+func LatestRegistryModuleVersion(versions []models.RegistryModuleVersion) *models.RegistryModuleVersion {
+	vs := make([]string, 0, len(versions))
+	for _, v := range versions {
+		vs = append(vs, v.Version)
+	}
+	if i := latestSemverIndex(vs); i >= 0 {
+		return &versions[i]
+	}
+	return nil
+}
+
+// GetRegistryModuleVersions 查询模块的所有版本，按版本号从高到低排序
+func GetRegistryModuleVersions(query *db.Session, moduleId models.Id) ([]models.RegistryModuleVersion, e.Error) {
+	versions := make([]models.RegistryModuleVersion, 0)
+	if err := query.Model(&models.RegistryModuleVersion{}).Where("module_id = ?", moduleId).Find(&versions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	SortRegistryModuleVersions(versions)
+	return versions, nil
+}
+
+// GetRegistryModuleVersion 通过版本号查询模块版本，版本号可以带 "v" 前缀
+func GetRegistryModuleVersion(query *db.Session, moduleId models.Id, version string) (*models.RegistryModuleVersion, e.Error) {
+	if sv, err := ParseTemplateVersion(version); err == nil {
+		version = sv.String()
+	}
+	v := models.RegistryModuleVersion{}
+	if err := query.Model(&models.RegistryModuleVersion{}).
+		Where("module_id = ? AND version = ?", moduleId, version).First(&v); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RegistryModuleVersionNotExist, fmt.Errorf("version '%s'", version), http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &v, nil
+}
+
+// newTagRegistryModuleVersions 从仓库 tag 中找出 semver 格式且尚未发布的版本
+func newTagRegistryModuleVersions(tags []string, exists []models.RegistryModuleVersion) []models.RegistryModuleVersion {
+	existsVersions := make([]string, 0, len(exists))
+	for _, v := range exists {
+		existsVersions = append(existsVersions, v.Version)
+	}
+
+	versions := make([]models.RegistryModuleVersion, 0)
+	for _, t := range newSemverTags(tags, existsVersions) {
+		versions = append(versions, models.RegistryModuleVersion{
+			Version: t.Version,
+			Tag:     t.Tag,
+		})
+	}
+	return versions
+}
+
+// SyncRegistryModuleVersions 将代码仓库中 semver 格式的 tag 发布为模块版本，返回新增的版本
+func SyncRegistryModuleVersions(tx *db.Session, m *models.RegistryModule) ([]models.RegistryModuleVersion, e.Error) {
+	vcs, er := GetVcsById(tx, m.VcsId)
+	if er != nil {
+		return nil, er
+	}
+	repo, err := vcsrv.GetRepo(vcs, m.RepoId)
+	if err != nil {
+		return nil, e.AutoNew(err, e.VcsError)
+	}
+	tags, err := repo.ListTags()
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+
+	exists, er := GetRegistryModuleVersions(tx, m.Id)
+	if er != nil {
+		return nil, er
+	}
+	versions := newTagRegistryModuleVersions(tags, exists)
+	for i := range versions {
+		versions[i].OrgId = m.OrgId
+		versions[i].ModuleId = m.Id
+		if err := models.Create(tx, &versions[i]); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	SortRegistryModuleVersions(versions)
+	return versions, nil
+}
+
+// registryModuleArchiveSource 生成 go-getter 格式的模块下载地址，模块不在仓库根目录时指定子目录
+func registryModuleArchiveSource(archiveUrl, workdir string) string {
+	if workdir = strings.Trim(workdir, "/"); workdir != "" && workdir != "." {
+		return archiveUrl + "//" + workdir
+	}
+	return archiveUrl
+}
+
+// GetRegistryModuleDownloadSource 返回模块版本的下载地址，地址指向 portal 的模块打包下载接口，
+// 通过有效期较短的 token 认证，不包含访问代码仓库的凭证
+func GetRegistryModuleDownloadSource(m *models.RegistryModule, v *models.RegistryModuleVersion) (string, e.Error) {
+	token, err := GenerateRegistryArchiveToken(v, consts.RegistryArchiveExpire)
+	if err != nil {
+		return "", e.New(e.InternalError, err)
+	}
+	archiveUrl := utils.JoinURL(configs.Get().Portal.Address, consts.RegistryArchiveUri, token, "module.tar.gz")
+	return registryModuleArchiveSource(archiveUrl, m.Workdir), nil
+}
+
+// WriteRegistryModuleArchive checkout 模块版本对应的代码并以 tar.gz 格式写入 w
+func WriteRegistryModuleArchive(tx *db.Session, m *models.RegistryModule, v *models.RegistryModuleVersion, w io.Writer) e.Error {
+	repoAddr, commitId, er := GetTaskRepoAddrAndCommitId(tx, &models.Template{VcsId: m.VcsId, RepoId: m.RepoId}, v.Tag)
+	if er != nil {
+		return er
+	}
+
+	tmpDir, err := os.MkdirTemp("", "registry-module-*")
+	if err != nil {
+		return e.New(e.IOError, err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := GitCheckout(tmpDir, repoAddr, commitId); err != nil {
+		// 错误信息中可能包含仓库地址，不直接返回给客户端
+		logs.Get().Errorf("checkout registry module %s %s: %v", m.Source(), v.Version, err)
+		return e.New(e.VcsError, fmt.Errorf("checkout module '%s' version %s failed", m.Source(), v.Version))
+	}
+	if err := utils.TarGzDir(tmpDir, w, ".git"); err != nil {
+		return e.New(e.IOError, err)
+	}
+	return nil
+}
+
+// RecordRegistryModuleDownload 增加版本下载次数，请求来自任务时记录云模板对该版本的使用
+func RecordRegistryModuleDownload(tx *db.Session, v *models.RegistryModuleVersion, claims *RegistryClaims) e.Error {
+	if _, err := tx.Model(&models.RegistryModuleVersion{}).Where("id = ?", v.Id).
+		UpdateColumn("downloads", gorm.Expr("downloads + 1")); err != nil {
+		return e.New(e.DBError, err)
+	}
+	if claims == nil || claims.TplId == "" {
+		return nil
+	}
+
+	now := models.Time(time.Now())
+	attrs := models.Attrs{
+		"last_env_id":  claims.EnvId,
+		"last_task_id": claims.TaskId,
+		"last_used_at": &now,
+	}
+	query := tx.Where("module_id = ? AND version = ? AND tpl_id = ?", v.ModuleId, v.Version, claims.TplId)
+	if n, err := models.UpdateAttr(query, &models.RegistryModuleUsage{}, attrs); err != nil {
+		return e.New(e.DBError, err)
+	} else if n > 0 {
+		return nil
+	}
+
+	usage := models.RegistryModuleUsage{
+		OrgId:      v.OrgId,
+		ModuleId:   v.ModuleId,
+		Version:    v.Version,
+		TplId:      claims.TplId,
+		LastEnvId:  claims.EnvId,
+		LastTaskId: claims.TaskId,
+		LastUsedAt: &now,
+	}
+	if err := models.Create(tx, &usage); err != nil && !e.IsDuplicate(err) {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// QueryRegistryModuleUsage 查询模块被云模板使用的记录
+func QueryRegistryModuleUsage(query *db.Session, moduleId models.Id) *db.Session {
+	return query.Model(&models.RegistryModuleUsage{}).
+		Joins("LEFT JOIN iac_template ON iac_template.id = iac_registry_module_usage.tpl_id").
+		Where("iac_registry_module_usage.module_id = ?", moduleId).
+		LazySelectAppend("iac_registry_module_usage.*", "iac_template.name AS tpl_name")
+}
+
+// RegistryProtocolModule 生成 registry 协议中的模块信息
+func RegistryProtocolModule(m *models.RegistryModule, v *models.RegistryModuleVersion) resps.RegistryProtocolModule {
+	return resps.RegistryProtocolModule{
+		Id:          m.Source() + "/" + v.Version,
+		Owner:       m.Namespace,
+		Namespace:   m.Namespace,
+		Name:        m.Name,
+		Version:     v.Version,
+		Provider:    m.Provider,
+		Description: m.Description,
+		Source:      RegistryModuleSource(m),
+		PublishedAt: time.Time(v.CreatedAt).Format(time.RFC3339),
+		Downloads:   v.Downloads,
+	}
+}
+
+type RegistryClaims struct {
+	jwt.RegisteredClaims
+
+	OrgId  models.Id `json:"orgId"`
+	TplId  models.Id `json:"tplId"`
+	EnvId  models.Id `json:"envId"`
+	TaskId models.Id `json:"taskId"`
+}
+
+// GenerateRegistryToken 生成 runner 访问私有 registry 使用的 token
+func GenerateRegistryToken(orgId, tplId, envId, taskId models.Id, expire time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, RegistryClaims{
+		OrgId:  orgId,
+		TplId:  tplId,
+		EnvId:  envId,
+		TaskId: taskId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expire)),
+			Subject:   consts.JwtSubjectRegistry,
+		},
+	})
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+func VerifyRegistryToken(tokenStr string) (*RegistryClaims, e.Error) {
+	claims := RegistryClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, e.New(e.InvalidToken, err, http.StatusUnauthorized)
+	}
+	if !token.Valid || claims.Subject != consts.JwtSubjectRegistry {
+		return nil, e.New(e.InvalidToken, http.StatusUnauthorized)
+	}
+	return &claims, nil
+}
+
+type RegistryArchiveClaims struct {
+	jwt.RegisteredClaims
+
+	OrgId    models.Id `json:"orgId"`
+	ModuleId models.Id `json:"moduleId"`
+	Version  string    `json:"version"`
+}
+
+// GenerateRegistryArchiveToken 生成模块版本下载链接中使用的 token
+func GenerateRegistryArchiveToken(v *models.RegistryModuleVersion, expire time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, RegistryArchiveClaims{
+		OrgId:    v.OrgId,
+		ModuleId: v.ModuleId,
+		Version:  v.Version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expire)),
+			Subject:   consts.JwtSubjectRegistryArchive,
+		},
+	})
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+func VerifyRegistryArchiveToken(tokenStr string) (*RegistryArchiveClaims, e.Error) {
+	claims := RegistryArchiveClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, e.New(e.InvalidToken, err, http.StatusUnauthorized)
+	}
+	if !token.Valid || claims.Subject != consts.JwtSubjectRegistryArchive {
+		return nil, e.New(e.InvalidToken, http.StatusUnauthorized)
+	}
+	return &claims, nil
+}
+
+// GetTaskModuleRegistry 生成任务访问私有 registry 的配置，未配置 portal 地址时返回 nil
+func GetTaskModuleRegistry(orgId, tplId, envId, taskId models.Id, expire time.Duration) *runner.TaskModuleRegistry {
+	host := RegistryModuleHost()
+	if host == "" {
+		return nil
+	}
+	token, err := GenerateRegistryToken(orgId, tplId, envId, taskId, expire)
+	if err != nil {
+		logs.Get().Errorf("generate registry token error: %v", err)
+		return nil
+	}
+	return &runner.TaskModuleRegistry{
+		Host:       host,
+		ModulesUrl: utils.JoinURL(configs.Get().Portal.Address, consts.RegistryModulesUri),
+		Token:      token,
+	}
+}
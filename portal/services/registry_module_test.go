@@ -0,0 +1,110 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRegistryModuleAddr(t *testing.T) {
+	assert.Nil(t, CheckRegistryModuleAddr("idcos", "vpc-network", "alicloud"))
+	assert.Nil(t, CheckRegistryModuleAddr("a", "my_module", "aws"))
+	assert.NotNil(t, CheckRegistryModuleAddr("-idcos", "vpc", "alicloud"))
+	assert.NotNil(t, CheckRegistryModuleAddr("idcos", "vpc/x", "alicloud"))
+	assert.NotNil(t, CheckRegistryModuleAddr("idcos", "vpc", "AliCloud"))
+	assert.NotNil(t, CheckRegistryModuleAddr("idcos", "vpc", ""))
+}
+
+func TestRegistryModuleVersions(t *testing.T) {
+	exists := []models.RegistryModuleVersion{{Version: "1.0.0", Tag: "v1.0.0"}}
+	versions := newTagRegistryModuleVersions([]string{"v1.0.0", "v1.2.0", "release", "1.2.0", "v2.0.0-rc1"}, exists)
+	assert.Equal(t, []models.RegistryModuleVersion{
+		{Version: "1.2.0", Tag: "v1.2.0"},
+		{Version: "2.0.0-rc1", Tag: "v2.0.0-rc1"},
+	}, versions)
+
+	versions = append(versions, exists...)
+	SortRegistryModuleVersions(versions)
+	assert.Equal(t, "2.0.0-rc1", versions[0].Version)
+	assert.Equal(t, "1.0.0", versions[2].Version)
+	assert.Equal(t, "1.2.0", LatestRegistryModuleVersion(versions).Version)
+	assert.Nil(t, LatestRegistryModuleVersion(nil))
+}
+
+func TestRegistryModuleDownloadSource(t *testing.T) {
+	configs.Set(&configs.Config{JwtSecretKey: "secret", Portal: configs.PortalConfig{Address: "https://iac.example.com"}})
+
+	m := models.RegistryModule{Workdir: "/modules/vpc/"}
+	v := models.RegistryModuleVersion{OrgId: "org-1", ModuleId: "rm-1", Version: "1.0.0"}
+	source, er := GetRegistryModuleDownloadSource(&m, &v)
+	assert.Nil(t, er)
+	assert.True(t, strings.HasPrefix(source, "https://iac.example.com/v1/module_archives/"))
+	assert.True(t, strings.HasSuffix(source, "/module.tar.gz//modules/vpc"))
+
+	token := strings.TrimSuffix(strings.TrimPrefix(source, "https://iac.example.com/v1/module_archives/"), "/module.tar.gz//modules/vpc")
+	claims, er := VerifyRegistryArchiveToken(token)
+	assert.Nil(t, er)
+	assert.Equal(t, models.Id("org-1"), claims.OrgId)
+	assert.Equal(t, models.Id("rm-1"), claims.ModuleId)
+	assert.Equal(t, "1.0.0", claims.Version)
+
+	// 任务的 registry token 不能用于下载
+	runnerToken, err := GenerateRegistryToken("org-1", "tpl-1", "env-1", "run-1", time.Hour)
+	assert.NoError(t, err)
+	_, er = VerifyRegistryArchiveToken(runnerToken)
+	assert.NotNil(t, er)
+
+	m.Workdir = "./"
+	source, er = GetRegistryModuleDownloadSource(&m, &v)
+	assert.Nil(t, er)
+	assert.True(t, strings.HasSuffix(source, "/module.tar.gz"))
+}
+
+func TestRegistryToken(t *testing.T) {
+	configs.Set(&configs.Config{JwtSecretKey: "secret"})
+
+	token, err := GenerateRegistryToken("org-1", "tpl-1", "env-1", "run-1", time.Hour)
+	assert.NoError(t, err)
+	claims, er := VerifyRegistryToken(token)
+	assert.Nil(t, er)
+	assert.Equal(t, models.Id("org-1"), claims.OrgId)
+	assert.Equal(t, models.Id("tpl-1"), claims.TplId)
+	assert.Equal(t, models.Id("run-1"), claims.TaskId)
+
+	token, err = GenerateRegistryToken("org-1", "", "", "", -time.Minute)
+	assert.NoError(t, err)
+	_, er = VerifyRegistryToken(token)
+	assert.NotNil(t, er)
+
+	// 其他用途的 token 不能用于访问 registry
+	destroyAt := models.Time(time.Now().Add(time.Hour))
+	token, err = GenerateEnvExtendToken(&models.Env{AutoDestroyAt: &destroyAt}, "1d")
+	assert.NoError(t, err)
+	_, er = VerifyRegistryToken(token)
+	assert.NotNil(t, er)
+}
+
+func TestGetTaskModuleRegistry(t *testing.T) {
+	configs.Set(&configs.Config{JwtSecretKey: "secret"})
+	assert.Nil(t, GetTaskModuleRegistry("org-1", "tpl-1", "env-1", "run-1", time.Hour))
+
+	configs.Set(&configs.Config{
+		JwtSecretKey: "secret",
+		Portal:       configs.PortalConfig{Address: "https://iac.example.com/"},
+	})
+	r := GetTaskModuleRegistry("org-1", "tpl-1", "env-1", "run-1", time.Hour)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "iac.example.com", r.Host)
+		assert.Equal(t, "https://iac.example.com/v1/modules/", r.ModulesUrl)
+		_, er := VerifyRegistryToken(r.Token)
+		assert.Nil(t, er)
+	}
+	assert.Equal(t, "iac.example.com/idcos/vpc/alicloud",
+		RegistryModuleSource(&models.RegistryModule{Namespace: "idcos", Name: "vpc", Provider: "alicloud"}))
+}
@@ -55,14 +55,6 @@ func findSensitiveNames(resourceChanges gjson.Result) map[string][]string {
 	mSensitiveNames := make(map[string][]string)
 
 	for _, resource := range resourceChanges.Array() {
-		sensitiveInfo := resource.Get("change.after_sensitive")
-		if !sensitiveInfo.Exists() {
-			return mSensitiveNames
-		}
-		if !sensitiveInfo.IsObject() {
-			return mSensitiveNames
-		}
-
 		addr := resource.Get("address").String()
 		sNames := findSensitiveNamesInResource(resource)
 		if len(sNames) > 0 {
@@ -72,9 +64,22 @@ func findSensitiveNames(resourceChanges gjson.Result) map[string][]string {
 	return mSensitiveNames
 }
 
+// findSensitiveNamesInResource 查找资源变更前后的敏感属性，
+// 属性只在变更前的状态中是敏感值时(如删除资源)也需要隐藏
 func findSensitiveNamesInResource(resource gjson.Result) []string {
 	sNames := make([]string, 0)
-	sensitiveInfo := resource.Get("change.after_sensitive")
+	for _, path := range []string{"change.before_sensitive", "change.after_sensitive"} {
+		for _, name := range findSensitiveNamesInObject(resource.Get(path)) {
+			if !utils.InArrayStr(sNames, name) {
+				sNames = append(sNames, name)
+			}
+		}
+	}
+	return sNames
+}
+
+func findSensitiveNamesInObject(sensitiveInfo gjson.Result) []string {
+	sNames := make([]string, 0)
 	if !sensitiveInfo.Exists() {
 		return sNames
 	}
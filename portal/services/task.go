@@ -4,7 +4,6 @@ package services
 
 import (
 	"cloudiac/common"
-	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
@@ -17,6 +16,8 @@ import (
 	"cloudiac/utils"
 	"cloudiac/utils/kafka"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
+	"cloudiac/utils/tracing"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -27,7 +28,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/acarl005/stripansi"
 	"github.com/alessio/shellescape"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -127,7 +127,8 @@ func CloneNewDriftTask(tx *db.Session, src models.Task, env *models.Env) (*model
 		cronTaskType string
 		taskSource   string
 	)
-	if env.AutoRepairDrift {
+	// 纠偏需要审批时先执行 plan 检测漂移，发现漂移后再创建待审批的纠偏任务
+	if env.AutoRepairDrift && !env.DriftRepairApproval() {
 		cronTaskType = models.TaskTypeApply
 		taskSource = consts.TaskSourceDriftApply
 	} else {
@@ -157,6 +158,8 @@ func CloneNewDriftTask(tx *db.Session, src models.Task, env *models.Env) (*model
 	// newCommonTask方法完成了对keyId赋值，这里不需要在进行一次赋值了
 	//task.KeyId = env.KeyId
 	task.Source = taskSource
+	// 不继承源任务的冻结期强制执行设置
+	task.FreezeOverrideReason = ""
 
 	// 自动纠偏任务总是使用环境的最新部署通道配置
 	task.RunnerId, er = GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
@@ -167,6 +170,193 @@ func CloneNewDriftTask(tx *db.Session, src models.Task, env *models.Env) (*model
 	return doCreateTask(tx, *task, tpl, env)
 }
 
+// CloneRerunTask 使用源任务记录的变量、commit、targets、terraform 版本、pipeline 和部署通道重新创建任务。
+// resumeStep 大于 0 时新任务从该步骤开始执行，之前的步骤直接标记为完成，执行时复用源任务的工作目录；
+// 审批结果不会沿用，之前有需要审批的步骤时从该步骤前的 plan 步骤开始重新执行
+func CloneRerunTask(tx *db.Session, src models.Task, env *models.Env, creatorId models.Id,
+	resumeStep int, freezeOverrideReason string) (*models.Task, e.Error) {
+	tpl, err := GetTemplateById(tx, src.TplId)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+
+	// 获取最新 repoAddr(带 token)，确保 vcs 更新后任务还可以正常 checkout 代码
+	repoAddr, _, err := GetTaskRepoAddrAndCommitId(tx, tpl, src.Revision)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+
+	task, er := newCommonTask(tpl, env, src)
+	if er != nil {
+		return nil, er
+	}
+
+	task.Name = src.Name
+	task.RepoAddr = repoAddr
+	task.CommitId = src.CommitId
+	task.TfVersion = src.TfVersion
+	task.Workdir = src.Workdir
+	task.Playbook = src.Playbook
+	task.TfVarsFile = src.TfVarsFile
+	task.PlayVarsFile = src.PlayVarsFile
+	task.StepTimeout = src.StepTimeout
+	task.CreatorId = creatorId
+	task.Source = consts.TaskSourceManual
+	task.SourceSys = ""
+	task.FreezeOverrideReason = freezeOverrideReason
+	task.SourceTaskId = src.Id
+
+	if resumeStep > 0 {
+		// 恢复执行需要使用源任务的工作目录，只能在同一个 runner 上执行
+		task.RunnerId = src.RunnerId
+		task.ResumeStep = resumeStep
+		task.CurrStep = resumeStep
+	} else if len(src.RunnerTags) > 0 {
+		// 源任务的 runner 可能已不可用，按源任务的 tags 重新选择
+		task.RunnerId, er = GetAvailableRunnerId("", src.RunnerTags)
+		if er != nil {
+			return nil, er
+		}
+	} else {
+		task.RunnerId = src.RunnerId
+	}
+
+	created, er := doCreateTask(tx, *task, tpl, env)
+	if er != nil {
+		return nil, er
+	}
+
+	// PR 触发的 plan 任务重新执行时同样将结果更新到 PR
+	if vp, err := GetVcsPrByTaskId(tx, &src); err == nil {
+		if er := CreateVcsPr(tx, models.VcsPr{
+			PrId:   vp.PrId,
+			TaskId: created.Id,
+			EnvId:  created.EnvId,
+			VcsId:  vp.VcsId,
+		}); er != nil {
+			return nil, er
+		}
+	} else if !e.IsRecordNotFound(err) {
+		return nil, e.New(e.DBError, err)
+	}
+
+	if resumeStep > 0 {
+		steps, err := GetTaskSteps(tx, created.Id)
+		if err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		if rs := resolveTaskResumeStep(steps, resumeStep); rs != resumeStep {
+			resumeStep = rs
+			created.ResumeStep = rs
+			created.CurrStep = rs
+			if _, err := tx.Model(&models.Task{}).Where("id = ?", created.Id).
+				UpdateAttrs(models.Attrs{"resume_step": rs, "curr_step": rs}); err != nil {
+				return nil, e.New(e.DBError, err)
+			}
+		}
+	}
+	if resumeStep > 0 {
+		if _, err := tx.Model(&models.TaskStep{}).
+			Where("task_id = ? AND `index` < ?", created.Id, resumeStep).
+			UpdateAttrs(models.Attrs{
+				"status":  models.TaskStepComplete,
+				"message": fmt.Sprintf("resumed from task %s", src.Id),
+			}); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	return created, nil
+}
+
+// resolveTaskResumeStep 返回任务实际恢复执行的步骤。
+// 需要审批的步骤不能直接标记为完成，resumeStep 之前有需要审批的步骤时，
+// 从该步骤之前最近的 plan 步骤(没有则从审批步骤)开始执行，重新生成执行计划并重新审批
+func resolveTaskResumeStep(steps []*models.TaskStep, resumeStep int) int {
+	for i, step := range steps {
+		if step.Index >= resumeStep {
+			break
+		}
+		if !step.MustApproval {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].Type == models.TaskStepPlan {
+				return steps[j].Index
+			}
+		}
+		return step.Index
+	}
+	return resumeStep
+}
+
+// CheckRollbackTask 检查源任务是否可以做为回滚目标，只能回滚到环境执行成功的部署任务
+func CheckRollbackTask(src *models.Task, env *models.Env) e.Error {
+	if src.EnvId != env.Id {
+		return e.New(e.TaskCannotRollback, fmt.Errorf("task %s not belong to env %s", src.Id, env.Id), http.StatusBadRequest)
+	}
+	if src.Type != models.TaskTypeApply || src.Status != models.TaskComplete {
+		return e.New(e.TaskCannotRollback,
+			fmt.Errorf("task type is '%s', status is '%s'", src.Type, src.Status), http.StatusBadRequest)
+	}
+	if src.RefreshOnly {
+		return e.New(e.TaskCannotRollback, fmt.Errorf("task is refresh-only"), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// CloneRollbackTask 使用历史部署任务的 commit、变量、terraform 版本、tfvars/playbook 配置及 targets 创建部署任务，
+// 回滚任务总是需要审批，以便在执行前确认 plan 与当前状态的差异
+func CloneRollbackTask(tx *db.Session, src models.Task, env *models.Env, creatorId models.Id,
+	freezeOverrideReason string) (*models.Task, e.Error) {
+	tpl, err := GetTemplateById(tx, src.TplId)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+
+	// 获取最新 repoAddr(带 token)，确保 vcs 更新后任务还可以正常 checkout 代码
+	repoAddr, _, err := GetTaskRepoAddrAndCommitId(tx, tpl, src.Revision)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+
+	task, er := newCommonTask(tpl, env, src)
+	if er != nil {
+		return nil, er
+	}
+
+	task.Name = fmt.Sprintf("%s (rollback to %s)", task.GetTaskNameByType(models.TaskTypeApply), src.Id)
+	task.RepoAddr = repoAddr
+	task.CommitId = src.CommitId
+	task.TfVersion = src.TfVersion
+	task.Workdir = src.Workdir
+	task.Playbook = src.Playbook
+	task.TfVarsFile = src.TfVarsFile
+	task.PlayVarsFile = src.PlayVarsFile
+	task.Replaces = nil
+	task.CreatorId = creatorId
+	task.AutoApprove = false
+	task.StopOnViolation = env.StopOnViolation
+	task.IsDriftTask = false
+	task.Source = consts.TaskSourceManual
+	task.SourceSys = ""
+	task.Callback = ""
+	task.FreezeOverrideReason = freezeOverrideReason
+	task.RollbackTaskId = src.Id
+	// 回滚不改变环境锁定的云模板版本
+	task.TplVersion = ""
+
+	// 回滚任务使用环境当前的部署通道
+	task.RunnerTags = nil
+	if env.RunnerTags != "" {
+		task.RunnerTags = strings.Split(env.RunnerTags, ",")
+	}
+	task.RunnerId, er = GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+	if er != nil {
+		return nil, er
+	}
+	return doCreateTask(tx, *task, tpl, env)
+}
+
 func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models.Task) (*models.Task, e.Error) {
 	// logger := logs.Get().WithField("func", "CreateTask")
 	// logger = logger.WithField("taskId", task.Id)
@@ -201,6 +391,11 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 		// 以下为需要外部传入的属性
 		Name:            pt.Name,
 		Targets:         pt.Targets,
+		Imports:         pt.Imports,
+		ImportMode:      pt.ImportMode,
+		StateOps:        pt.StateOps,
+		Replaces:        pt.Replaces,
+		RefreshOnly:     pt.RefreshOnly,
 		CreatorId:       pt.CreatorId,
 		Variables:       pt.Variables,
 		AutoApprove:     pt.AutoApprove,
@@ -243,17 +438,45 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 		Source:      pt.Source,
 		SourceSys:   pt.SourceSys,
 		IsDriftTask: pt.IsDriftTask,
+
+		FreezeOverrideReason: pt.FreezeOverrideReason,
+		RunnerTags:           pt.RunnerTags,
+		TplVersion:           pt.TplVersion,
+	}
+	if len(task.RunnerTags) == 0 && env.RunnerTags != "" {
+		task.RunnerTags = strings.Split(env.RunnerTags, ",")
 	}
 	task.Id = models.Task{}.NewId()
 	return &task, nil
 }
 
-func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *models.Env) (*models.Task, e.Error) {
+func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *models.Env) (_ *models.Task, er e.Error) {
+	_, span := tracing.Start(tx.Context(), "services.createTask",
+		tracing.AttrOrgId.String(task.OrgId.String()),
+		tracing.AttrProjectId.String(task.ProjectId.String()),
+		tracing.AttrEnvId.String(task.EnvId.String()),
+		tracing.AttrTaskId.String(task.Id.String()),
+		tracing.AttrTaskType.String(task.Type),
+	)
+	defer func() { tracing.End(span, er) }()
+
 	// pipeline 内容可以从外部传入，如果没有传则尝试读取云模板目录下的文件
 	var err error
 	if er := createTaskParamCheck(task); er != nil {
 		return nil, er
 	}
+	if er := checkTaskDeployFreeze(tx, &task); er != nil {
+		return nil, er
+	}
+	if !task.AutoApprove && task.IsEffectTask() {
+		policy, er := GetEnvApprovalPolicy(tx, task.ProjectId, task.EnvId)
+		if er != nil {
+			return nil, er
+		}
+		if policy != nil {
+			task.ApprovalPolicyId = policy.Id
+		}
+	}
 
 	if task.Pipeline == "" {
 		task.Pipeline, err = GetTplPipeline(tx, tpl.Id, task.Revision, task.Workdir)
@@ -262,6 +485,11 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 		}
 	}
 
+	// 执行 terraform 前检查变量值是否符合任务 commit 中 tf 文件定义的类型及校验规则
+	if er := CheckTaskTfVariables(tx, tpl, task.CommitId, task.Workdir, task.Variables); er != nil {
+		return nil, er
+	}
+
 	pipeline, err := DecodePipeline(task.Pipeline)
 	if err != nil {
 		return nil, e.New(e.InvalidPipeline, err)
@@ -562,6 +790,10 @@ func ChangeTaskStatus(dbSess *db.Session, task *models.Task, status, message str
 		return e.AutoNew(err, e.DBError)
 	}
 
+	if preStatus != status {
+		metrics.TaskStatusChanges.WithLabelValues(task.Type, task.Status).Inc()
+	}
+
 	if preStatus != status && !task.IsDriftTask &&
 		// 忽略任务类型由 审批中 变更为 running 状态时的消息通知
 		// running 状态变更为审批中时已经进行过通知了，这里就不需要在重复通知了
@@ -612,6 +844,7 @@ func taskStatusExitedCall(dbSess *db.Session, task *models.Task, status string)
 
 	// 如果勾选提交pr自动plan，任务结束时 plan作业结果写入PR评论中
 	if task.Type == common.TaskTypePlan {
+		SendVcsCommitStatus(dbSess, task, status)
 		SendVcsComment(dbSess, task, status)
 	}
 }
@@ -758,6 +991,15 @@ type TfPlan struct {
 	FormatVersion string `json:"format_version"`
 
 	ResourceChanges []TfPlanResource `json:"resource_changes"`
+	ResourceDrift   []TfPlanResource `json:"resource_drift"` // 资源在 terraform 之外发生的变更
+}
+
+// GetResourceChanges 返回任务会应用的资源变更，refresh-only 任务只会将 resource_drift 同步到 state
+func (p *TfPlan) GetResourceChanges(refreshOnly bool) []TfPlanResource {
+	if refreshOnly {
+		return p.ResourceDrift
+	}
+	return p.ResourceChanges
 }
 
 type TfPlanResource struct {
@@ -770,14 +1012,17 @@ type TfPlanResource struct {
 	Name  string      `json:"name"`
 	Index interface{} `json:"index"`
 
-	Change TfPlanResourceChange `json:"change"`
+	Change       TfPlanResourceChange `json:"change"`
+	ActionReason string               `json:"action_reason,omitempty"` // 执行该动作的原因，如 replace_because_tainted
 }
 
 // TfPlanResourceChange doc: https://www.terraform.io/docs/internals/json-format.html#change-representation
 type TfPlanResourceChange struct {
-	Actions []string    `json:"actions"` // no-op, create, read, update, delete
-	Before  interface{} `json:"before"`
-	After   interface{} `json:"after"`
+	Actions      []string        `json:"actions"` // no-op, create, read, update, delete
+	Before       interface{}     `json:"before"`
+	After        interface{}     `json:"after"`
+	AfterUnknown interface{}     `json:"after_unknown,omitempty"`
+	ReplacePaths [][]interface{} `json:"replace_paths,omitempty"` // 导致资源重建的属性路径
 }
 
 func UnmarshalPlanJson(bs []byte) (*TfPlan, error) {
@@ -1097,6 +1342,7 @@ func ChangeScanTaskStatus(dbSess *db.Session, task *models.ScanTask, status, pol
 	if task.Status == status && task.PolicyStatus == policyStatus && message == "" {
 		return nil
 	}
+	preStatus := task.Status
 
 	updateAttrs := models.Attrs{
 		"message": message,
@@ -1126,6 +1372,9 @@ func ChangeScanTaskStatus(dbSess *db.Session, task *models.ScanTask, status, pol
 	if _, err := dbSess.Model(task).Where("id = ?", task.Id).UpdateAttrs(updateAttrs); err != nil {
 		return e.AutoNew(err, e.DBError)
 	}
+	if preStatus != task.Status {
+		metrics.TaskStatusChanges.WithLabelValues(task.Type, task.Status).Inc()
+	}
 
 	return nil
 }
@@ -1512,9 +1761,10 @@ func SendHttpMessage(callbackUrl string, session *db.Session, task *models.Task,
 
 type Resource struct {
 	models.Resource
-	DriftDetail string       `json:"driftDetail"`
-	DriftAt     *models.Time `json:"driftAt"`
-	IsDrift     bool         `json:"isDrift" form:"isDrift" `
+	DriftDetail string            `json:"driftDetail"`
+	DriftAttrs  models.DriftAttrs `json:"driftAttrs"` // 结构化的属性漂移信息
+	DriftAt     *models.Time      `json:"driftAt"`
+	IsDrift     bool              `json:"isDrift" form:"isDrift" `
 }
 
 func GetTaskResourceToTaskId(dbSess *db.Session, task *models.Task) ([]Resource, e.Error) {
@@ -1525,7 +1775,7 @@ func GetTaskResourceToTaskId(dbSess *db.Session, task *models.Task) ([]Resource,
 		Joins("left join iac_resource_drift as rd on rd.res_id =  r.id ").
 		Where("r.org_id = ? AND r.project_id = ? AND r.env_id = ? AND r.task_id = ?",
 			task.OrgId, task.ProjectId, task.EnvId, task.Id).
-		LazySelectAppend("r.*, rd.drift_detail, rd.updated_at, rd.created_at").
+		LazySelectAppend("r.*, rd.drift_detail, rd.attrs as drift_attrs, rd.updated_at, rd.created_at").
 		Find(&rs); err != nil {
 		return nil, e.New(e.DBError, err)
 	}
@@ -1554,59 +1804,13 @@ func InsertOrUpdateCronTaskInfo(session *db.Session, resDrift models.ResourceDri
 		}
 	} else {
 		dbResDrift.DriftDetail = resDrift.DriftDetail
+		dbResDrift.Attrs = resDrift.Attrs
 		if _, err := models.UpdateModelAll(session, &dbResDrift); err != nil {
 			logs.Get().Errorf("update resource drift info error: %v", err)
 		}
 	}
 }
 
-func SendVcsComment(session *db.Session, task *models.Task, taskStatus string) {
-	env, er := GetEnvById(session, task.EnvId)
-	if er != nil {
-		logs.Get().Errorf("vcs comment err, get env detail data err: %v", er)
-		return
-	}
-
-	vp, err := GetVcsPrByTaskId(session, task)
-	if err != nil {
-		if !e.IsRecordNotFound(err) {
-			logs.Get().Errorf("vcs comment err, get vcs pr data err: %v", err)
-		}
-		return
-	}
-
-	vcs, er := GetVcsRepoByTplId(session, task.TplId)
-	if er != nil {
-		logs.Get().Errorf("vcs comment err, get vcs data err: %v", er)
-		return
-	}
-	taskStep, er := GetTaskPlanStep(session, task.Id)
-	if er != nil {
-		logs.Get().Errorf("vcs comment err, get task step data err: %v", er)
-		return
-	}
-
-	logContent, err := logstorage.Get().Read(taskStep.LogPath)
-	if err != nil {
-		logs.Get().Errorf("vcs comment err, get task plan log err: %v", err)
-		return
-	}
-
-	attr := map[string]interface{}{
-		"Status": taskStatus,
-		"Name":   env.Name,
-		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
-		"Addr":    fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id),
-		"Content": stripansi.Strip(string(logContent)),
-	}
-
-	content := utils.SprintTemplate(consts.PrCommentTpl, attr)
-	if err := vcs.CreatePrComment(vp.PrId, content); err != nil {
-		logs.Get().Errorf("vcs comment err, create comment err: %v", err)
-		return
-	}
-}
-
 func QueryResource(dbSess *db.Session, task *models.Task) *db.Session {
 	return dbSess.Table("iac_resource as r").
 		Joins("inner join iac_resource_drift as rd on rd.address =  r.address  and rd.env_id = ? ", task.EnvId).
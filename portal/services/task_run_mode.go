@@ -0,0 +1,47 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BuildTaskReplaces 检查部署任务的 replace、refresh-only 参数，返回去重后的 replace 地址列表
+func BuildTaskReplaces(taskType string, replaces []string, refreshOnly bool, isDriftTask bool) (models.StrSlice, e.Error) {
+	rs := make(models.StrSlice, 0, len(replaces))
+	if len(replaces) == 0 && !refreshOnly {
+		return rs, nil
+	}
+
+	if taskType != common.TaskTypePlan && taskType != common.TaskTypeApply {
+		return nil, e.New(e.EnvDeployModeInvalid,
+			fmt.Errorf("replace and refresh-only are not supported by %s task", taskType), http.StatusBadRequest)
+	}
+	if isDriftTask {
+		return nil, e.New(e.EnvDeployModeInvalid,
+			fmt.Errorf("replace and refresh-only are not supported by drift task"), http.StatusBadRequest)
+	}
+	if refreshOnly && len(replaces) > 0 {
+		return nil, e.New(e.EnvDeployModeInvalid,
+			fmt.Errorf("replace can not be used with refresh-only"), http.StatusBadRequest)
+	}
+
+	addrs := make(map[string]struct{})
+	for _, addr := range replaces {
+		addr = strings.TrimSpace(addr)
+		if !CheckImportAddress(addr) {
+			return nil, e.New(e.EnvDeployModeInvalid, fmt.Errorf("invalid replace address '%s'", addr), http.StatusBadRequest)
+		}
+		if _, ok := addrs[addr]; ok {
+			continue
+		}
+		addrs[addr] = struct{}{}
+		rs = append(rs, addr)
+	}
+	return rs, nil
+}
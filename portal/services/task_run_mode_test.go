@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTaskReplaces(t *testing.T) {
+	rs, err := BuildTaskReplaces(common.TaskTypeApply, nil, false, false)
+	assert.Nil(t, err)
+	assert.Empty(t, rs)
+
+	rs, err = BuildTaskReplaces(common.TaskTypePlan,
+		[]string{" aws_instance.web[0]", `module.a.aws_eip.ip["x"]`, "aws_instance.web[0]"}, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, models.StrSlice{"aws_instance.web[0]", `module.a.aws_eip.ip["x"]`}, rs)
+
+	rs, err = BuildTaskReplaces(common.TaskTypeApply, nil, true, false)
+	assert.Nil(t, err)
+	assert.Empty(t, rs)
+
+	cases := []struct {
+		taskType    string
+		replaces    []string
+		refreshOnly bool
+		isDrift     bool
+	}{
+		{common.TaskTypeDestroy, nil, true, false},
+		{common.TaskTypePlan, nil, true, true},
+		{common.TaskTypeApply, []string{"aws_instance.web"}, true, false},
+		{common.TaskTypeApply, []string{"module.vpc"}, false, false},
+		{common.TaskTypeApply, []string{"data.aws_ami.ubuntu"}, false, false},
+	}
+	for _, c := range cases {
+		_, err := BuildTaskReplaces(c.taskType, c.replaces, c.refreshOnly, c.isDrift)
+		if assert.NotNil(t, err, "%+v", c) {
+			assert.Equal(t, e.EnvDeployModeInvalid, err.Code())
+		}
+	}
+}
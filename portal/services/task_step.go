@@ -9,6 +9,8 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
+	"net/http"
 	"time"
 )
 
@@ -31,46 +33,102 @@ func GetTaskStep(sess *db.Session, taskId models.Id, step int) (*models.TaskStep
 	return &taskStep, nil
 }
 
-// ApproveTaskStep 标识步骤通过审批
-func ApproveTaskStep(tx *db.Session, taskId models.Id, step int, userId models.Id) e.Error {
-	if _, err := tx.Model(&models.TaskStep{}).
-		Where("task_id = ? AND `index` = ?", taskId, step).
-		Update(&models.TaskStep{ApproverId: userId}); err != nil {
-		if e.IsRecordNotFound(err) {
-			return e.New(e.TaskStepNotExists)
-		}
-		return e.New(e.DBError, err)
+// lockApprovingTaskStep 锁定待审批的步骤记录，使并发的审批、驳回和审批超时串行执行
+func lockApprovingTaskStep(tx *db.Session, taskId models.Id, step int) (*models.TaskStep, e.Error) {
+	taskStep, err := GetTaskStep(tx.ForUpdate(), taskId, step)
+	if err != nil {
+		return nil, err
 	}
-
-	taskStep, er := GetTaskStep(tx, taskId, step)
-	if er != nil {
-		return e.AutoNew(er, e.DBError)
+	if taskStep.Status != models.TaskStepApproving || taskStep.ApproverId != "" {
+		return nil, e.New(e.TaskApproveNotPending, http.StatusConflict)
 	}
+	return taskStep, nil
+}
 
+// ApproveTaskStep 标识步骤通过审批
+// 任务配置了审批策略时，需要通过审批的人数达到策略要求后步骤才会通过审批；
+// 部署预估费用超出预算时，还需要有预算审批人审批通过
+func ApproveTaskStep(tx *db.Session, taskId models.Id, step int, userId models.Id, comment string) e.Error {
+	// 先锁定步骤再统计审批人数，避免并发审批时重复计数
+	taskStep, err := lockApprovingTaskStep(tx, taskId, step)
+	if err != nil {
+		return err
+	}
 	task, err := GetTask(tx, taskId)
 	if err != nil {
 		return err
 	}
 
+	policy, err := getTaskApprovalPolicy(tx, task)
+	if err != nil {
+		return err
+	}
+	if err := checkTaskApprover(tx, task, policy, step, userId, models.TaskApprovalApproved); err != nil {
+		return err
+	}
+	if err := createTaskApproval(tx, task, step, userId, models.TaskApprovalApproved, comment); err != nil {
+		return err
+	}
+
+	if policy != nil {
+		approved, err := tx.Model(&models.TaskApproval{}).
+			Where("task_id = ? AND step = ? AND action = ?", taskId, step, models.TaskApprovalApproved).
+			Count()
+		if err != nil {
+			return e.New(e.DBError, err)
+		}
+		if int(approved) < policy.RequiredApprovals {
+			// 审批人数未达到要求，步骤保持待审批状态
+			return nil
+		}
+	}
+
+	if task.BudgetExceeded && taskStep.Type == common.TaskStepTfApply {
+		if ok, err := hasTaskBudgetApproval(tx, task, step); err != nil {
+			return err
+		} else if !ok {
+			// 预算审批人未审批，步骤保持待审批状态
+			return nil
+		}
+	}
+
+	if _, err := tx.Model(&models.TaskStep{}).
+		Where("task_id = ? AND `index` = ?", taskId, step).
+		Update(&models.TaskStep{ApproverId: userId}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	taskStep.ApproverId = userId
+
 	// 审批通过将步骤标识为 pending 状态，任务被同步修改为 running 状态，
 	// task manager 会在检测到步骤通过审批后开始执行步骤, 并标识为 running 状态
 	return ChangeTaskStepStatus(tx, task, taskStep, models.TaskStepPending, "")
 }
 
-// RejectTaskStep 驳回步骤审批
-func RejectTaskStep(dbSess *db.Session, taskId models.Id, step int, userId models.Id) e.Error {
-	taskStep, er := GetTaskStep(dbSess, taskId, step)
+// RejectTaskStep 驳回步骤审批，任一审批人驳回即驳回任务
+func RejectTaskStep(dbSess *db.Session, taskId models.Id, step int, userId models.Id, comment string) e.Error {
+	taskStep, er := lockApprovingTaskStep(dbSess, taskId, step)
 	if er != nil {
-		return e.AutoNew(er, e.DBError)
+		return er
 	}
 
-	taskStep.ApproverId = userId
-
-	if task, err := GetTask(dbSess, taskStep.TaskId); err != nil {
+	task, err := GetTask(dbSess, taskStep.TaskId)
+	if err != nil {
 		return e.AutoNew(err, e.DBError)
-	} else {
-		return ChangeTaskStepStatus(dbSess, task, taskStep, models.TaskStepRejected, "rejected")
 	}
+
+	policy, err := getTaskApprovalPolicy(dbSess, task)
+	if err != nil {
+		return err
+	}
+	if err := checkTaskApprover(dbSess, task, policy, step, userId, models.TaskApprovalRejected); err != nil {
+		return err
+	}
+	if err := createTaskApproval(dbSess, task, step, userId, models.TaskApprovalRejected, comment); err != nil {
+		return err
+	}
+
+	taskStep.ApproverId = userId
+	return ChangeTaskStepStatus(dbSess, task, taskStep, models.TaskStepRejected, "rejected")
 }
 
 func ChangeTaskStep2Aborted(db *db.Session, taskId models.Id, step int) e.Error {
@@ -140,6 +198,10 @@ func changeTaskStepStatusAndExitCode(dbSess *db.Session, task models.Tasker, tas
 	if _, err := dbSess.Model(taskStep).Where("id = ?", taskStep.Id).UpdateAttrs(updateAttrs); err != nil {
 		return e.New(e.DBError, err)
 	}
+	if _, ok := updateAttrs["end_at"]; ok {
+		metrics.TaskStepDurationSeconds.WithLabelValues(taskStep.Type, taskStep.Status).
+			Observe(time.Time(now).Sub(time.Time(*taskStep.StartAt)).Seconds())
+	}
 
 	if taskStep.IsExited() && !taskStep.IsRejected() {
 		// 步骤结束时任务不能同步修改状态，需要等资源采集步骤执行结束并生成统计数据后才能更新任务状态。
@@ -169,8 +231,9 @@ func newTaskStep(task models.Task, stepBody models.PipelineStep, index int) *mod
 		RetryNumber:  task.RetryNumber,
 	}
 
-	// apply 和 destroy 步骤需要审批
-	if !task.AutoApprove && (s.Type == common.TaskStepTfApply || s.Type == common.TaskStepTfDestroy) {
+	// apply、destroy、import 和 state 操作步骤需要审批
+	if !task.AutoApprove && (s.Type == common.TaskStepTfApply || s.Type == common.TaskStepTfDestroy ||
+		s.Type == common.TaskStepTfImport || s.Type == common.TaskStepTfStateOp) {
 		s.MustApproval = true
 	}
 
@@ -3,7 +3,10 @@
 package services
 
 import (
+	"cloudiac/common"
 	"cloudiac/policy"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
 	"cloudiac/portal/models/resps"
 	"encoding/json"
 	"testing"
@@ -323,3 +326,56 @@ func TestUnmarshalTfResultJson(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckRollbackTask(t *testing.T) {
+	env := &models.Env{}
+	env.Id = "env-1"
+
+	task := &models.Task{EnvId: "env-1"}
+	task.Type = models.TaskTypeApply
+	task.Status = models.TaskComplete
+	assert.Nil(t, CheckRollbackTask(task, env))
+
+	cases := []func(t *models.Task){
+		func(t *models.Task) { t.EnvId = "env-2" },
+		func(t *models.Task) { t.Type = models.TaskTypePlan },
+		func(t *models.Task) { t.Status = models.TaskFailed },
+		func(t *models.Task) { t.RefreshOnly = true },
+	}
+	for _, c := range cases {
+		src := *task
+		c(&src)
+		err := CheckRollbackTask(&src, env)
+		if assert.NotNil(t, err) {
+			assert.Equal(t, e.TaskCannotRollback, err.Code())
+		}
+	}
+}
+
+func TestResolveTaskResumeStep(t *testing.T) {
+	newSteps := func(mustApproval bool) []*models.TaskStep {
+		types := []string{common.TaskStepCheckout, models.TaskStepInit, models.TaskStepPlan,
+			models.TaskStepApply, models.TaskStepPlay}
+		steps := make([]*models.TaskStep, 0, len(types))
+		for i, typ := range types {
+			s := &models.TaskStep{Index: i}
+			s.Type = typ
+			s.MustApproval = mustApproval && typ == models.TaskStepApply
+			steps = append(steps, s)
+		}
+		return steps
+	}
+
+	// 无需审批时从失败步骤恢复
+	assert.Equal(t, 4, resolveTaskResumeStep(newSteps(false), 4))
+	// 失败的是审批步骤本身，新任务的该步骤会重新审批
+	assert.Equal(t, 3, resolveTaskResumeStep(newSteps(true), 3))
+	assert.Equal(t, 2, resolveTaskResumeStep(newSteps(true), 2))
+	// 审批步骤之后的步骤失败，从 plan 步骤开始重新执行并审批
+	assert.Equal(t, 2, resolveTaskResumeStep(newSteps(true), 4))
+
+	// 没有 plan 步骤时从审批步骤开始执行
+	steps := newSteps(true)
+	steps[2].Type = models.TaskStepInit
+	assert.Equal(t, 3, resolveTaskResumeStep(steps, 4))
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/utils"
+	"sort"
+)
+
+const (
+	VarDiffAdded   = "added"
+	VarDiffRemoved = "removed"
+	VarDiffChanged = "changed"
+)
+
+// DiffTaskVariables 对比两个任务生效的变量及其来源，只返回有差异的变量，敏感变量不返回值
+func DiffTaskVariables(base, target models.TaskVariables) []resps.TaskVariableDiff {
+	baseVars := make(map[string]models.VariableBody, len(base))
+	for _, v := range base {
+		baseVars[v.Key()] = v
+	}
+	targetVars := make(map[string]models.VariableBody, len(target))
+	for _, v := range target {
+		targetVars[v.Key()] = v
+	}
+
+	diffs := make([]resps.TaskVariableDiff, 0)
+	for k, bv := range baseVars {
+		tv, ok := targetVars[k]
+		if !ok {
+			diffs = append(diffs, resps.TaskVariableDiff{
+				Type:         bv.Type,
+				Name:         bv.Name,
+				Action:       VarDiffRemoved,
+				ValueChanged: true,
+				Base:         newTaskVariableValue(bv),
+			})
+			continue
+		}
+
+		valueChanged := !isTaskVarValueEqual(bv, tv)
+		if valueChanged || bv.Sensitive != tv.Sensitive || bv.Scope != tv.Scope || bv.VarGroupId != tv.VarGroupId {
+			diffs = append(diffs, resps.TaskVariableDiff{
+				Type:         tv.Type,
+				Name:         tv.Name,
+				Action:       VarDiffChanged,
+				ValueChanged: valueChanged,
+				Base:         newTaskVariableValue(bv),
+				Target:       newTaskVariableValue(tv),
+			})
+		}
+	}
+	for k, tv := range targetVars {
+		if _, ok := baseVars[k]; !ok {
+			diffs = append(diffs, resps.TaskVariableDiff{
+				Type:         tv.Type,
+				Name:         tv.Name,
+				Action:       VarDiffAdded,
+				ValueChanged: true,
+				Target:       newTaskVariableValue(tv),
+			})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Type != diffs[j].Type {
+			return diffs[i].Type < diffs[j].Type
+		}
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
+
+func newTaskVariableValue(v models.VariableBody) *resps.TaskVariableValue {
+	tv := &resps.TaskVariableValue{
+		Scope:        v.Scope,
+		Value:        v.Value,
+		Sensitive:    v.Sensitive,
+		VarGroupId:   v.VarGroupId,
+		VarGroupName: v.VarGroupName,
+		UpdaterId:    v.UpdaterId,
+	}
+	if v.Sensitive {
+		tv.Value = ""
+	}
+	return tv
+}
+
+// isTaskVarValueEqual 比较变量值，敏感变量每次加密结果不同，需要解密后比较
+func isTaskVarValueEqual(a, b models.VariableBody) bool {
+	if a.Value == b.Value {
+		return true
+	}
+	if !a.Sensitive && !b.Sensitive {
+		return false
+	}
+	av, err := utils.DecryptSecretVar(a.Value)
+	if err != nil {
+		return false
+	}
+	bv, err := utils.DecryptSecretVar(b.Value)
+	if err != nil {
+		return false
+	}
+	return av == bv
+}
+
+// DiffTaskFields 对比两个任务的代码版本、tfvars 文件及 terraform 版本等执行参数
+func DiffTaskFields(base, target *models.Task) []resps.TaskFieldDiff {
+	fields := []struct {
+		name         string
+		base, target string
+	}{
+		{"revision", base.Revision, target.Revision},
+		{"commitId", base.CommitId, target.CommitId},
+		{"tfVarsFile", base.TfVarsFile, target.TfVarsFile},
+		{"playVarsFile", base.PlayVarsFile, target.PlayVarsFile},
+		{"tfVersion", base.TfVersion, target.TfVersion},
+	}
+
+	diffs := make([]resps.TaskFieldDiff, 0)
+	for _, f := range fields {
+		if f.base != f.target {
+			diffs = append(diffs, resps.TaskFieldDiff{Field: f.name, Base: f.base, Target: f.target})
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTaskVariables(t *testing.T) {
+	configs.Set(&configs.Config{SecretKey: "0123456789abcdef"})
+
+	secret1, err := utils.EncryptSecretVar("pass")
+	assert.NoError(t, err)
+	secret2, err := utils.EncryptSecretVar("pass")
+	assert.NoError(t, err)
+	secret3, err := utils.EncryptSecretVar("new-pass")
+	assert.NoError(t, err)
+
+	base := models.TaskVariables{
+		{Scope: "env", Type: "terraform", Name: "same", Value: "1"},
+		{Scope: "env", Type: "terraform", Name: "changed", Value: "1", UpdaterId: "u-1"},
+		{Scope: "project", Type: "terraform", Name: "scope", Value: "1"},
+		{Scope: "env", Type: "terraform", Name: "removed", Value: "1"},
+		{Scope: "env", Type: "environment", Name: "PASSWORD", Value: secret1, Sensitive: true},
+		{Scope: "env", Type: "environment", Name: "TOKEN", Value: secret1, Sensitive: true},
+	}
+	target := models.TaskVariables{
+		{Scope: "env", Type: "terraform", Name: "same", Value: "1"},
+		{Scope: "env", Type: "terraform", Name: "changed", Value: "2", UpdaterId: "u-2"},
+		{Scope: "env", Type: "terraform", Name: "scope", Value: "1", VarGroupId: "vg-1", VarGroupName: "common"},
+		{Scope: "env", Type: "terraform", Name: "added", Value: "1"},
+		{Scope: "env", Type: "environment", Name: "PASSWORD", Value: secret2, Sensitive: true},
+		{Scope: "env", Type: "environment", Name: "TOKEN", Value: secret3, Sensitive: true},
+	}
+
+	diffs := DiffTaskVariables(base, target)
+	names := make([]string, 0, len(diffs))
+	for _, d := range diffs {
+		names = append(names, d.Name)
+	}
+	assert.Equal(t, []string{"TOKEN", "added", "changed", "removed", "scope"}, names)
+
+	token := diffs[0]
+	assert.Equal(t, VarDiffChanged, token.Action)
+	assert.True(t, token.ValueChanged)
+	assert.Equal(t, "", token.Base.Value)
+	assert.Equal(t, "", token.Target.Value)
+
+	assert.Equal(t, VarDiffAdded, diffs[1].Action)
+	assert.Nil(t, diffs[1].Base)
+
+	changed := diffs[2]
+	assert.True(t, changed.ValueChanged)
+	assert.Equal(t, "1", changed.Base.Value)
+	assert.Equal(t, "2", changed.Target.Value)
+	assert.Equal(t, models.Id("u-2"), changed.Target.UpdaterId)
+
+	assert.Equal(t, VarDiffRemoved, diffs[3].Action)
+	assert.Nil(t, diffs[3].Target)
+
+	// 值未变化但来源变化
+	scope := diffs[4]
+	assert.False(t, scope.ValueChanged)
+	assert.Equal(t, "project", scope.Base.Scope)
+	assert.Equal(t, "common", scope.Target.VarGroupName)
+}
+
+func TestDiffTaskFields(t *testing.T) {
+	base := &models.Task{Revision: "master", CommitId: "a", TfVarsFile: "dev.tfvars", TfVersion: "1.2.0"}
+	target := &models.Task{Revision: "master", CommitId: "b", TfVarsFile: "prod.tfvars", TfVersion: "1.2.0"}
+
+	diffs := DiffTaskFields(base, target)
+	if assert.Len(t, diffs, 2) {
+		assert.Equal(t, "commitId", diffs[0].Field)
+		assert.Equal(t, "tfVarsFile", diffs[1].Field)
+		assert.Equal(t, "prod.tfvars", diffs[1].Target)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Masterminds/semver"
+)
+
+// ParseTemplateVersion 解析 semver 格式的版本号，支持 "v" 前缀
+func ParseTemplateVersion(s string) (*semver.Version, e.Error) {
+	v, err := semver.NewVersion(s)
+	if err != nil {
+		return nil, e.New(e.TemplateVersionInvalid, fmt.Errorf("version '%s': %v", s, err), http.StatusBadRequest)
+	}
+	return v, nil
+}
+
+// compareSemver 比较两个版本号，无法解析的版本号视为最低版本
+func compareSemver(a, b string) int {
+	va, erra := semver.NewVersion(a)
+	vb, errb := semver.NewVersion(b)
+	switch {
+	case erra != nil && errb != nil:
+		return 0
+	case erra != nil:
+		return -1
+	case errb != nil:
+		return 1
+	}
+	return va.Compare(vb)
+}
+
+// latestSemverIndex 返回最新的正式版本的下标，没有正式版本时返回最高的预发布版本，都没有时返回 -1
+func latestSemverIndex(versions []string) int {
+	latest, latestPre := -1, -1
+	for i := range versions {
+		v, err := semver.NewVersion(versions[i])
+		if err != nil {
+			continue
+		}
+		if v.Prerelease() != "" {
+			if latestPre < 0 || compareSemver(versions[i], versions[latestPre]) > 0 {
+				latestPre = i
+			}
+		} else if latest < 0 || compareSemver(versions[i], versions[latest]) > 0 {
+			latest = i
+		}
+	}
+	if latest >= 0 {
+		return latest
+	}
+	return latestPre
+}
+
+type semverTag struct {
+	Version string
+	Tag     string
+}
+
+// newSemverTags 从仓库 tag 中找出 semver 格式且版本号不在 exists 中的 tag
+func newSemverTags(tags []string, exists []string) []semverTag {
+	existsMap := make(map[string]struct{}, len(exists))
+	for _, v := range exists {
+		existsMap[v] = struct{}{}
+	}
+
+	results := make([]semverTag, 0)
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil {
+			continue
+		}
+		if _, ok := existsMap[v.String()]; ok {
+			continue
+		}
+		existsMap[v.String()] = struct{}{}
+		results = append(results, semverTag{Version: v.String(), Tag: tag})
+	}
+	return results
+}
+
+// SortTemplateVersions 按版本号从高到低排序
+func SortTemplateVersions(versions []models.TemplateVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareSemver(versions[i].Version, versions[j].Version) > 0
+	})
+}
+
+// LatestTemplateVersion 返回最新的正式版本，没有正式版本时返回最高的预发布版本
+func LatestTemplateVersion(versions []models.TemplateVersion) *models.TemplateVersion {
+	vs := make([]string, 0, len(versions))
+	for _, v := range versions {
+		vs = append(vs, v.Version)
+	}
+	if i := latestSemverIndex(vs); i >= 0 {
+		return &versions[i]
+	}
+	return nil
+}
+
+// newTagTemplateVersions 从仓库 tag 中找出 semver 格式且尚未创建的版本
+func newTagTemplateVersions(tags []string, exists []models.TemplateVersion) []models.TemplateVersion {
+	existsVersions := make([]string, 0, len(exists))
+	for _, v := range exists {
+		existsVersions = append(existsVersions, v.Version)
+	}
+
+	versions := make([]models.TemplateVersion, 0)
+	for _, t := range newSemverTags(tags, existsVersions) {
+		versions = append(versions, models.TemplateVersion{
+			Version:  t.Version,
+			Revision: t.Tag,
+			Source:   models.TemplateVersionSourceTag,
+		})
+	}
+	return versions
+}
+
+func QueryTemplateVersion(query *db.Session, tplId models.Id) *db.Session {
+	return query.Model(&models.TemplateVersion{}).Where("tpl_id = ?", tplId)
+}
+
+// GetTemplateVersions 查询云模板的所有版本，按版本号从高到低排序
+func GetTemplateVersions(query *db.Session, tplId models.Id) ([]models.TemplateVersion, e.Error) {
+	versions := make([]models.TemplateVersion, 0)
+	if err := QueryTemplateVersion(query, tplId).Find(&versions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	SortTemplateVersions(versions)
+	return versions, nil
+}
+
+func GetTemplateVersionById(query *db.Session, tplId, id models.Id) (*models.TemplateVersion, e.Error) {
+	v := models.TemplateVersion{}
+	if err := QueryTemplateVersion(query, tplId).Where("id = ?", id).First(&v); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TemplateVersionNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &v, nil
+}
+
+// GetTemplateVersion 通过版本号查询云模板版本，版本号可以带 "v" 前缀
+func GetTemplateVersion(query *db.Session, tplId models.Id, version string) (*models.TemplateVersion, e.Error) {
+	sv, err := ParseTemplateVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	v := models.TemplateVersion{}
+	if err := QueryTemplateVersion(query, tplId).Where("version = ?", sv.String()).First(&v); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TemplateVersionNotExists, fmt.Errorf("version '%s'", version), http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &v, nil
+}
+
+func CreateTemplateVersion(tx *db.Session, v models.TemplateVersion) (*models.TemplateVersion, e.Error) {
+	sv, er := ParseTemplateVersion(v.Version)
+	if er != nil {
+		return nil, er
+	}
+	v.Version = sv.String()
+	if err := models.Create(tx, &v); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.TemplateVersionExists, fmt.Errorf("version '%s'", v.Version), http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &v, nil
+}
+
+func UpdateTemplateVersion(tx *db.Session, tplId, id models.Id, attrs models.Attrs) (*models.TemplateVersion, e.Error) {
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.TemplateVersion{}, attrs); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("update template version error: %v", err))
+	}
+	return GetTemplateVersionById(tx, tplId, id)
+}
+
+func DeleteTemplateVersion(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.TemplateVersion{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete template version error: %v", err))
+	}
+	return nil
+}
+
+// SyncTemplateVersionTags 将代码仓库中 semver 格式的 tag 同步为云模板版本，返回新增的版本
+func SyncTemplateVersionTags(tx *db.Session, tpl *models.Template, creatorId models.Id) ([]models.TemplateVersion, e.Error) {
+	repo, er := GetVcsRepoByTplId(tx, tpl.Id)
+	if er != nil {
+		return nil, er
+	}
+	tags, err := repo.ListTags()
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+
+	exists, er := GetTemplateVersions(tx, tpl.Id)
+	if er != nil {
+		return nil, er
+	}
+	versions := newTagTemplateVersions(tags, exists)
+	for i := range versions {
+		versions[i].OrgId = tpl.OrgId
+		versions[i].TplId = tpl.Id
+		versions[i].CreatorId = creatorId
+		if err := models.Create(tx, &versions[i]); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	SortTemplateVersions(versions)
+	return versions, nil
+}
+
+// filterOutdatedEnvs 返回锁定的版本低于最新版本的环境
+func filterOutdatedEnvs(envs []models.Env, latest string) []resps.OutdatedEnvResp {
+	results := make([]resps.OutdatedEnvResp, 0)
+	for _, env := range envs {
+		if env.TplVersion == "" || compareSemver(env.TplVersion, latest) >= 0 {
+			continue
+		}
+		results = append(results, resps.OutdatedEnvResp{
+			EnvId:         env.Id,
+			EnvName:       env.Name,
+			ProjectId:     env.ProjectId,
+			Status:        env.Status,
+			TplVersion:    env.TplVersion,
+			LatestVersion: latest,
+		})
+	}
+	return results
+}
+
+// GetOutdatedEnvs 查询锁定的版本落后于云模板最新版本的环境(不包含已归档的环境)
+func GetOutdatedEnvs(query *db.Session, tplId models.Id) ([]resps.OutdatedEnvResp, e.Error) {
+	versions, er := GetTemplateVersions(query, tplId)
+	if er != nil {
+		return nil, er
+	}
+	latest := LatestTemplateVersion(versions)
+	if latest == nil {
+		return []resps.OutdatedEnvResp{}, nil
+	}
+
+	envs := make([]models.Env, 0)
+	if err := query.Model(&models.Env{}).
+		Where("tpl_id = ? AND tpl_version != '' AND archived = ?", tplId, false).
+		Order("created_at DESC").
+		Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return filterOutdatedEnvs(envs, latest.Version), nil
+}
+
+// applyEnvUpgrade 升级任务部署成功后将环境锁定到目标版本，升级任务审批或部署完成前环境保持原版本
+func applyEnvUpgrade(tx *db.Session, task *models.Task) e.Error {
+	if task.TplVersion == "" {
+		return nil
+	}
+	env, er := GetEnvById(tx, task.EnvId)
+	if er != nil {
+		return er
+	}
+	before := *env
+	env.Revision = task.Revision
+	env.TplVersion = task.TplVersion
+	if _, err := models.UpdateAttr(tx.Where("id = ?", env.Id), &models.Env{}, models.Attrs{
+		"revision": env.Revision, "tpl_version": env.TplVersion,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return RecordEnvChanges(tx, &before, env, task.CreatorId, "")
+}
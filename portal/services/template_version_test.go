@@ -0,0 +1,56 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemplateVersion(t *testing.T) {
+	v, err := ParseTemplateVersion("v1.2.3")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3", v.String())
+
+	_, err = ParseTemplateVersion("master")
+	assert.NotNil(t, err)
+	assert.Equal(t, e.TemplateVersionInvalid, err.Code())
+}
+
+func TestSortAndLatestTemplateVersion(t *testing.T) {
+	versions := []models.TemplateVersion{
+		{Version: "1.2.0"}, {Version: "1.10.0"}, {Version: "2.0.0-rc.1"}, {Version: "1.9.3"},
+	}
+	SortTemplateVersions(versions)
+	assert.Equal(t, []string{"2.0.0-rc.1", "1.10.0", "1.9.3", "1.2.0"},
+		[]string{versions[0].Version, versions[1].Version, versions[2].Version, versions[3].Version})
+
+	assert.Equal(t, "1.10.0", LatestTemplateVersion(versions).Version)
+	assert.Equal(t, "1.0.0-beta", LatestTemplateVersion([]models.TemplateVersion{{Version: "1.0.0-beta"}}).Version)
+	assert.Nil(t, LatestTemplateVersion(nil))
+}
+
+func TestNewTagTemplateVersions(t *testing.T) {
+	exists := []models.TemplateVersion{{Version: "1.0.0"}}
+	versions := newTagTemplateVersions([]string{"v1.0.0", "v1.1.0", "release-x", "1.1.0", "v2.0.0"}, exists)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, "1.1.0", versions[0].Version)
+	assert.Equal(t, "v1.1.0", versions[0].Revision)
+	assert.Equal(t, models.TemplateVersionSourceTag, versions[0].Source)
+	assert.Equal(t, "2.0.0", versions[1].Version)
+}
+
+func TestFilterOutdatedEnvs(t *testing.T) {
+	envs := []models.Env{
+		{Name: "a", TplVersion: "1.0.0"},
+		{Name: "b", TplVersion: "1.2.0"},
+		{Name: "c", TplVersion: ""},
+	}
+	outdated := filterOutdatedEnvs(envs, "1.2.0")
+	assert.Equal(t, 1, len(outdated))
+	assert.Equal(t, "a", outdated[0].EnvName)
+	assert.Equal(t, "1.2.0", outdated[0].LatestVersion)
+}
@@ -0,0 +1,456 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// TfVariableSchema variables.tf 中定义的 terraform 变量
+type TfVariableSchema struct {
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`              // 类型约束，如 list(string)，未声明类型时为 any
+	Default     json.RawMessage        `json:"default,omitempty"` // 默认值(json 格式)
+	Description string                 `json:"description"`
+	Sensitive   bool                   `json:"sensitive"`
+	Required    bool                   `json:"required"` // 无默认值的变量为必填
+	Validations []TfVariableValidation `json:"validations,omitempty"`
+
+	ty         cty.Type
+	conditions []hcl.Expression
+}
+
+// TfVariableSchemaResult 变量定义及对应的 JSON Schema
+type TfVariableSchemaResult struct {
+	Variables  []TfVariableSchema     `json:"variables"`
+	JSONSchema map[string]interface{} `json:"jsonSchema"`
+}
+
+type TfVariableValidation struct {
+	Condition    string `json:"condition"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+type tfVariableSchemaConfig struct {
+	Variables []*tfVariableSchemaBlock `hcl:"variable,block"`
+	Remain    hcl.Body                 `hcl:",remain"`
+}
+
+type tfVariableSchemaBlock struct {
+	Name        string                       `hcl:",label"`
+	Default     *hcl.Attribute               `hcl:"default,optional"`
+	Type        *hcl.Attribute               `hcl:"type,optional"`
+	Description string                       `hcl:"description,optional"`
+	Sensitive   bool                         `hcl:"sensitive,optional"`
+	Validations []*tfVariableValidationBlock `hcl:"validation,block"`
+	Remain      hcl.Body                     `hcl:",remain"`
+}
+
+type tfVariableValidationBlock struct {
+	Condition    hcl.Expression `hcl:"condition,attr"`
+	ErrorMessage string         `hcl:"error_message,optional"`
+}
+
+// ParseTfVariableSchema 解析 tf 文件中的变量定义，包括类型、默认值、描述、sensitive 标识及 validation 规则
+func ParseTfVariableSchema(filename string, content []byte) ([]TfVariableSchema, e.Error) {
+	logger := logs.Get().WithField("filename", filename)
+	file, diags := hclsyntax.ParseConfig(content, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, e.New(e.HCLParseError, diags)
+	}
+
+	c := &tfVariableSchemaConfig{}
+	diags = gohcl.DecodeBody(file.Body, nil, c)
+	for _, d := range diags {
+		logger.Warnf(d.Error())
+	}
+
+	schemas := make([]TfVariableSchema, 0, len(c.Variables))
+	for _, b := range c.Variables {
+		s := TfVariableSchema{
+			Name:        b.Name,
+			Description: b.Description,
+			Sensitive:   b.Sensitive,
+			Required:    b.Default == nil,
+			ty:          cty.DynamicPseudoType,
+		}
+		if b.Type != nil {
+			ty, diags := typeexpr.TypeConstraint(b.Type.Expr)
+			if diags.HasErrors() {
+				// 不支持的类型约束(如 optional())不做类型校验，由 terraform 执行时检查
+				logger.Warnf("variable %s: %v", b.Name, diags)
+			} else {
+				s.ty = ty
+			}
+		}
+		s.Type = typeexpr.TypeString(s.ty)
+
+		if b.Default != nil {
+			val, diags := b.Default.Expr.Value(nil)
+			if !diags.HasErrors() && val.IsWhollyKnown() {
+				bs, err := ctyjson.Marshal(val, val.Type())
+				if err != nil {
+					return nil, e.New(e.HCLParseError, fmt.Errorf("variable %s: failed to serialize default value as JSON: %v", b.Name, err))
+				}
+				s.Default = bs
+			}
+		}
+
+		for _, v := range b.Validations {
+			s.Validations = append(s.Validations, TfVariableValidation{
+				Condition:    string(v.Condition.Range().SliceBytes(content)),
+				ErrorMessage: v.ErrorMessage,
+			})
+			s.conditions = append(s.conditions, v.Condition)
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas, nil
+}
+
+// GetTfVariableSchemas 读取代码仓库工作目录下所有 tf 文件中的变量定义
+func GetTfVariableSchemas(repo vcsrv.RepoIface, revision, workdir string) ([]TfVariableSchema, e.Error) {
+	files, err := repo.ListFiles(vcsrv.VcsIfaceOptions{
+		Ref:    revision,
+		Search: consts.TfFileMatch,
+		Path:   workdir,
+	})
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+
+	schemas := make([]TfVariableSchema, 0)
+	for _, file := range files {
+		content, err := repo.ReadFileContent(revision, file)
+		if err != nil {
+			return nil, e.New(e.VcsError, err)
+		}
+		vs, er := ParseTfVariableSchema(file, content)
+		if er != nil {
+			return nil, er
+		}
+		schemas = append(schemas, vs...)
+	}
+	return schemas, nil
+}
+
+// ctyTypeJSONSchema 将 terraform 类型约束转换为 JSON Schema
+func ctyTypeJSONSchema(ty cty.Type) map[string]interface{} {
+	switch {
+	case ty == cty.String:
+		return map[string]interface{}{"type": "string"}
+	case ty == cty.Number:
+		return map[string]interface{}{"type": "number"}
+	case ty == cty.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case ty.IsListType():
+		return map[string]interface{}{"type": "array", "items": ctyTypeJSONSchema(ty.ElementType())}
+	case ty.IsSetType():
+		return map[string]interface{}{"type": "array", "items": ctyTypeJSONSchema(ty.ElementType()), "uniqueItems": true}
+	case ty.IsMapType():
+		return map[string]interface{}{"type": "object", "additionalProperties": ctyTypeJSONSchema(ty.ElementType())}
+	case ty.IsObjectType():
+		props := make(map[string]interface{})
+		required := make([]string, 0)
+		for name, at := range ty.AttributeTypes() {
+			props[name] = ctyTypeJSONSchema(at)
+			required = append(required, name)
+		}
+		sort.Strings(required)
+		return map[string]interface{}{"type": "object", "properties": props, "required": required}
+	case ty.IsTupleType():
+		items := make([]interface{}, 0)
+		for _, et := range ty.TupleElementTypes() {
+			items = append(items, ctyTypeJSONSchema(et))
+		}
+		return map[string]interface{}{"type": "array", "items": items, "minItems": len(items), "maxItems": len(items)}
+	default:
+		// any
+		return map[string]interface{}{}
+	}
+}
+
+// TfVariablesJSONSchema 将变量定义转换为 JSON Schema(draft-07)，sensitive 变量标记为 writeOnly
+func TfVariablesJSONSchema(schemas []TfVariableSchema) map[string]interface{} {
+	props := make(map[string]interface{})
+	required := make([]string, 0)
+	for _, s := range schemas {
+		p := ctyTypeJSONSchema(s.ty)
+		if s.Description != "" {
+			p["description"] = s.Description
+		}
+		if len(s.Default) > 0 {
+			p["default"] = s.Default
+		}
+		if s.Sensitive {
+			p["writeOnly"] = true
+		}
+		props[s.Name] = p
+		if s.Required {
+			required = append(required, s.Name)
+		}
+	}
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"type":       "object",
+		"properties": props,
+		"required":   required,
+	}
+}
+
+// parseTfVariableValue 按照 runner 生成 tfvars.json 的规则解析变量值：
+// 可以解析为 json 的 map、list 及 null 按对应类型传入，其他值都以字符串传入
+func parseTfVariableValue(raw string) cty.Value {
+	tv := strings.TrimSpace(raw)
+	if strings.HasPrefix(tv, "{") || strings.HasPrefix(tv, "[") {
+		if ty, err := ctyjson.ImpliedType([]byte(tv)); err == nil {
+			if val, err := ctyjson.Unmarshal([]byte(tv), ty); err == nil {
+				return val
+			}
+		}
+	} else if tv == "null" {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	return cty.StringVal(raw)
+}
+
+var tfValidationFunctions = map[string]function.Function{
+	"abs":        stdlib.AbsoluteFunc,
+	"can":        tryfunc.CanFunc,
+	"ceil":       stdlib.CeilFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"concat":     stdlib.ConcatFunc,
+	"contains":   stdlib.ContainsFunc,
+	"distinct":   stdlib.DistinctFunc,
+	"element":    stdlib.ElementFunc,
+	"floor":      stdlib.FloorFunc,
+	"format":     stdlib.FormatFunc,
+	"join":       stdlib.JoinFunc,
+	"keys":       stdlib.KeysFunc,
+	"length":     tfLengthFunc,
+	"lookup":     stdlib.LookupFunc,
+	"lower":      stdlib.LowerFunc,
+	"max":        stdlib.MaxFunc,
+	"min":        stdlib.MinFunc,
+	"parseint":   stdlib.ParseIntFunc,
+	"regex":      stdlib.RegexFunc,
+	"regexall":   stdlib.RegexAllFunc,
+	"replace":    stdlib.ReplaceFunc,
+	"split":      stdlib.SplitFunc,
+	"substr":     stdlib.SubstrFunc,
+	"trimprefix": stdlib.TrimPrefixFunc,
+	"trimspace":  stdlib.TrimSpaceFunc,
+	"trimsuffix": stdlib.TrimSuffixFunc,
+	"try":        tryfunc.TryFunc,
+	"upper":      stdlib.UpperFunc,
+	"values":     stdlib.ValuesFunc,
+}
+
+// tfLengthFunc 与 terraform 的 length() 一致，同时支持字符串和集合类型
+var tfLengthFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.DynamicPseudoType, AllowDynamicType: true, AllowUnknown: true},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if args[0].Type() == cty.String {
+			return stdlib.Strlen(args[0])
+		}
+		return stdlib.Length(args[0])
+	},
+})
+
+// tfConditionSupported 检查 validation 条件中使用的函数是否都支持，
+// 不能依赖计算错误判断，因为 can()/try() 会吞掉未知函数的错误
+func tfConditionSupported(expr hcl.Expression) bool {
+	syntaxExpr, ok := expr.(hclsyntax.Expression)
+	if !ok {
+		return false
+	}
+	supported := true
+	_ = hclsyntax.VisitAll(syntaxExpr, func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok {
+			if _, ok := tfValidationFunctions[call.Name]; !ok {
+				supported = false
+			}
+		}
+		return nil
+	})
+	return supported
+}
+
+// Validate 检查变量值是否符合类型约束及 validation 规则。
+// validation 条件中使用了不支持的函数或无法计算时跳过该规则，由 terraform 执行时检查
+func (s *TfVariableSchema) Validate(raw string) error {
+	val := parseTfVariableValue(raw)
+	if val.IsNull() {
+		return nil
+	}
+
+	val, err := convert.Convert(val, s.ty)
+	if err != nil {
+		return fmt.Errorf("variable %s: %s required, %v", s.Name, s.Type, err)
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(map[string]cty.Value{s.Name: val})},
+		Functions: tfValidationFunctions,
+	}
+	for i, cond := range s.conditions {
+		if !tfConditionSupported(cond) {
+			continue
+		}
+		result, diags := cond.Value(ctx)
+		if diags.HasErrors() || !result.IsWhollyKnown() || result.IsNull() {
+			continue
+		}
+		if result, err = convert.Convert(result, cty.Bool); err != nil {
+			continue
+		}
+		if result.False() {
+			msg := s.Validations[i].ErrorMessage
+			if msg == "" {
+				msg = fmt.Sprintf("validation condition failed: %s", s.Validations[i].Condition)
+			}
+			return fmt.Errorf("variable %s: %s", s.Name, msg)
+		}
+	}
+	return nil
+}
+
+// ValidateTfVariables 使用变量定义检查 terraform 变量的值，未在 tf 文件中定义的变量不做检查
+func ValidateTfVariables(schemas []TfVariableSchema, vars []models.VariableBody) e.Error {
+	schemaMap := make(map[string]*TfVariableSchema, len(schemas))
+	for i := range schemas {
+		schemaMap[schemas[i].Name] = &schemas[i]
+	}
+
+	errs := make([]string, 0)
+	for _, v := range vars {
+		s, ok := schemaMap[v.Name]
+		if !ok || v.Type != consts.VarTypeTerraform {
+			continue
+		}
+		value := v.Value
+		if v.Sensitive {
+			var err error
+			if value, err = utils.DecryptSecretVar(v.Value); err != nil {
+				return e.New(e.InternalError, fmt.Errorf("decrypt variable %s: %v", v.Name, err))
+			}
+		}
+		if err := s.Validate(value); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return e.New(e.VariableValueInvalid, fmt.Errorf("%s", strings.Join(errs, "; ")), http.StatusBadRequest)
+	}
+	return nil
+}
+
+func hasTfVariable(vars []models.VariableBody) bool {
+	for _, v := range vars {
+		if v.Type == consts.VarTypeTerraform {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTplTfVariables 读取云模板代码中的变量定义并检查变量值。
+// 读取代码仓库或解析 tf 文件失败时不阻断操作，由 terraform 执行时检查
+func CheckTplTfVariables(sess *db.Session, tplId models.Id, revision, workdir string, vars []models.VariableBody) e.Error {
+	if !hasTfVariable(vars) {
+		return nil
+	}
+
+	lg := logs.Get().WithField("tplId", tplId)
+	repo, er := GetVcsRepoByTplId(sess, tplId)
+	if er != nil {
+		lg.Warnf("get template repo error: %v", er)
+		return nil
+	}
+	schemas, er := GetTfVariableSchemas(repo, revision, workdir)
+	if er != nil {
+		lg.Warnf("get terraform variable schemas error: %v", er)
+		return nil
+	}
+	return ValidateTfVariables(schemas, vars)
+}
+
+// 同一 commit 的变量定义不会变化，按 commit 缓存，避免每次创建任务都读取代码仓库
+var tfVariableSchemaCache = struct {
+	sync.Mutex
+	items map[string][]TfVariableSchema
+}{items: make(map[string][]TfVariableSchema)}
+
+const tfVariableSchemaCacheSize = 1024
+
+func getCachedTfVariableSchemas(key string) ([]TfVariableSchema, bool) {
+	tfVariableSchemaCache.Lock()
+	defer tfVariableSchemaCache.Unlock()
+	schemas, ok := tfVariableSchemaCache.items[key]
+	return schemas, ok
+}
+
+func setCachedTfVariableSchemas(key string, schemas []TfVariableSchema) {
+	tfVariableSchemaCache.Lock()
+	defer tfVariableSchemaCache.Unlock()
+	if len(tfVariableSchemaCache.items) >= tfVariableSchemaCacheSize {
+		tfVariableSchemaCache.items = make(map[string][]TfVariableSchema)
+	}
+	tfVariableSchemaCache.items[key] = schemas
+}
+
+// CheckTaskTfVariables 使用任务 commit 对应的变量定义检查变量值，变量定义按 commit 缓存。
+// 读取代码仓库或解析 tf 文件失败时不阻断任务，由 terraform 执行时检查
+func CheckTaskTfVariables(sess *db.Session, tpl *models.Template, commitId, workdir string, vars []models.VariableBody) e.Error {
+	if !hasTfVariable(vars) || tpl.VcsId == "" || commitId == "" {
+		return nil
+	}
+
+	key := strings.Join([]string{tpl.VcsId.String(), tpl.RepoId, commitId, workdir}, "|")
+	schemas, ok := getCachedTfVariableSchemas(key)
+	if !ok {
+		lg := logs.Get().WithField("tplId", tpl.Id)
+		vcs, er := GetVcsById(sess, tpl.VcsId)
+		if er != nil {
+			lg.Warnf("get template vcs error: %v", er)
+			return nil
+		}
+		repo, err := vcsrv.GetRepo(vcs, tpl.RepoId)
+		if err != nil {
+			lg.Warnf("get template repo error: %v", err)
+			return nil
+		}
+		if schemas, er = GetTfVariableSchemas(repo, commitId, workdir); er != nil {
+			lg.Warnf("get terraform variable schemas error: %v", er)
+			return nil
+		}
+		setCachedTfVariableSchemas(key, schemas)
+	}
+	return ValidateTfVariables(schemas, vars)
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTfVariables = `
+variable "name" {
+  description = "instance name"
+}
+
+variable "instance_count" {
+  type    = number
+  default = 1
+}
+
+variable "zones" {
+  type    = list(string)
+  default = ["a", "b"]
+}
+
+variable "tags" {
+  type = map(string)
+}
+
+variable "network" {
+  type = object({
+    cidr    = string
+    private = bool
+  })
+}
+
+variable "image_id" {
+  type      = string
+  sensitive = true
+  validation {
+    condition     = length(var.image_id) > 4 && substr(var.image_id, 0, 4) == "ami-"
+    error_message = "The image_id value must be a valid AMI id."
+  }
+  validation {
+    condition     = can(unknown_func(var.image_id))
+    error_message = "unsupported function should be skipped."
+  }
+}
+
+variable "opts" {
+  type = object({
+    a = optional(string)
+  })
+}
+
+resource "null_resource" "test" {}
+`
+
+func TestParseTfVariableSchema(t *testing.T) {
+	schemas, err := ParseTfVariableSchema("variables.tf", []byte(testTfVariables))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(schemas))
+
+	assert.Equal(t, "name", schemas[0].Name)
+	assert.Equal(t, "any", schemas[0].Type)
+	assert.True(t, schemas[0].Required)
+
+	assert.Equal(t, "number", schemas[1].Type)
+	assert.False(t, schemas[1].Required)
+	assert.Equal(t, "1", string(schemas[1].Default))
+
+	assert.Equal(t, "list(string)", schemas[2].Type)
+	assert.Equal(t, `["a","b"]`, string(schemas[2].Default))
+
+	assert.True(t, schemas[5].Sensitive)
+	assert.Equal(t, 2, len(schemas[5].Validations))
+	assert.Equal(t, `length(var.image_id) > 4 && substr(var.image_id, 0, 4) == "ami-"`, schemas[5].Validations[0].Condition)
+
+	// 不支持的类型约束不做类型校验
+	assert.Equal(t, "any", schemas[6].Type)
+
+	_, err = ParseTfVariableSchema("variables.tf", []byte(`variable "x" {`))
+	assert.NotNil(t, err)
+}
+
+func TestTfVariablesJSONSchema(t *testing.T) {
+	schemas, _ := ParseTfVariableSchema("variables.tf", []byte(testTfVariables))
+	js := TfVariablesJSONSchema(schemas)
+	assert.Equal(t, []string{"name", "tags", "network", "image_id", "opts"}, js["required"])
+
+	props := js["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{}, props["opts"])
+	assert.Equal(t, "number", props["instance_count"].(map[string]interface{})["type"])
+	assert.Equal(t, map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}, props["tags"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"cidr":    map[string]interface{}{"type": "string"},
+			"private": map[string]interface{}{"type": "boolean"},
+		},
+		"required": []string{"cidr", "private"},
+	}, props["network"])
+	assert.Equal(t, true, props["image_id"].(map[string]interface{})["writeOnly"])
+}
+
+func TestTfVariableSchemaValidate(t *testing.T) {
+	schemas, _ := ParseTfVariableSchema("variables.tf", []byte(testTfVariables))
+	schemaMap := make(map[string]*TfVariableSchema)
+	for i := range schemas {
+		schemaMap[schemas[i].Name] = &schemas[i]
+	}
+
+	cases := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"name", "web", true},
+		{"name", `{"a": 1}`, true},
+		{"instance_count", "3", true},
+		{"instance_count", "three", false},
+		{"zones", `["a", "b"]`, true},
+		{"zones", "a,b", false},
+		{"zones", "null", true},
+		{"tags", `{"env": "dev"}`, true},
+		{"tags", `["dev"]`, false},
+		{"network", `{"cidr": "10.0.0.0/16", "private": true}`, true},
+		{"network", `{"cidr": "10.0.0.0/16"}`, false},
+		{"image_id", "ami-123456", true},
+		{"image_id", "img-123456", false},
+		{"opts", `{"a": "b"}`, true},
+	}
+	for _, c := range cases {
+		err := schemaMap[c.name].Validate(c.value)
+		assert.Equal(t, c.valid, err == nil, "%s=%s: %v", c.name, c.value, err)
+	}
+	assert.Contains(t, schemaMap["image_id"].Validate("img-123456").Error(), "must be a valid AMI id")
+}
+
+func TestValidateTfVariables(t *testing.T) {
+	schemas, _ := ParseTfVariableSchema("variables.tf", []byte(testTfVariables))
+
+	assert.Nil(t, ValidateTfVariables(schemas, []models.VariableBody{
+		{Name: "instance_count", Value: "2", Type: consts.VarTypeTerraform},
+		{Name: "instance_count", Value: "two", Type: consts.VarTypeEnv},
+		{Name: "undefined", Value: "x", Type: consts.VarTypeTerraform},
+	}))
+
+	err := ValidateTfVariables(schemas, []models.VariableBody{
+		{Name: "instance_count", Value: "two", Type: consts.VarTypeTerraform},
+		{Name: "zones", Value: "a", Type: consts.VarTypeTerraform},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, e.VariableValueInvalid, err.Code())
+	assert.Contains(t, err.Error(), "instance_count")
+	assert.Contains(t, err.Error(), "zones")
+}
+
+func TestValidateTfVariablesSensitive(t *testing.T) {
+	configs.Set(&configs.Config{SecretKey: "0123456789abcdef"})
+	schemas, _ := ParseTfVariableSchema("variables.tf", []byte(testTfVariables))
+
+	encrypted, err := utils.EncryptSecretVar("two")
+	assert.NoError(t, err)
+	er := ValidateTfVariables(schemas, []models.VariableBody{
+		{Name: "instance_count", Value: encrypted, Type: consts.VarTypeTerraform, Sensitive: true},
+	})
+	assert.NotNil(t, er)
+	assert.Equal(t, e.VariableValueInvalid, er.Code())
+
+	// 无法解密的值返回错误，不跳过检查
+	er = ValidateTfVariables(schemas, []models.VariableBody{
+		{Name: "instance_count", Value: utils.EncodeSecretVar("invalid", true), Type: consts.VarTypeTerraform, Sensitive: true},
+	})
+	assert.NotNil(t, er)
+	assert.Equal(t, e.InternalError, er.Code())
+}
+
+func TestCheckTaskTfVariablesCache(t *testing.T) {
+	schemas, _ := ParseTfVariableSchema("variables.tf", []byte(testTfVariables))
+	tpl := models.Template{VcsId: "vcs-1", RepoId: "idcos/tpl"}
+	setCachedTfVariableSchemas("vcs-1|idcos/tpl|c0ffee|modules", schemas)
+
+	// 命中缓存时不访问数据库及代码仓库
+	er := CheckTaskTfVariables(nil, &tpl, "c0ffee", "modules", []models.VariableBody{
+		{Name: "instance_count", Value: "two", Type: consts.VarTypeTerraform},
+	})
+	assert.NotNil(t, er)
+	assert.Equal(t, e.VariableValueInvalid, er.Code())
+	assert.Nil(t, CheckTaskTfVariables(nil, &tpl, "c0ffee", "modules", []models.VariableBody{
+		{Name: "instance_count", Value: "2", Type: consts.VarTypeTerraform},
+	}))
+}
@@ -341,7 +341,7 @@ func UpdateObjectVars(tx *db.Session, scope string, objectId models.Id, vars []m
 func insertVars(dbVarsMap map[string]models.Variable, vars []models.Variable, tx *db.Session) e.Error {
 	insertSqls := utils.NewBatchSQL(1024, "INSERT INTO", models.Variable{}.TableName(),
 		"org_id", "project_id", "tpl_id", "env_id",
-		"id", "scope", "type", "name", "value", "sensitive", "description", "options")
+		"id", "scope", "type", "name", "value", "sensitive", "description", "options", "updater_id")
 
 	for _, v := range vars {
 		if dbVar, ok := dbVarsMap[v.Key()]; ok { // 同名变量己存在，进行更新
@@ -354,12 +354,16 @@ func insertVars(dbVarsMap map[string]models.Variable, vars []models.Variable, tx
 			if v.Id == "" {
 				v.Id = dbVar.Id
 			}
+			// 变量未修改时保留原修改人
+			if isVarUnchanged(dbVar.VariableBody, v.VariableBody) {
+				v.UpdaterId = dbVar.UpdaterId
+			}
 			if _, err := models.UpdateModelAll(tx, v, "id = ?", dbVar.Id); err != nil {
 				return e.AutoNew(err, e.DBError)
 			}
 		} else { // 否则插入新变量
 			insertSqls.MustAddRow(v.OrgId, v.ProjectId, v.TplId, v.EnvId,
-				v.NewId(), v.Scope, v.Type, v.Name, v.Value, v.Sensitive, v.Description, v.Options)
+				v.NewId(), v.Scope, v.Type, v.Name, v.Value, v.Sensitive, v.Description, v.Options, v.UpdaterId)
 		}
 	}
 
@@ -372,6 +376,12 @@ func insertVars(dbVarsMap map[string]models.Variable, vars []models.Variable, tx
 	return nil
 }
 
+// isVarUnchanged 判断提交的变量与已保存的变量是否相同，敏感变量提交了新值即视为修改
+func isVarUnchanged(dbVar, v models.VariableBody) bool {
+	return !v.Sensitive && !dbVar.Sensitive && dbVar.Value == v.Value &&
+		dbVar.Description == v.Description && utils.SliceEqualStr(dbVar.Options, v.Options)
+}
+
 func WithVarScopeIdWhere(query *db.Session, tableName string, scope string, id models.Id) *db.Session {
 	query = query.Where(fmt.Sprintf("`%s`.`scope` = ?", tableName), scope)
 	switch scope {
@@ -408,6 +408,9 @@ func MergeVariableGroupVars(vgs []VarGroupRel, vars map[string]models.Variable)
 					Value:       variable.Value,
 					Sensitive:   variable.Sensitive,
 					Description: variable.Description,
+
+					VarGroupId:   v.VarGroupId,
+					VarGroupName: v.VariableGroup.Name,
 				},
 			}
 		}
@@ -150,6 +150,9 @@ func TestGetVariableGroupVar(t *testing.T) {
 							false,
 							"",
 							nil,
+							"",
+							"",
+							"",
 						},
 						OrgId:     "org-c902qsahsj54g0s8ug",
 						ProjectId: "p-c90hl7qsahsj54g0s90g",
@@ -172,6 +175,9 @@ func TestGetVariableGroupVar(t *testing.T) {
 						false,
 						"",
 						nil,
+						"",
+						"",
+						"",
 					}, "org-c902qsahsj54g0s8ug",
 					"p-c90hl7qsahsj54g0s90g",
 					"tpl-c9183bisahsld18h0hog",
@@ -228,6 +234,9 @@ func TestGetVariableGroupVar(t *testing.T) {
 							false,
 							"",
 							nil,
+							"",
+							"",
+							"",
 						},
 						OrgId: "org-2qsahsj54g0s8ug",
 					},
@@ -244,6 +253,9 @@ func TestGetVariableGroupVar(t *testing.T) {
 						false,
 						"测试",
 						nil,
+						"",
+						"vg-c90mgoasahsk60ulahi0",
+						"测试",
 					},
 				},
 			},
@@ -297,6 +309,9 @@ func TestGetVariableGroupVar(t *testing.T) {
 							false,
 							"",
 							nil,
+							"",
+							"",
+							"",
 						},
 						ProjectId: "p-c90hl7qsahsj54g0s90g",
 					},
@@ -313,6 +328,9 @@ func TestGetVariableGroupVar(t *testing.T) {
 						false,
 						"测试",
 						nil,
+						"",
+						"vg-c90mgoasahsk60ulahi0",
+						"测试",
 					},
 				},
 			},
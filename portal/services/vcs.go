@@ -250,3 +250,25 @@ func GetVcsPrByTaskId(session *db.Session, task *models.Task) (models.VcsPr, err
 	}
 	return vp, nil
 }
+
+// GetVcsPrCommentId 获取环境在该 PR 下已发布的 plan 评论 id，没有则返回 0
+func GetVcsPrCommentId(session *db.Session, vp models.VcsPr) (int64, error) {
+	prev := models.VcsPr{}
+	err := session.Model(&models.VcsPr{}).
+		Where("env_id = ? AND vcs_id = ? AND pr_id = ?", vp.EnvId, vp.VcsId, vp.PrId).
+		Where("comment_id != 0").
+		Order("id DESC").First(&prev)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return prev.CommentId, nil
+}
+
+func UpdateVcsPrCommentId(session *db.Session, id uint, commentId int64) error {
+	_, err := session.Model(&models.VcsPr{}).Where("id = ?", id).
+		UpdateColumn("comment_id", commentId)
+	return err
+}
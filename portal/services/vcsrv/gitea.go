@@ -343,20 +343,50 @@ func (gitea *giteaRepoIface) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (gitea *giteaRepoIface) CreatePrComment(prId int, comment string) error {
-	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/pulls/%d/reviews", gitea.repository.FullName, prId)
-	requestBody := map[string]string{
-		"body": comment,
+// CreatePrComment 使用 issue 评论接口添加 PR 评论，以便后续可以修改评论内容
+func (gitea *giteaRepoIface) CreatePrComment(prId int, comment string) (int64, error) {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/issues/%d/comments", gitea.repository.FullName, prId)
+	body, err := gitea.jsonRequest(path, http.MethodPost, map[string]string{"body": comment})
+	if err != nil {
+		return 0, err
+	}
+	c := vcsComment{}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return 0, e.New(e.VcsError, err)
 	}
+	return c.Id, nil
+}
+
+func (gitea *giteaRepoIface) UpdatePrComment(prId int, commentId int64, comment string) error {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/issues/comments/%d", gitea.repository.FullName, commentId)
+	_, err := gitea.jsonRequest(path, http.MethodPatch, map[string]string{"body": comment})
+	return err
+}
+
+func (gitea *giteaRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/statuses/%s", gitea.repository.FullName, commitId)
+	_, err := gitea.jsonRequest(path, http.MethodPost, map[string]string{
+		"state":       status.State,
+		"context":     status.Context,
+		"description": status.Description,
+		"target_url":  status.TargetUrl,
+	})
+	return err
+}
+
+func (gitea *giteaRepoIface) jsonRequest(path, method string, requestBody interface{}) ([]byte, error) {
 	b, err := json.Marshal(requestBody)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, _, err = giteaRequest(path, http.MethodPost, gitea.vcs.VcsToken, b)
+	response, body, err := giteaRequest(path, method, gitea.vcs.VcsToken, b)
 	if err != nil {
-		return e.New(e.VcsError, err)
+		return nil, e.New(e.VcsError, err)
 	}
-	return nil
+	if response.StatusCode > 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
+	}
+	return body, nil
 }
 
 func (gitea *giteaRepoIface) GetFullFilePath(address, filePath, repoRevision string) string {
@@ -383,7 +413,7 @@ func giteaRequest(path, method, token string, requestBody []byte) (*http.Respons
 	if er != nil {
 		return nil, nil, er
 	}
-	client := &http.Client{}
+	client := newHttpClient()
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Authorization", fmt.Sprintf("token %s", vcsToken))
 	//request.Body.Read()
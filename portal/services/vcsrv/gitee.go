@@ -7,6 +7,7 @@ import (
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/models"
 	"cloudiac/utils"
+	"cloudiac/utils/logs"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -348,21 +349,46 @@ func (gitee *giteeRepoIface) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (gitee *giteeRepoIface) CreatePrComment(prId int, comment string) error {
+func (gitee *giteeRepoIface) CreatePrComment(prId int, comment string) (int64, error) {
 	path := gitee.vcs.Address +
 		fmt.Sprintf("/repos/%s/pulls/%d/comments?access_token=%s", gitee.repository.FullName, prId, gitee.urlParam.Get("access_token"))
-
-	requestBody := map[string]string{
-		"body": comment,
+	body, err := gitee.commentRequest(path, http.MethodPost, comment)
+	if err != nil {
+		return 0, err
 	}
-	b, er := json.Marshal(requestBody)
+	c := vcsComment{}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return c.Id, nil
+}
+
+func (gitee *giteeRepoIface) UpdatePrComment(prId int, commentId int64, comment string) error {
+	path := gitee.vcs.Address +
+		fmt.Sprintf("/repos/%s/pulls/comments/%d?access_token=%s", gitee.repository.FullName, commentId, gitee.urlParam.Get("access_token"))
+	_, err := gitee.commentRequest(path, http.MethodPatch, comment)
+	return err
+}
+
+func (gitee *giteeRepoIface) commentRequest(path, method, comment string) ([]byte, error) {
+	b, er := json.Marshal(map[string]string{"body": comment})
 	if er != nil {
-		return er
+		return nil, er
 	}
-	_, _, err := giteeRequest(path, http.MethodPost, b)
+	response, body, err := giteeRequest(path, method, b)
 	if err != nil {
-		return e.New(e.VcsError, err)
+		return nil, e.New(e.VcsError, err)
 	}
+	if response.StatusCode > 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
+	}
+	return body, nil
+}
+
+// SetCommitStatus gitee 的 openapi 不支持设置 commit 状态，只记录日志，plan 结果仍会通过 PR 评论反馈
+func (gitee *giteeRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	logs.Get().WithField("repo", gitee.repository.FullName).
+		Debugf("gitee does not support commit status, skip commit %s status %s", commitId, status.State)
 	return nil
 }
 
@@ -386,7 +412,7 @@ func giteeRequest(path, method string, requestBody []byte) (*http.Response, []by
 	if er != nil {
 		return nil, nil, er
 	}
-	client := &http.Client{}
+	client := newHttpClient()
 	request.Header.Set("Content-Type", "application/json")
 	response, err := client.Do(request)
 	if err != nil {
@@ -367,22 +367,56 @@ func (github *githubRepoIface) DeleteWebhook(id int) error {
 }
 
 //CreatePrComment doc: https://docs.github.com/en/rest/reference/pulls#submit-a-review-for-a-pull-request
-func (github *githubRepoIface) CreatePrComment(prId int, comment string) error {
-	path := utils.GenQueryURL(github.vcs.Address, fmt.Sprintf("/repos/%s/pulls/%d/reviews", github.repository.FullName, prId), nil)
-	requestBody := map[string]string{
-		"body":  comment,
-		"event": "COMMENT",
+// CreatePrComment 使用 issue 评论接口添加 PR 评论，以便后续可以修改评论内容
+func (github *githubRepoIface) CreatePrComment(prId int, comment string) (int64, error) {
+	path := utils.GenQueryURL(github.vcs.Address, fmt.Sprintf("/repos/%s/issues/%d/comments", github.repository.FullName, prId), nil)
+	body, err := github.commentRequest(path, http.MethodPost, comment)
+	if err != nil {
+		return 0, err
+	}
+	c := vcsComment{}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return c.Id, nil
+}
+
+func (github *githubRepoIface) UpdatePrComment(prId int, commentId int64, comment string) error {
+	path := utils.GenQueryURL(github.vcs.Address, fmt.Sprintf("/repos/%s/issues/comments/%d", github.repository.FullName, commentId), nil)
+	_, err := github.commentRequest(path, http.MethodPatch, comment)
+	return err
+}
+
+func (github *githubRepoIface) commentRequest(path, method, comment string) ([]byte, error) {
+	b, er := json.Marshal(map[string]string{"body": comment})
+	if er != nil {
+		return nil, er
+	}
+	response, body, err := githubRequest(path, method, github.vcs.VcsToken, b)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
 	}
-	b, er := json.Marshal(requestBody)
+	if response.StatusCode > 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
+	}
+	return body, nil
+}
+
+func (github *githubRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	path := utils.GenQueryURL(github.vcs.Address, fmt.Sprintf("/repos/%s/statuses/%s", github.repository.FullName, commitId), nil)
+	b, er := json.Marshal(map[string]string{
+		"state":       status.State,
+		"context":     status.Context,
+		"description": status.Description,
+		"target_url":  status.TargetUrl,
+	})
 	if er != nil {
 		return er
 	}
 	response, body, err := githubRequest(path, http.MethodPost, github.vcs.VcsToken, b)
-
 	if err != nil {
 		return e.New(e.VcsError, err)
 	}
-
 	if response.StatusCode > 300 {
 		return e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
 	}
@@ -414,7 +448,7 @@ func githubRequest(path, method, token string, requestBody []byte) (*http.Respon
 	if er != nil {
 		return nil, nil, er
 	}
-	client := &http.Client{}
+	client := newHttpClient()
 	request.Header.Set("Content-Type", "multipart/form-data")
 	request.Header.Set("Accept", "application/vnd.github.v3+json")
 	request.Header.Set("Authorization", fmt.Sprintf("token %s", vcsToken))
@@ -269,8 +269,34 @@ func (git *gitlabRepoIface) DeleteWebhook(id int) error {
 	return err
 }
 
-func (git *gitlabRepoIface) CreatePrComment(prId int, comment string) error {
-	if _, _, err := git.gitConn.Notes.CreateMergeRequestNote(git.Project.ID, prId, &gitlab.CreateMergeRequestNoteOptions{Body: gitlab.String(comment)}); err != nil {
+func (git *gitlabRepoIface) CreatePrComment(prId int, comment string) (int64, error) {
+	note, _, err := git.gitConn.Notes.CreateMergeRequestNote(git.Project.ID, prId, &gitlab.CreateMergeRequestNoteOptions{Body: gitlab.String(comment)})
+	if err != nil {
+		return 0, err
+	}
+	return int64(note.ID), nil
+}
+
+func (git *gitlabRepoIface) UpdatePrComment(prId int, commentId int64, comment string) error {
+	if _, _, err := git.gitConn.Notes.UpdateMergeRequestNote(git.Project.ID, prId, int(commentId),
+		&gitlab.UpdateMergeRequestNoteOptions{Body: gitlab.String(comment)}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (git *gitlabRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	state := gitlab.BuildStateValue(status.State)
+	switch status.State {
+	case CommitStatusFailure, CommitStatusError:
+		state = gitlab.Failed
+	}
+	if _, _, err := git.gitConn.Commits.SetCommitStatus(git.Project.ID, commitId, &gitlab.SetCommitStatusOptions{
+		State:       state,
+		Name:        gitlab.String(status.Context),
+		TargetURL:   gitlab.String(status.TargetUrl),
+		Description: gitlab.String(status.Description),
+	}); err != nil {
 		return err
 	}
 	return nil
@@ -293,7 +319,8 @@ func GetGitConn(gitlabToken, gitlabUrl string) (*gitlab.Client, e.Error) {
 	if err != nil {
 		return nil, e.New(e.VcsError, err)
 	}
-	git, er := gitlab.NewClient(token, gitlab.WithBaseURL(gitlabUrl+"/api/v4"))
+	git, er := gitlab.NewClient(token, gitlab.WithBaseURL(gitlabUrl+"/api/v4"),
+		gitlab.WithHTTPClient(newHttpClient()))
 	if er != nil {
 		return nil, e.New(e.JSONParseError, er)
 	}
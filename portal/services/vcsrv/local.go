@@ -279,8 +279,16 @@ func (l *LocalRepo) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (l *LocalRepo) CreatePrComment(prId int, comment string) error {
+func (l *LocalRepo) CreatePrComment(prId int, comment string) (int64, error) {
 
+	return 0, nil
+}
+
+func (l *LocalRepo) UpdatePrComment(prId int, commentId int64, comment string) error {
+	return nil
+}
+
+func (l *LocalRepo) SetCommitStatus(commitId string, status CommitStatus) error {
 	return nil
 }
 
@@ -254,8 +254,16 @@ func (r *RegistryRepo) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (r *RegistryRepo) CreatePrComment(prId int, comment string) error {
+func (r *RegistryRepo) CreatePrComment(prId int, comment string) (int64, error) {
 
+	return 0, nil
+}
+
+func (r *RegistryRepo) UpdatePrComment(prId int, commentId int64, comment string) error {
+	return nil
+}
+
+func (r *RegistryRepo) SetCommitStatus(commitId string, status CommitStatus) error {
 	return nil
 }
 
@@ -278,7 +286,7 @@ func registryVcsRequest(path, method string, params map[string]string) (*http.Re
 		return nil, nil, err
 	}
 
-	client := &http.Client{}
+	client := newHttpClient()
 	req, err := http.NewRequest(method, path, payload)
 
 	if err != nil {
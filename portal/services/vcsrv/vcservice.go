@@ -9,7 +9,9 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/utils"
+	"cloudiac/utils/tracing"
 	"fmt"
+	"net/http"
 	"path"
 	"strings"
 
@@ -104,8 +106,16 @@ type RepoIface interface {
 	//AddWebhook 查询Webhook列表
 	AddWebhook(url string) error
 
-	//CreatePrComment 添加PR评论
-	CreatePrComment(prId int, comment string) error
+	//CreatePrComment 添加PR评论，返回评论 id
+	CreatePrComment(prId int, comment string) (int64, error)
+
+	// UpdatePrComment 修改PR评论
+	UpdatePrComment(prId int, commentId int64, comment string) error
+
+	// SetCommitStatus 设置 commit 的状态
+	// param commitId: commit id
+	// param status: 状态信息，不支持 commit 状态的 vcs 直接忽略
+	SetCommitStatus(commitId string, status CommitStatus) error
 
 	// GetVcsFullFilePath 获取文件完整路径
 	GetFullFilePath(address, filePath, repoRevision string) string
@@ -114,6 +124,25 @@ type RepoIface interface {
 	GetCommitFullPath(address, commitId string) string
 }
 
+const (
+	CommitStatusPending = "pending"
+	CommitStatusSuccess = "success"
+	CommitStatusFailure = "failure"
+	CommitStatusError   = "error"
+)
+
+type CommitStatus struct {
+	State       string // pending, success, failure, error
+	Context     string // 状态名称，同一 commit 下相同 context 的状态会被覆盖
+	Description string
+	TargetUrl   string
+}
+
+// vcsComment 创建评论接口返回的评论信息
+type vcsComment struct {
+	Id int64 `json:"id"`
+}
+
 type RepoHook struct {
 	Id  int    `json:"id"`
 	Url string `json:"url"`
@@ -231,6 +260,11 @@ func SetWebhook(vcs *models.Vcs, repoId, apiToken string, triggers []string) err
 	return nil
 }
 
+// newHttpClient 返回访问 vcs api 使用的 http client，每个请求都会记录链路追踪 span
+func newHttpClient() *http.Client {
+	return &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+}
+
 func GetVcsToken(token string) (string, error) {
 	return utils.DecryptSecretVar(token)
 }
@@ -51,12 +51,85 @@ func cronBillCollectTask() {
 		services.BuildVgBilling(tx, vgs[index], logger, billingCycle)
 	}
 
+	// 账单采集完成后检查预算使用情况，达到阈值时在事务提交后发送通知
+	alerts := services.ProcessBudgetThresholds(tx, billingCycle, logger)
+
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
 		logger.Errorf("bill task db commit err: %s", err)
+		return
 	}
+	services.SendBudgetThresholdAlerts(db.Get(), alerts)
 
 	logger.Info("stop bill collect")
 }
 
+func envExpireCron(ctx context.Context) {
+	c := cron.New()
+	if _, err := c.AddFunc("@every 1m", cronEnvExpireNotifyTask); err != nil {
+		logs.Get().Error("env expire cron task start failed")
+		return
+	}
+	c.Start()
+
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+}
+
+// cronEnvExpireNotifyTask 检查即将自动销毁的环境并发送提醒
+func cronEnvExpireNotifyTask() {
+	logger := logs.Get().WithField("action", "env expire cron task")
+	services.ProcessEnvExpireNotify(db.Get(), time.Now(), logger)
+}
+
+func envBatchCron(ctx context.Context) {
+	c := cron.New()
+	if _, err := c.AddFunc("@every 10s", cronEnvBatchTask); err != nil {
+		logs.Get().Error("env batch cron task start failed")
+		return
+	}
+	c.Start()
+
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+}
+
+// cronEnvBatchTask 按速率限制为批量操作创建子任务，并同步子任务状态
+func cronEnvBatchTask() {
+	logger := logs.Get().WithField("action", "env batch cron task")
+	dbSess := db.Get()
+	batches, err := services.GetProcessingEnvBatches(dbSess)
+	if err != nil {
+		logger.Errorf("get env batches error: %v", err)
+		return
+	}
+	for i := range batches {
+		if err := services.ProcessEnvBatch(dbSess, &batches[i], time.Now(), logger); err != nil {
+			logger.Errorf("process env batch %s error: %v", batches[i].Id, err)
+		}
+	}
+}
+
+func driftRemediationCron(ctx context.Context) {
+	c := cron.New()
+	if _, err := c.AddFunc("@every 1m", cronDriftRemediationTask); err != nil {
+		logs.Get().Error("drift remediation cron task start failed")
+		return
+	}
+	c.Start()
 
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+}
+
+// cronDriftRemediationTask 同步纠偏任务的执行结果，统计纠偏时间
+func cronDriftRemediationTask() {
+	logger := logs.Get().WithField("action", "drift remediation cron task")
+	services.ProcessDriftRemediations(db.Get(), time.Now(), logger)
+}
@@ -17,7 +17,10 @@ import (
 	"cloudiac/utils"
 	"cloudiac/utils/consul"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
+	"cloudiac/utils/tracing"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
@@ -31,6 +34,7 @@ import (
 	"github.com/acarl005/stripansi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -139,6 +143,12 @@ func (m *TaskManager) start() {
 
 	// 启动账单采集定时任务
 	billCron(ctx)
+	// 启动环境自动销毁提醒定时任务
+	envExpireCron(ctx)
+	// 启动环境批量操作定时任务
+	envBatchCron(ctx)
+	// 启动漂移纠偏状态同步定时任务
+	driftRemediationCron(ctx)
 
 	// 恢复执行中的任务状态
 	if err = m.recoverTask(ctx); err != nil {
@@ -151,6 +161,7 @@ func (m *TaskManager) start() {
 
 	m.logger.Infof("start task manager mainloop")
 	for {
+		loopStart := time.Now()
 		m.logger.Trace("start process auto destroy tasks")
 		if err := m.processAutoDestroy(); err != nil {
 			m.logger.Errorf("process auto destroy error: %v", err)
@@ -166,6 +177,7 @@ func (m *TaskManager) start() {
 		m.logger.Trace("start cron dritf tasks")
 		// 执行所有偏移检测任务
 		m.beginCronDriftTask()
+		metrics.TaskManagerLoopSeconds.Observe(time.Since(loopStart).Seconds())
 
 		select {
 		case <-ticker.C:
@@ -226,6 +238,9 @@ func (m *TaskManager) beginCronDriftTask() {
 			if err != nil {
 				logger.Errorf("delete expired task and task step failed, error: %v", err)
 			}
+			if err := services.DeleteExpiredEnvDriftRun(m.db, consts.EnvDriftRunKeepDuration); err != nil {
+				logger.Errorf("delete expired env drift run failed, error: %v", err)
+			}
 			_, err = services.CloneNewDriftTask(m.db, *task, env)
 			if err != nil {
 				logger.Errorf("clone drift task error: %v", err) //nolint
@@ -392,20 +407,76 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 			continue
 		}
 
+		if t, ok := task.(*models.Task); ok && m.isHeldByDeployFreeze(t) {
+			continue
+		}
+
 		if err := m.runTask(ctx, task); err != nil {
 			if errors.Is(err, errHasRunningTask) {
 				continue
 			} else {
 				logger.WithField("taskId", task.GetId()).Errorf("run task error: %s", err)
 			}
+		} else {
+			observeTaskQueueWait(task)
 		}
 	}
 }
 
+// observeTaskQueueWait 记录任务从创建到开始执行的等待时长
+func observeTaskQueueWait(task models.Tasker) {
+	var base *models.BaseTask
+	switch t := task.(type) {
+	case *models.Task:
+		base = &t.BaseTask
+	case *models.ScanTask:
+		base = &t.BaseTask
+	default:
+		return
+	}
+	metrics.TaskQueueWaitSeconds.WithLabelValues(base.Type).
+		Observe(time.Since(time.Time(base.CreatedAt)).Seconds())
+}
+
+// taskSpanAttrs 返回任务相关的 span 属性
+func taskSpanAttrs(task models.Tasker) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{tracing.AttrTaskId.String(task.GetId().String())}
+	switch t := task.(type) {
+	case *models.Task:
+		attrs = append(attrs,
+			tracing.AttrOrgId.String(t.OrgId.String()),
+			tracing.AttrProjectId.String(t.ProjectId.String()),
+			tracing.AttrEnvId.String(t.EnvId.String()),
+			tracing.AttrTaskType.String(t.Type))
+	case *models.ScanTask:
+		attrs = append(attrs,
+			tracing.AttrOrgId.String(t.OrgId.String()),
+			tracing.AttrEnvId.String(t.EnvId.String()),
+			tracing.AttrTaskType.String(t.Type))
+	}
+	return attrs
+}
+
 var (
 	errHasRunningTask = errors.New("environment has running task")
 )
 
+// isHeldByDeployFreeze 冻结期内的部署、销毁任务保持 pending 状态，等冻结结束后再执行
+func (m *TaskManager) isHeldByDeployFreeze(task *models.Task) bool {
+	logger := m.logger.WithField("taskId", task.Id)
+	freeze, err := services.GetTaskHoldingDeployFreeze(m.db, task)
+	if err != nil {
+		// 查询失败时不执行任务，下次再检查
+		logger.Errorf("get deploy freeze error: %v", err)
+		return true
+	}
+	if freeze != nil {
+		logger.Debugf("task held by deploy freeze '%s'", freeze.Id)
+		return true
+	}
+	return false
+}
+
 func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 	logger := m.logger.WithField("taskId", task.GetId())
 
@@ -419,7 +490,10 @@ func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 
 	m.wg.Add(1)
 	go func() {
+		dispatched := metrics.RunnerDispatchedTasks.WithLabelValues(task.GetRunnerId())
+		dispatched.Inc()
 		defer func() {
+			dispatched.Dec()
 			if t, ok := task.(*models.Task); ok {
 				m.envRunningTask.Delete(t.EnvId)
 			}
@@ -445,6 +519,8 @@ func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 //nolint:cyclop
 func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startErr error) {
 	logger := m.logger.WithField("taskId", task.Id)
+	ctx, span := tracing.Start(ctx, "taskManager.runTask", taskSpanAttrs(task)...)
+	defer func() { tracing.End(span, startErr) }()
 	scanTask, _ := services.GetMirrorScanTask(m.db, task.Id)
 
 	changeTaskStatus := func(status, message string, skipUpdateEnv bool) error {
@@ -548,6 +624,14 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 					logger.Errorf("read plan output log: %v", err)
 				} else {
 					driftInfo := ParseResourceDriftInfo(bs)
+					if len(driftInfo) > 0 {
+						// 只有被忽略的属性发生漂移时不执行纠偏
+						if resources, err := getTaskDriftResources(m.db, task); err != nil {
+							logger.Warnf("get task drift resources: %v", err)
+						} else {
+							filterIgnoredDrift(driftInfo, resources)
+						}
+					}
 					if len(driftInfo) <= 0 {
 						_ = changeTaskStatus(models.TaskStepComplete, "autoDrift source nothing changed", false)
 						logger.WithField("step", fmt.Sprintf("%d(%s)", step.Index, step.Name)).
@@ -635,6 +719,9 @@ func (m *TaskManager) processStepDone(task *models.Task, step *models.TaskStep)
 	dbSess := m.db
 
 	changePlanResult(dbSess, task, step)
+	if err := planDoneProcessBudget(dbSess, task, step); err != nil {
+		return err
+	}
 
 	processScanResult := func() error {
 		var (
@@ -758,6 +845,13 @@ func (m *TaskManager) processTaskDone(taskId models.Id) { //nolint:cyclop
 		}
 	}
 
+	if lastStep.Status == models.TaskComplete {
+		// 注意：需要在更新环境的 lastResTaskId 之前执行
+		if err := taskDoneProcessRefreshOnly(dbSess, task); err != nil {
+			logger.Errorf("process refresh-only task done: %v", err)
+		}
+	}
+
 	if lastStep.Status == models.TaskComplete && task.IsDriftTask {
 		if err := taskDoneProcessDriftTask(logger, dbSess, task); err != nil {
 			logger.Errorf("process drafit task done: %v", err)
@@ -783,6 +877,12 @@ func (m *TaskManager) processTaskDone(taskId models.Id) { //nolint:cyclop
 				logger.Errorf("process auto destroy: %v", err)
 			}
 		}
+		if err := taskDoneProcessPreviewEnv(dbSess, task); err != nil {
+			logger.Errorf("process preview env: %v", err)
+		}
+		if err := taskDoneProcessStateOp(dbSess, task); err != nil {
+			logger.Errorf("process state op: %v", err)
+		}
 	}
 }
 
@@ -805,6 +905,10 @@ func (m *TaskManager) runTaskStep(
 	task *models.Task,
 	step *models.TaskStep) (err error) {
 
+	ctx, span := tracing.Start(ctx, "taskManager.runTaskStep", append(taskSpanAttrs(task),
+		tracing.AttrStep.Int(step.Index), tracing.AttrStepType.String(step.Type))...)
+	defer func() { tracing.End(span, err) }()
+
 	logger := m.logger.WithField("taskId", taskReq.TaskId)
 	logger = logger.WithField("func", "runTaskStep").
 		WithField("step", fmt.Sprintf("%d(%s)", step.Index, step.Type))
@@ -817,6 +921,15 @@ func (m *TaskManager) runTaskStep(
 		}
 	}()
 
+	if step.Type == common.TaskStepTfApply && !step.MustApproval {
+		// plan 预估费用超出预算时部署步骤需要审批，这里获取步骤的最新配置
+		if newStep, err := services.GetTaskStep(m.db, task.Id, step.Index); err != nil {
+			return err
+		} else {
+			step = newStep
+		}
+	}
+
 	if step.NextStep != "" {
 		if nextStep, err := services.GetTaskStepByStepId(m.db, step.NextStep); err != nil {
 			err = errors.Wrapf(err, "get task step %s", string(step.NextStep))
@@ -875,8 +988,14 @@ func waitTaskStepApprove(ctx context.Context, db *db.Session, task *models.Task,
 	)
 	if step.MustApproval && !step.IsApproved() {
 		logger.Infof("waitting task step approve")
+		if step.ApprovalExpireAt == nil {
+			if er := services.SetTaskStepApprovalExpireAt(db, task, step, time.Now()); er != nil {
+				logger.Errorf("set task step approval expire time error: %v", er)
+				return nil, er
+			}
+		}
 		changeStepStatus(models.TaskStepApproving, "", step)
-		if newStep, err = WaitTaskStepApprove(ctx, db, step.TaskId, step.Index); err != nil {
+		if newStep, err = WaitTaskStepApprove(ctx, db, task, step.Index); err != nil {
 			if errors.Is(err, context.Canceled) {
 				return nil, err
 			}
@@ -925,7 +1044,7 @@ func waitTaskStepDone(
 		case models.TaskStepPending, models.TaskApproving:
 			// 先将步骤置为 running 状态，然后再发起调用，保证步骤不会重复执行
 			changeStepStatus(models.TaskStepRunning, "", step)
-			if cid, retryAble, err := StartTaskStep(taskReq, *step); err != nil {
+			if cid, retryAble, err := StartTaskStep(ctx, taskReq, *step); err != nil {
 				logger.Warnf("start task step %s(%d): %v", step.Type, step.Index, err)
 
 				if e.Is(err, e.TaskAborted) {
@@ -1050,10 +1169,17 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		RepoBranch:      task.Revision,
 		RepoCommitId:    task.CommitId,
 		NetworkMirror:   services.GetRegistryMirrorUrl(dbSess),
+		ModuleRegistry:  services.GetTaskModuleRegistry(task.OrgId, task.TplId, task.EnvId, task.Id, consts.RegistryTokenExpire),
+		ProviderMirror:  services.GetTaskProviderMirror(dbSess, task.OrgId, task.TplId, task.EnvId, task.Id, consts.RegistryTokenExpire),
 		Timeout:         task.StepTimeout,
 		StopOnViolation: task.StopOnViolation,
 		ContainerId:     task.ContainerId,
 		CreatorId:       task.CreatorId.String(),
+		Imports:         task.Imports,
+		ImportMode:      task.ImportMode,
+		StateOps:        task.StateOps,
+		Replaces:        task.Replaces,
+		RefreshOnly:     task.RefreshOnly,
 	}
 
 	if err := runTaskReqAddSysEnvs(taskReq); err != nil {
@@ -1072,6 +1198,11 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		taskReq.PrivateKey = utils.EncodeSecretVar(pk, true)
 	}
 
+	if task.ResumeStep > 0 {
+		// 从失败步骤恢复执行的任务在启动容器时复用源任务的工作目录
+		taskReq.ResumeTaskId = task.SourceTaskId.String()
+	}
+
 	return taskReq, nil
 }
 
@@ -1208,6 +1339,8 @@ func deployOrDestroy(env *models.Env, lg *logrus.Entry, dbSess *db.Session, op s
 //nolint:cyclop
 func (m *TaskManager) doRunScanTask(ctx context.Context, task *models.ScanTask) (startErr error) {
 	logger := m.logger.WithField("taskId", task.Id)
+	ctx, span := tracing.Start(ctx, "taskManager.runScanTask", taskSpanAttrs(task)...)
+	defer func() { tracing.End(span, startErr) }()
 
 	changeTaskStatus := func(status, message string) error {
 		if er := services.ChangeScanTaskStatus(m.db, task, status, "", message); er != nil {
@@ -1370,6 +1503,8 @@ func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.Ta
 		RepoBranch:      task.Revision,
 		RepoCommitId:    task.CommitId,
 		NetworkMirror:   services.GetRegistryMirrorUrl(dbSess),
+		ModuleRegistry:  services.GetTaskModuleRegistry(task.OrgId, task.TplId, task.EnvId, task.Id, consts.RegistryTokenExpire),
+		ProviderMirror:  services.GetTaskProviderMirror(dbSess, task.OrgId, task.TplId, task.EnvId, task.Id, consts.RegistryTokenExpire),
 		StopOnViolation: true,
 		DockerImage:     task.Flow.Image,
 		ContainerId:     task.ContainerId,
@@ -1505,7 +1640,7 @@ func waitScanTaskStepDone(
 			// 先将步骤置为 running 状态，然后再发起调用，保证步骤不会重复执行
 			changeStepStatus(models.TaskStepRunning, "", step)
 			logger.Infof("start task step %d(%s)", step.Index, step.Type)
-			if cid, _, err := StartTaskStep(taskReq, *step); err != nil {
+			if cid, _, err := StartTaskStep(ctx, taskReq, *step); err != nil {
 				logger.Errorf("start task step error: %s", err.Error())
 
 				if e.Is(err, e.TaskAborted) {
@@ -1594,6 +1729,9 @@ func runTaskReqAddSysEnvs(req *runner.RunTaskReq) error {
 		sysEnvs["CLOUDIAC_ENV_STATUS"] = env.Status
 		// 任务启动前的环境资源数量
 		sysEnvs["CLOUDIAC_ENV_RESOURCES"] = fmt.Sprintf("%d", resCount)
+		// 环境标签，JSON 格式，terraform 中可声明 map(string) 类型的 cloudiac_env_tags 变量引用
+		envTags, _ := json.Marshal(models.EnvTagsMap(env.Tags))
+		sysEnvs["CLOUDIAC_ENV_TAGS"] = string(envTags)
 		// 当前任务使用的 terraform 版本号(eg. 0.14.11)
 		sysEnvs["CLOUDIAC_TF_VERSION"] = req.Env.TfVersion
 
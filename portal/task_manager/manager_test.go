@@ -102,3 +102,29 @@ func TestParseResourceDriftInfo(t *testing.T) {
 	}
 
 }
+
+func TestFilterIgnoredDrift(t *testing.T) {
+	driftMap := ParseResourceDriftInfo([]byte(TextCase))
+	resources := models.DriftResourceDiffs{
+		{Address: "random_password.password[0]", Ignored: true},
+		{Address: "random_password.password[1]", Attrs: models.DriftAttrs{
+			{Name: "length", Before: 12, After: 13},
+			{Name: "result", Ignored: true},
+		}},
+		{Address: "random_password.password[9]"},
+	}
+	filterIgnoredDrift(driftMap, resources)
+
+	if _, ok := driftMap["random_password.password[0]"]; ok {
+		t.Error("ignored resource should be removed")
+	}
+	if attrs := driftMap["random_password.password[1]"].Attrs; len(attrs) != 1 || attrs[0].Name != "length" {
+		t.Errorf("unexpected drift attrs: %+v", attrs)
+	}
+	if _, ok := driftMap["random_password.password[2]"]; !ok {
+		t.Error("resource without structured drift info should be kept")
+	}
+	if _, ok := driftMap["random_password.password[9]"]; ok {
+		t.Error("resource not in drift output should not be added")
+	}
+}
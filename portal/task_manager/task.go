@@ -22,13 +22,21 @@ import (
 	"cloudiac/runner"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/tracing"
 )
 
 // StartTaskStep 启动任务的一步
 // 该函数会设置 taskReq 中 step 相关的数据
-func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (
+func StartTaskStep(ctx context.Context, taskReq runner.RunTaskReq, step models.TaskStep) (
 	containerId string, retryAble bool, err error) {
 
+	ctx, span := tracing.Start(ctx, "taskManager.StartTaskStep",
+		tracing.AttrTaskId.String(taskReq.TaskId),
+		tracing.AttrStep.Int(step.Index),
+		tracing.AttrStepType.String(step.Type),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	logger := logs.Get().
 		WithField("action", "StartTaskStep").
 		WithField("taskId", taskReq.TaskId).
@@ -52,7 +60,8 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (
 	taskReq.StepBeforeCmds = step.BeforeCmds
 	taskReq.StepAfterCmds = step.AfterCmds
 
-	respData, err := utils.HttpService(requestUrl, "POST", header, taskReq,
+	// 只传递链路追踪信息，请求的取消仍由超时时间控制
+	respData, err := utils.HttpServiceWithContext(tracing.Detach(ctx), requestUrl, "POST", header, taskReq,
 		int(consts.RunnerConnectTimeout.Seconds()), int(consts.RunnerConnectTimeout.Seconds())*10)
 	if err != nil {
 		return "", true, err
@@ -165,6 +174,18 @@ func saveTaskStepResultFiles(task *models.Task, step *models.TaskStep, result ru
 			logger.WithField("path", path).Errorf("write task provider json error: %v", err)
 		}
 	}
+	if len(result.TfStateBefore) > 0 {
+		path := task.StateSnapshotPath(models.StateSnapshotBefore)
+		if err := logstorage.Get().Write(path, result.TfStateBefore); err != nil {
+			logger.WithField("path", path).Errorf("write task state snapshot error: %v", err)
+		}
+	}
+	if len(result.TfStateAfter) > 0 {
+		path := task.StateSnapshotPath(models.StateSnapshotAfter)
+		if err := logstorage.Get().Write(path, result.TfStateAfter); err != nil {
+			logger.WithField("path", path).Errorf("write task state snapshot error: %v", err)
+		}
+	}
 	if len(result.TfPlanJson) > 0 {
 		path := task.PlanJsonPath()
 		if err := logstorage.Get().Write(path, result.TfPlanJson); err != nil {
@@ -331,9 +352,9 @@ var (
 	ErrTaskStepAborted  = fmt.Errorf("aborted")
 )
 
-// WaitTaskStepApprove
+// WaitTaskStepApprove 等待步骤审批，步骤审批超时后自动驳回
 // TODO: 使用注册通知机制，统一由一个 worker 来加载所有待审批的步骤最新状态，当有步骤审批通过时触发通知
-func WaitTaskStepApprove(ctx context.Context, dbSess *db.Session, taskId models.Id, step int) (
+func WaitTaskStepApprove(ctx context.Context, dbSess *db.Session, task *models.Task, step int) (
 	taskStep *models.TaskStep, err error) {
 
 	ticker := time.NewTicker(consts.DbTaskPollInterval)
@@ -344,11 +365,20 @@ func WaitTaskStepApprove(ctx context.Context, dbSess *db.Session, taskId models.
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		case <-ticker.C:
-			taskStep, err = services.GetTaskStep(dbSess, taskId, step)
+			taskStep, err = services.GetTaskStep(dbSess, task.Id, step)
 			if err != nil {
 				return nil, err
 			}
 
+			if taskStep.Status == models.TaskStepApproving && taskStep.ApprovalExpireAt != nil &&
+				time.Now().After(time.Time(*taskStep.ApprovalExpireAt)) {
+				if err = dbSess.Transaction(func(tx *db.Session) error {
+					return services.ExpireTaskStepApproval(tx, task, taskStep)
+				}); err != nil {
+					return nil, err
+				}
+			}
+
 			if taskStep.Status == models.TaskStepRejected {
 				return nil, ErrTaskStepRejected
 			} else if taskStep.Status == models.TaskStepAborted {
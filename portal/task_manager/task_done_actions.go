@@ -7,6 +7,7 @@ import (
 	"cloudiac/policy"
 	"cloudiac/portal/apps"
 	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
@@ -74,14 +75,16 @@ func taskDoneProcessPlan(dbSess *db.Session, task *models.Task, isPlanResult boo
 
 		var costs []float32
 		var forecastFailed []string
-		if isPlanResult {
+		// refresh-only 任务不会变更资源，不需要计算费用
+		if isPlanResult && !task.RefreshOnly {
 			costs, forecastFailed, err = getForecastCostWhenTaskPlan(dbSess, task, bs)
 			if err != nil {
 				logs.Get().Warnf("get prices after plan error: %v", err)
 			}
 		}
 
-		if err = services.SaveTaskChanges(dbSess, task, tfPlan.ResourceChanges, isPlanResult, costs, forecastFailed); err != nil {
+		changes := tfPlan.GetResourceChanges(task.RefreshOnly)
+		if err = services.SaveTaskChanges(dbSess, task, changes, isPlanResult, costs, forecastFailed); err != nil {
 			return fmt.Errorf("save task changes: %v", err)
 		}
 	}
@@ -175,6 +178,67 @@ func computeResourceCost(resources []*schema.Resource) (float32, []string, error
 	return cost, forecastFailed, nil
 }
 
+// planDoneProcessBudget plan 完成后检查部署预估费用是否超出预算，
+// 超出时根据预算策略要求部署步骤由预算审批人审批，或者将 plan 步骤置为失败并返回错误以中止任务
+func planDoneProcessBudget(dbSess *db.Session, task *models.Task, step *models.TaskStep) error {
+	if step.Type != common.TaskStepTfPlan || step.Status != models.TaskStepComplete ||
+		task.Type != common.TaskTypeApply || task.RefreshOnly {
+		return nil
+	}
+	logger := logs.Get().WithField("taskId", task.Id).WithField("func", "planDoneProcessBudget")
+
+	// 预算检查出错时不影响部署流程
+	usages, er := services.GetTaskExceededBudgets(dbSess, task, time.Now().Format("2006-01"))
+	if er != nil {
+		logger.Errorf("get exceeded budgets: %v", er)
+		return nil
+	}
+	if len(usages) == 0 {
+		return nil
+	}
+
+	message := services.BudgetUsagesMessage(usages)
+	if _, err := dbSess.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("budget_exceeded", true); err != nil {
+		logger.Errorf("update task budget exceeded: %v", err)
+	}
+	task.BudgetExceeded = true
+
+	if services.IsBudgetBlocked(usages) {
+		if err := services.ChangeTaskStepStatus(dbSess, task, step, models.TaskStepFailed, message); err != nil {
+			logger.Errorf("change plan step status: %v", err)
+		}
+		return fmt.Errorf(message)
+	}
+
+	// 部署步骤原本就需要审批时同样生效，审批通过前还需要预算审批人审批
+	logger.Infof("%s, apply must be approved by a budget approver", message)
+	if _, err := dbSess.Model(&models.TaskStep{}).
+		Where("task_id = ? AND type = ?", task.Id, common.TaskStepTfApply).
+		UpdateColumn("must_approval", true); err != nil {
+		logger.Errorf("update apply step must approval: %v", err)
+	}
+	return nil
+}
+
+// taskDoneProcessRefreshOnly refresh-only 部署完成后资源漂移已同步到 state，清除环境当前的漂移记录
+func taskDoneProcessRefreshOnly(dbSess *db.Session, task *models.Task) error {
+	if !task.RefreshOnly || task.Type != common.TaskTypeApply {
+		return nil
+	}
+	env, err := services.GetEnv(dbSess, task.EnvId)
+	if err != nil {
+		return err
+	}
+	if env.LastResTaskId == "" {
+		return nil
+	}
+	if err := services.DeleteEnvResourceDrift(dbSess, env.LastResTaskId); err != nil {
+		return err
+	}
+	return nil
+}
+
 func taskDoneProcessDriftTask(logger logs.Logger, dbSess *db.Session, task *models.Task) error {
 	// 判断是否是偏移检测任务，如果是，解析log文件并写入表
 	step, err := services.GetTaskPlanStep(db.Get(), task.Id)
@@ -192,6 +256,20 @@ func taskDoneProcessDriftTask(logger logs.Logger, dbSess *db.Session, task *mode
 				return err
 			}
 			driftInfoMap := ParseResourceDriftInfo(bs)
+			resources, err := getTaskDriftResources(dbSess, task)
+			if err != nil {
+				logger.Warnf("get task drift resources: %v", err)
+			}
+			filterIgnoredDrift(driftInfoMap, resources)
+			run, err := saveEnvDriftRun(dbSess, task, len(driftInfoMap), resources)
+			if err != nil {
+				logger.Errorf("save env drift run: %v", err)
+			} else if run.Drifted && env.DriftRepairApproval() {
+				if err := createDriftRemediation(dbSess, env, task, run); err != nil {
+					logger.Errorf("create drift remediation: %v", err)
+				}
+			}
+
 			if len(driftInfoMap) == 0 {
 				err = services.DeleteEnvResourceDrift(dbSess, env.LastResTaskId)
 				if err != nil {
@@ -234,6 +312,100 @@ func taskDoneProcessDriftTask(logger logs.Logger, dbSess *db.Session, task *mode
 	return nil
 }
 
+// getTaskDriftResources 解析任务 plan json 中的漂移资源，并根据环境的忽略规则标记被忽略的资源
+func getTaskDriftResources(dbSess *db.Session, task *models.Task) (models.DriftResourceDiffs, error) {
+	bs, err := readIfExist(task.PlanJsonPath())
+	if err != nil {
+		return nil, fmt.Errorf("read plan json: %v", err)
+	} else if len(bs) == 0 {
+		return nil, nil
+	}
+	resources, err := services.BuildDriftResources(bs)
+	if err != nil {
+		return nil, fmt.Errorf("parse plan json: %v", err)
+	}
+
+	env, er := services.GetEnv(dbSess, task.EnvId)
+	if er != nil {
+		return nil, er
+	}
+	rules, er := services.GetEnvDriftIgnoreRules(dbSess, env)
+	if er != nil {
+		return nil, er
+	}
+	services.ApplyDriftIgnoreRules(resources, rules)
+	return resources, nil
+}
+
+// filterIgnoredDrift 移除被忽略的漂移资源，并记录未被忽略的属性漂移信息
+func filterIgnoredDrift(driftInfoMap map[string]models.ResourceDrift, resources models.DriftResourceDiffs) {
+	for _, r := range resources {
+		info, ok := driftInfoMap[r.Address]
+		if !ok {
+			continue
+		}
+		if r.Ignored {
+			delete(driftInfoMap, r.Address)
+			continue
+		}
+		info.Attrs = make(models.DriftAttrs, 0, len(r.Attrs))
+		for _, a := range r.Attrs {
+			if !a.Ignored {
+				info.Attrs = append(info.Attrs, a)
+			}
+		}
+		driftInfoMap[r.Address] = info
+	}
+}
+
+func saveEnvDriftRun(dbSess *db.Session, task *models.Task, driftCount int, resources models.DriftResourceDiffs) (*models.EnvDriftRun, error) {
+	run := models.EnvDriftRun{
+		OrgId:      task.OrgId,
+		ProjectId:  task.ProjectId,
+		EnvId:      task.EnvId,
+		TaskId:     task.Id,
+		Drifted:    driftCount > 0,
+		DriftCount: driftCount,
+		Resources:  resources,
+	}
+	if run.Resources == nil {
+		run.Resources = models.DriftResourceDiffs{}
+	}
+	for _, r := range resources {
+		if r.Ignored {
+			run.IgnoredCount++
+		}
+	}
+	if err := services.CreateEnvDriftRun(dbSess, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// createDriftRemediation 创建待审批的纠偏任务并通知环境负责人
+func createDriftRemediation(dbSess *db.Session, env *models.Env, task *models.Task, run *models.EnvDriftRun) error {
+	var r *models.DriftRemediation
+	err := dbSess.Transaction(func(tx *db.Session) error {
+		var er e.Error
+		if r, er = services.CreateDriftRemediation(tx, env, task, run, time.Now()); er != nil {
+			return er
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	} else if r == nil {
+		// 已有未完成的纠偏任务
+		return nil
+	}
+	repairTask, er := services.GetTaskById(dbSess, r.TaskId)
+	if er != nil {
+		return er
+	}
+	services.SendDriftRemediationMessage(dbSess, env, repairTask, r)
+	return nil
+}
+
 func taskDoneProcessAutoDeploy(dbSess *db.Session, task *models.Task) error {
 	env, err := services.GetEnv(dbSess, task.EnvId)
 	if err != nil {
@@ -288,6 +460,7 @@ func taskDoneProcessAutoDestroy(dbSess *db.Session, task *models.Task) error {
 		// ttl 需要保留，做为重建环境的默认 ttl
 		updateAttrs["AutoDestroyAt"] = nil
 		updateAttrs["AutoDestroyTaskId"] = ""
+		updateAttrs["ExtendCount"] = 0
 	}
 
 	// 如果设置了环境的 ttl/cron，则在部署成功后自动根据 ttl/cron 设置销毁时间。
@@ -324,6 +497,45 @@ func taskDoneProcessAutoDestroy(dbSess *db.Session, task *models.Task) error {
 	return nil
 }
 
+// taskDoneProcessPreviewEnv PR 预览环境的任务结束后将结果写入 PR 评论，销毁成功后归档环境
+func taskDoneProcessPreviewEnv(dbSess *db.Session, task *models.Task) error {
+	env, err := services.GetEnv(dbSess, task.EnvId)
+	if err != nil {
+		return errors.Wrapf(err, "get env '%s'", task.EnvId)
+	}
+	if env.PreviewPrId == 0 {
+		return nil
+	}
+
+	if task.Type == models.TaskTypeDestroy && task.Status == models.TaskComplete {
+		if env, err = services.UpdateEnv(dbSess, env.Id, models.Attrs{"archived": true}); err != nil {
+			return errors.Wrapf(err, "archive env")
+		}
+	}
+	services.SendPreviewEnvComment(dbSess, env, task)
+	return nil
+}
+
+// taskDoneProcessStateOp state 操作任务结束后记录操作结果及快照路径到操作日志
+func taskDoneProcessStateOp(dbSess *db.Session, task *models.Task) error {
+	if task.Type != models.TaskTypeStateOp {
+		return nil
+	}
+	env, err := services.GetEnv(dbSess, task.EnvId)
+	if err != nil {
+		return errors.Wrapf(err, "get env '%s'", task.EnvId)
+	}
+	services.InsertUserOperateLog(task.CreatorId, task.OrgId, env.Id, consts.OperatorObjectTypeEnv, "stateOpDone", env.Name,
+		models.ResAttrs{
+			"taskId":         task.Id,
+			"status":         task.Status,
+			"ops":            task.StateOps,
+			"snapshotBefore": task.StateSnapshotPath(models.StateSnapshotBefore),
+			"snapshotAfter":  task.StateSnapshotPath(models.StateSnapshotAfter),
+		})
+	return nil
+}
+
 func StopTaskContainers(sess *db.Session, taskId, envId models.Id) error {
 	return stopTaskContainers(sess, taskId, envId, false)
 }
@@ -0,0 +1,111 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type ApprovalPolicy struct {
+	ctrl.GinController
+}
+
+// Search 查询审批策略
+// @Tags 审批策略
+// @Summary 查询审批策略
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchApprovalPolicyForm true "parameter"
+// @router /approval_policies [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ApprovalPolicy}}
+func (ApprovalPolicy) Search(c *ctx.GinRequest) {
+	form := &forms.SearchApprovalPolicyForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchApprovalPolicy(c.Service(), form))
+}
+
+// Create 创建审批策略
+// @Tags 审批策略
+// @Summary 创建审批策略
+// @Description 传入 envId 时创建环境级策略，否则创建项目级策略。环境级策略优先于项目级策略生效
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param json body forms.CreateApprovalPolicyForm true "parameter"
+// @router /approval_policies [post]
+// @Success 200 {object} ctx.JSONResult{result=models.ApprovalPolicy}
+func (ApprovalPolicy) Create(c *ctx.GinRequest) {
+	form := &forms.CreateApprovalPolicyForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateApprovalPolicy(c.Service(), form))
+}
+
+// Update 修改审批策略
+// @Tags 审批策略
+// @Summary 修改审批策略
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "策略ID"
+// @Param json body forms.UpdateApprovalPolicyForm true "parameter"
+// @router /approval_policies/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.ApprovalPolicy}
+func (ApprovalPolicy) Update(c *ctx.GinRequest) {
+	form := &forms.UpdateApprovalPolicyForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateApprovalPolicy(c.Service(), form))
+}
+
+// Delete 删除审批策略
+// @Tags 审批策略
+// @Summary 删除审批策略
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "策略ID"
+// @router /approval_policies/{id} [delete]
+// @Success 200
+func (ApprovalPolicy) Delete(c *ctx.GinRequest) {
+	form := &forms.DeleteApprovalPolicyForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteApprovalPolicy(c.Service(), form))
+}
+
+// Detail 审批策略详情
+// @Tags 审批策略
+// @Summary 审批策略详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "策略ID"
+// @router /approval_policies/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.ApprovalPolicy}
+func (ApprovalPolicy) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailApprovalPolicyForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ApprovalPolicyDetail(c.Service(), form))
+}
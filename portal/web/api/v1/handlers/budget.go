@@ -0,0 +1,111 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type Budget struct {
+	ctrl.GinController
+}
+
+// Search 查询费用预算
+// @Tags 费用预算
+// @Summary 查询费用预算
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchBudgetForm true "parameter"
+// @router /budgets [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.Budget}}
+func (Budget) Search(c *ctx.GinRequest) {
+	form := &forms.SearchBudgetForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchBudget(c.Service(), form))
+}
+
+// Create 创建费用预算
+// @Tags 费用预算
+// @Summary 创建费用预算
+// @Description 传入 envId 时创建环境级预算，否则创建项目级预算。部署预估费用加本月已产生费用超出环境或项目预算时，部署需要审批(approval)或被禁止(block)
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param json body forms.CreateBudgetForm true "parameter"
+// @router /budgets [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Budget}
+func (Budget) Create(c *ctx.GinRequest) {
+	form := &forms.CreateBudgetForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateBudget(c.Service(), form))
+}
+
+// Update 修改费用预算
+// @Tags 费用预算
+// @Summary 修改费用预算
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "预算ID"
+// @Param json body forms.UpdateBudgetForm true "parameter"
+// @router /budgets/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.Budget}
+func (Budget) Update(c *ctx.GinRequest) {
+	form := &forms.UpdateBudgetForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateBudget(c.Service(), form))
+}
+
+// Delete 删除费用预算
+// @Tags 费用预算
+// @Summary 删除费用预算
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "预算ID"
+// @router /budgets/{id} [delete]
+// @Success 200
+func (Budget) Delete(c *ctx.GinRequest) {
+	form := &forms.DeleteBudgetForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteBudget(c.Service(), form))
+}
+
+// Detail 费用预算详情
+// @Tags 费用预算
+// @Summary 费用预算详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "预算ID"
+// @router /budgets/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.Budget}
+func (Budget) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailBudgetForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.BudgetDetail(c.Service(), form))
+}
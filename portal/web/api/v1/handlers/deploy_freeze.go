@@ -0,0 +1,112 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type DeployFreeze struct {
+	ctrl.GinController
+}
+
+// Search 查询部署冻结规则
+// @Tags 部署冻结
+// @Summary 查询部署冻结规则
+// @Description 不传项目ID时查询组织级规则，传入项目ID时查询项目及项目下环境的规则
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.SearchDeployFreezeForm true "parameter"
+// @router /deploy_freezes [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.DeployFreeze}}
+func (DeployFreeze) Search(c *ctx.GinRequest) {
+	form := &forms.SearchDeployFreezeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchDeployFreeze(c.Service(), form))
+}
+
+// Create 创建部署冻结规则
+// @Tags 部署冻结
+// @Summary 创建部署冻结规则
+// @Description 不传项目ID时创建组织级规则，传入项目ID时创建项目级规则，同时传入 envId 时创建环境级规则
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param json body forms.CreateDeployFreezeForm true "parameter"
+// @router /deploy_freezes [post]
+// @Success 200 {object} ctx.JSONResult{result=models.DeployFreeze}
+func (DeployFreeze) Create(c *ctx.GinRequest) {
+	form := &forms.CreateDeployFreezeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateDeployFreeze(c.Service(), form))
+}
+
+// Update 修改部署冻结规则
+// @Tags 部署冻结
+// @Summary 修改部署冻结规则
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param id path string true "规则ID"
+// @Param json body forms.UpdateDeployFreezeForm true "parameter"
+// @router /deploy_freezes/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.DeployFreeze}
+func (DeployFreeze) Update(c *ctx.GinRequest) {
+	form := &forms.UpdateDeployFreezeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateDeployFreeze(c.Service(), form))
+}
+
+// Delete 删除部署冻结规则
+// @Tags 部署冻结
+// @Summary 删除部署冻结规则
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param id path string true "规则ID"
+// @router /deploy_freezes/{id} [delete]
+// @Success 200
+func (DeployFreeze) Delete(c *ctx.GinRequest) {
+	form := &forms.DeleteDeployFreezeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteDeployFreeze(c.Service(), form))
+}
+
+// Detail 部署冻结规则详情
+// @Tags 部署冻结
+// @Summary 部署冻结规则详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param id path string true "规则ID"
+// @router /deploy_freezes/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.DeployFreeze}
+func (DeployFreeze) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailDeployFreezeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeployFreezeDetail(c.Service(), form))
+}
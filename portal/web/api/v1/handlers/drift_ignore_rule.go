@@ -0,0 +1,112 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type DriftIgnoreRule struct {
+	ctrl.GinController
+}
+
+// Search 查询漂移忽略规则
+// @Tags 漂移忽略规则
+// @Summary 查询漂移忽略规则
+// @Description 不传项目ID时查询组织级规则，传入项目ID时查询项目及项目下环境的规则
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.SearchDriftIgnoreRuleForm true "parameter"
+// @router /drift_ignore_rules [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.DriftIgnoreRule}}
+func (DriftIgnoreRule) Search(c *ctx.GinRequest) {
+	form := &forms.SearchDriftIgnoreRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchDriftIgnoreRule(c.Service(), form))
+}
+
+// Create 创建漂移忽略规则
+// @Tags 漂移忽略规则
+// @Summary 创建漂移忽略规则
+// @Description 匹配规则的资源或属性发生漂移时不会触发通知和自动纠偏。不传项目ID时创建组织级规则，传入项目ID时创建项目级规则，同时传入 envId 时创建环境级规则
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param json body forms.CreateDriftIgnoreRuleForm true "parameter"
+// @router /drift_ignore_rules [post]
+// @Success 200 {object} ctx.JSONResult{result=models.DriftIgnoreRule}
+func (DriftIgnoreRule) Create(c *ctx.GinRequest) {
+	form := &forms.CreateDriftIgnoreRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateDriftIgnoreRule(c.Service(), form))
+}
+
+// Update 修改漂移忽略规则
+// @Tags 漂移忽略规则
+// @Summary 修改漂移忽略规则
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param id path string true "规则ID"
+// @Param json body forms.UpdateDriftIgnoreRuleForm true "parameter"
+// @router /drift_ignore_rules/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.DriftIgnoreRule}
+func (DriftIgnoreRule) Update(c *ctx.GinRequest) {
+	form := &forms.UpdateDriftIgnoreRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateDriftIgnoreRule(c.Service(), form))
+}
+
+// Delete 删除漂移忽略规则
+// @Tags 漂移忽略规则
+// @Summary 删除漂移忽略规则
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param id path string true "规则ID"
+// @router /drift_ignore_rules/{id} [delete]
+// @Success 200
+func (DriftIgnoreRule) Delete(c *ctx.GinRequest) {
+	form := &forms.DeleteDriftIgnoreRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteDriftIgnoreRule(c.Service(), form))
+}
+
+// Detail 漂移忽略规则详情
+// @Tags 漂移忽略规则
+// @Summary 漂移忽略规则详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param id path string true "规则ID"
+// @router /drift_ignore_rules/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.DriftIgnoreRule}
+func (DriftIgnoreRule) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailDriftIgnoreRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DriftIgnoreRuleDetail(c.Service(), form))
+}
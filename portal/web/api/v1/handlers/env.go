@@ -132,6 +132,89 @@ func (Env) Deploy(c *ctx.GinRequest) {
 	c.JSONResult(apps.EnvDeploy(c.Service(), &form))
 }
 
+// Promote 环境提升/克隆
+// @Tags 环境
+// @Summary 将环境配置复制到其他项目的新环境或已有环境
+// @Description 复制环境的分支、变量、变量组、触发器及合规配置，可锁定到最后一次成功部署的 commit，dryRun 时只返回配置差异
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param data body forms.PromoteEnvForm true "提升参数"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/promote [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.PromoteEnvResp}
+func (Env) Promote(c *ctx.GinRequest) {
+	form := forms.PromoteEnvForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PromoteEnv(c.Service(), &form))
+}
+
+// Import 导入已有云资源
+// @Tags 环境
+// @Summary 将已存在的云资源导入到环境中
+// @Description 创建导入任务，执行 terraform import 或通过 import 块导入资源，环境未开启自动审批时导入步骤需要审批
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param data body forms.ImportEnvForm true "导入参数"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/import [post]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvDetail}
+func (Env) Import(c *ctx.GinRequest) {
+	form := forms.ImportEnvForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvImport(c.Service(), &form))
+}
+
+// StateOps 环境 state 操作
+// @Tags 环境
+// @Summary 执行 state mv/rm、taint/untaint 或 force-unlock 操作
+// @Description 创建 state 操作任务，操作按顺序执行，执行前后会保存 state 快照，环境未开启自动审批时需要审批
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param data body forms.EnvStateOpsForm true "state 操作参数"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/state/ops [post]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvDetail}
+func (Env) StateOps(c *ctx.GinRequest) {
+	form := forms.EnvStateOpsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvStateOps(c.Service(), &form))
+}
+
+// StateSnapshot 环境 state 操作快照
+// @Tags 环境
+// @Summary 获取 state 操作任务执行前或执行后的 state 快照
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.EnvStateSnapshotForm true "parameter"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/state/snapshot [get]
+// @Success 200 {object} ctx.JSONResult
+func (Env) StateSnapshot(c *ctx.GinRequest) {
+	form := forms.EnvStateSnapshotForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvStateSnapshot(c.Service(), &form))
+}
+
 // DeployCheck 环境重新部署检测接口
 // @Tags 环境
 // @Summary 环境重新部署检测
@@ -170,6 +253,8 @@ func (Env) Destroy(c *ctx.GinRequest) {
 		Id:       form.Id,
 		TaskType: models.TaskTypeDestroy,
 		Source:   form.Source,
+
+		FreezeOverrideReason: form.FreezeOverrideReason,
 	}
 	c.JSONResult(apps.EnvDeploy(c.Service(), &deployForm))
 }
@@ -404,6 +489,73 @@ func (Env) EnvStat(c *ctx.GinRequest) {
 	c.JSONResult(apps.EnvStat(c.Service(), &form))
 }
 
+// EnvRollback 环境回滚
+// @Tags 环境
+// @Summary 回滚环境到历史部署
+// @Description 使用历史部署成功任务的 commit、变量、terraform 版本、tfvars/playbook 配置及 targets 创建部署任务，
+// @Description 任务需要审批，可在审批前通过 plan diff 确认与当前状态的差异
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form formData forms.EnvRollbackForm true "parameter"
+// @router /envs/{envId}/rollback [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.TaskDetailResp}
+func EnvRollback(c *ctx.GinRequest) {
+	form := forms.EnvRollbackForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvRollback(c.Service(), &form))
+}
+
+// EnvUpgrade 环境升级
+// @Tags 环境
+// @Summary 升级环境到指定云模板版本
+// @Description 将环境锁定到指定版本并使用版本对应的分支/标签执行 plan，确认变更后通过部署完成升级
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form formData forms.EnvUpgradeForm true "parameter"
+// @router /envs/{envId}/upgrade [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.TaskDetailResp}
+func EnvUpgrade(c *ctx.GinRequest) {
+	form := forms.EnvUpgradeForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvUpgrade(c.Service(), &form))
+}
+
+// EnvExtend 环境延期
+// @Tags 环境
+// @Summary 延长环境的自动销毁时间
+// @Accept multipart/form-data
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form formData forms.EnvExtendForm true "延期参数"
+// @router /envs/{envId}/extend [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func EnvExtend(c *ctx.GinRequest) {
+	form := forms.EnvExtendForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvExtend(c.Service(), &form))
+}
+
 // EnvLock 环境锁定
 // @Tags 环境
 // @Summary 环境锁定
@@ -469,3 +621,102 @@ func EnvUnLockConfirm(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.EnvUnLockConfirm(c.Service(), &form))
 }
+
+// EnvHistory 环境配置变更记录
+// @Tags 环境
+// @Summary 查询环境配置、变量及变量组关联的字段级变更记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.ObjectHistoryForm true "parameter"
+// @router /envs/{envId}/history [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.ChangeHistoryResp}}
+func EnvHistory(c *ctx.GinRequest) {
+	form := forms.ObjectHistoryForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvHistory(c.Service(), &form))
+}
+
+// EnvDriftRunSearch 环境漂移检测历史
+// @Tags 环境
+// @Summary 查询环境的漂移检测历史
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvDriftRunForm true "parameter"
+// @router /envs/{envId}/drifts [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvDriftRun}}
+func EnvDriftRunSearch(c *ctx.GinRequest) {
+	form := forms.SearchEnvDriftRunForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvDriftRun(c.Service(), &form))
+}
+
+// EnvDriftRunDetail 漂移检测记录详情
+// @Tags 环境
+// @Summary 漂移检测记录详情，返回每个漂移资源的属性变更
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param driftId path string true "漂移检测记录ID"
+// @router /envs/{envId}/drifts/{driftId} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvDriftRun}
+func EnvDriftRunDetail(c *ctx.GinRequest) {
+	form := forms.DetailEnvDriftRunForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvDriftRunDetail(c.Service(), &form))
+}
+
+// EnvDriftRemediationSearch 环境漂移纠偏记录
+// @Tags 环境
+// @Summary 查询环境的漂移纠偏记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchDriftRemediationForm true "parameter"
+// @router /envs/{envId}/drift_remediations [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.DriftRemediation}}
+func EnvDriftRemediationSearch(c *ctx.GinRequest) {
+	form := forms.SearchDriftRemediationForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchDriftRemediation(c.Service(), &form))
+}
+
+// EnvDriftRemediationStat 环境漂移纠偏统计
+// @Tags 环境
+// @Summary 环境漂移纠偏统计，包括平均纠偏时间
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/drift_remediations/stat [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.DriftRemediationStatResp}
+func EnvDriftRemediationStat(c *ctx.GinRequest) {
+	form := forms.DriftRemediationStatForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DriftRemediationStat(c.Service(), &form))
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type EnvBatch struct {
+	ctrl.GinController
+}
+
+// Search 查询环境批量操作
+// @Tags 环境批量操作
+// @Summary 查询环境批量操作
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchEnvBatchForm true "parameter"
+// @router /env_batches [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.EnvBatchResp}}
+func (EnvBatch) Search(c *ctx.GinRequest) {
+	form := &forms.SearchEnvBatchForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvBatch(c.Service(), form))
+}
+
+// Create 创建环境批量操作
+// @Tags 环境批量操作
+// @Summary 对筛选出的环境执行部署、plan、销毁、锁定、解锁或归档
+// @Description 部署、plan、销毁任务由后台按 rate(每分钟任务数)逐步创建，锁定、解锁、归档操作直接执行。
+// @Description 当前状态不允许执行该操作的环境会被跳过(skipped)
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param json body forms.CreateEnvBatchForm true "parameter"
+// @router /env_batches [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvBatchDetailResp}
+func (EnvBatch) Create(c *ctx.GinRequest) {
+	form := &forms.CreateEnvBatchForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateEnvBatch(c.Service(), form))
+}
+
+// Detail 环境批量操作详情
+// @Tags 环境批量操作
+// @Summary 环境批量操作详情，包含每个环境的执行状态和子任务
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param batchId path string true "批量操作ID"
+// @router /env_batches/{batchId} [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvBatchDetailResp}
+func (EnvBatch) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailEnvBatchForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvBatchDetail(c.Service(), form))
+}
+
+// Preview 预览环境批量操作
+// @Tags 环境批量操作
+// @Summary 预览批量操作会影响的环境
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param json body forms.PreviewEnvBatchForm true "parameter"
+// @router /env_batches/preview [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvBatchPreviewResp}
+func (EnvBatch) Preview(c *ctx.GinRequest) {
+	form := &forms.PreviewEnvBatchForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PreviewEnvBatch(c.Service(), form))
+}
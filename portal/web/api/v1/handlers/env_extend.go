@@ -0,0 +1,130 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"bytes"
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// envExtendPage 延期链接打开的页面，确认后通过 POST 提交延期请求
+var envExtendPage = template.Must(template.New("envExtend").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>CloudIaC</title>
+</head>
+<body style="font-family: sans-serif; max-width: 560px; margin: 60px auto;">
+{{- if .Error }}
+<p>{{ .Error }}</p>
+{{- else if .Done }}
+<p>环境 <b>{{ .EnvName }}</b> 已延期，新的自动销毁时间为 {{ .DestroyAt }}。</p>
+{{- else }}
+<p>环境 <b>{{ .EnvName }}</b> 将于 {{ .DestroyAt }} 自动销毁。</p>
+<form method="post" action="">
+<input type="hidden" name="token" value="{{ .Token }}">
+<button type="submit">延期 {{ .Duration }}</button>
+</form>
+{{- end }}
+</body>
+</html>
+`))
+
+type envExtendPageData struct {
+	Token     string
+	EnvName   string
+	DestroyAt string
+	Duration  string
+	Done      bool
+	Error     string
+}
+
+func renderEnvExtendPage(c *ctx.GinRequest, data envExtendPageData, er e.Error) {
+	status := http.StatusOK
+	if er != nil {
+		status = er.Status()
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		data.Error = e.ErrorMsg(er, c.GetHeader("accept-language"))
+	}
+	buf := bytes.Buffer{}
+	if err := envExtendPage.Execute(&buf, data); err != nil {
+		c.Logger().Errorf("render env extend page: %v", err)
+		c.Context.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Context.Data(status, "text/html; charset=utf-8", buf.Bytes())
+	c.Abort()
+}
+
+func formatEnvExtendTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// EnvSignedExtendConfirm 延期确认页面
+// @Tags 环境
+// @Summary 打开提醒消息中的延期链接，返回延期确认页面，不修改环境
+// @Produce html
+// @Param token query string true "延期链接携带的 token"
+// @router /env_extend [get]
+// @Success 200 {string} string "延期确认页面"
+func EnvSignedExtendConfirm(c *ctx.GinRequest) {
+	form := forms.EnvSignedExtendForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	info, er := apps.EnvSignedExtendInfo(c.Service(), &form)
+	if er != nil {
+		renderEnvExtendPage(c, envExtendPageData{}, er)
+		return
+	}
+	renderEnvExtendPage(c, envExtendPageData{
+		Token:     form.Token,
+		EnvName:   info.EnvName,
+		DestroyAt: formatEnvExtendTime((*time.Time)(info.DestroyAt)),
+		Duration:  info.Duration,
+	}, nil)
+}
+
+// EnvSignedExtend 通过延期链接延长环境的自动销毁时间
+// @Tags 环境
+// @Summary 确认后通过签名 token 延长环境的自动销毁时间
+// @Description 请求接受 text/html 时返回结果页面，否则返回 json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "延期链接携带的 token"
+// @router /env_extend [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func EnvSignedExtend(c *ctx.GinRequest) {
+	form := forms.EnvSignedExtendForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	env, er := apps.EnvSignedExtend(c.Service(), &form)
+	if c.Context.NegotiateFormat(binding.MIMEJSON, binding.MIMEHTML) != binding.MIMEHTML {
+		c.JSONResult(env, er)
+		return
+	}
+	if er != nil {
+		renderEnvExtendPage(c, envExtendPageData{}, er)
+		return
+	}
+	renderEnvExtendPage(c, envExtendPageData{
+		EnvName:   env.Name,
+		DestroyAt: formatEnvExtendTime((*time.Time)(env.AutoDestroyAt)),
+		Done:      true,
+	}, nil)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type EnvTagSchema struct {
+	ctrl.GinController
+}
+
+// Search 查询组织环境标签规范
+// @Tags 环境标签
+// @Summary 查询组织环境标签规范
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchEnvTagSchemaForm true "parameter"
+// @router /env_tag_schemas [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvTagSchema}}
+func (EnvTagSchema) Search(c *ctx.GinRequest) {
+	form := &forms.SearchEnvTagSchemaForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvTagSchema(c.Service(), form))
+}
+
+// Create 创建环境标签规范
+// @Tags 环境标签
+// @Summary 创建环境标签规范
+// @Description 规范创建后，创建环境或修改环境标签时需要满足必填及取值范围的约束
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.CreateEnvTagSchemaForm true "parameter"
+// @router /env_tag_schemas [post]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvTagSchema}
+func (EnvTagSchema) Create(c *ctx.GinRequest) {
+	form := &forms.CreateEnvTagSchemaForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateEnvTagSchema(c.Service(), form))
+}
+
+// Update 修改环境标签规范
+// @Tags 环境标签
+// @Summary 修改环境标签规范
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "规范ID"
+// @Param json body forms.UpdateEnvTagSchemaForm true "parameter"
+// @router /env_tag_schemas/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvTagSchema}
+func (EnvTagSchema) Update(c *ctx.GinRequest) {
+	form := &forms.UpdateEnvTagSchemaForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateEnvTagSchema(c.Service(), form))
+}
+
+// Delete 删除环境标签规范
+// @Tags 环境标签
+// @Summary 删除环境标签规范
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "规范ID"
+// @router /env_tag_schemas/{id} [delete]
+// @Success 200
+func (EnvTagSchema) Delete(c *ctx.GinRequest) {
+	form := &forms.DeleteEnvTagSchemaForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteEnvTagSchema(c.Service(), form))
+}
+
+// Detail 环境标签规范详情
+// @Tags 环境标签
+// @Summary 环境标签规范详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "规范ID"
+// @router /env_tag_schemas/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvTagSchema}
+func (EnvTagSchema) Detail(c *ctx.GinRequest) {
+	form := &forms.DetailEnvTagSchemaForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvTagSchemaDetail(c.Service(), form))
+}
@@ -328,3 +328,22 @@ func (Organization) OrgProjectsStat(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.OrgProjectsStat(c.Service(), &form))
 }
+
+// OrgTagCostStat 按环境标签统计费用
+// @Tags 组织
+// @Summary 按环境标签统计费用
+// @Description 按指定标签的值对账单月内环境的费用进行分组汇总，未设置该标签的环境汇总到 value 为空的分组
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.OrgTagCostStatForm true "parameter"
+// @router /orgs/projects/cost/tags [get]
+// @Success 200 {object} ctx.JSONResult{result=[]resps.TagCostStatResp}
+func (Organization) OrgTagCostStat(c *ctx.GinRequest) {
+	form := forms.OrgTagCostStatForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.OrgTagCostStat(c.Service(), &form))
+}
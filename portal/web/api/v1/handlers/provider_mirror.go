@@ -0,0 +1,119 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"net/http"
+	"strings"
+)
+
+// ProviderMirrorSearch provider mirror 安装包列表
+// @Tags Provider Mirror
+// @Summary 查询 provider mirror 中的安装包
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param form query forms.SearchProviderMirrorForm true "parameter"
+// @router /provider_mirrors [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ProviderMirrorPackage}}
+func ProviderMirrorSearch(c *ctx.GinRequest) {
+	form := forms.SearchProviderMirrorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchProviderMirror(c.Service(), &form))
+}
+
+// ProviderMirrorUpload 上传 provider 安装包
+// @Tags Provider Mirror
+// @Summary 上传 provider 安装包
+// @Description 安装包文件名为 terraform-provider-<type>_<version>_<os>_<arch>.zip 时可以省略 type、version、os 和 arch 参数
+// @Accept multipart/form-data
+// @Produce json
+// @Security AuthToken
+// @Param form formData forms.UploadProviderMirrorForm true "parameter"
+// @Param file formData file true "provider 安装包(zip 格式)"
+// @router /provider_mirrors [post]
+// @Success 200 {object} ctx.JSONResult{result=models.ProviderMirrorPackage}
+func ProviderMirrorUpload(c *ctx.GinRequest) {
+	form := forms.UploadProviderMirrorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UploadProviderMirror(c.Service(), &form))
+}
+
+// ProviderMirrorSync 从 registry 同步 provider
+// @Tags Provider Mirror
+// @Summary 从 registry 同步 provider 安装包
+// @Description 同步在后台执行，可以通过安装包列表查询同步状态
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param form formData forms.SyncProviderMirrorForm true "parameter"
+// @router /provider_mirrors/sync [post]
+// @Success 200 {object} ctx.JSONResult{result=[]models.ProviderMirrorPackage}
+func ProviderMirrorSync(c *ctx.GinRequest) {
+	form := forms.SyncProviderMirrorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SyncProviderMirror(c.Service(), &form))
+}
+
+// ProviderMirrorDelete 删除 provider 安装包
+// @Tags Provider Mirror
+// @Summary 删除 provider 安装包
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param packageId path string true "安装包ID"
+// @router /provider_mirrors/{packageId} [delete]
+// @Success 200 {object} ctx.JSONResult
+func ProviderMirrorDelete(c *ctx.GinRequest) {
+	form := forms.DeleteProviderMirrorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteProviderMirror(c.Service(), &form))
+}
+
+// ProviderMirrorProtocol terraform provider network mirror 协议
+// file 为 index.json 时返回可用版本，为 <version>.json 时返回各平台的安装包，其他情况下载安装包
+func ProviderMirrorProtocol(c *ctx.GinRequest) {
+	form := forms.ProviderMirrorProtocolForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+
+	switch {
+	case form.File == "index.json":
+		result, err := apps.ProviderMirrorVersions(c.Service(), &form)
+		if err != nil {
+			registryProtocolError(c, err)
+			return
+		}
+		c.Context.JSON(http.StatusOK, result)
+	case strings.HasSuffix(form.File, ".json"):
+		result, err := apps.ProviderMirrorArchives(c.Service(), &form, strings.TrimSuffix(form.File, ".json"))
+		if err != nil {
+			registryProtocolError(c, err)
+			return
+		}
+		c.Context.JSON(http.StatusOK, result)
+	case strings.HasSuffix(form.File, ".zip"):
+		path, err := apps.ProviderMirrorPackageFile(c.Service(), &form)
+		if err != nil {
+			registryProtocolError(c, err)
+			return
+		}
+		c.Context.File(path)
+	default:
+		registryProtocolError(c, e.New(e.ObjectNotExists, http.StatusNotFound))
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegistryModuleSearch 私有模块列表
+// @Tags 私有模块
+// @Summary 查询组织的私有模块列表
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchRegistryModuleForm true "parameter"
+// @router /registry_modules [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.RegistryModuleResp}}
+func RegistryModuleSearch(c *ctx.GinRequest) {
+	form := forms.SearchRegistryModuleForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRegistryModule(c.Service(), &form))
+}
+
+// RegistryModuleCreate 创建私有模块
+// @Tags 私有模块
+// @Summary 创建私有模块
+// @Description 创建后会将代码仓库中 semver 格式的 tag 发布为模块版本
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form formData forms.CreateRegistryModuleForm true "parameter"
+// @router /registry_modules [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.RegistryModuleResp}
+func RegistryModuleCreate(c *ctx.GinRequest) {
+	form := forms.CreateRegistryModuleForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateRegistryModule(c.Service(), &form))
+}
+
+// RegistryModuleDetail 私有模块详情
+// @Tags 私有模块
+// @Summary 私有模块详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param moduleId path string true "模块ID"
+// @router /registry_modules/{moduleId} [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.RegistryModuleResp}
+func RegistryModuleDetail(c *ctx.GinRequest) {
+	form := forms.DetailRegistryModuleForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RegistryModuleDetail(c.Service(), &form))
+}
+
+// RegistryModuleUpdate 修改私有模块
+// @Tags 私有模块
+// @Summary 修改私有模块
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param moduleId path string true "模块ID"
+// @Param form formData forms.UpdateRegistryModuleForm true "parameter"
+// @router /registry_modules/{moduleId} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.RegistryModule}
+func RegistryModuleUpdate(c *ctx.GinRequest) {
+	form := forms.UpdateRegistryModuleForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateRegistryModule(c.Service(), &form))
+}
+
+// RegistryModuleDelete 删除私有模块
+// @Tags 私有模块
+// @Summary 删除私有模块
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param moduleId path string true "模块ID"
+// @router /registry_modules/{moduleId} [delete]
+// @Success 200 {object} ctx.JSONResult
+func RegistryModuleDelete(c *ctx.GinRequest) {
+	form := forms.DeleteRegistryModuleForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteRegistryModule(c.Service(), &form))
+}
+
+// RegistryModuleSync 同步私有模块版本
+// @Tags 私有模块
+// @Summary 将代码仓库中新增的 semver 格式 tag 发布为模块版本
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param moduleId path string true "模块ID"
+// @router /registry_modules/{moduleId}/sync [post]
+// @Success 200 {object} ctx.JSONResult{result=[]models.RegistryModuleVersion}
+func RegistryModuleSync(c *ctx.GinRequest) {
+	form := forms.SyncRegistryModuleForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SyncRegistryModule(c.Service(), &form))
+}
+
+// RegistryModuleUsageSearch 私有模块使用记录
+// @Tags 私有模块
+// @Summary 查询使用私有模块的云模板及版本
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param moduleId path string true "模块ID"
+// @Param form query forms.SearchRegistryModuleUsageForm true "parameter"
+// @router /registry_modules/{moduleId}/usages [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.RegistryModuleUsageResp}}
+func RegistryModuleUsageSearch(c *ctx.GinRequest) {
+	form := forms.SearchRegistryModuleUsageForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRegistryModuleUsage(c.Service(), &form))
+}
+
+// registryProtocolError 按 registry 协议的格式返回错误
+func registryProtocolError(c *ctx.GinRequest, err e.Error) {
+	status := err.Status()
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	c.Logger().Infof("registry protocol error: %v", err)
+	c.Context.AbortWithStatusJSON(status, gin.H{"errors": []string{e.ErrorMsg(err, c.GetHeader("accept-language"))}})
+}
+
+// RegistryDiscovery terraform registry 服务发现，路由为 /.well-known/terraform.json
+func RegistryDiscovery(c *ctx.GinRequest) {
+	c.Context.JSON(http.StatusOK, gin.H{"modules.v1": consts.RegistryModulesUri})
+}
+
+// RegistryProtocolList terraform registry 模块列表，每个模块返回最新版本
+func RegistryProtocolList(c *ctx.GinRequest) {
+	form := forms.RegistryProtocolListForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	result, err := apps.RegistryProtocolList(c.Service(), &form)
+	if err != nil {
+		registryProtocolError(c, err)
+		return
+	}
+	c.Context.JSON(http.StatusOK, result)
+}
+
+// RegistryProtocolModule terraform registry 模块版本列表及下载
+// action 为 versions 时返回版本列表，为 {version}/download 时在 X-Terraform-Get 头中返回下载地址，
+// 为 download 时重定向到最新版本的下载地址
+func RegistryProtocolModule(c *ctx.GinRequest) {
+	form := forms.RegistryProtocolModuleForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+
+	action := strings.Trim(form.Action, "/")
+	switch {
+	case action == "versions":
+		result, err := apps.RegistryProtocolVersions(c.Service(), &form)
+		if err != nil {
+			registryProtocolError(c, err)
+			return
+		}
+		c.Context.JSON(http.StatusOK, result)
+	case action == "download":
+		version, err := apps.RegistryProtocolLatestVersion(c.Service(), &form)
+		if err != nil {
+			registryProtocolError(c, err)
+			return
+		}
+		c.Context.Redirect(http.StatusFound, version+"/download")
+	case strings.HasSuffix(action, "/download") && strings.Count(action, "/") == 1:
+		var claims *services.RegistryClaims
+		if v, ok := c.Get(consts.CtxKeyRegistryClaims); ok {
+			claims, _ = v.(*services.RegistryClaims)
+		}
+		version := strings.TrimSuffix(action, "/download")
+		source, err := apps.RegistryProtocolDownload(c.Service(), &form, version, claims)
+		if err != nil {
+			registryProtocolError(c, err)
+			return
+		}
+		c.Header("X-Terraform-Get", source)
+		c.Context.Status(http.StatusNoContent)
+	default:
+		registryProtocolError(c, e.New(e.ObjectNotExists, http.StatusNotFound))
+	}
+}
+
+// RegistryModuleArchive 下载模块版本的 tar.gz 包，通过下载链接中的 token 认证
+func RegistryModuleArchive(c *ctx.GinRequest) {
+	form := forms.RegistryModuleArchiveForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+
+	// 先写入临时文件，避免打包失败时已经返回了部分内容
+	f, err := os.CreateTemp("", "registry-module-*.tar.gz")
+	if err != nil {
+		registryProtocolError(c, e.New(e.IOError, err))
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if er := apps.RegistryModuleArchive(c.Service(), &form, f); er != nil {
+		registryProtocolError(c, er)
+		return
+	}
+	c.Context.Header("Content-Type", "application/gzip")
+	c.Context.File(f.Name())
+}
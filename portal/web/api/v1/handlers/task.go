@@ -120,6 +120,72 @@ func (Task) TaskApprove(c *ctx.GinRequest) {
 	c.JSONResult(apps.ApproveTask(c.Service(), form))
 }
 
+// TaskRerun 重新执行任务
+// @Tags 环境
+// @Summary 重新执行任务
+// @Description 复制源任务的变量、commit、targets、terraform 版本及部署通道创建新任务，
+// @Description resume 为 true 时从源任务失败的步骤恢复执行
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "任务ID"
+// @Param form formData forms.RerunTaskForm true "parameter"
+// @router /tasks/{id}/rerun [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.TaskDetailResp}
+func (Task) TaskRerun(c *ctx.GinRequest) {
+	form := &forms.RerunTaskForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RerunTask(c.Service(), form))
+}
+
+// PlanDiff 执行计划的资源变更详情
+// @Tags 环境
+// @Summary 执行计划的资源变更详情
+// @Description 按资源地址返回变更前后的属性值，敏感属性值会被隐藏，modules 为按模块分组的变更统计
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "任务ID"
+// @Param form query forms.TaskPlanDiffForm true "parameter"
+// @router /tasks/{id}/plan/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.PlanDiffResp}
+func (Task) PlanDiff(c *ctx.GinRequest) {
+	form := &forms.TaskPlanDiffForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TaskPlanDiff(c.Service(), form))
+}
+
+// VariablesDiff 任务变量对比
+// @Tags 环境
+// @Summary 对比任务与基准任务生效的变量
+// @Description 返回有差异的变量及其来源(scope、变量组、修改人)，敏感变量只返回是否修改；
+// @Description fields 为代码版本、tfvars 文件、terraform 版本等执行参数的差异
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "任务ID"
+// @Param form query forms.TaskVariablesDiffForm true "parameter"
+// @router /tasks/{id}/variables/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.TaskVariablesDiffResp}
+func (Task) VariablesDiff(c *ctx.GinRequest) {
+	form := &forms.TaskVariablesDiffForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TaskVariablesDiff(c.Service(), form))
+}
+
 // TaskAbort 中止任务
 // @Tags 环境
 // @Summary 中止部署任务
@@ -155,6 +155,43 @@ func TemplateVariableSearch(c *ctx.GinRequest) {
 	c.JSONResult(apps.VcsVariableSearch(c.Service(), &form))
 }
 
+// TemplateVariableSchemaSearch 查询代码仓库中的 terraform 变量定义
+// @Tags 云模板
+// @Summary 解析代码仓库中的 terraform 变量定义(类型、默认值、描述、sensitive、validation)并生成 JSON Schema
+// @Accept application/x-www-form-urlencoded
+// @Param IaC-Org-Id header string true "组织ID"
+// @Security AuthToken
+// @Param form query forms.TemplateVariableSearchForm true "parameter"
+// @Param vcsId path string true "vcs地址iD"
+// @Router /vcs/{vcsId}/repos/variables/schema [get]
+// @Success 200 {object} ctx.JSONResult{result=services.TfVariableSchemaResult}
+func TemplateVariableSchemaSearch(c *ctx.GinRequest) {
+	form := forms.TemplateVariableSearchForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.VcsVariableSchema(c.Service(), &form))
+}
+
+// TemplateVariableSchema 查询云模板的 terraform 变量定义
+// @Tags 云模板
+// @Summary 解析云模板代码中的 terraform 变量定义并生成 JSON Schema
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param form query forms.TemplateVariableSchemaForm true "parameter"
+// @router /templates/{templateId}/variables/schema [get]
+// @Success 200 {object} ctx.JSONResult{result=services.TfVariableSchemaResult}
+func TemplateVariableSchema(c *ctx.GinRequest) {
+	form := forms.TemplateVariableSchemaForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateVariableSchema(c.Service(), &form))
+}
+
 // TemplatePlaybookSearch
 // @Tags 云模板
 // @Summary  playbook列表接口
@@ -286,3 +323,22 @@ func TemplateImport(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.TemplateImport(c.Service(), &form))
 }
+
+// TemplateHistory 云模板配置变更记录
+// @Tags 云模板
+// @Summary 查询云模板配置、变量及变量组关联的字段级变更记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param form query forms.ObjectHistoryForm true "parameter"
+// @router /templates/{templateId}/history [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.ChangeHistoryResp}}
+func TemplateHistory(c *ctx.GinRequest) {
+	form := forms.ObjectHistoryForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateHistory(c.Service(), &form))
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// TemplateVersionSearch 云模板版本列表
+// @Tags 云模板
+// @Summary 查询云模板版本列表，按版本号从高到低排序
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @router /templates/{templateId}/versions [get]
+// @Success 200 {object} ctx.JSONResult{result=[]models.TemplateVersion}
+func TemplateVersionSearch(c *ctx.GinRequest) {
+	form := forms.SearchTemplateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTemplateVersion(c.Service(), &form))
+}
+
+// TemplateVersionCreate 发布云模板版本
+// @Tags 云模板
+// @Summary 发布云模板版本
+// @Description 版本号需符合 semver 格式，revision 为空时使用版本号作为分支/标签
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param form formData forms.CreateTemplateVersionForm true "parameter"
+// @router /templates/{templateId}/versions [post]
+// @Success 200 {object} ctx.JSONResult{result=models.TemplateVersion}
+func TemplateVersionCreate(c *ctx.GinRequest) {
+	form := forms.CreateTemplateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateTemplateVersion(c.Service(), &form))
+}
+
+// TemplateVersionUpdate 修改云模板版本
+// @Tags 云模板
+// @Summary 修改云模板版本的变更说明
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param versionId path string true "版本ID"
+// @Param form formData forms.UpdateTemplateVersionForm true "parameter"
+// @router /templates/{templateId}/versions/{versionId} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.TemplateVersion}
+func TemplateVersionUpdate(c *ctx.GinRequest) {
+	form := forms.UpdateTemplateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateTemplateVersion(c.Service(), &form))
+}
+
+// TemplateVersionDelete 删除云模板版本
+// @Tags 云模板
+// @Summary 删除云模板版本
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param versionId path string true "版本ID"
+// @router /templates/{templateId}/versions/{versionId} [delete]
+// @Success 200 {object} ctx.JSONResult
+func TemplateVersionDelete(c *ctx.GinRequest) {
+	form := forms.DeleteTemplateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteTemplateVersion(c.Service(), &form))
+}
+
+// TemplateVersionSync 同步云模板版本
+// @Tags 云模板
+// @Summary 将代码仓库中 semver 格式的 tag 同步为云模板版本
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @router /templates/{templateId}/versions/sync [post]
+// @Success 200 {object} ctx.JSONResult{result=[]models.TemplateVersion}
+func TemplateVersionSync(c *ctx.GinRequest) {
+	form := forms.SyncTemplateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SyncTemplateVersion(c.Service(), &form))
+}
+
+// TemplateOutdatedEnvs 版本落后的环境
+// @Tags 云模板
+// @Summary 查询锁定的云模板版本落后于最新版本的环境
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @router /templates/{templateId}/outdated_envs [get]
+// @Success 200 {object} ctx.JSONResult{result=[]resps.OutdatedEnvResp}
+func TemplateOutdatedEnvs(c *ctx.GinRequest) {
+	form := forms.TemplateOutdatedEnvsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateOutdatedEnvs(c.Service(), &form))
+}
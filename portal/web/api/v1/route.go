@@ -4,6 +4,7 @@ package v1
 
 import (
 	"cloudiac/common"
+	"cloudiac/portal/consts"
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/web/api/v1/handlers"
 	"cloudiac/portal/web/middleware"
@@ -61,6 +62,10 @@ func Register(g *gin.RouterGroup) {
 
 	g.GET("/system_config/switches", w(handlers.SystemSwitchesStatus))
 
+	// 环境自动销毁提醒中的延期链接，打开确认页面，确认后 POST 执行延期，通过签名 token 鉴权
+	g.GET("/env_extend", w(handlers.EnvSignedExtendConfirm))
+	g.POST("/env_extend", w(handlers.EnvSignedExtend))
+
 	// Authorization Header 鉴权
 	g.Use(w(middleware.Auth)) // 解析 header token
 
@@ -184,6 +189,8 @@ func Register(g *gin.RouterGroup) {
 
 	// 组织概览统计数据
 	g.GET("/orgs/projects/statistics", ac(), w(handlers.Organization{}.OrgProjectsStat))
+	// 按环境标签统计费用
+	g.GET("/orgs/projects/cost/tags", ac(), w(handlers.Organization{}.OrgTagCostStat))
 
 	// 组织用户管理
 	g.GET("/orgs/:id/users", ac("orgs", "listuser"), w(handlers.Organization{}.SearchUser))
@@ -247,17 +254,50 @@ func Register(g *gin.RouterGroup) {
 	// 云模板
 	ctrl.Register(g.Group("templates", ac()), &handlers.Template{})
 	g.GET("/vcs/:id/repos/variables", ac(), w(handlers.TemplateVariableSearch))
+	g.GET("/vcs/:id/repos/variables/schema", ac(), w(handlers.TemplateVariableSchemaSearch))
 	g.GET("/templates/tfversions", ac(), w(handlers.TemplateTfVersionSearch))
 	g.GET("/templates/autotfversion", ac(), w(handlers.AutoTemplateTfVersionChoice))
 	g.POST("/templates/checks", ac(), w(handlers.TemplateChecks))
 	g.GET("/templates/export", ac(), w(handlers.TemplateExport))
 	g.POST("/templates/import", ac(), w(handlers.TemplateImport))
+	g.GET("/templates/:id/history", ac(), w(handlers.TemplateHistory))
+	g.GET("/templates/:id/variables/schema", ac(), w(handlers.TemplateVariableSchema))
+	g.GET("/templates/:id/versions", ac(), w(handlers.TemplateVersionSearch))
+	g.POST("/templates/:id/versions", ac(), w(handlers.TemplateVersionCreate))
+	g.POST("/templates/:id/versions/sync", ac(), w(handlers.TemplateVersionSync))
+	g.PUT("/templates/:id/versions/:versionId", ac(), w(handlers.TemplateVersionUpdate))
+	g.DELETE("/templates/:id/versions/:versionId", ac(), w(handlers.TemplateVersionDelete))
+	g.GET("/templates/:id/outdated_envs", ac(), w(handlers.TemplateOutdatedEnvs))
 	g.GET("/vcs/:id/repos/tfvars", ac(), w(handlers.TemplateTfvarsSearch))
 	g.GET("/vcs/:id/repos/playbook", ac(), w(handlers.TemplatePlaybookSearch))
 	g.GET("/vcs/:id/repos/url", ac(), w(handlers.Vcs{}.GetFileFullPath))
 	g.GET("/vcs/:id/file", ac(), w(handlers.Vcs{}.GetVcsRepoFileContent))
 	ctrl.Register(g.Group("notifications", ac()), &handlers.Notification{})
 
+	// 部署冻结规则(组织级规则不需要项目ID)
+	ctrl.Register(g.Group("deploy_freezes", ac()), &handlers.DeployFreeze{})
+
+	// provider mirror
+	g.GET("/provider_mirrors", ac(), w(handlers.ProviderMirrorSearch))
+	g.POST("/provider_mirrors", ac(), w(handlers.ProviderMirrorUpload))
+	g.POST("/provider_mirrors/sync", ac(), w(handlers.ProviderMirrorSync))
+	g.DELETE("/provider_mirrors/:id", ac(), w(handlers.ProviderMirrorDelete))
+
+	// 私有模块 registry
+	g.GET("/registry_modules", ac(), w(handlers.RegistryModuleSearch))
+	g.POST("/registry_modules", ac(), w(handlers.RegistryModuleCreate))
+	g.GET("/registry_modules/:id", ac(), w(handlers.RegistryModuleDetail))
+	g.PUT("/registry_modules/:id", ac(), w(handlers.RegistryModuleUpdate))
+	g.DELETE("/registry_modules/:id", ac(), w(handlers.RegistryModuleDelete))
+	g.POST("/registry_modules/:id/sync", ac(), w(handlers.RegistryModuleSync))
+	g.GET("/registry_modules/:id/usages", ac(), w(handlers.RegistryModuleUsageSearch))
+
+	// 漂移忽略规则(组织级规则不需要项目ID)
+	ctrl.Register(g.Group("drift_ignore_rules", ac()), &handlers.DriftIgnoreRule{})
+
+	// 环境标签规范
+	ctrl.Register(g.Group("env_tag_schemas", ac()), &handlers.EnvTagSchema{})
+
 	// 任务实时日志（云模板检测无项目ID）
 	g.GET("/tasks/:id/log/sse", ac(), w(handlers.Task{}.FollowLogSse))
 
@@ -277,6 +317,17 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/envs/:id/tasks/last", ac(), w(handlers.Env{}.LastTask))
 	g.POST("/envs/:id/deploy", ac("envs", "deploy"), w(handlers.Env{}.Deploy))
 	g.POST("/envs/:id/deploy/check", ac("envs", "deploy"), w(handlers.Env{}.DeployCheck))
+	g.POST("/envs/:id/promote", ac("envs", "promote"), w(handlers.Env{}.Promote))
+	g.POST("/envs/:id/rollback", ac("envs", "deploy"), w(handlers.EnvRollback))
+	g.POST("/envs/:id/upgrade", ac("envs", "deploy"), w(handlers.EnvUpgrade))
+	g.GET("/envs/:id/history", ac(), w(handlers.EnvHistory))
+	g.GET("/envs/:id/drifts", ac(), w(handlers.EnvDriftRunSearch))
+	g.GET("/envs/:id/drifts/:driftId", ac(), w(handlers.EnvDriftRunDetail))
+	g.GET("/envs/:id/drift_remediations", ac(), w(handlers.EnvDriftRemediationSearch))
+	g.GET("/envs/:id/drift_remediations/stat", ac(), w(handlers.EnvDriftRemediationStat))
+	g.POST("/envs/:id/import", ac("envs", "deploy"), w(handlers.Env{}.Import))
+	g.POST("/envs/:id/state/ops", ac("envs", "stateOps"), w(handlers.Env{}.StateOps))
+	g.GET("/envs/:id/state/snapshot", ac("envs", "stateOps"), w(handlers.Env{}.StateSnapshot))
 	g.POST("/envs/:id/destroy", ac("envs", "destroy"), w(handlers.Env{}.Destroy))
 	g.POST("/envs/:id/tags", ac("envs", "tags"), w(handlers.Env{}.UpdateTags))
 	g.GET("/envs/:id/resources", ac(), w(handlers.Env{}.SearchResources))
@@ -288,8 +339,19 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/envs/:id/resources/graph/:resourceId", ac(), w(handlers.Env{}.ResourceGraphDetail))
 	g.POST("/envs/:id/lock", ac("envs", "lock"), w(handlers.EnvLock))
 	g.POST("/envs/:id/unlock", ac("envs", "unlock"), w(handlers.EnvUnLock))
+	g.POST("/envs/:id/extend", ac("envs", "update"), w(handlers.EnvExtend))
 	g.GET("/envs/:id/unlock/confirm", ac(), w(handlers.EnvUnLockConfirm))
 
+	// 审批策略
+	ctrl.Register(g.Group("approval_policies", ac()), &handlers.ApprovalPolicy{})
+
+	// 费用预算
+	ctrl.Register(g.Group("budgets", ac()), &handlers.Budget{})
+
+	// 环境批量操作
+	ctrl.Register(g.Group("env_batches", ac()), &handlers.EnvBatch{})
+	g.POST("/env_batches/preview", ac("env_batches", "read"), w(handlers.EnvBatch{}.Preview))
+
 	// 环境概览统计数据
 	g.GET("/envs/:id/statistics", ac(), w(handlers.Env{}.EnvStat))
 
@@ -299,8 +361,11 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/tasks/:id/log", ac(), w(handlers.Task{}.Log))
 	g.GET("/tasks/:id/output", ac(), w(handlers.Task{}.Output))
 	g.GET("/tasks/:id/resources", ac(), w(handlers.Task{}.Resource))
+	g.GET("/tasks/:id/plan/diff", ac(), w(handlers.Task{}.PlanDiff))
+	g.GET("/tasks/:id/variables/diff", ac(), w(handlers.Task{}.VariablesDiff))
 	g.POST("/tasks/:id/abort", ac("tasks", "abort"), w(handlers.Task{}.TaskAbort))
 	g.POST("/tasks/:id/approve", ac("tasks", "approve"), w(handlers.Task{}.TaskApprove))
+	g.POST("/tasks/:id/rerun", ac("tasks", "rerun"), w(handlers.Task{}.TaskRerun))
 	g.POST("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Create))
 	g.GET("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Search))
 	g.GET("/tasks/:id/steps", ac(), w(handlers.Task{}.SearchTaskStep))
@@ -312,3 +377,20 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/vcs/webhook", ac(), w(handlers.Token{}.VcsWebhookUrl))
 	ctrl.Register(g.Group("resource/account", ac()), &handlers.ResourceAccount{})
 }
+
+// RegisterRegistry 注册 terraform module registry 及 provider network mirror 协议的路由，协议要求路由位于根路径下
+func RegisterRegistry(e *gin.Engine) {
+	w := ctrl.WrapHandler
+
+	e.GET("/.well-known/terraform.json", w(handlers.RegistryDiscovery))
+
+	g := e.Group(consts.RegistryModulesUri, w(middleware.AuthRegistry))
+	g.GET("", w(handlers.RegistryProtocolList))
+	g.GET("/:namespace", w(handlers.RegistryProtocolList))
+	g.GET("/:namespace/:name/:provider/*action", w(handlers.RegistryProtocolModule))
+	// 模块下载链接自带 token，terraform 下载模块时不会携带 registry 的认证信息
+	e.GET(consts.RegistryArchiveUri+":token/module.tar.gz", w(handlers.RegistryModuleArchive))
+
+	mirror := e.Group(consts.RegistryMirrorUri, w(middleware.AuthRegistry))
+	mirror.GET("/:hostname/:namespace/:type/:file", w(handlers.ProviderMirrorProtocol))
+}
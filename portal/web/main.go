@@ -10,10 +10,13 @@ import (
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/libs/validate"
+	"cloudiac/portal/services"
 	api_v1 "cloudiac/portal/web/api/v1"
 	"cloudiac/portal/web/middleware"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
+	"cloudiac/utils/tracing"
 	"io"
 
 	"github.com/gin-gonic/gin"
@@ -36,6 +39,7 @@ func GetRouter() *gin.Engine {
 	e.Use(w(middleware.Cors))
 	e.Use(w(middleware.Operation))
 	e.GET("/swagger/*any", gs.WrapHandler(swaggerFiles.Handler))
+	e.Use(tracing.GinMiddleware(common.IacPortalServiceName))
 
 	e.GET("/system/info", w(func(c *ctx.GinRequest) {
 		c.JSONSuccess(gin.H{
@@ -45,6 +49,7 @@ func GetRouter() *gin.Engine {
 	}))
 	validate.RegisterValida()
 	api_v1.Register(e.Group("/api/v1"))
+	api_v1.RegisterRegistry(e)
 
 	// 直接提供静态文件访问，生产环境部署时也可以使用 nginx 反代
 	e.StaticFS(consts.ReposUrlPrefix, gin.Dir(consts.LocalGitReposPath, true))
@@ -54,6 +59,10 @@ func GetRouter() *gin.Engine {
 func StartServer() {
 	conf := configs.Get()
 	utils.SetGinMode()
+	metrics.MustRegisterPortal(services.NewTaskMetricsCollector())
+	if conf.Portal.MetricsListen != "" {
+		go startMetricsServer(conf.Portal.MetricsListen)
+	}
 	e := GetRouter()
 	logger.Infof("starting server on %v", conf.Listen)
 	// API 接口总是使用 http 协议，ssl 证书由 nginx 管理
@@ -61,3 +70,10 @@ func StartServer() {
 		logger.Fatalln(err)
 	}
 }
+
+func startMetricsServer(listen string) {
+	logger.Infof("starting metrics server on %v", listen)
+	if err := metrics.ListenAndServe(listen); err != nil {
+		logger.Fatalln(err)
+	}
+}
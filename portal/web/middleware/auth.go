@@ -11,7 +11,9 @@ import (
 	"cloudiac/portal/services"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
 
@@ -151,3 +153,30 @@ func AuthApiToken(c *ctx.GinRequest) {
 		return
 	}
 }
+
+// AuthRegistry 私有 registry 认证，支持任务生成的 registry token 和组织的 api token
+func AuthRegistry(c *ctx.GinRequest) {
+	tokenStr := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer"))
+	if tokenStr == "" {
+		registryUnauthorized(c, "missing token")
+		return
+	}
+
+	if claims, err := services.VerifyRegistryToken(tokenStr); err == nil {
+		c.Service().OrgId = claims.OrgId
+		c.Set(consts.CtxKeyRegistryClaims, claims)
+	} else if apiToken, err := services.GetApiTokenByToken(c.Service().DB(), tokenStr); err == nil && apiToken.OrgId != "" {
+		c.Service().OrgId = apiToken.OrgId
+	} else {
+		registryUnauthorized(c, "invalid token")
+		return
+	}
+	c.Service().UserId = consts.SysUserId
+	c.Service().Username = consts.DefaultSysName
+	c.Service().UserIpAddr = c.ClientIP()
+}
+
+// registryUnauthorized 按 registry 协议的格式返回认证错误
+func registryUnauthorized(c *ctx.GinRequest, msg string) {
+	c.Context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": []string{msg}})
+}
@@ -10,6 +10,8 @@ import (
 	"io/ioutil"
 	"regexp"
 	"time"
+
+	"github.com/gin-gonic/gin/binding"
 )
 
 type HandleTableAndDesc map[string]string
@@ -66,13 +68,20 @@ func Operation(c *ctx.GinRequest) {
 	opMethod := &OperationMethod{C: c}
 	var opLog *models.OperationLog
 
-	bodyBytes, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		c.Logger().Warnf("operation log read body err %v", err)
-		return
+	var (
+		bodyBytes []byte
+		err       error
+	)
+	// 文件上传请求的 body 可能很大，不记录请求内容
+	if c.ContentType() != binding.MIMEMultipartPOSTForm {
+		bodyBytes, err = ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Logger().Warnf("operation log read body err %v", err)
+			return
+		}
+		// 恢复原始的 body
+		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 	}
-	// 恢复原始的 body
-	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	// 执行其他中间件以及api路由
 	c.Next()
@@ -3,6 +3,7 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
@@ -10,6 +11,8 @@ import (
 
 	"cloudiac/runner"
 	"cloudiac/runner/api/ctx"
+	"cloudiac/utils/metrics"
+	"cloudiac/utils/tracing"
 )
 
 func RunTask(c *ctx.Context) {
@@ -24,8 +27,10 @@ func RunTask(c *ctx.Context) {
 		return
 	}
 
-	task := runner.NewTask(req, c.Logger)
-	if cid, err := task.Run(); err != nil {
+	task := runner.NewTask(c.Request.Context(), req, c.Logger)
+	cid, err := task.Run()
+	metrics.RunnerStepRequests.WithLabelValues(metrics.Result(err)).Inc()
+	if err != nil {
 		if errors.Is(err, runner.ErrTaskAborted) {
 			c.Result(gin.H{"aborted": true})
 		} else {
@@ -33,10 +38,27 @@ func RunTask(c *ctx.Context) {
 		}
 		return
 	} else {
+		go watchRunningStep(req)
 		c.Result(gin.H{"containerId": cid})
 	}
 }
 
+// watchRunningStep 等待步骤执行结束，用于统计 runner 当前正在执行的步骤数量
+func watchRunningStep(req runner.RunTaskReq) {
+	logger := logger.WithField("taskId", req.TaskId).WithField("step", req.Step)
+	task, err := runner.LoadStartedTask(req.Env.Id, req.TaskId, req.Step)
+	if err != nil {
+		logger.Warnf("load started task error: %v", err)
+		return
+	}
+
+	metrics.RunnerRunningSteps.Inc()
+	defer metrics.RunnerRunningSteps.Dec()
+	if _, err := task.Wait(context.Background()); err != nil {
+		logger.Debugf("wait step error: %v", err)
+	}
+}
+
 func StopTask(c *ctx.Context) {
 	req := runner.TaskStopReq{}
 	if err := c.BindJSON(&req); err != nil {
@@ -48,7 +70,11 @@ func StopTask(c *ctx.Context) {
 		_ = runner.CleanTaskWorkDirCode(req.EnvId, req.TaskId)
 	}()
 
-	if err := runner.KillContainers(c, req.ContainerIds...); err != nil {
+	_, span := tracing.Start(c.Request.Context(), "runner.killContainers",
+		tracing.AttrEnvId.String(req.EnvId), tracing.AttrTaskId.String(req.TaskId))
+	err := runner.KillContainers(c, req.ContainerIds...)
+	tracing.End(span, err)
+	if err != nil {
 		c.Error(err, http.StatusInternalServerError)
 		return
 	}
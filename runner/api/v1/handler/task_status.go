@@ -162,6 +162,17 @@ func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog
 			msg.TFProviderSchemaJson = providerJson
 		}
 
+		if before, err := runner.FetchJson(task.EnvId, task.TaskId, runner.TFStateBeforeFile); err != nil {
+			logger.Errorf("fetch terraform state snapshot error: %v", err)
+		} else {
+			msg.TfStateBefore = before
+		}
+		if after, err := runner.FetchJson(task.EnvId, task.TaskId, runner.TFStateAfterFile); err != nil {
+			logger.Errorf("fetch terraform state snapshot error: %v", err)
+		} else {
+			msg.TfStateAfter = after
+		}
+
 		if planJson, err := runner.FetchPlanJson(task.EnvId, task.TaskId); err != nil {
 			logger.Errorf("fetch terraform state json error: %v", err)
 		} else {
@@ -45,12 +45,18 @@ const (
 	CloudIacPlayVars = "_cloudiac_play_vars.yml"
 	CloudIacTfvarsJson = "_cloudiac.tfvars.json"
 
+	CloudIacImportTfJson = "_cloudiac_import.tf.json" // 导入任务生成的 import 块
+	CloudIacGeneratedTf  = "_cloudiac_generated.tf"   // 导入任务通过 -generate-config-out 生成的资源配置
+
 	CloudIacAnsibleRequirements = "requirements.yml"
 
 	TFStateJsonFile  = "tfstate.json"
 	TFPlanJsonFile   = "tfplan.json"
 	TFProviderSchema = "tfproviderschema.json"
 
+	TFStateBeforeFile = "tfstate.before" // state 操作前通过 state pull 保存的快照
+	TFStateAfterFile  = "tfstate.after"  // state 操作后通过 state pull 保存的快照
+
 	AnsibleStateAnalysisName = "terraform.py"
 
 	FollowLogDelay = time.Second // follow 文件时读到 EOF 后进行下次读取的等待时长
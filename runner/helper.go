@@ -9,6 +9,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -92,6 +93,62 @@ func GetTaskDirName(step int) string {
 	return fmt.Sprintf("step%d", step)
 }
 
+// copyTaskWorkspace 复制源任务的工作目录，用于从失败步骤恢复执行。
+// 任务控制文件及 resumeStep 及之后步骤的目录不复制
+func copyTaskWorkspace(src, dst string, resumeStep int) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == TaskControlFileName {
+			return nil
+		}
+		if info.IsDir() && rel != "." && filepath.Dir(rel) == "." {
+			var step int
+			if n, _ := fmt.Sscanf(rel, "step%d", &step); n == 1 && step >= resumeStep {
+				return filepath.SkipDir
+			}
+		}
+
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 func FetchTaskLog(envId string, taskId string, step int) ([]byte, error) {
 	path := filepath.Join(GetTaskDir(envId, taskId, step), TaskLogName)
 	return ioutil.ReadFile(path)
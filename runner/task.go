@@ -9,6 +9,9 @@ import (
 	"cloudiac/portal/consts"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/metrics"
+	"cloudiac/utils/tracing"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -17,25 +20,43 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v2"
 )
 
 type Task struct {
+	ctx    context.Context // 用于传递链路追踪信息
 	req    RunTaskReq
 	logger logs.Logger
 	// config    configs.RunnerConfig
 	workspace string
 }
 
-func NewTask(req RunTaskReq, logger logs.Logger) *Task {
+func NewTask(ctx context.Context, req RunTaskReq, logger logs.Logger) *Task {
 	return &Task{
+		ctx:    ctx,
 		req:    req,
 		logger: logger,
 		// config: configs.Get().Runner,
 	}
 }
 
+// startSpan 创建当前任务步骤的子 span
+func (t *Task) startSpan(name string, attrs ...attribute.KeyValue) (context.Context, func(err error)) {
+	if t.ctx == nil {
+		t.ctx = context.Background()
+	}
+	ctx, span := tracing.Start(t.ctx, name, append([]attribute.KeyValue{
+		tracing.AttrEnvId.String(t.req.Env.Id),
+		tracing.AttrTaskId.String(t.req.TaskId),
+		tracing.AttrStep.Int(t.req.Step),
+		tracing.AttrStepType.String(t.req.StepType),
+	}, attrs...)...)
+	return ctx, func(err error) { tracing.End(span, err) }
+}
+
 func CleanTaskWorkDirCode(envId, taskId string) error {
 	logger.Debugf("CleanTaskWorkDirCode params: envId=%s, taskId=%s", envId, taskId)
 	workspace := GetTaskWorkspace(envId, taskId)
@@ -52,6 +73,10 @@ func CleanTaskWorkDirCode(envId, taskId string) error {
 }
 
 func (t *Task) Run() (cid string, err error) {
+	ctx, end := t.startSpan("runner.runTaskStep")
+	defer func() { end(err) }()
+	t.ctx = ctx
+
 	if t.req.ContainerId == "" {
 		cid, err = t.start()
 		if err != nil {
@@ -83,7 +108,9 @@ func (t *Task) start() (cid string, err error) {
 		}
 	}
 
+	_, endInitSpan := t.startSpan("runner.initWorkspace")
 	t.workspace, err = t.initWorkspace()
+	endInitSpan(err)
 	if err != nil {
 		return "", errors.Wrap(err, "initial workspace")
 	}
@@ -128,7 +155,11 @@ func (t *Task) start() (cid string, err error) {
 	}
 
 	t.logger.Infof("start task step, %s", stepDir)
-	if cid, err = cmd.Start(); err != nil {
+	_, endStartSpan := t.startSpan("runner.startContainer", attribute.String("container.image", cmd.Image))
+	cid, err = cmd.Start()
+	endStartSpan(err)
+	if err != nil {
+		metrics.RunnerContainerStartFailures.Inc()
 		return cid, err
 	}
 
@@ -172,6 +203,9 @@ func (t *Task) generateCommand(cmd string) []string {
 }
 
 func (t *Task) runStep() (err error) {
+	_, end := t.startSpan("runner.execStep", attribute.String("container.id", t.req.ContainerId))
+	defer func() { end(err) }()
+
 	_, err = t.genStepScript()
 	if err != nil {
 		return errors.Wrap(err, "generate step script")
@@ -258,7 +292,9 @@ func (t *Task) initWorkspace() (workspace string, err error) {
 	}
 
 	workspace = GetTaskWorkspace(t.req.Env.Id, t.req.TaskId)
-	if t.req.Step != 0 {
+	// 从失败步骤恢复执行时，首次启动容器需要先复制源任务的工作目录
+	resume := t.req.ResumeTaskId != "" && t.req.ContainerId == ""
+	if t.req.Step != 0 && !resume {
 		return workspace, nil
 	}
 
@@ -266,6 +302,18 @@ func (t *Task) initWorkspace() (workspace string, err error) {
 		return workspace, err
 	}
 
+	if resume {
+		srcWorkspace := GetTaskWorkspace(t.req.Env.Id, t.req.ResumeTaskId)
+		if exists, err := PathExists(srcWorkspace); err != nil {
+			return workspace, err
+		} else if !exists {
+			return workspace, fmt.Errorf("workspace of task %s is not available", t.req.ResumeTaskId)
+		}
+		if err = copyTaskWorkspace(srcWorkspace, workspace, t.req.Step); err != nil {
+			return workspace, errors.Wrap(err, "copy workspace")
+		}
+	}
+
 	privateKeyPath := filepath.Join(workspace, "ssh_key")
 	keyContent := fmt.Sprintf("%s\n", strings.TrimSpace(t.req.PrivateKey))
 	if err = os.WriteFile(privateKeyPath, []byte(keyContent), 0600); err != nil {
@@ -287,6 +335,9 @@ func (t *Task) initWorkspace() (workspace string, err error) {
 	if err = t.genTerraformrcFile(workspace); err != nil {
 		return workspace, errors.Wrap(err, "generate terraformrc file")
 	}
+	if err = t.genImportTfJsonFile(workspace); err != nil {
+		return workspace, errors.Wrap(err, "generate import tf json file")
+	}
 
 	return workspace, nil
 }
@@ -412,6 +463,41 @@ func (t *Task) genTfvarsJsonFile(workspace string) error {
 	return enc.Encode(vars)
 }
 
+// escapeTfTemplate 转义 terraform 字符串模板中的插值符号，保证 id 按原样传入
+func escapeTfTemplate(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+// genImportTfJsonFile 以 block 方式导入资源时生成 import 块文件(json 格式，避免处理 hcl 转义)
+func (t *Task) genImportTfJsonFile(workspace string) error {
+	if t.req.ImportMode != common.TaskImportModeBlock || len(t.req.Imports) == 0 {
+		return nil
+	}
+
+	blocks := make([]map[string]string, 0, len(t.req.Imports))
+	for _, i := range t.req.Imports {
+		blocks = append(blocks, map[string]string{
+			"to": i.Address,
+			"id": escapeTfTemplate(i.Id),
+		})
+	}
+
+	fp, err := os.OpenFile(
+		filepath.Join(workspace, CloudIacImportTfJson),
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		0644) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"import": blocks})
+}
+
 /*
     network mirror 段添加了 exclude = ["registry.terraform.io/idcos/*"]，
 	因为 idcos 这个命名空间是我们之前特殊处理的，在 registry.terraform.io 上不存在（即使存在也不属于我们管理），
@@ -422,18 +508,37 @@ var terraformrcTpl = template.Must(template.New("").Parse(`provider_installation
     path = "/cloudiac/terraform/plugins"
   }
 
+  {{ with .ProviderMirror }}
+  network_mirror {
+    url = "{{.Url}}"
+    include = [{{ range $i, $p := .Providers }}{{ if $i }}, {{ end }}"{{ $p }}"{{ end }}]
+  }
+  {{ end }}
+
   {{ if .NetworkMirrorUrl }}
   network_mirror {
     url = "{{.NetworkMirrorUrl}}"
     include = ["registry.terraform.io/*/*"]
-    exclude = ["registry.terraform.io/idcos/*"]
+    exclude = ["registry.terraform.io/idcos/*"{{ range .MirrorProviders }}, "{{ . }}"{{ end }}]
   }
   {{ end }}
 
   direct {
-    exclude = ["{{ .DirectExclude }}"]
+    exclude = ["{{ .DirectExclude }}"{{ range .MirrorProviders }}, "{{ . }}"{{ end }}]
   }
-}`))
+}
+{{ with .ModuleRegistry }}
+host "{{.Host}}" {
+  services = {
+    "modules.v1" = "{{.ModulesUrl}}"
+  }
+}
+{{ end }}
+{{ with .Credentials }}
+credentials "{{.Host}}" {
+  token = "{{.Token}}"
+}
+{{ end }}`))
 
 func (t *Task) genTerraformrcFile(workspace string) error {
 	path := filepath.Join(workspace, TerraformrcFileName)
@@ -447,9 +552,31 @@ func (t *Task) genTerraformrcFile(workspace string) error {
 		directExclude = "registry.terraform.io/*/*"
 	}
 
+	// portal provider mirror 中已有的 provider 只从 portal 安装
+	var (
+		providerMirror  *TaskProviderMirror
+		mirrorProviders []string
+	)
+	if t.req.ProviderMirror != nil && len(t.req.ProviderMirror.Providers) > 0 {
+		providerMirror = t.req.ProviderMirror
+		mirrorProviders = providerMirror.Providers
+	}
+
+	// module registry 和 provider mirror 都由 portal 提供，使用同一个凭证
+	var credentials map[string]string
+	if r := t.req.ModuleRegistry; r != nil {
+		credentials = map[string]string{"Host": r.Host, "Token": r.Token}
+	} else if providerMirror != nil && providerMirror.Host != "" {
+		credentials = map[string]string{"Host": providerMirror.Host, "Token": providerMirror.Token}
+	}
+
 	return execTpl2File(terraformrcTpl, map[string]interface{}{
 		"NetworkMirrorUrl": t.req.NetworkMirror,
 		"DirectExclude":    directExclude,
+		"ModuleRegistry":   t.req.ModuleRegistry,
+		"ProviderMirror":   providerMirror,
+		"MirrorProviders":  mirrorProviders,
+		"Credentials":      credentials,
 	}, path)
 }
 
@@ -506,6 +633,10 @@ func (t *Task) genStepScript() (string, error) {
 		command, err = t.stepApply()
 	case common.TaskStepTfDestroy:
 		command, err = t.stepDestroy()
+	case common.TaskStepTfImport:
+		command, err = t.stepImport()
+	case common.TaskStepTfStateOp:
+		command, err = t.stepStateOp()
 	case common.TaskStepAnsiblePlay:
 		command, err = t.stepPlay()
 	case common.TaskStepCommand:
@@ -579,9 +710,11 @@ clone_result=$?
 
 mkdir -p code && cd code
 # clone success
+# commit 不在克隆的分支上时(如 fork 仓库的 PR)单独拉取该 commit
 if [ $clone_result -eq 0 ]; then
 	echo 'checkout {{.Req.RepoCommitId}}.' && \
-	git checkout -q '{{.Req.RepoCommitId}}'
+	{ git checkout -q '{{.Req.RepoCommitId}}' 2>/dev/null || \
+		{ git fetch -q origin '{{.Req.RepoCommitId}}' && git checkout -q '{{.Req.RepoCommitId}}'; }; }
 fi
 
 # create workdir in spite of clone was failed or not
@@ -652,6 +785,7 @@ cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 terraform plan -input=false -out=_cloudiac.tfplan \
 {{if .TfVars}}-var-file={{.TfVars}} {{end}}-var-file={{.IacTfVars}} \
+{{if .Req.RefreshOnly}}-refresh-only {{end}}{{ range $addr := .Replaces }}-replace={{$addr}} {{ end }}\
 {{ range $arg := .Req.StepArgs }}{{$arg}} {{ end }}&& \
 terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}} {{- if .After}} && \
 {{.After}}{{- end}}
@@ -659,8 +793,13 @@ terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}} {{- if
 
 func (t *Task) stepPlan() (command string, err error) {
 	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
+	replaces := make([]string, 0, len(t.req.Replaces))
+	for _, addr := range t.req.Replaces {
+		replaces = append(replaces, shellescape.Quote(addr))
+	}
 	return t.executeTpl(planCommandTpl, map[string]interface{}{
 		"Req":                t.req,
+		"Replaces":           replaces,
 		"TfVars":             t.req.Env.TfVarsFile,
 		"IacTfVars":          t.up2Workspace(CloudIacTfvarsJson),
 		"TFPlanJsonFilePath": t.up2Workspace(TFPlanJsonFile),
@@ -714,6 +853,146 @@ func (t *Task) stepDestroy() (command string, err error) {
 	})
 }
 
+// block 方式导入时 plan 会同时为缺少配置的资源生成 tf 代码，执行完成后输出生成的代码以便用户提交到代码库
+var importCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{if .Before}}{{.Before}} && \{{- end}}
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{- if .Block }}
+cp -f {{.ImportTfJson}} {{.ImportTfJsonName}} && rm -f {{.GeneratedTf}} && \
+terraform plan -input=false -out=_cloudiac.tfplan -generate-config-out={{.GeneratedTf}} \
+{{if .TfVars}}-var-file={{.TfVars}} {{end}}-var-file={{.IacTfVars}} \
+{{ range $arg := .Args }}{{$arg}} {{ end }}&& \
+terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}} && \
+terraform apply -input=false -auto-approve _cloudiac.tfplan && \
+if [ -f {{.GeneratedTf}} ]; then echo "# {{.GeneratedTf}}"; cat {{.GeneratedTf}}; fi
+{{- else }}
+{{- range $cmd := .Commands }}
+{{$cmd}} && \
+{{- end }}
+echo "import finished"
+{{- end }} {{- if .After}} && \
+{{.After}}{{- end}}
+`))
+
+func (t *Task) stepImport() (command string, err error) {
+	if len(t.req.Imports) == 0 {
+		return "", fmt.Errorf("no resources to import")
+	}
+
+	varFiles := make([]string, 0)
+	if t.req.Env.TfVarsFile != "" {
+		varFiles = append(varFiles, fmt.Sprintf("-var-file=%s", t.req.Env.TfVarsFile))
+	}
+	varFiles = append(varFiles, fmt.Sprintf("-var-file=%s", t.up2Workspace(CloudIacTfvarsJson)))
+
+	block := t.req.ImportMode == common.TaskImportModeBlock
+	args := append([]string{}, t.req.StepArgs...)
+	commands := make([]string, 0, len(t.req.Imports))
+	for _, i := range t.req.Imports {
+		if block {
+			// 只 apply 导入的资源，避免同时变更环境中的其他资源
+			args = append(args, fmt.Sprintf("-target=%s", shellescape.Quote(i.Address)))
+			continue
+		}
+		cmdArgs := append([]string{"terraform", "import", "-input=false"}, varFiles...)
+		cmdArgs = append(cmdArgs, t.req.StepArgs...)
+		cmdArgs = append(cmdArgs, shellescape.Quote(i.Address), shellescape.Quote(i.Id))
+		commands = append(commands, strings.Join(cmdArgs, " "))
+	}
+
+	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
+	return t.executeTpl(importCommandTpl, map[string]interface{}{
+		"Req":                t.req,
+		"Block":              block,
+		"Args":               args,
+		"Commands":           commands,
+		"TfVars":             t.req.Env.TfVarsFile,
+		"IacTfVars":          t.up2Workspace(CloudIacTfvarsJson),
+		"ImportTfJson":       t.up2Workspace(CloudIacImportTfJson),
+		"ImportTfJsonName":   CloudIacImportTfJson,
+		"GeneratedTf":        CloudIacGeneratedTf,
+		"TFPlanJsonFilePath": t.up2Workspace(TFPlanJsonFile),
+		"Before":             beforeCmds,
+		"After":              afterCmds,
+		"ContainerWorkspace": ContainerWorkspace,
+	})
+}
+
+// 操作前后分别通过 state pull 保存 state 快照，操作失败时也会保存操作后的快照
+var stateOpCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{if .Before}}{{.Before}} && \{{- end}}
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+terraform state pull >{{.StateBefore}} && \
+{{- range $cmd := .Commands }}
+{{$cmd}} && \
+{{- end }}
+echo "state operations finished" {{- if .After}} && \
+{{.After}}{{- end}}
+
+result=$?
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+terraform state pull >{{.StateAfter}}
+exit $result
+`))
+
+// stateOpCommand 生成 state 操作对应的 terraform 命令
+func stateOpCommand(op TaskStateOp, args []string) (string, error) {
+	var cmdArgs []string
+	switch op.Action {
+	case common.StateOpMv:
+		cmdArgs = []string{"terraform", "state", "mv"}
+	case common.StateOpRm:
+		cmdArgs = []string{"terraform", "state", "rm"}
+	case common.StateOpTaint:
+		cmdArgs = []string{"terraform", "taint"}
+	case common.StateOpUntaint:
+		cmdArgs = []string{"terraform", "untaint"}
+	case common.StateOpForceUnlock:
+		cmdArgs = []string{"terraform", "force-unlock", "-force"}
+	default:
+		return "", fmt.Errorf("unknown state operation '%s'", op.Action)
+	}
+	cmdArgs = append(cmdArgs, args...)
+
+	switch op.Action {
+	case common.StateOpMv:
+		cmdArgs = append(cmdArgs, shellescape.Quote(op.Address), shellescape.Quote(op.Destination))
+	case common.StateOpForceUnlock:
+		cmdArgs = append(cmdArgs, shellescape.Quote(op.LockId))
+	default:
+		cmdArgs = append(cmdArgs, shellescape.Quote(op.Address))
+	}
+	return strings.Join(cmdArgs, " "), nil
+}
+
+func (t *Task) stepStateOp() (command string, err error) {
+	if len(t.req.StateOps) == 0 {
+		return "", fmt.Errorf("no state operations")
+	}
+
+	commands := make([]string, 0, len(t.req.StateOps))
+	for _, op := range t.req.StateOps {
+		cmd, err := stateOpCommand(op, t.req.StepArgs)
+		if err != nil {
+			return "", err
+		}
+		commands = append(commands, cmd)
+	}
+
+	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
+	return t.executeTpl(stateOpCommandTpl, map[string]interface{}{
+		"Req":                t.req,
+		"Commands":           commands,
+		"StateBefore":        t.up2Workspace(TFStateBeforeFile),
+		"StateAfter":         t.up2Workspace(TFStateAfterFile),
+		"Before":             beforeCmds,
+		"After":              afterCmds,
+		"ContainerWorkspace": ContainerWorkspace,
+	})
+}
+
 // CLOUDIAC_WORKDIR 环境变量在 task_manager 中会自动设置
 var playCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 export CLOUDIAC_ANSIBLE_INVENTORY={{.AnsibleStateAnalysis}}
@@ -812,7 +1091,8 @@ var scanInitCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 if [[ ! -e code ]]; then git clone '{{.Req.RepoAddress}}' code || exit $?; fi && \
 cd code && \
 echo 'checkout {{.Req.RepoCommitId}}.' && \
-git checkout -q '{{.Req.RepoCommitId}}' && \
+{ git checkout -q '{{.Req.RepoCommitId}}' 2>/dev/null || \
+	{ git fetch -q origin '{{.Req.RepoCommitId}}' && git checkout -q '{{.Req.RepoCommitId}}'; }; } && \
 cd '{{.Req.Env.Workdir}}'
 `))
 
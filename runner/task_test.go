@@ -146,9 +146,252 @@ func TestGenTerraformrcFile(t *testing.T) {
 	}
 }
 
+func TestGenTerraformrcFileWithModuleRegistry(t *testing.T) {
+	configs.Set(&configs.Config{})
+
+	task := Task{
+		req: RunTaskReq{
+			ModuleRegistry: &TaskModuleRegistry{
+				Host:       "iac.example.org",
+				ModulesUrl: "https://iac.example.org/v1/modules/",
+				Token:      "token",
+			},
+		},
+		logger: logs.Get(),
+	}
+
+	dir := t.TempDir()
+	if err := task.genTerraformrcFile(dir); err != nil {
+		t.Fatalf("genTerraformrcFile error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, TerraformrcFileName))
+	if err != nil {
+		t.Fatalf("readfile error: %v", err)
+	}
+
+	assert.Contains(t, removeSpace(string(content)), removeSpace(`host "iac.example.org" {
+  services = {
+    "modules.v1" = "https://iac.example.org/v1/modules/"
+  }
+}
+
+credentials "iac.example.org" {
+  token = "token"
+}`))
+}
+
+func TestGenTerraformrcFileWithProviderMirror(t *testing.T) {
+	configs.Set(&configs.Config{})
+
+	task := Task{
+		req: RunTaskReq{
+			NetworkMirror: "https://registry.example.org/v1/mirrors/providers/",
+			ProviderMirror: &TaskProviderMirror{
+				Host:      "iac.example.org",
+				Url:       "https://iac.example.org/v1/mirrors/providers/",
+				Token:     "mirror-token",
+				Providers: []string{"registry.terraform.io/hashicorp/random", "registry.example.org/corp/internal"},
+			},
+		},
+		logger: logs.Get(),
+	}
+
+	dir := t.TempDir()
+	if err := task.genTerraformrcFile(dir); err != nil {
+		t.Fatalf("genTerraformrcFile error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, TerraformrcFileName))
+	if err != nil {
+		t.Fatalf("readfile error: %v", err)
+	}
+
+	assert.Equal(t, removeSpace(`provider_installation {
+  filesystem_mirror {
+    path = "/cloudiac/terraform/plugins"
+  }
+
+  network_mirror {
+    url = "https://iac.example.org/v1/mirrors/providers/"
+    include = ["registry.terraform.io/hashicorp/random", "registry.example.org/corp/internal"]
+  }
+
+  network_mirror {
+    url = "https://registry.example.org/v1/mirrors/providers/"
+    include = ["registry.terraform.io/*/*"]
+    exclude = ["registry.terraform.io/idcos/*", "registry.terraform.io/hashicorp/random", "registry.example.org/corp/internal"]
+  }
+
+  direct {
+    exclude = ["registry.terraform.io/*/*", "registry.terraform.io/hashicorp/random", "registry.example.org/corp/internal"]
+  }
+}
+
+credentials "iac.example.org" {
+  token = "mirror-token"
+}`), removeSpace(string(content)))
+
+	// mirror 中没有 provider 时不生成配置
+	task.req.ProviderMirror.Providers = nil
+	if err := task.genTerraformrcFile(dir); err != nil {
+		t.Fatalf("genTerraformrcFile error: %v", err)
+	}
+	content, err = os.ReadFile(filepath.Join(dir, TerraformrcFileName))
+	if err != nil {
+		t.Fatalf("readfile error: %v", err)
+	}
+	assert.NotContains(t, string(content), "iac.example.org")
+}
+
 func removeSpace(s string) string {
 	s = strings.ReplaceAll(s, " ", "")
 	s = strings.ReplaceAll(s, "\t", "")
 	s = strings.ReplaceAll(s, "\n", "")
 	return s
 }
+
+func TestCopyTaskWorkspace(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	files := map[string]string{
+		"code/main.tf":              "resource {}",
+		TaskControlFileName:         "{}",
+		"step0/" + TaskLogName:      "checkout",
+		"step1/" + TaskLogName:      "init",
+		"step2/" + TaskLogName:      "plan failed",
+		TFPlanJsonFile:              "{}",
+		"code/.terraform/lock.json": "{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	assert.NoError(t, copyTaskWorkspace(src, dst, 2))
+
+	for _, name := range []string{"code/main.tf", "step0/" + TaskLogName, "step1/" + TaskLogName,
+		TFPlanJsonFile, "code/.terraform/lock.json"} {
+		content, err := os.ReadFile(filepath.Join(dst, name))
+		assert.NoError(t, err)
+		assert.Equal(t, files[name], string(content))
+	}
+	for _, name := range []string{TaskControlFileName, "step2"} {
+		_, err := os.Stat(filepath.Join(dst, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestStepPlanModes(t *testing.T) {
+	task := Task{
+		req: RunTaskReq{
+			Env:      TaskEnv{Workdir: "sub"},
+			Replaces: []string{`aws_instance.web["a"]`, "module.vpc.aws_vpc.this"},
+			StepArgs: []string{"-target=aws_instance.web"},
+		},
+		logger: logs.Get(),
+	}
+
+	command, err := task.stepPlan()
+	assert.NoError(t, err)
+	assert.Contains(t, command, `-replace='aws_instance.web["a"]' -replace=module.vpc.aws_vpc.this \`)
+	assert.Contains(t, command, "-target=aws_instance.web && \\")
+	assert.NotContains(t, command, "-refresh-only")
+
+	task.req.Replaces = nil
+	task.req.RefreshOnly = true
+	command, err = task.stepPlan()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "-refresh-only \\")
+	assert.NotContains(t, command, "-replace")
+}
+
+func TestStepImport(t *testing.T) {
+	task := Task{
+		req: RunTaskReq{
+			Env: TaskEnv{Workdir: "sub", TfVarsFile: "prod.tfvars"},
+			Imports: []TaskImport{
+				{Address: `aws_instance.web["a"]`, Id: "i-123"},
+				{Address: "module.vpc.aws_vpc.this", Id: "vpc-1"},
+			},
+		},
+		logger: logs.Get(),
+	}
+
+	command, err := task.stepImport()
+	assert.NoError(t, err)
+	assert.Contains(t, command,
+		`terraform import -input=false -var-file=prod.tfvars -var-file=../../_cloudiac.tfvars.json 'aws_instance.web["a"]' i-123 && \`)
+	assert.Contains(t, command, "module.vpc.aws_vpc.this vpc-1 && \\")
+	assert.NotContains(t, command, "-generate-config-out")
+
+	task.req.ImportMode = "block"
+	command, err = task.stepImport()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "cp -f ../../_cloudiac_import.tf.json _cloudiac_import.tf.json")
+	assert.Contains(t, command, "-generate-config-out=_cloudiac_generated.tf")
+	assert.Contains(t, command, `-target='aws_instance.web["a"]' -target=module.vpc.aws_vpc.this && \`)
+	assert.NotContains(t, command, "terraform import")
+
+	task.req.Imports = nil
+	_, err = task.stepImport()
+	assert.Error(t, err)
+}
+
+func TestGenImportTfJsonFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cloudiac-runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	task := Task{
+		req: RunTaskReq{
+			Imports: []TaskImport{{Address: "aws_instance.web", Id: "i-${abc}"}},
+		},
+		logger: logs.Get(),
+	}
+	assert.NoError(t, task.genImportTfJsonFile(dir))
+	_, err = os.Stat(filepath.Join(dir, CloudIacImportTfJson))
+	assert.True(t, os.IsNotExist(err))
+
+	task.req.ImportMode = "block"
+	assert.NoError(t, task.genImportTfJsonFile(dir))
+	content, err := os.ReadFile(filepath.Join(dir, CloudIacImportTfJson))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"import": [{"to": "aws_instance.web", "id": "i-$${abc}"}]}`, string(content))
+}
+
+func TestStepStateOp(t *testing.T) {
+	task := Task{
+		req: RunTaskReq{
+			Env: TaskEnv{Workdir: "sub"},
+			StateOps: []TaskStateOp{
+				{Action: "mv", Address: "aws_instance.old", Destination: `module.web.aws_instance.this["a"]`},
+				{Action: "rm", Address: "aws_instance.tmp"},
+				{Action: "taint", Address: "aws_instance.web[0]"},
+				{Action: "untaint", Address: "aws_instance.web[1]"},
+				{Action: "forceUnlock", LockId: "6f0c2d7e-0a4e-4e47-b3c1-6f3b9e0b2f59"},
+			},
+		},
+		logger: logs.Get(),
+	}
+
+	command, err := task.stepStateOp()
+	assert.NoError(t, err)
+	for _, s := range []string{
+		"terraform state pull >../../tfstate.before && \\",
+		`terraform state mv aws_instance.old 'module.web.aws_instance.this["a"]' && \`,
+		"terraform state rm aws_instance.tmp && \\",
+		"terraform taint 'aws_instance.web[0]' && \\",
+		"terraform untaint 'aws_instance.web[1]' && \\",
+		"terraform force-unlock -force 6f0c2d7e-0a4e-4e47-b3c1-6f3b9e0b2f59 && \\",
+		"terraform state pull >../../tfstate.after",
+	} {
+		assert.Contains(t, command, s)
+	}
+
+	task.req.StateOps = []TaskStateOp{{Action: "push"}}
+	_, err = task.stepStateOp()
+	assert.Error(t, err)
+}
@@ -41,6 +41,21 @@ type StateStore struct {
 	Address     string `json:"address" binding:""` // consul 地址 runner 会自动设置
 }
 
+// TaskModuleRegistry portal 私有 module registry 的访问配置
+type TaskModuleRegistry struct {
+	Host       string `json:"host"`       // registry 主机名，即模块 source 中的 host 部分
+	ModulesUrl string `json:"modulesUrl"` // modules.v1 服务地址
+	Token      string `json:"token"`      // 访问 registry 的 token
+}
+
+// TaskProviderMirror portal 提供的 provider network mirror
+type TaskProviderMirror struct {
+	Host      string   `json:"host"`      // mirror 主机名，用于配置访问凭证
+	Url       string   `json:"url"`       // network mirror 地址
+	Token     string   `json:"token"`     // 访问 mirror 的 token
+	Providers []string `json:"providers"` // mirror 中已有的 provider，格式为 <hostname>/<namespace>/<type>
+}
+
 type RunTaskReq struct {
 	Env            TaskEnv    `json:"env" binding:""`
 	RunnerId       string     `json:"runnerId" binding:""`
@@ -56,7 +71,9 @@ type RunTaskReq struct {
 	RepoBranch     string     `json:"repoBranch" binding:""`  // git branch or tag
 	RepoCommitId   string     `json:"repoCommitId" binding:""`
 
-	NetworkMirror string `json:"networkMirror"` // terraform network mirror url
+	NetworkMirror  string              `json:"networkMirror"`            // terraform network mirror url
+	ModuleRegistry *TaskModuleRegistry `json:"moduleRegistry,omitempty"` // portal 私有 module registry
+	ProviderMirror *TaskProviderMirror `json:"providerMirror,omitempty"` // portal provider mirror
 
 	SysEnvironments map[string]string `json:"sysEnvironments "` // 系统注入的环境变量
 
@@ -71,6 +88,16 @@ type RunTaskReq struct {
 	ContainerId string `json:"containerId"`
 	PauseTask   bool   `json:"pauseTask"` // 本次执行结束后暂停任务
 
+	ResumeTaskId string `json:"resumeTaskId"` // 恢复执行时复用该任务的工作目录
+
+	Imports    []TaskImport `json:"imports"`    // 导入任务需要导入的资源列表
+	ImportMode string       `json:"importMode"` // 资源导入方式: cli, block
+
+	StateOps []TaskStateOp `json:"stateOps"` // state 操作任务需要执行的操作列表
+
+	Replaces    []string `json:"replaces"`    // plan 时强制替换的资源地址(-replace)
+	RefreshOnly bool     `json:"refreshOnly"` // 只同步 state，不变更资源(-refresh-only)
+
 	CreatorId string `json:"creatorId"`
 }
 
@@ -95,6 +122,20 @@ func (r RunTaskReq) Validate() error {
 	return nil
 }
 
+// TaskImport 导入任务中资源地址与云资源 ID 的对应关系
+type TaskImport struct {
+	Address string `json:"address"` // 资源在 terraform 配置中的地址，如 aws_instance.web
+	Id      string `json:"id"`      // 云资源 ID
+}
+
+// TaskStateOp state 操作任务中的一个操作
+type TaskStateOp struct {
+	Action      string `json:"action"`      // 操作类型: mv, rm, taint, untaint, forceUnlock
+	Address     string `json:"address"`     // 资源地址，mv 操作时为源地址
+	Destination string `json:"destination"` // mv 操作的目标地址
+	LockId      string `json:"lockId"`      // forceUnlock 操作的锁 ID
+}
+
 type Repository struct {
 	RepoAddress  string `json:"repoAddress" binding:""` // 带 token 的完整路径
 	RepoRevision string `json:"repoRevision" binding:""`
@@ -157,6 +198,8 @@ type TaskStatusMessage struct {
 	TfScanJson           []byte `json:"tfScanJson"`
 	TfResultJson         []byte `json:"tfResultJson"`
 	TFProviderSchemaJson []byte `json:"tfProviderSchemaJson"`
+	TfStateBefore        []byte `json:"tfStateBefore"` // state 操作前的 state 快照
+	TfStateAfter         []byte `json:"tfStateAfter"`  // state 操作后的 state 快照
 }
 
 type ErrorMessage struct {
@@ -0,0 +1,47 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarGzDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "modules", "vpc"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("main"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "modules", "vpc", "vpc.tf"), []byte("vpc"), 0644))
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, TarGzDir(dir, &buf, ".git"))
+
+	gr, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gr)
+	files := make(map[string]string)
+	names := make([]string, 0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names = append(names, hdr.Name)
+		content, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(content)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"main.tf", "modules", "modules/vpc", "modules/vpc/vpc.tf"}, names)
+	assert.Equal(t, "vpc", files["modules/vpc/vpc.tf"])
+}
@@ -5,6 +5,8 @@ package consulClient
 import (
 	"cloudiac/common"
 	"cloudiac/configs"
+	"cloudiac/utils/metrics"
+
 	consulapi "github.com/hashicorp/consul/api"
 )
 
@@ -22,6 +24,14 @@ func NewConsulClient() (*consulapi.Client, error) {
 		config.TLSConfig.KeyFile = conf.Consul.ConsulCertPath + common.ConsulCakey
 	}
 
+	// 使用自定义的 http client 以统计 consul 请求耗时
+	httpClient, err := consulapi.NewHttpClient(config.Transport, config.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = metrics.InstrumentRoundTripper(metrics.ConsulRequestSeconds, httpClient.Transport)
+	config.HttpClient = httpClient
+
 	client, err := consulapi.NewClient(config)
 	return client, err
 }
@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"cloudiac/configs"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/tracing"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -23,7 +25,7 @@ const HeaderContentType string = "Content-Type"
 
 func httpClient(conntimeout, deadline int) *http.Client {
 	c := &http.Client{
-		Transport: &http.Transport{
+		Transport: tracing.Transport(&http.Transport{
 			Dial: func(netw, addr string) (net.Conn, error) {
 				deadline := time.Now().Add(time.Duration(deadline) * time.Second)
 				c, err := net.DialTimeout(netw, addr, time.Duration(conntimeout)*time.Second)
@@ -36,14 +38,14 @@ func httpClient(conntimeout, deadline int) *http.Client {
 				// 默认配置为 false，可通过配置 HttpClientInsecure 设置为跳过证书验证
 				InsecureSkipVerify: configs.Get().HttpClientInsecure, //nolint:gosec
 			},
-		},
+		}),
 	}
 	return c
 }
 
-func getHttpRequest(reqUrl, method string, header *http.Header, data interface{}) (*http.Request, error) {
+func getHttpRequest(ctx context.Context, reqUrl, method string, header *http.Header, data interface{}) (*http.Request, error) {
 	if http.MethodGet == method || data == nil {
-		return http.NewRequest(method, reqUrl, nil)
+		return http.NewRequestWithContext(ctx, method, reqUrl, nil)
 	}
 
 	// json data
@@ -52,7 +54,7 @@ func getHttpRequest(reqUrl, method string, header *http.Header, data interface{}
 		if err != nil {
 			return nil, err
 		}
-		req, err := http.NewRequest(method, reqUrl, bytes.NewReader(b))
+		req, err := http.NewRequestWithContext(ctx, method, reqUrl, bytes.NewReader(b))
 		if err != nil {
 			return nil, err
 		}
@@ -62,7 +64,7 @@ func getHttpRequest(reqUrl, method string, header *http.Header, data interface{}
 
 	// string data
 	if value, ok := data.(string); ok {
-		req, err := http.NewRequest(method, reqUrl, bytes.NewReader([]byte(value)))
+		req, err := http.NewRequestWithContext(ctx, method, reqUrl, bytes.NewReader([]byte(value)))
 		if err != nil {
 			return nil, err
 		}
@@ -74,6 +76,12 @@ func getHttpRequest(reqUrl, method string, header *http.Header, data interface{}
 }
 
 func HttpService(reqUrl, method string, header *http.Header, data interface{}, conntimeout, deadline int) ([]byte, error) {
+	return HttpServiceWithContext(context.Background(), reqUrl, method, header, data, conntimeout, deadline)
+}
+
+// HttpServiceWithContext 同 HttpService，请求会携带 ctx 中的链路追踪信息
+func HttpServiceWithContext(ctx context.Context, reqUrl, method string, header *http.Header, data interface{},
+	conntimeout, deadline int) ([]byte, error) {
 	c := httpClient(conntimeout, deadline)
 
 	var err error
@@ -85,7 +93,7 @@ func HttpService(reqUrl, method string, header *http.Header, data interface{}, c
 	}
 
 	var req *http.Request
-	req, err = getHttpRequest(reqUrl, method, header, data)
+	req, err = getHttpRequest(ctx, reqUrl, method, header, data)
 	if err != nil {
 		return nil, err
 	}
@@ -148,3 +156,21 @@ func HttpPostFiles(reqUrl string, header *http.Header, formParts []FormPart, con
 	resp, err = c.Do(req)
 	return
 }
+
+// HttpDownload 下载文件并写入 w，响应状态码不是 200 时返回错误
+func HttpDownload(reqUrl string, w io.Writer, connTimeout, deadline int) error {
+	c := httpClient(connTimeout, deadline)
+
+	logs.Get().Debugf("GET %s", reqUrl)
+	resp, err := c.Get(reqUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: %s", reqUrl, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
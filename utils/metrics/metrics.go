@@ -0,0 +1,183 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cloudiac"
+
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+// 任务相关指标
+var (
+	TaskStatusChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "task_status_changes_total",
+		Help:      "Number of task status changes, by task type and new status.",
+	}, []string{"type", "status"})
+
+	TaskQueueWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_queue_wait_seconds",
+		Help:      "Time tasks spent in pending status before being started.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"type"})
+
+	TaskStepDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_step_duration_seconds",
+		Help:      "Duration of finished task steps, by step type and exit status.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"type", "status"})
+
+	TaskManagerLoopSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_manager_loop_seconds",
+		Help:      "Duration of one task manager main loop iteration.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// RunnerDispatchedTasks portal 下发到各 runner 且尚未结束的任务数量
+	RunnerDispatchedTasks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "runner_dispatched_tasks",
+		Help:      "Number of tasks currently dispatched by the task manager to each runner.",
+	}, []string{"runner"})
+)
+
+// runner 相关指标
+var (
+	RunnerRunningSteps = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "runner_running_steps",
+		Help:      "Number of task steps currently running on this runner.",
+	})
+
+	RunnerStepRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runner_step_requests_total",
+		Help:      "Number of run step requests handled by this runner, by result.",
+	}, []string{"result"})
+
+	RunnerContainerStartFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runner_container_start_failures_total",
+		Help:      "Number of task containers failed to create or start.",
+	})
+)
+
+// 外部交互相关指标
+var (
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of received vcs webhook deliveries, by vcs type and result.",
+	}, []string{"vcs_type", "result"})
+
+	NotificationSendFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_send_failures_total",
+		Help:      "Number of notification messages failed to send, by notification type.",
+	}, []string{"type"})
+
+	DBQuerySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_seconds",
+		Help:      "Latency of database operations, by operation and table.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "table"})
+
+	ConsulRequestSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "consul_request_seconds",
+		Help:      "Latency of consul api requests, by method, endpoint and status code.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "endpoint", "code"})
+)
+
+// MustRegisterPortal 注册 portal 服务使用的指标，extra 为业务层提供的 collector
+func MustRegisterPortal(extra ...prometheus.Collector) {
+	prometheus.MustRegister(
+		TaskStatusChanges,
+		TaskQueueWaitSeconds,
+		TaskStepDurationSeconds,
+		TaskManagerLoopSeconds,
+		RunnerDispatchedTasks,
+		WebhookDeliveries,
+		NotificationSendFailures,
+		DBQuerySeconds,
+		ConsulRequestSeconds,
+	)
+	prometheus.MustRegister(extra...)
+}
+
+// MustRegisterRunner 注册 runner 服务使用的指标
+func MustRegisterRunner() {
+	prometheus.MustRegister(
+		RunnerRunningSteps,
+		RunnerStepRequests,
+		RunnerContainerStartFailures,
+		ConsulRequestSeconds,
+	)
+}
+
+// Handler 返回 /metrics 接口的 http handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ListenAndServe 在单独的地址上提供 /metrics 接口，避免指标暴露在对外的 API 端口上
+func ListenAndServe(listen string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(listen, mux) //nolint:gosec
+}
+
+func Result(err error) string {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultSuccess
+}
+
+// InstrumentRoundTripper 统计通过 next 发出的 http 请求耗时
+func InstrumentRoundTripper(observer *prometheus.HistogramVec, next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		observer.WithLabelValues(req.Method, RequestEndpoint(req.URL.Path), code).
+			Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+// RequestEndpoint 取请求路径的前两段作为 endpoint 标签，避免 key 等路径参数导致标签基数过大，
+// 如 /v1/kv/cloudiac/lock 返回 /v1/kv
+func RequestEndpoint(path string) string {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
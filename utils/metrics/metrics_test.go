@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestEndpoint(t *testing.T) {
+	cases := []struct {
+		path   string
+		expect string
+	}{
+		{"/v1/kv/cloudiac/task-manager-lock", "/v1/kv"},
+		{"/v1/session/create", "/v1/session"},
+		{"/v1/status", "/v1/status"},
+		{"/", "/"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expect, RequestEndpoint(c.path), c.path)
+	}
+}
+
+func TestInstrumentRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	observer := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_request_seconds"},
+		[]string{"method", "endpoint", "code"})
+	client := http.Client{Transport: InstrumentRoundTripper(observer, http.DefaultTransport)}
+	resp, err := client.Get(srv.URL + "/v1/kv/some/key")
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, 1, testutil.CollectAndCount(observer))
+	_, err = observer.GetMetricWithLabelValues(http.MethodGet, "/v1/kv", "404")
+	assert.NoError(t, err)
+}
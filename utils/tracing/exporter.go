@@ -0,0 +1,38 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+)
+
+const otlpTracesPath = "/v1/traces"
+
+// newOtlpHttpExporter 创建 OTLP/HTTP(protobuf) 协议的 span exporter，
+// endpoint 为 collector 地址(如 http://otel-collector:4318)，未指定路径时使用默认的 /v1/traces
+func newOtlpHttpExporter(endpoint string, headers map[string]string) (*otlptrace.Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid tracing endpoint '%s'", endpoint)
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(path, otlpTracesPath) {
+		path += otlpTracesPath
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path),
+		otlptracehttp.WithHeaders(headers),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tracing
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/utils/logs"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "cloudiac"
+
+// 通用的 span 属性
+const (
+	AttrOrgId     = attribute.Key("cloudiac.org_id")
+	AttrProjectId = attribute.Key("cloudiac.project_id")
+	AttrEnvId     = attribute.Key("cloudiac.env_id")
+	AttrTaskId    = attribute.Key("cloudiac.task_id")
+	AttrTaskType  = attribute.Key("cloudiac.task_type")
+	AttrStep      = attribute.Key("cloudiac.step")
+	AttrStepType  = attribute.Key("cloudiac.step_type")
+)
+
+var provider *sdktrace.TracerProvider
+
+// Init 初始化链路追踪，未配置 collector 地址时只设置 trace context 传播，不采集 span
+func Init(serviceName string, conf configs.TracingConfig) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	if conf.Endpoint == "" {
+		return
+	}
+
+	ratio := conf.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	exporter, err := newOtlpHttpExporter(conf.Endpoint, conf.Headers)
+	if err != nil {
+		logs.Get().Errorf("init tracing exporter: %v", err)
+		return
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(common.VERSION),
+	)
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logs.Get().WithField("func", "tracing").Warnf("%v", err)
+	}))
+	logs.Get().Infof("tracing enabled, exporting to %s", conf.Endpoint)
+}
+
+// Shutdown 上报缓存中的 span 并停止链路追踪
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		logs.Get().Warnf("shutdown tracer provider: %v", err)
+	}
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start 创建 span，调用方需要在操作结束后调用 End()
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 span，err 不为空时标记 span 为失败状态
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Detach 返回只携带 ctx 中 span 信息的新 context，
+// 用于 span 需要跨越 ctx 生命周期的场景(如请求结束后仍在执行的 db 事务或异步任务)
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
+
+// Inject 将 ctx 中的 trace context 写入到请求头
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Transport 包装 http.RoundTripper，为每个请求创建 client span 并传播 trace context
+func Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx, span := Tracer().Start(req.Context(), fmt.Sprintf("HTTP %s", req.Method),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(req.Method),
+				semconv.HTTPURLKey.String(spanURL(req.URL)),
+				semconv.NetPeerNameKey.String(req.URL.Hostname()),
+			))
+		defer span.End()
+
+		req = req.Clone(ctx)
+		Inject(ctx, req.Header)
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return resp, err
+		}
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		return resp, nil
+	})
+}
+
+// spanURL 返回只包含 scheme、host 和 path 的 url，避免 query 或 userinfo 中的 token 被导出
+func spanURL(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, RawPath: u.RawPath}).String()
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// GinMiddleware 为每个请求创建 server span，并从请求头中提取上游传递的 trace context
+func GinMiddleware(serviceName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := Tracer().Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPServerNameKey.String(serviceName),
+				semconv.HTTPMethodKey.String(c.Request.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(c.Request.URL.Path),
+				semconv.HTTPClientIPKey.String(c.ClientIP()),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.SetAttributes(attribute.String("gin.errors", c.Errors.String()))
+		}
+	}
+}
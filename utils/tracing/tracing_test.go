@@ -0,0 +1,122 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOtlpHttpExporter(t *testing.T) {
+	var (
+		received tracepb.TracesData
+		header   http.Header
+		path     string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, header = r.URL.Path, r.Header
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, proto.Unmarshal(body, &received))
+	}))
+	defer srv.Close()
+
+	exporter, err := newOtlpHttpExporter(srv.URL, map[string]string{"Authorization": "token"})
+	assert.NoError(t, err)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "test"))),
+	)
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, child := tp.Tracer("test").Start(ctx, "child", trace.WithAttributes(AttrTaskId.String("run-1")))
+	End(child, errors.New("failed"))
+
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/x-protobuf", header.Get("Content-Type"))
+	assert.Equal(t, "token", header.Get("Authorization"))
+	if assert.Len(t, received.ResourceSpans, 1) {
+		rs := received.ResourceSpans[0]
+		assert.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+		assert.Equal(t, "test", rs.ScopeSpans[0].Scope.Name)
+
+		span := rs.ScopeSpans[0].Spans[0]
+		parentId := parent.SpanContext().SpanID()
+		assert.Equal(t, "child", span.Name)
+		assert.Equal(t, parentId[:], span.ParentSpanId)
+		assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+		assert.Equal(t, "run-1", span.Attributes[0].Value.GetStringValue())
+	}
+	parent.End()
+}
+
+func TestTransport(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ctx, span := Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	span.End()
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		client := spans[0]
+		assert.Equal(t, "HTTP GET", client.Name())
+		assert.Equal(t, span.SpanContext().SpanID(), client.Parent().SpanID())
+		assert.Contains(t, traceparent, client.SpanContext().SpanID().String())
+		assert.Equal(t, "Error", client.Status().Code.String())
+	}
+}
+
+func TestTransportHidesURLSecrets(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/api/v5/user/repos?access_token=secret-token&page=1")
+	u.User = url.UserPassword("user", "secret-password")
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		for _, attr := range spans[0].Attributes() {
+			assert.NotContains(t, attr.Value.Emit(), "secret", string(attr.Key))
+		}
+		assert.Contains(t, spans[0].Attributes(), semconv.HTTPURLKey.String(srv.URL+"/api/v5/user/repos"))
+	}
+}